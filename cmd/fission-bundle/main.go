@@ -31,6 +31,7 @@ import (
 	"github.com/fission/fission/pkg/buildermgr"
 	"github.com/fission/fission/pkg/controller"
 	"github.com/fission/fission/pkg/executor"
+	"github.com/fission/fission/pkg/fetcher"
 	"github.com/fission/fission/pkg/info"
 	"github.com/fission/fission/pkg/kubewatcher"
 	functionLogger "github.com/fission/fission/pkg/logger"
@@ -81,6 +82,10 @@ func runBuilderMgr(ctx context.Context, logger *zap.Logger, storageSvcUrl string
 	return buildermgr.Start(ctx, logger, storageSvcUrl, envBuilderNamespace)
 }
 
+func runWasmModuleCache(ctx context.Context, logger *zap.Logger, port int, dir string, storageSvcUrl string) error {
+	return fetcher.StartModuleCache(ctx, logger, dir, storageSvcUrl, port)
+}
+
 func runLogger(ctx context.Context, logger *zap.Logger) {
 	functionLogger.Start(ctx, logger)
 }
@@ -123,6 +128,8 @@ func getServiceName(arguments map[string]interface{}) string {
 		serviceName = "Fission-StorageSvc"
 	} else if arguments["--mqt_keda"] == true {
 		serviceName = "Fission-Keda-MQTrigger"
+	} else if arguments["--wasmModuleCachePort"] != nil {
+		serviceName = "Fission-WasmModuleCache"
 	}
 
 	return serviceName
@@ -176,6 +183,7 @@ Usage:
   fission-bundle --timer [--routerUrl=<url>]
   fission-bundle --mqt   [--routerUrl=<url>]
   fission-bundle --mqt_keda [--routerUrl=<url>]
+  fission-bundle --wasmModuleCachePort=<port> [--filePath=<filePath>] [--storageSvcUrl=<url>]
   fission-bundle --logger
   fission-bundle --version
 Options:
@@ -183,6 +191,7 @@ Options:
   --routerPort=<port>             Port that the router should listen on.
   --executorPort=<port>           Port that the executor should listen on.
   --storageServicePort=<port>     Port that the storage service should listen on.
+  --wasmModuleCachePort=<port>    Port that the node local wasm module cache should listen on.
   --executorUrl=<url>             Executor URL. Not required if --executorPort is specified.
   --routerUrl=<url>               Router URL.
   --etcdUrl=<etcdUrl>             Etcd URL.
@@ -311,6 +320,16 @@ Options:
 		}
 	}
 
+	if arguments["--wasmModuleCachePort"] != nil {
+		port := getPort(logger, arguments["--wasmModuleCachePort"])
+		dir := getStringArgWithDefault(arguments["--filePath"], "/var/lib/fission/wasm-modules")
+		err := runWasmModuleCache(ctx, logger, port, dir, storageSvcUrl)
+		if err != nil {
+			logger.Error("wasm module cache exited", zap.Error(err))
+			return
+		}
+	}
+
 	<-ctx.Done()
 	logger.Error("exiting")
 }
@@ -31,7 +31,9 @@ import (
 	"github.com/fission/fission/pkg/mqtrigger"
 	"github.com/fission/fission/pkg/mqtrigger/factory"
 	"github.com/fission/fission/pkg/mqtrigger/messageQueue"
+	_ "github.com/fission/fission/pkg/mqtrigger/messageQueue/jetstream"
 	_ "github.com/fission/fission/pkg/mqtrigger/messageQueue/kafka"
+	_ "github.com/fission/fission/pkg/mqtrigger/messageQueue/redis"
 )
 
 func Start(ctx context.Context, logger *zap.Logger, routerUrl string) error {
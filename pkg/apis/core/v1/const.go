@@ -41,6 +41,10 @@ const (
 
 	// ArchiveTypeUrl means the package contents are at the specified URL.
 	ArchiveTypeUrl ArchiveType = "url"
+
+	// ArchiveTypeOCI means the package contents are an OCI artifact, the
+	// URL being its reference and the checksum the digest of its manifest.
+	ArchiveTypeOCI ArchiveType = "oci"
 )
 
 const (
@@ -56,6 +60,12 @@ const (
 	AllowedFunctionsPerContainerInfinite = "infinite"
 )
 
+const (
+	LoadBalancerStrategyRoundRobin       LoadBalancerStrategy = "roundrobin"
+	LoadBalancerStrategyLeastOutstanding LoadBalancerStrategy = "leastoutstanding"
+	LoadBalancerStrategyConsistentHash   LoadBalancerStrategy = "consistenthash"
+)
+
 const (
 	ExecutorTypePoolmgr   ExecutorType = "poolmgr"
 	ExecutorTypeNewdeploy ExecutorType = "newdeploy"
@@ -87,7 +97,14 @@ const (
 )
 
 const (
-	MessageQueueTypeKafka = "kafka"
+	MessageQueueTypeKafka         = "kafka"
+	MessageQueueTypeNatsJetStream = "nats-jetstream"
+	MessageQueueTypeRedis         = "redis"
+)
+
+const (
+	BatchFormatJSON   BatchFormat = "json"
+	BatchFormatNDJSON BatchFormat = "ndjson"
 )
 
 const (
@@ -145,6 +162,66 @@ const (
 	ANNOTATION_SVC_HOST = "svcHost"
 )
 
+// wasm function annotation keys, read by the wasm runtime to fetch the module
+const (
+	ANNOTATION_WASM_MODULE_URL      = "wasm.module.url"
+	ANNOTATION_WASM_MODULE_FILENAME = "wasm.module.filename"
+	// ANNOTATION_WASM_MODULE_OCI is the digest pinned reference of the
+	// module when it is published as an OCI artifact
+	ANNOTATION_WASM_MODULE_OCI = "wasm.module.oci"
+	// ANNOTATION_WASM_MODULE_SHA256 is the checksum of the module the
+	// runtime verifies the module it fetched against
+	ANNOTATION_WASM_MODULE_SHA256 = "wasm.module.sha256"
+)
+
+const (
+	WasmEngineWasmtime WasmEngine = "wasmtime"
+	WasmEngineWasmEdge WasmEngine = "wasmedge"
+	WasmEngineWasmer   WasmEngine = "wasmer"
+)
+
+const (
+	WasmLanguageRust           WasmLanguage = "rust"
+	WasmLanguageTinyGo         WasmLanguage = "tinygo"
+	WasmLanguageAssemblyScript WasmLanguage = "assemblyscript"
+)
+
+const (
+	WasmModeDeployment WasmMode = "deployment"
+	WasmModePool       WasmMode = "pool"
+	WasmModeShared     WasmMode = "shared"
+)
+
+// WASM_POOL is the label of the pods of the pre-warmed wasm runtime pool,
+// set to the runtime class of the pool.
+const WASM_POOL = "wasmPool"
+
+// WASM_HOST is the label of the wasm host pods shared by functions, set to
+// the runtime class of the hosts.
+const WASM_HOST = "wasmHost"
+
+// wasm pod annotation keys, set by the wasm executor from the WasmSpec of the
+// function for the wasm runtime to read
+const (
+	ANNOTATION_WASM_ENTRYPOINT = "wasm.entrypoint"
+	ANNOTATION_WASM_ENGINE     = "wasm.engine"
+	ANNOTATION_WASM_PREOPENS   = "wasm.preopens"
+	ANNOTATION_WASM_MAX_MEMORY = "wasm.memory.max"
+	ANNOTATION_WASM_FUEL       = "wasm.fuel"
+	// ANNOTATION_WASM_MODULE_VARIANTS lists the precompiled variants of the
+	// module, the runtime picks the one of its engine and node architecture
+	ANNOTATION_WASM_MODULE_VARIANTS = "wasm.module.variants"
+)
+
+// wasm package annotation keys, recording what the CLI found when it
+// inspected the module at package creation
+const (
+	ANNOTATION_WASM_MODULE_KIND    = "wasm.module.kind"
+	ANNOTATION_WASM_MODULE_WASI    = "wasm.module.wasi"
+	ANNOTATION_WASM_MODULE_IMPORTS = "wasm.module.imports"
+	ANNOTATION_WASM_MODULE_EXPORTS = "wasm.module.exports"
+)
+
 const (
 	ArchiveLiteralSizeLimit int64 = 256 * 1024
 )
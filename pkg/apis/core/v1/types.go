@@ -19,6 +19,7 @@ package v1
 import (
 	asv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
@@ -233,10 +234,11 @@ type (
 	// Archive contains or references a collection of sources or
 	// binary files.
 	Archive struct {
-		// Type defines how the package is specified: literal or URL.
+		// Type defines how the package is specified: literal, URL or OCI.
 		// Available value:
 		//  - literal
 		//  - url
+		//  - oci
 		// +optional
 		Type ArchiveType `json:"type,omitempty"`
 
@@ -295,9 +297,52 @@ type (
 		// +optional
 		BuildCommand string `json:"buildcmd,omitempty"`
 
+		// Wasm makes the builder compile the source archive into a wasm
+		// module, and optionally precompile the module for a wasm engine.
+		// +optional
+		Wasm *WasmBuildSpec `json:"wasm,omitempty"`
+
+		// DeploymentVariants are the deployment archive precompiled by the
+		// builder for a wasm engine and node architecture.
+		// +optional
+		// +nullable
+		DeploymentVariants []DeploymentVariant `json:"deploymentVariants,omitempty"`
+
 		// In the future, we can have a debug build here too
 	}
 
+	// WasmBuildSpec configures how the builder builds a wasm module.
+	WasmBuildSpec struct {
+		// Language of the source, which picks the build command if the
+		// package has none. Available value:
+		// - rust
+		// - tinygo
+		// - assemblyscript
+		Language WasmLanguage `json:"language"`
+
+		// Precompile is the wasm engine the module is compiled ahead of
+		// time for, none if empty.
+		// +optional
+		Precompile WasmEngine `json:"precompile,omitempty"`
+
+		// Architectures are the node architectures the module is
+		// precompiled for, like amd64 and arm64. Defaults to amd64.
+		// +optional
+		// +nullable
+		Architectures []string `json:"architectures,omitempty"`
+	}
+
+	// DeploymentVariant is a deployment archive precompiled for a wasm
+	// engine and node architecture.
+	DeploymentVariant struct {
+		Engine       WasmEngine `json:"engine"`
+		Architecture string     `json:"architecture"`
+		Archive      Archive    `json:"archive"`
+	}
+
+	// WasmLanguage is the source language of a wasm module.
+	WasmLanguage string
+
 	// PackageStatus contains the build status of a package also the build log for examination.
 	PackageStatus struct {
 		// TODO: Add another status field to indicate whether a package
@@ -415,8 +460,112 @@ type (
 		// Different arguments mentioned for container based function are populated inside a pod.
 		// +optional
 		PodSpec *apiv1.PodSpec `json:"podspec,omitempty"`
+
+		// Wasm specifies how the wasm runtime runs the module of executor type
+		// wasm functions.
+		// +optional
+		Wasm *WasmSpec `json:"wasm,omitempty"`
 	}
 
+	// WasmSpec configures how the wasm runtime runs the module of a function.
+	WasmSpec struct {
+		// Module references the wasm module of the function.
+		Module WasmModule `json:"module"`
+
+		// Entrypoint is the export of the module the runtime invokes.
+		// +optional
+		Entrypoint string `json:"entrypoint,omitempty"`
+
+		// Args are the WASI command line arguments of the module.
+		// +optional
+		// +nullable
+		Args []string `json:"args,omitempty"`
+
+		// Env are the WASI environment variables of the module.
+		// +optional
+		// +nullable
+		Env []WasmEnvVar `json:"env,omitempty"`
+
+		// PreopenDirs are the directories of the pod the module is given
+		// access to.
+		// +optional
+		// +nullable
+		PreopenDirs []WasmPreopenDir `json:"preopenDirs,omitempty"`
+
+		// Engine is a hint of the wasm engine the runtime class runs the
+		// module with. Available value:
+		// - wasmtime
+		// - wasmedge
+		// - wasmer
+		// +optional
+		Engine WasmEngine `json:"engine,omitempty"`
+
+		// MaxMemory limits the linear memory of the module.
+		// +optional
+		MaxMemory *resource.Quantity `json:"maxMemory,omitempty"`
+
+		// Fuel limits the instructions the module executes per request,
+		// 0 for no limit.
+		// +optional
+		Fuel int64 `json:"fuel,omitempty"`
+
+		// Mode is how the wasm executor starts the function. Available value:
+		// - deployment: a deployment and a service per function (default)
+		// - pool: a pre-warmed generic wasm runtime pod is specialized with the
+		//   module, falling back to deployment if the pool has no ready pod
+		// - shared: the module is loaded into a host pod shared with other
+		//   functions, falling back to deployment if no host has room for it.
+		//   Functions without a mode whose environment allows infinite
+		//   functions per container are shared as well.
+		// +optional
+		Mode WasmMode `json:"mode,omitempty"`
+	}
+
+	// WasmModule references a wasm module, either stored in storagesvc or
+	// published as an OCI artifact.
+	WasmModule struct {
+		// URL of the module in storagesvc.
+		// +optional
+		URL string `json:"url,omitempty"`
+
+		// Filename the module is stored as in the pod.
+		// +optional
+		Filename string `json:"filename,omitempty"`
+
+		// OCI is the reference of the module published as an OCI artifact.
+		// +optional
+		OCI string `json:"oci,omitempty"`
+	}
+
+	// WasmEnvVar is a WASI environment variable.
+	WasmEnvVar struct {
+		Name string `json:"name"`
+
+		// +optional
+		Value string `json:"value,omitempty"`
+	}
+
+	// WasmPreopenDir is a directory of the pod preopened for the module.
+	WasmPreopenDir struct {
+		// Path of the directory in the pod.
+		Path string `json:"path"`
+
+		// GuestPath is the path the module sees the directory at, defaults
+		// to Path.
+		// +optional
+		GuestPath string `json:"guestPath,omitempty"`
+
+		// ReadOnly prevents the module from writing to the directory.
+		// +optional
+		ReadOnly bool `json:"readOnly,omitempty"`
+	}
+
+	// WasmEngine is the wasm engine a module runs with.
+	WasmEngine string
+
+	// WasmMode is how the wasm executor starts a function.
+	WasmMode string
+
 	// InvokeStrategy is a set of controls over how the function executes.
 	// It affects the performance and resource usage of the function.
 	//
@@ -704,8 +853,35 @@ type (
 		// IngressConfig for router to set up Ingress.
 		// +optional
 		IngressConfig IngressConfig `json:"ingressconfig"`
+
+		// LoadBalancer configures how router spreads requests across the pods
+		// of functions it sends requests to directly, e.g. wasm functions.
+		// +optional
+		LoadBalancer *LoadBalancerConfig `json:"loadbalancer,omitempty"`
+	}
+
+	// LoadBalancerConfig is for router to pick the function pod a request is sent to.
+	LoadBalancerConfig struct {
+		// Strategy is the load balancing strategy. Available value:
+		// - roundrobin
+		// - leastoutstanding
+		// - consistenthash
+		// Defaults to roundrobin.
+		// +optional
+		Strategy LoadBalancerStrategy `json:"strategy,omitempty"`
+
+		// HashHeader is the request header consistenthash hashes on.
+		// +optional
+		HashHeader string `json:"hashheader,omitempty"`
+
+		// HashCookie is the request cookie consistenthash hashes on.
+		// +optional
+		HashCookie string `json:"hashcookie,omitempty"`
 	}
 
+	// LoadBalancerStrategy is the strategy router uses to pick a function pod.
+	LoadBalancerStrategy string
+
 	// IngressConfig is for router to set up Ingress.
 	IngressConfig struct {
 		// Annotations will be added to metadata when creating Ingress.
@@ -818,8 +994,42 @@ type (
 		// - Structs are merged and variables from pod spec take precedence
 		// +optional
 		PodSpec *apiv1.PodSpec `json:"podspec,omitempty"`
+
+		// Batch delivers the records of the subscribed topic to the function
+		// in batches instead of one invocation per record. Only supported by
+		// the kafka message queue type with the fission mqtkind.
+		// +optional
+		Batch *MessageQueueTriggerBatch `json:"batch,omitempty"`
+	}
+
+	// MessageQueueTriggerBatch configures how records are collected into
+	// batches. A batch is delivered as soon as one of its limits is reached.
+	MessageQueueTriggerBatch struct {
+		// Maximum number of records in a batch
+		MaxRecords int `json:"maxRecords"`
+
+		// Maximum total size in bytes of the record values in a batch,
+		// unlimited if zero.
+		// +optional
+		MaxBytes int `json:"maxBytes,omitempty"`
+
+		// Maximum time to wait for a batch to fill up before it is
+		// delivered. Defaults to 1s.
+		// +optional
+		MaxWait metav1.Duration `json:"maxWait,omitempty"`
+
+		// Format of the request body. Available value:
+		// - json, a JSON array of records (default)
+		// - ndjson, one JSON record per line
+		// Batches are sent as a CloudEvents batch instead when the message
+		// queue trigger manager encodes CloudEvents.
+		// +optional
+		Format BatchFormat `json:"format,omitempty"`
 	}
 
+	// BatchFormat is the encoding of the batches sent to a function.
+	BatchFormat string
+
 	// TimeTriggerSpec invokes the specific function at a time or
 	// times specified by a cron string.
 	TimeTriggerSpec struct {
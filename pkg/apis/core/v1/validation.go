@@ -20,16 +20,20 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"path"
 	"reflect"
 	"regexp"
 	"strings"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/robfig/cron"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/validation"
 
 	"github.com/fission/fission/pkg/mqtrigger/validator"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 )
 
 const (
@@ -184,7 +188,7 @@ func (archive Archive) Validate() error {
 
 	if len(archive.Type) > 0 {
 		switch archive.Type {
-		case ArchiveTypeLiteral, ArchiveTypeUrl: // no op
+		case ArchiveTypeLiteral, ArchiveTypeUrl, ArchiveTypeOCI: // no op
 		default:
 			result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "Archive.Type", archive.Type, "not a valid archive type"))
 		}
@@ -226,6 +230,42 @@ func (spec PackageSpec) Validate() error {
 		}
 	}
 
+	if spec.Wasm != nil {
+		result = multierror.Append(result, spec.Wasm.Validate())
+	}
+	for _, v := range spec.DeploymentVariants {
+		result = multierror.Append(result, v.Archive.Validate())
+	}
+
+	return result.ErrorOrNil()
+}
+
+func (ws WasmBuildSpec) Validate() error {
+	result := &multierror.Error{}
+
+	switch ws.Language {
+	case WasmLanguageRust, WasmLanguageTinyGo, WasmLanguageAssemblyScript: // no op
+	default:
+		result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "WasmBuildSpec.Language", ws.Language, "not a supported wasm source language"))
+	}
+
+	switch ws.Precompile {
+	case "", WasmEngineWasmtime, WasmEngineWasmEdge, WasmEngineWasmer: // no op
+	default:
+		result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "WasmBuildSpec.Precompile", ws.Precompile, "not a supported wasm engine"))
+	}
+
+	for _, arch := range ws.Architectures {
+		switch arch {
+		case "amd64", "arm64": // no op
+		default:
+			result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "WasmBuildSpec.Architectures", arch, "not a supported node architecture"))
+		}
+	}
+	if len(ws.Architectures) > 0 && len(ws.Precompile) == 0 {
+		result = multierror.Append(result, MakeValidationErr(ErrorInvalidObject, "WasmBuildSpec.Architectures", "", "architectures need an engine to precompile for"))
+	}
+
 	return result.ErrorOrNil()
 }
 
@@ -279,6 +319,10 @@ func (spec FunctionSpec) Validate() error {
 		result = multierror.Append(result, MakeValidationErr(ErrorInvalidObject, "FunctionSpec.PodSpec", "", "executor type container requires a pod spec"))
 	}
 
+	if spec.InvokeStrategy.ExecutionStrategy.ExecutorType == ExecutorTypeWasm {
+		result = multierror.Append(result, spec.validateWasm())
+	}
+
 	// TODO Add below validation warning
 	/*if spec.FunctionTimeout <= 0 {
 		result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "FunctionTimeout value", spec.FunctionTimeout, "not a valid value. Should always be more than 0"))
@@ -287,6 +331,116 @@ func (spec FunctionSpec) Validate() error {
 	return result.ErrorOrNil()
 }
 
+// validateWasm rejects settings the wasm runtime class can not honour. Wasm
+// pods run a single module with no init or sidecar containers, and only CPU
+// and memory can be limited.
+func (spec FunctionSpec) validateWasm() error {
+	result := &multierror.Error{}
+
+	for name := range spec.Resources.Requests {
+		if name != apiv1.ResourceCPU && name != apiv1.ResourceMemory {
+			result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "FunctionSpec.Resources.Requests", name, "executor type wasm only supports cpu and memory"))
+		}
+	}
+	for name, limit := range spec.Resources.Limits {
+		if name != apiv1.ResourceCPU && name != apiv1.ResourceMemory {
+			result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "FunctionSpec.Resources.Limits", name, "executor type wasm only supports cpu and memory"))
+			continue
+		}
+		if request, ok := spec.Resources.Requests[name]; ok && !limit.IsZero() && request.Cmp(limit) > 0 {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, fmt.Sprintf("FunctionSpec.Resources.Requests.%v", name), request.String(), "must be less than or equal to the limit"))
+		}
+	}
+
+	if spec.PodSpec == nil {
+		result = multierror.Append(result, MakeValidationErr(ErrorInvalidObject, "FunctionSpec.PodSpec", "", "executor type wasm requires a pod spec"))
+	} else {
+		if len(spec.PodSpec.Containers) > 1 {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "FunctionSpec.PodSpec.Containers", len(spec.PodSpec.Containers), "executor type wasm supports a single container"))
+		}
+		if len(spec.PodSpec.InitContainers) > 0 {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "FunctionSpec.PodSpec.InitContainers", len(spec.PodSpec.InitContainers), "executor type wasm does not support init containers"))
+		}
+		if spec.PodSpec.RuntimeClassName != nil && *spec.PodSpec.RuntimeClassName != "wasm" {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "FunctionSpec.PodSpec.RuntimeClassName", *spec.PodSpec.RuntimeClassName, "executor type wasm requires runtime class wasm"))
+		}
+	}
+
+	if spec.Wasm != nil {
+		result = multierror.Append(result, spec.Wasm.Validate())
+
+		// the module can not use more memory than the pod is allowed to
+		memoryLimit, ok := spec.Resources.Limits[apiv1.ResourceMemory]
+		if ok && !memoryLimit.IsZero() && spec.Wasm.MaxMemory != nil && spec.Wasm.MaxMemory.Cmp(memoryLimit) > 0 {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "WasmSpec.MaxMemory", spec.Wasm.MaxMemory.String(), "must be less than or equal to the memory limit"))
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
+func (ws WasmSpec) Validate() error {
+	result := &multierror.Error{}
+
+	if len(ws.Module.URL) > 0 && len(ws.Module.OCI) > 0 {
+		result = multierror.Append(result, MakeValidationErr(ErrorInvalidObject, "WasmSpec.Module", "", "only one of url and oci can be set"))
+	}
+	if len(ws.Module.OCI) > 0 {
+		if _, err := wasmmodule.ParseOCIReference(ws.Module.OCI); err != nil {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "WasmSpec.Module.OCI", ws.Module.OCI, err.Error()))
+		}
+	}
+	if strings.Contains(ws.Module.Filename, "/") {
+		result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "WasmSpec.Module.Filename", ws.Module.Filename, "must be a file name, not a path"))
+	}
+
+	for _, env := range ws.Env {
+		if len(env.Name) == 0 || strings.ContainsAny(env.Name, "=\x00") {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "WasmSpec.Env.Name", env.Name, "not a valid WASI environment variable name"))
+		}
+	}
+
+	guestPaths := make(map[string]struct{})
+	for _, dir := range ws.PreopenDirs {
+		if !path.IsAbs(dir.Path) {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "WasmSpec.PreopenDirs.Path", dir.Path, "must be an absolute path"))
+		}
+		guestPath := dir.GuestPath
+		if len(guestPath) == 0 {
+			guestPath = dir.Path
+		}
+		if !path.IsAbs(guestPath) {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "WasmSpec.PreopenDirs.GuestPath", guestPath, "must be an absolute path"))
+		}
+		if _, ok := guestPaths[guestPath]; ok {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "WasmSpec.PreopenDirs.GuestPath", guestPath, "preopened more than once"))
+		}
+		guestPaths[guestPath] = struct{}{}
+	}
+
+	switch ws.Engine {
+	case "", WasmEngineWasmtime, WasmEngineWasmEdge, WasmEngineWasmer: // no op
+	default:
+		result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "WasmSpec.Engine", ws.Engine, "not a supported wasm engine"))
+	}
+
+	switch ws.Mode {
+	case "", WasmModeDeployment, WasmModePool, WasmModeShared: // no op
+	default:
+		result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "WasmSpec.Mode", ws.Mode, "not a supported wasm mode"))
+	}
+
+	// wasm32 modules address at most 4GiB of linear memory
+	if ws.MaxMemory != nil && (ws.MaxMemory.Sign() <= 0 || ws.MaxMemory.Cmp(resource.MustParse("4Gi")) > 0) {
+		result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "WasmSpec.MaxMemory", ws.MaxMemory.String(), "must be greater than 0 and at most 4Gi"))
+	}
+	if ws.Fuel < 0 {
+		result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "WasmSpec.Fuel", ws.Fuel, "must not be negative"))
+	}
+
+	return result.ErrorOrNil()
+}
+
 func (is InvokeStrategy) Validate() error {
 	result := &multierror.Error{}
 
@@ -436,6 +590,35 @@ func (spec HTTPTriggerSpec) Validate() error {
 
 	result = multierror.Append(result, spec.IngressConfig.Validate())
 
+	if spec.LoadBalancer != nil {
+		result = multierror.Append(result, spec.LoadBalancer.Validate())
+	}
+
+	return result.ErrorOrNil()
+}
+
+func (config LoadBalancerConfig) Validate() error {
+	result := &multierror.Error{}
+
+	switch config.Strategy {
+	case "", LoadBalancerStrategyRoundRobin, LoadBalancerStrategyLeastOutstanding: // no op
+		if len(config.HashHeader) > 0 || len(config.HashCookie) > 0 {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "HTTPTriggerSpec.LoadBalancer.Strategy", config.Strategy, "hash header and cookie are only supported by the consistenthash strategy"))
+		}
+	case LoadBalancerStrategyConsistentHash:
+		if (len(config.HashHeader) > 0) == (len(config.HashCookie) > 0) {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "HTTPTriggerSpec.LoadBalancer.Strategy", config.Strategy, "exactly one of hash header or hash cookie must be set"))
+		}
+	default:
+		result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "HTTPTriggerSpec.LoadBalancer.Strategy", config.Strategy, "not a supported load balancing strategy"))
+	}
+
+	if len(config.HashHeader) > 0 {
+		for _, msg := range validation.IsHTTPHeaderName(config.HashHeader) {
+			result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "HTTPTriggerSpec.LoadBalancer.HashHeader", config.HashHeader, msg))
+		}
+	}
+
 	return result.ErrorOrNil()
 }
 
@@ -523,6 +706,35 @@ func (spec MessageQueueTriggerSpec) Validate() error {
 		}
 	}
 
+	if spec.Batch != nil {
+		if spec.MessageQueueType != MessageQueueTypeKafka || spec.MqtKind == "keda" {
+			result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "MessageQueueTriggerSpec.Batch", spec.MessageQueueType, "batch delivery is only supported by kafka triggers of the fission mqtkind"))
+		}
+		result = multierror.Append(result, spec.Batch.Validate())
+	}
+
+	return result.ErrorOrNil()
+}
+
+func (b MessageQueueTriggerBatch) Validate() error {
+	result := &multierror.Error{}
+
+	if b.MaxRecords < 1 {
+		result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "MessageQueueTriggerBatch.MaxRecords", b.MaxRecords, "must be greater than 0"))
+	}
+	if b.MaxBytes < 0 {
+		result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "MessageQueueTriggerBatch.MaxBytes", b.MaxBytes, "must be greater than or equal to 0"))
+	}
+	if b.MaxWait.Duration < 0 {
+		result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "MessageQueueTriggerBatch.MaxWait", b.MaxWait.Duration, "must be greater than or equal to 0"))
+	}
+
+	switch b.Format {
+	case "", BatchFormatJSON, BatchFormatNDJSON: // no op
+	default:
+		result = multierror.Append(result, MakeValidationErr(ErrorUnsupportedType, "MessageQueueTriggerBatch.Format", b.Format, "not a supported batch format"))
+	}
+
 	return result.ErrorOrNil()
 }
 
@@ -570,6 +782,20 @@ func (f *Function) Validate() error {
 		validateMetadata("Function", f.ObjectMeta),
 		f.Spec.Validate())
 
+	// wasm pods read secrets and configmaps from their own namespace only
+	if f.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType == ExecutorTypeWasm {
+		for _, s := range f.Spec.Secrets {
+			if len(s.Namespace) > 0 && s.Namespace != f.ObjectMeta.Namespace {
+				result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "FunctionSpec.Secrets", s.Namespace, "secret must be in the namespace of the function"))
+			}
+		}
+		for _, c := range f.Spec.ConfigMaps {
+			if len(c.Namespace) > 0 && c.Namespace != f.ObjectMeta.Namespace {
+				result = multierror.Append(result, MakeValidationErr(ErrorInvalidValue, "FunctionSpec.ConfigMaps", c.Namespace, "configmap must be in the namespace of the function"))
+			}
+		}
+	}
+
 	return result.ErrorOrNil()
 }
 
@@ -216,6 +216,23 @@ func (in *ConfigMapReference) DeepCopy() *ConfigMapReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeploymentVariant) DeepCopyInto(out *DeploymentVariant) {
+	*out = *in
+	in.Archive.DeepCopyInto(&out.Archive)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeploymentVariant.
+func (in *DeploymentVariant) DeepCopy() *DeploymentVariant {
+	if in == nil {
+		return nil
+	}
+	out := new(DeploymentVariant)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Environment) DeepCopyInto(out *Environment) {
 	*out = *in
@@ -466,6 +483,11 @@ func (in *FunctionSpec) DeepCopyInto(out *FunctionSpec) {
 		*out = new(corev1.PodSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Wasm != nil {
+		in, out := &in.Wasm, &out.Wasm
+		*out = new(WasmSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -554,6 +576,11 @@ func (in *HTTPTriggerSpec) DeepCopyInto(out *HTTPTriggerSpec) {
 	}
 	in.FunctionReference.DeepCopyInto(&out.FunctionReference)
 	in.IngressConfig.DeepCopyInto(&out.IngressConfig)
+	if in.LoadBalancer != nil {
+		in, out := &in.LoadBalancer, &out.LoadBalancer
+		*out = new(LoadBalancerConfig)
+		**out = **in
+	}
 	return
 }
 
@@ -691,6 +718,22 @@ func (in *KubernetesWatchTriggerSpec) DeepCopy() *KubernetesWatchTriggerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LoadBalancerConfig) DeepCopyInto(out *LoadBalancerConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LoadBalancerConfig.
+func (in *LoadBalancerConfig) DeepCopy() *LoadBalancerConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LoadBalancerConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MessageQueueTrigger) DeepCopyInto(out *MessageQueueTrigger) {
 	*out = *in
@@ -751,6 +794,23 @@ func (in *MessageQueueTriggerList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MessageQueueTriggerBatch) DeepCopyInto(out *MessageQueueTriggerBatch) {
+	*out = *in
+	out.MaxWait = in.MaxWait
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MessageQueueTriggerBatch.
+func (in *MessageQueueTriggerBatch) DeepCopy() *MessageQueueTriggerBatch {
+	if in == nil {
+		return nil
+	}
+	out := new(MessageQueueTriggerBatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MessageQueueTriggerSpec) DeepCopyInto(out *MessageQueueTriggerSpec) {
 	*out = *in
@@ -787,6 +847,11 @@ func (in *MessageQueueTriggerSpec) DeepCopyInto(out *MessageQueueTriggerSpec) {
 		*out = new(corev1.PodSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Batch != nil {
+		in, out := &in.Batch, &out.Batch
+		*out = new(MessageQueueTriggerBatch)
+		**out = **in
+	}
 	return
 }
 
@@ -883,6 +948,18 @@ func (in *PackageSpec) DeepCopyInto(out *PackageSpec) {
 	out.Environment = in.Environment
 	in.Source.DeepCopyInto(&out.Source)
 	in.Deployment.DeepCopyInto(&out.Deployment)
+	if in.Wasm != nil {
+		in, out := &in.Wasm, &out.Wasm
+		*out = new(WasmBuildSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeploymentVariants != nil {
+		in, out := &in.DeploymentVariants, &out.DeploymentVariants
+		*out = make([]DeploymentVariant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -1063,3 +1140,109 @@ func (in *ValidationError) DeepCopy() *ValidationError {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WasmBuildSpec) DeepCopyInto(out *WasmBuildSpec) {
+	*out = *in
+	if in.Architectures != nil {
+		in, out := &in.Architectures, &out.Architectures
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WasmBuildSpec.
+func (in *WasmBuildSpec) DeepCopy() *WasmBuildSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WasmBuildSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WasmEnvVar) DeepCopyInto(out *WasmEnvVar) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WasmEnvVar.
+func (in *WasmEnvVar) DeepCopy() *WasmEnvVar {
+	if in == nil {
+		return nil
+	}
+	out := new(WasmEnvVar)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WasmModule) DeepCopyInto(out *WasmModule) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WasmModule.
+func (in *WasmModule) DeepCopy() *WasmModule {
+	if in == nil {
+		return nil
+	}
+	out := new(WasmModule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WasmPreopenDir) DeepCopyInto(out *WasmPreopenDir) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WasmPreopenDir.
+func (in *WasmPreopenDir) DeepCopy() *WasmPreopenDir {
+	if in == nil {
+		return nil
+	}
+	out := new(WasmPreopenDir)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WasmSpec) DeepCopyInto(out *WasmSpec) {
+	*out = *in
+	out.Module = in.Module
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]WasmEnvVar, len(*in))
+		copy(*out, *in)
+	}
+	if in.PreopenDirs != nil {
+		in, out := &in.PreopenDirs, &out.PreopenDirs
+		*out = make([]WasmPreopenDir, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxMemory != nil {
+		in, out := &in.MaxMemory, &out.MaxMemory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WasmSpec.
+func (in *WasmSpec) DeepCopy() *WasmSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WasmSpec)
+	in.DeepCopyInto(out)
+	return out
+}
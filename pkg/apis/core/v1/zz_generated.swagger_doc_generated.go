@@ -12,7 +12,7 @@ package v1
 // AUTO-GENERATED FUNCTIONS START HERE
 var map_Archive = map[string]string{
 	"":         "Archive contains or references a collection of sources or binary files.",
-	"type":     "Type defines how the package is specified: literal or URL. Available value:\n - literal\n - url",
+	"type":     "Type defines how the package is specified: literal, URL or OCI. Available value:\n - literal\n - url\n - oci",
 	"literal":  "Literal contents of the package. Can be used for encoding packages below TODO (256 KB?) size.",
 	"url":      "URL references a package.",
 	"checksum": "Checksum ensures the integrity of packages referenced by URL. Ignored for literals.",
@@ -204,6 +204,7 @@ var map_FunctionSpec = map[string]string{
 	"requestsPerPod":  "RequestsPerPod indicates the maximum number of concurrent requests that can be served by a specialized pod This is optional. If not specified default value will be taken as 1",
 	"onceOnly":        "OnceOnly specifies if specialized pod will serve exactly one request in its lifetime and would be garbage collected after serving that one request This is optional. If not specified default value will be taken as false",
 	"podspec":         "Podspec specifies podspec to use for executor type container based functions Different arguments mentioned for container based function are populated inside a pod.",
+	"wasm":            "Wasm specifies how the wasm runtime runs the module of executor type wasm functions.",
 }
 
 func (FunctionSpec) SwaggerDoc() map[string]string {
@@ -237,12 +238,24 @@ var map_HTTPTriggerSpec = map[string]string{
 	"functionref":   "FunctionReference is a reference to the target function.",
 	"createingress": "If CreateIngress is true, router will create an ingress definition.",
 	"ingressconfig": "IngressConfig for router to set up Ingress.",
+	"loadbalancer":  "LoadBalancer configures how router spreads requests across the pods of functions it sends requests to directly, e.g. wasm functions.",
 }
 
 func (HTTPTriggerSpec) SwaggerDoc() map[string]string {
 	return map_HTTPTriggerSpec
 }
 
+var map_LoadBalancerConfig = map[string]string{
+	"":           "LoadBalancerConfig is for router to pick the function pod a request is sent to.",
+	"strategy":   "Strategy is the load balancing strategy. Available value: - roundrobin - leastoutstanding - consistenthash Defaults to roundrobin.",
+	"hashheader": "HashHeader is the request header consistenthash hashes on.",
+	"hashcookie": "HashCookie is the request cookie consistenthash hashes on.",
+}
+
+func (LoadBalancerConfig) SwaggerDoc() map[string]string {
+	return map_LoadBalancerConfig
+}
+
 var map_IngressConfig = map[string]string{
 	"":            "IngressConfig is for router to set up Ingress.",
 	"annotations": "Annotations will be added to metadata when creating Ingress.",
@@ -308,6 +321,18 @@ func (MessageQueueTriggerList) SwaggerDoc() map[string]string {
 	return map_MessageQueueTriggerList
 }
 
+var map_MessageQueueTriggerBatch = map[string]string{
+	"":           "MessageQueueTriggerBatch configures how records are collected into batches. A batch is delivered as soon as one of its limits is reached.",
+	"maxRecords": "Maximum number of records in a batch",
+	"maxBytes":   "Maximum total size in bytes of the record values in a batch, unlimited if zero.",
+	"maxWait":    "Maximum time to wait for a batch to fill up before it is delivered. Defaults to 1s.",
+	"format":     "Format of the request body. Available value: - json, a JSON array of records (default) - ndjson, one JSON record per line Batches are sent as a CloudEvents batch instead when the message queue trigger manager encodes CloudEvents.",
+}
+
+func (MessageQueueTriggerBatch) SwaggerDoc() map[string]string {
+	return map_MessageQueueTriggerBatch
+}
+
 var map_MessageQueueTriggerSpec = map[string]string{
 	"":                 "MessageQueueTriggerSpec defines a binding from a topic in a message queue to a function.",
 	"functionref":      "The reference to a function for message queue trigger to invoke with when receiving messages from subscribed topic.",
@@ -325,6 +350,7 @@ var map_MessageQueueTriggerSpec = map[string]string{
 	"secret":           "Secret name",
 	"mqtkind":          "Kind of Message Queue Trigger to be created, by default its fission",
 	"podspec":          "(Optional) Podspec allows modification of deployed runtime pod with Kubernetes PodSpec The merging logic is briefly described below and detailed MergePodSpec function - Volumes mounts and env variables for function and fetcher container are appended - All additional containers and init containers are appended - Volume definitions are appended - Lists such as tolerations, ImagePullSecrets, HostAliases are appended - Structs are merged and variables from pod spec take precedence",
+	"batch":            "Batch delivers the records of the subscribed topic to the function in batches instead of one invocation per record. Only supported by the kafka message queue type with the fission mqtkind.",
 }
 
 func (MessageQueueTriggerSpec) SwaggerDoc() map[string]string {
@@ -358,17 +384,38 @@ func (PackageRef) SwaggerDoc() map[string]string {
 }
 
 var map_PackageSpec = map[string]string{
-	"":            "PackageSpec includes source/deploy archives and the reference of environment to build the package.",
-	"environment": "Environment is a reference to the environment for building source archive.",
-	"source":      "Source is the archive contains source code and dependencies file. If the package status is in PENDING state, builder manager will then notify builder to compile source and save the result as deployable archive.",
-	"deployment":  "Deployment is the deployable archive that environment runtime used to run user function.",
-	"buildcmd":    "BuildCommand is a custom build command that builder used to build the source archive.",
+	"":                   "PackageSpec includes source/deploy archives and the reference of environment to build the package.",
+	"environment":        "Environment is a reference to the environment for building source archive.",
+	"source":             "Source is the archive contains source code and dependencies file. If the package status is in PENDING state, builder manager will then notify builder to compile source and save the result as deployable archive.",
+	"deployment":         "Deployment is the deployable archive that environment runtime used to run user function.",
+	"buildcmd":           "BuildCommand is a custom build command that builder used to build the source archive.",
+	"wasm":               "Wasm makes the builder compile the source archive into a wasm module, and optionally precompile the module for a wasm engine.",
+	"deploymentVariants": "DeploymentVariants are the deployment archive precompiled by the builder for a wasm engine and node architecture.",
 }
 
 func (PackageSpec) SwaggerDoc() map[string]string {
 	return map_PackageSpec
 }
 
+var map_WasmBuildSpec = map[string]string{
+	"":              "WasmBuildSpec configures how the builder builds a wasm module.",
+	"language":      "Language of the source, which picks the build command if the package has none. Available value: - rust - tinygo - assemblyscript",
+	"precompile":    "Precompile is the wasm engine the module is compiled ahead of time for, none if empty.",
+	"architectures": "Architectures are the node architectures the module is precompiled for, like amd64 and arm64. Defaults to amd64.",
+}
+
+func (WasmBuildSpec) SwaggerDoc() map[string]string {
+	return map_WasmBuildSpec
+}
+
+var map_DeploymentVariant = map[string]string{
+	"": "DeploymentVariant is a deployment archive precompiled for a wasm engine and node architecture.",
+}
+
+func (DeploymentVariant) SwaggerDoc() map[string]string {
+	return map_DeploymentVariant
+}
+
 var map_PackageStatus = map[string]string{
 	"":                    "PackageStatus contains the build status of a package also the build log for examination.",
 	"buildstatus":         "BuildStatus is the package build status.",
@@ -433,4 +480,51 @@ func (TimeTriggerSpec) SwaggerDoc() map[string]string {
 	return map_TimeTriggerSpec
 }
 
+var map_WasmEnvVar = map[string]string{
+	"": "WasmEnvVar is a WASI environment variable.",
+}
+
+func (WasmEnvVar) SwaggerDoc() map[string]string {
+	return map_WasmEnvVar
+}
+
+var map_WasmModule = map[string]string{
+	"":         "WasmModule references a wasm module, either stored in storagesvc or published as an OCI artifact.",
+	"url":      "URL of the module in storagesvc.",
+	"filename": "Filename the module is stored as in the pod.",
+	"oci":      "OCI is the reference of the module published as an OCI artifact.",
+}
+
+func (WasmModule) SwaggerDoc() map[string]string {
+	return map_WasmModule
+}
+
+var map_WasmPreopenDir = map[string]string{
+	"":          "WasmPreopenDir is a directory of the pod preopened for the module.",
+	"path":      "Path of the directory in the pod.",
+	"guestPath": "GuestPath is the path the module sees the directory at, defaults to Path.",
+	"readOnly":  "ReadOnly prevents the module from writing to the directory.",
+}
+
+func (WasmPreopenDir) SwaggerDoc() map[string]string {
+	return map_WasmPreopenDir
+}
+
+var map_WasmSpec = map[string]string{
+	"":            "WasmSpec configures how the wasm runtime runs the module of a function.",
+	"module":      "Module references the wasm module of the function.",
+	"entrypoint":  "Entrypoint is the export of the module the runtime invokes.",
+	"args":        "Args are the WASI command line arguments of the module.",
+	"env":         "Env are the WASI environment variables of the module.",
+	"preopenDirs": "PreopenDirs are the directories of the pod the module is given access to.",
+	"engine":      "Engine is a hint of the wasm engine the runtime class runs the module with. Available value: - wasmtime - wasmedge - wasmer",
+	"maxMemory":   "MaxMemory limits the linear memory of the module.",
+	"fuel":        "Fuel limits the instructions the module executes per request, 0 for no limit.",
+	"mode":        "Mode is how the wasm executor starts the function. Available value: - deployment: a deployment and a service per function (default) - pool: a pre-warmed generic wasm runtime pod is specialized with the\n  module, falling back to deployment if the pool has no ready pod - shared: the module is loaded into a host pod shared with other\n  functions, falling back to deployment if no host has room for it.\n  Functions without a mode whose environment allows infinite\n  functions per container are shared as well.",
+}
+
+func (WasmSpec) SwaggerDoc() map[string]string {
+	return map_WasmSpec
+}
+
 // AUTO-GENERATED FUNCTIONS END HERE
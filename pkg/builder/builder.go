@@ -33,6 +33,7 @@ import (
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
 	"github.com/fission/fission/pkg/info"
 )
 
@@ -51,11 +52,23 @@ type (
 		// 1. SRC_PKG: path to source package directory
 		// 2. DEPLOY_PKG: path to deployment package directory
 		BuildCommand string `json:"command"`
+		// Wasm switches the builder to the wasm build mode, which
+		// verifies the build produced a wasm module and precompiles it.
+		Wasm *fv1.WasmBuildSpec `json:"wasm,omitempty"`
 	}
 
 	PackageBuildResponse struct {
-		ArtifactFilename string `json:"artifactFilename"`
-		BuildLogs        string `json:"buildLogs"`
+		ArtifactFilename string                `json:"artifactFilename"`
+		BuildLogs        string                `json:"buildLogs"`
+		Variants         []PackageBuildVariant `json:"variants,omitempty"`
+	}
+
+	// PackageBuildVariant is an artifact precompiled for a wasm engine and
+	// node architecture.
+	PackageBuildVariant struct {
+		Engine           fv1.WasmEngine `json:"engine"`
+		Architecture     string         `json:"architecture"`
+		ArtifactFilename string         `json:"artifactFilename"`
 	}
 
 	Builder struct {
@@ -121,7 +134,15 @@ func (builder *Builder) Handler(w http.ResponseWriter, r *http.Request) {
 
 	var buildArgs []string
 	buildCmd := req.BuildCommand
-	if len(buildCmd) == 0 {
+	if len(buildCmd) == 0 && req.Wasm != nil {
+		// use the toolchain of the source language
+		buildCmd, buildArgs, err = wasmBuildCommand(req.Wasm.Language, deployPkgPath)
+		if err != nil {
+			builder.logger.Error("error getting wasm build command", zap.Error(err))
+			builder.reply(w, "", err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else if len(buildCmd) == 0 {
 		// use default build command
 		buildCmd = "/build"
 	} else {
@@ -135,6 +156,12 @@ func (builder *Builder) Handler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	buildLogs, err := builder.build(buildCmd, buildArgs, srcPkgPath, deployPkgPath)
+	var variants []PackageBuildVariant
+	if err == nil && req.Wasm != nil {
+		var wasmLogs string
+		wasmLogs, variants, err = builder.buildWasmVariants(req.Wasm, srcPkgPath, deployPkgFilename)
+		buildLogs += wasmLogs
+	}
 	if err != nil {
 		e := "error building source package"
 		builder.logger.Error(e, zap.Error(err))
@@ -145,15 +172,21 @@ func (builder *Builder) Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	builder.reply(w, deployPkgFilename, buildLogs, http.StatusOK)
+	builder.replyWith(w, PackageBuildResponse{
+		ArtifactFilename: deployPkgFilename,
+		BuildLogs:        buildLogs,
+		Variants:         variants,
+	}, http.StatusOK)
 }
 
 func (builder *Builder) reply(w http.ResponseWriter, pkgFilename string, buildLogs string, statusCode int) {
-	resp := PackageBuildResponse{
+	builder.replyWith(w, PackageBuildResponse{
 		ArtifactFilename: pkgFilename,
 		BuildLogs:        buildLogs,
-	}
+	}, statusCode)
+}
 
+func (builder *Builder) replyWith(w http.ResponseWriter, resp PackageBuildResponse, statusCode int) {
 	rBody, err := json.Marshal(resp)
 	if err != nil {
 		e := errors.Wrap(err, "error encoding response body")
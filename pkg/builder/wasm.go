@@ -0,0 +1,150 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package builder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
+)
+
+const (
+	// rustWasmTarget is the target cargo builds WASI modules for
+	rustWasmTarget = "wasm32-wasi"
+	// defaultWasmArchitecture is the node architecture modules are
+	// precompiled for if the package names none
+	defaultWasmArchitecture = "amd64"
+)
+
+// wasmBuildCommand returns the command compiling source of language into a
+// wasm module at deployPkgPath.
+func wasmBuildCommand(language fv1.WasmLanguage, deployPkgPath string) (string, []string, error) {
+	switch language {
+	case fv1.WasmLanguageRust:
+		// cargo has no option for the output path, collectWasmModule
+		// moves the module to deployPkgPath
+		return "cargo", []string{"build", "--release", "--target", rustWasmTarget}, nil
+	case fv1.WasmLanguageTinyGo:
+		return "tinygo", []string{"build", "-o", deployPkgPath, "-target", "wasi", "."}, nil
+	case fv1.WasmLanguageAssemblyScript:
+		return "npx", []string{"asc", "assembly/index.ts", "--outFile", deployPkgPath, "--optimize"}, nil
+	}
+	return "", nil, errors.Errorf("unsupported wasm source language %q", language)
+}
+
+// precompileCommand returns the command compiling module ahead of time for
+// engine on nodes of arch into out.
+func precompileCommand(engine fv1.WasmEngine, arch string, module string, out string) (string, []string, error) {
+	triple, err := wasmmodule.TargetTriple(arch)
+	if err != nil {
+		return "", nil, err
+	}
+	switch engine {
+	case fv1.WasmEngineWasmtime:
+		return "wasmtime", []string{"compile", "--target", triple, "-o", out, module}, nil
+	case fv1.WasmEngineWasmer:
+		return "wasmer", []string{"compile", "--target", triple, module, "-o", out}, nil
+	case fv1.WasmEngineWasmEdge:
+		// wasmedgec has no cross compilation
+		if arch != runtime.GOARCH {
+			return "", nil, errors.Errorf("wasmedge precompiles for the %v architecture of the builder only, not %v", runtime.GOARCH, arch)
+		}
+		return "wasmedgec", []string{module, out}, nil
+	}
+	return "", nil, errors.Errorf("unsupported wasm engine %q", engine)
+}
+
+// collectWasmModule moves the module cargo built to deployPkgPath, other
+// toolchains write the module there directly.
+func collectWasmModule(srcPkgPath string, deployPkgPath string) error {
+	if _, err := os.Stat(deployPkgPath); err == nil {
+		return nil
+	}
+
+	srcDir := srcPkgPath
+	if fi, err := os.Stat(srcPkgPath); err == nil && !fi.IsDir() {
+		srcDir = filepath.Dir(srcPkgPath)
+	}
+	modules, err := filepath.Glob(filepath.Join(srcDir, "target", rustWasmTarget, "release", "*.wasm"))
+	if err != nil {
+		return errors.Wrap(err, "error looking for the wasm module")
+	}
+	if len(modules) != 1 {
+		return errors.Errorf("expected the build to produce one wasm module, found %d", len(modules))
+	}
+	return os.Rename(modules[0], deployPkgPath)
+}
+
+// buildWasmVariants verifies the build produced a wasm module and
+// precompiles the module for the engine and architectures of the package.
+// The variants are stored next to the deployment artifact.
+func (builder *Builder) buildWasmVariants(spec *fv1.WasmBuildSpec, srcPkgPath string, deployPkgFilename string) (string, []PackageBuildVariant, error) {
+	deployPkgPath := filepath.Join(builder.sharedVolumePath, deployPkgFilename)
+	err := collectWasmModule(srcPkgPath, deployPkgPath)
+	if err != nil {
+		return "", nil, err
+	}
+	if !wasmmodule.IsWasmFile(deployPkgPath) {
+		return "", nil, errors.New("the build did not produce a wasm module")
+	}
+
+	if len(spec.Precompile) == 0 {
+		return "", nil, nil
+	}
+	architectures := spec.Architectures
+	if len(architectures) == 0 {
+		architectures = []string{defaultWasmArchitecture}
+	}
+
+	var buildLogs string
+	var variants []PackageBuildVariant
+	for _, arch := range architectures {
+		filename := fmt.Sprintf("%s-%s-%s%s", deployPkgFilename, spec.Precompile, arch,
+			wasmmodule.PrecompiledExtension(string(spec.Precompile)))
+		variantPath := filepath.Join(builder.sharedVolumePath, filename)
+
+		command, args, err := precompileCommand(spec.Precompile, arch, deployPkgPath, variantPath)
+		if err != nil {
+			return buildLogs, nil, err
+		}
+		builder.logger.Info("precompiling wasm module",
+			zap.String("engine", string(spec.Precompile)),
+			zap.String("architecture", arch))
+		logs, err := builder.build(command, args, srcPkgPath, variantPath)
+		buildLogs += logs
+		if err != nil {
+			return buildLogs, nil, errors.Wrapf(err, "error precompiling wasm module for %v", arch)
+		}
+		if _, err := os.Stat(variantPath); err != nil {
+			return buildLogs, nil, errors.Errorf("precompiling for %v did not produce %v", arch, filename)
+		}
+
+		variants = append(variants, PackageBuildVariant{
+			Engine:           spec.Precompile,
+			Architecture:     arch,
+			ArtifactFilename: filename,
+		})
+	}
+	return buildLogs, variants, nil
+}
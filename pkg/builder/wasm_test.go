@@ -0,0 +1,130 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/utils/loggerfactory"
+)
+
+// fakeTool installs an executable named name on PATH, which writes content
+// to the path following "-o" in its arguments.
+func fakeTool(t *testing.T, binDir string, name string, content string) {
+	script := `#!/bin/sh
+out=""
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-o" ]; then out="$2"; fi
+	shift
+done
+printf '` + content + `' > "$out"
+echo "` + name + ` done"
+`
+	err := os.WriteFile(filepath.Join(binDir, name), []byte(script), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func buildWasm(t *testing.T, builder *Builder, req *PackageBuildRequest) (*PackageBuildResponse, int) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	builder.Handler(w, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+	var resp PackageBuildResponse
+	err = json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &resp, w.Code
+}
+
+func TestBuildWasm(t *testing.T) {
+	binDir := t.TempDir()
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	wasmHeader := `\000asm\001\000\000\000`
+	fakeTool(t, binDir, "tinygo", wasmHeader)
+	fakeTool(t, binDir, "wasmtime", "precompiled")
+
+	dir := t.TempDir()
+	builder := MakeBuilder(loggerfactory.GetLogger(), dir)
+	err := os.Mkdir(filepath.Join(dir, "hello"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, code := buildWasm(t, builder, &PackageBuildRequest{
+		SrcPkgFilename: "hello",
+		Wasm: &fv1.WasmBuildSpec{
+			Language:      fv1.WasmLanguageTinyGo,
+			Precompile:    fv1.WasmEngineWasmtime,
+			Architectures: []string{"amd64", "arm64"},
+		},
+	})
+	if code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, code, resp.BuildLogs)
+	}
+
+	expected := []PackageBuildVariant{
+		{Engine: fv1.WasmEngineWasmtime, Architecture: "amd64", ArtifactFilename: resp.ArtifactFilename + "-wasmtime-amd64.cwasm"},
+		{Engine: fv1.WasmEngineWasmtime, Architecture: "arm64", ArtifactFilename: resp.ArtifactFilename + "-wasmtime-arm64.cwasm"},
+	}
+	if !reflect.DeepEqual(resp.Variants, expected) {
+		t.Fatalf("expected variants %v, got %v", expected, resp.Variants)
+	}
+	for _, v := range resp.Variants {
+		b, err := os.ReadFile(filepath.Join(dir, v.ArtifactFilename))
+		if err != nil || string(b) != "precompiled" {
+			t.Fatalf("expected precompiled variant %v, got %q, %v", v.ArtifactFilename, b, err)
+		}
+	}
+
+	// a build producing something else than a wasm module fails
+	fakeTool(t, binDir, "tinygo", "not wasm")
+	resp, code = buildWasm(t, builder, &PackageBuildRequest{
+		SrcPkgFilename: "hello",
+		Wasm:           &fv1.WasmBuildSpec{Language: fv1.WasmLanguageTinyGo},
+	})
+	if code != http.StatusInternalServerError {
+		t.Fatalf("expected status code %d, got %d", http.StatusInternalServerError, code)
+	}
+	if len(resp.Variants) != 0 {
+		t.Fatalf("expected no variants, got %v", resp.Variants)
+	}
+}
+
+func TestPrecompileCommand(t *testing.T) {
+	command, args, err := precompileCommand(fv1.WasmEngineWasmer, "arm64", "in.wasm", "out.wasmu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command != "wasmer" || !reflect.DeepEqual(args, []string{"compile", "--target", "aarch64-unknown-linux-gnu", "in.wasm", "-o", "out.wasmu"}) {
+		t.Fatalf("unexpected command %v %v", command, args)
+	}
+	if _, _, err := precompileCommand(fv1.WasmEngineWasmtime, "s390x", "in.wasm", "out"); err == nil {
+		t.Fatal("expected an error for an unsupported architecture")
+	}
+}
@@ -41,18 +41,18 @@ import (
 // Following is the steps buildPackage function takes to complete the whole process.
 // 1. Send fetch request to fetcher to fetch source package.
 // 2. Send build request to builder to start a build.
-// 3. Send upload request to fetcher to upload deployment package.
-// 4. Return upload response and build logs.
+// 3. Send upload request to fetcher to upload deployment package and precompiled wasm modules.
+// 4. Return upload response, precompiled variants and build logs.
 // *. Return build logs and error if any one of steps above failed.
 func buildPackage(ctx context.Context, logger *zap.Logger, fissionClient versioned.Interface, envBuilderNamespace string,
-	storageSvcUrl string, pkg *fv1.Package) (uploadResp *fetcher.ArchiveUploadResponse, buildLogs string, err error) {
+	storageSvcUrl string, pkg *fv1.Package) (uploadResp *fetcher.ArchiveUploadResponse, variants []fv1.DeploymentVariant, buildLogs string, err error) {
 
 	env, err := fissionClient.CoreV1().Environments(pkg.Spec.Environment.Namespace).Get(ctx, pkg.Spec.Environment.Name, metav1.GetOptions{})
 	if err != nil {
 		e := "error getting environment CRD info"
 		logger.Error(e, zap.Error(err))
 		e = fmt.Sprintf("%s: %v", e, err)
-		return nil, e, ferror.MakeError(http.StatusInternalServerError, e)
+		return nil, nil, e, ferror.MakeError(http.StatusInternalServerError, e)
 	}
 
 	svcName := fmt.Sprintf("%v-%v.%v", env.ObjectMeta.Name, env.ObjectMeta.ResourceVersion, envBuilderNamespace)
@@ -73,17 +73,20 @@ func buildPackage(ctx context.Context, logger *zap.Logger, fissionClient version
 		e := "error fetching source package"
 		logger.Error(e, zap.Error(err))
 		e = fmt.Sprintf("%s: %v", e, err)
-		return nil, e, ferror.MakeError(http.StatusInternalServerError, e)
+		return nil, nil, e, ferror.MakeError(http.StatusInternalServerError, e)
 	}
 
+	// the builder picks the build command of the source language of wasm
+	// packages without a build command
 	buildCmd := pkg.Spec.BuildCommand
-	if len(buildCmd) == 0 {
+	if len(buildCmd) == 0 && pkg.Spec.Wasm == nil {
 		buildCmd = env.Spec.Builder.Command
 	}
 
 	pkgBuildReq := &builder.PackageBuildRequest{
 		SrcPkgFilename: srcPkgFilename,
 		BuildCommand:   buildCmd,
+		Wasm:           pkg.Spec.Wasm,
 	}
 
 	logger.Info("started building with source package", zap.String("source_package", srcPkgFilename))
@@ -96,12 +99,13 @@ func buildPackage(ctx context.Context, logger *zap.Logger, fissionClient version
 			buildLogs = buildResp.BuildLogs
 		}
 		buildLogs += fmt.Sprintf("%v\n", e)
-		return nil, buildLogs, ferror.MakeError(http.StatusInternalServerError, e)
+		return nil, nil, buildLogs, ferror.MakeError(http.StatusInternalServerError, e)
 	}
 
 	logger.Info("build succeed", zap.String("source_package", srcPkgFilename), zap.String("deployment_package", buildResp.ArtifactFilename))
 
-	archivePackage := !env.Spec.KeepArchive
+	// wasm modules are stored as is for the runtime to load them
+	archivePackage := !env.Spec.KeepArchive && pkg.Spec.Wasm == nil
 
 	uploadReq := &fetcher.ArchiveUploadRequest{
 		Filename:       buildResp.ArtifactFilename,
@@ -115,10 +119,35 @@ func buildPackage(ctx context.Context, logger *zap.Logger, fissionClient version
 	if err != nil {
 		e := fmt.Sprintf("Error uploading deployment package: %v", err)
 		buildResp.BuildLogs += fmt.Sprintf("%v\n", e)
-		return nil, buildResp.BuildLogs, ferror.MakeError(http.StatusInternalServerError, e)
+		return nil, nil, buildResp.BuildLogs, ferror.MakeError(http.StatusInternalServerError, e)
 	}
 
-	return uploadResp, buildResp.BuildLogs, nil
+	for _, v := range buildResp.Variants {
+		logger.Info("started uploading precompiled wasm module",
+			zap.String("deployment_package", v.ArtifactFilename),
+			zap.String("engine", string(v.Engine)),
+			zap.String("architecture", v.Architecture))
+		variantResp, err := fetcherC.Upload(ctx, &fetcher.ArchiveUploadRequest{
+			Filename:      v.ArtifactFilename,
+			StorageSvcUrl: storageSvcUrl,
+		})
+		if err != nil {
+			e := fmt.Sprintf("Error uploading precompiled wasm module for %v: %v", v.Architecture, err)
+			buildResp.BuildLogs += fmt.Sprintf("%v\n", e)
+			return nil, nil, buildResp.BuildLogs, ferror.MakeError(http.StatusInternalServerError, e)
+		}
+		variants = append(variants, fv1.DeploymentVariant{
+			Engine:       v.Engine,
+			Architecture: v.Architecture,
+			Archive: fv1.Archive{
+				Type:     fv1.ArchiveTypeUrl,
+				URL:      variantResp.ArchiveDownloadUrl,
+				Checksum: variantResp.Checksum,
+			},
+		})
+	}
+
+	return uploadResp, variants, buildResp.BuildLogs, nil
 }
 
 func updatePackage(logger *zap.Logger, fissionClient versioned.Interface,
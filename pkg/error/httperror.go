@@ -17,6 +17,7 @@ limitations under the License.
 package error
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -62,6 +63,8 @@ func MakeErrorFromHTTP(resp *http.Response) error {
 		errCode = ErrorTooManyRequests
 	case http.StatusUnauthorized:
 		errCode = ErrorNotAuthorized
+	case http.StatusServiceUnavailable:
+		errCode = ErrorServiceUnavailable
 	default:
 		errCode = ErrorInternal
 	}
@@ -89,6 +92,8 @@ func (err Error) HTTPStatus() int {
 		code = http.StatusConflict
 	case ErrorTooManyRequests:
 		code = http.StatusTooManyRequests
+	case ErrorServiceUnavailable:
+		code = http.StatusServiceUnavailable
 	default:
 		code = http.StatusInternalServerError
 	}
@@ -106,8 +111,10 @@ func (err Error) Description() string {
 func GetHTTPError(err error) (int, string) {
 	var msg string
 	var code int
-	fe, ok := err.(Error)
-	if ok {
+	// Look through wrapped errors so that callers can add context
+	// without losing the status code of the underlying error.
+	var fe Error
+	if errors.As(err, &fe) {
 		code = fe.HTTPStatus()
 		msg = fe.Message
 	} else {
@@ -138,6 +145,7 @@ const (
 	ErrorSizeLimitExceeded
 	ErrorRequestTimeout
 	ErrorTooManyRequests
+	ErrorServiceUnavailable
 )
 
 // must match order and len of the above const
@@ -152,4 +160,6 @@ var errorDescriptions = []string{
 	"Checksum verification failed",
 	"Size limit exceeded",
 	"Request time limit exceeded",
+	"Too many requests",
+	"Service unavailable",
 }
@@ -22,17 +22,23 @@ import (
 	"fmt"
 	"html"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/labels"
 
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
 	ferror "github.com/fission/fission/pkg/error"
 	"github.com/fission/fission/pkg/executor/client"
+	"github.com/fission/fission/pkg/executor/executortype"
+	"github.com/fission/fission/pkg/executor/fscache"
 	"github.com/fission/fission/pkg/utils/httpserver"
 	"github.com/fission/fission/pkg/utils/metrics"
 	otelUtils "github.com/fission/fission/pkg/utils/otel"
@@ -79,7 +85,7 @@ func (executor *Executor) getServiceForFunctionAPI(w http.ResponseWriter, r *htt
 			if et.IsValid(ctx, fsvc) {
 				// Cached, return svc address
 				logger.Debug("served from cache", zap.String("name", fsvc.Name), zap.String("address", fsvc.Address))
-				executor.writeResponse(w, fsvc.Address, fn.ObjectMeta.Name)
+				executor.writeResponse(w, r, et, fsvc)
 				return
 			}
 			logger.Debug("deleting cache entry for invalid address",
@@ -96,12 +102,12 @@ func (executor *Executor) getServiceForFunctionAPI(w http.ResponseWriter, r *htt
 			http.Error(w, html.EscapeString(errMsg), http.StatusTooManyRequests)
 			return
 		}
-	} else if t == fv1.ExecutorTypeNewdeploy || t == fv1.ExecutorTypeContainer || t == fv1.ExecutorTypeWasm{
+	} else if t == fv1.ExecutorTypeNewdeploy || t == fv1.ExecutorTypeContainer || t == fv1.ExecutorTypeWasm {
 		fsvc, err := et.GetFuncSvcFromCache(ctx, fn)
 		if err == nil {
 			if et.IsValid(ctx, fsvc) {
 				// Cached, return svc address
-				executor.writeResponse(w, fsvc.Address, fn.ObjectMeta.Name)
+				executor.writeResponse(w, r, et, fsvc)
 				return
 			}
 			logger.Debug("deleting cache entry for invalid address",
@@ -112,7 +118,7 @@ func (executor *Executor) getServiceForFunctionAPI(w http.ResponseWriter, r *htt
 		}
 	}
 
-	serviceName, err := executor.getServiceForFunction(ctx, fn)
+	fsvc, err := executor.getServiceForFunction(ctx, fn)
 	if err != nil {
 		code, msg := ferror.GetHTTPError(err)
 		logger.Error("error getting service for function",
@@ -122,15 +128,46 @@ func (executor *Executor) getServiceForFunctionAPI(w http.ResponseWriter, r *htt
 		http.Error(w, msg, code)
 		return
 	}
-	executor.writeResponse(w, serviceName, fn.ObjectMeta.Name)
+	executor.writeResponse(w, r, et, fsvc)
 }
 
-func (executor *Executor) writeResponse(w http.ResponseWriter, serviceName string, fnName string) {
-	_, err := w.Write([]byte(serviceName))
+// podEndpointsTTL is how long the router is suggested to cache the pod
+// endpoints of a function before asking for them again.
+const podEndpointsTTL = 30 * time.Second
+
+// writeResponse writes the function service as JSON to clients accepting
+// client.ServiceForFunctionContentType. Other clients, e.g. routers of an
+// older release during a rolling upgrade, get the service address followed
+// by the pod endpoints separated by commas.
+func (executor *Executor) writeResponse(w http.ResponseWriter, r *http.Request, et executortype.ExecutorType, fsvc *fscache.FuncSvc) {
+	svc := &client.ServiceForFunction{
+		Address:      fsvc.Address,
+		ExecutorType: fsvc.Executor,
+	}
+	svc.PodEndpoints, svc.CacheGeneration = et.GetPodEndpoints(r.Context(), fsvc)
+	if len(svc.PodEndpoints) > 0 {
+		svc.TTLSeconds = int(podEndpointsTTL.Seconds())
+	}
+
+	var body []byte
+	if strings.Contains(r.Header.Get("Accept"), client.ServiceForFunctionContentType) {
+		var err error
+		body, err = json.Marshal(svc)
+		if err != nil {
+			executor.logger.Error("error encoding service for function", zap.String("function", fsvc.Function.Name), zap.Error(err))
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", client.ServiceForFunctionContentType)
+	} else {
+		body = []byte(strings.Join(append([]string{svc.Address}, svc.PodEndpoints...), ","))
+	}
+
+	_, err := w.Write(body)
 	if err != nil {
 		executor.logger.Error(
 			"error writing HTTP response",
-			zap.String("function", fnName),
+			zap.String("function", fsvc.Function.Name),
 			zap.Error(err),
 		)
 	}
@@ -145,7 +182,7 @@ func (executor *Executor) writeResponse(w http.ResponseWriter, serviceName strin
 // stale addresses are not returned to the router.
 // To make it optimal, plan is to add an eager cache invalidator function that watches for pod deletion events and
 // invalidates the cache entry if the pod address was cached.
-func (executor *Executor) getServiceForFunction(ctx context.Context, fn *fv1.Function) (string, error) {
+func (executor *Executor) getServiceForFunction(ctx context.Context, fn *fv1.Function) (*fscache.FuncSvc, error) {
 	respChan := make(chan *createFuncServiceResponse)
 	executor.requestChan <- &createFuncServiceRequest{
 		context:  ctx,
@@ -153,15 +190,7 @@ func (executor *Executor) getServiceForFunction(ctx context.Context, fn *fv1.Fun
 		respChan: respChan,
 	}
 	resp := <-respChan
-	if resp.err != nil {
-		return "", resp.err
-	}
-	if fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType==fv1.ExecutorTypeWasm{
-		address := fmt.Sprintf("%v,%v", resp.funcSvc.Address, resp.funcSvc.PodIpPort)
-		executor.logger.Info("getting wasm address like serviceaddres,podip:port", zap.String("Address", address))
-		return address,resp.err
-	}
-	return resp.funcSvc.Address, resp.err
+	return resp.funcSvc, resp.err
 }
 
 // find funcSvc and update its atime
@@ -262,7 +291,9 @@ func (executor *Executor) GetHandler() http.Handler {
 	r.HandleFunc("/v2/tapService", executor.tapService).Methods("POST") // for backward compatibility
 	r.HandleFunc("/v2/tapServices", executor.tapServices).Methods("POST")
 	r.HandleFunc("/healthz", executor.healthHandler).Methods("GET")
-	r.HandleFunc("/v2/storePodIP/{functionUid}", executor.storePodIP).Methods("POST")//给下层提供存储podIP的接口
+	r.HandleFunc("/v2/storePodIP/{functionUid}", executor.storePodIP).Methods("POST") //给下层提供存储podIP的接口
+	r.HandleFunc("/v2/wasmUsage/{functionUid}", executor.reportWasmUsage).Methods("POST")
+	r.HandleFunc("/v2/wasmUsage", executor.getWasmUsage).Methods("GET")
 	r.HandleFunc("/v2/unTapService", executor.unTapService).Methods("POST")
 	return r
 }
@@ -274,32 +305,126 @@ func (executor *Executor) Serve(ctx context.Context, port int) {
 
 }
 
+// podIPCallback is the JSON payload a wasm runtime may report the address of
+// its pod with. Runtimes may also post the plain "ip" or "ip:port" instead.
+type podIPCallback struct {
+	PodIP string `json:"podIP"`
+	Port  int    `json:"port,omitempty"`
+}
+
+// maxPodIPCallbackSize limits the size of a storePodIP request body.
+const maxPodIPCallbackSize = 1024
+
+// parsePodIPCallback parses the body of a storePodIP request and returns the
+// reported pod IP. The port, if any, is only validated since requests are
+// always sent to the container port declared in the function spec.
+func parsePodIPCallback(body []byte) (string, error) {
+	payload := strings.TrimSpace(string(body))
+
+	var host string
+	if strings.HasPrefix(payload, "{") {
+		cb := podIPCallback{}
+		err := json.Unmarshal([]byte(payload), &cb)
+		if err != nil {
+			return "", errors.Wrap(err, "error decoding pod IP payload")
+		}
+		if cb.Port < 0 || cb.Port > 65535 {
+			return "", errors.Errorf("invalid port %d", cb.Port)
+		}
+		host = cb.PodIP
+	} else if h, port, err := net.SplitHostPort(payload); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return "", errors.Errorf("invalid port %q", port)
+		}
+		host = h
+	} else {
+		host = payload
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", errors.Errorf("invalid pod IP %q", host)
+	}
+	return ip.String(), nil
+}
+
+// isFunctionPod reports whether podIP is the address of a pod which is not
+// terminating and carries the label of the function with the given UID.
+func (executor *Executor) isFunctionPod(fnUID string, podIP string) (bool, error) {
+	pods, err := executor.podLister.List(labels.Set{fv1.FUNCTION_UID: fnUID}.AsSelector())
+	if err != nil {
+		return false, err
+	}
+
+	ip := net.ParseIP(podIP)
+	for _, pod := range pods {
+		if pod.ObjectMeta.DeletionTimestamp != nil {
+			continue
+		}
+		if ip.Equal(net.ParseIP(pod.Status.PodIP)) {
+			return true, nil
+		}
+		for _, podIP := range pod.Status.PodIPs {
+			if ip.Equal(net.ParseIP(podIP.IP)) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// storePodIP is called back by wasm runtime pods to report their address.
+// Requests must carry the token signed for the function in the URL handed
+// to the pod, and the reported IP must belong to a pod of that function.
 func (executor *Executor) storePodIP(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	logger := otelUtils.LoggerWithTraceID(ctx, executor.logger)
-	body, err := io.ReadAll(r.Body)
 
+	fnUID := mux.Vars(r)["functionUid"]
+	if !executor.callbackSigner.Verify(fnUID, r.URL.Query().Get("token")) {
+		logger.Warn("rejecting pod IP callback with invalid token", zap.String("function_uid", fnUID))
+		http.Error(w, "Invalid callback token", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPodIPCallbackSize))
 	if err != nil {
 		http.Error(w, "Failed to read request", http.StatusInternalServerError)
 		return
 	}
-    logger.Info("*****Wasm成功拿到PodIP**********", zap.String("PodIP:",string(body)))
-	vars := mux.Vars(r)
-	UID := vars["functionUid"]
-   
-  
-    et:= executor.executorTypes[fv1.ExecutorTypeWasm]
-	err =et.StorePodIP(ctx,UID,string(body))
+
+	podIP, err := parsePodIPCallback(body)
 	if err != nil {
-		logger.Error("error storing PodIP for function",zap.Error(err))
-		http.Error(w, "Failed to storing PodIP request", http.StatusBadRequest)
+		logger.Warn("rejecting malformed pod IP callback", zap.Error(err), zap.String("function_uid", fnUID))
+		http.Error(w, html.EscapeString(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	ok, err := executor.isFunctionPod(fnUID, podIP)
+	if err != nil {
+		logger.Error("error looking up pods of function", zap.Error(err), zap.String("function_uid", fnUID))
+		http.Error(w, "Failed to look up pods of function", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		logger.Warn("rejecting pod IP callback for pod not belonging to function",
+			zap.String("function_uid", fnUID), zap.String("pod_ip", podIP))
+		http.Error(w, "Pod IP does not belong to function", http.StatusForbidden)
+		return
+	}
+
+	et := executor.executorTypes[fv1.ExecutorTypeWasm]
+	err = et.StorePodIP(ctx, fnUID, podIP)
+	if err != nil {
+		logger.Error("error storing pod IP for function", zap.Error(err), zap.String("function_uid", fnUID))
+		http.Error(w, "Failed to store pod IP", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
 
-
 func (executor *Executor) extractQueryParamFromRequest(r *http.Request, queryParam string) string {
 	values := r.URL.Query()
 	return values.Get(queryParam)
-}
\ No newline at end of file
+}
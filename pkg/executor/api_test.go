@@ -0,0 +1,211 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	k8sCache "k8s.io/client-go/tools/cache"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/executor/client"
+	"github.com/fission/fission/pkg/executor/executortype"
+	"github.com/fission/fission/pkg/executor/fscache"
+	"github.com/fission/fission/pkg/executor/util"
+)
+
+// podIPRecorder is an ExecutorType recording the pod IPs stored through it.
+type podIPRecorder struct {
+	executortype.ExecutorType
+	podIPs map[string]string
+}
+
+func (r *podIPRecorder) StorePodIP(ctx context.Context, funcUID string, podIP string) error {
+	r.podIPs[funcUID] = podIP
+	return nil
+}
+
+// podEndpointsStub is an ExecutorType returning fixed pod endpoints.
+type podEndpointsStub struct {
+	executortype.ExecutorType
+}
+
+func (podEndpointsStub) GetPodEndpoints(ctx context.Context, fsvc *fscache.FuncSvc) ([]string, int64) {
+	return []string{"10.0.0.1:8888", "10.0.0.2:8888"}, 42
+}
+
+func TestWriteResponse(t *testing.T) {
+	executor := &Executor{logger: zap.NewNop()}
+	fsvc := &fscache.FuncSvc{
+		Function: &metav1.ObjectMeta{Name: "fn"},
+		Executor: fv1.ExecutorTypeWasm,
+		Address:  "fn-svc.fission-function:8888",
+	}
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v2/getServiceForFunction", nil)
+		req.Header.Set("Accept", client.ServiceForFunctionContentType)
+		w := httptest.NewRecorder()
+		executor.writeResponse(w, req, podEndpointsStub{}, fsvc)
+
+		if ct := w.Header().Get("Content-Type"); ct != client.ServiceForFunctionContentType {
+			t.Fatalf("expected content type %q, got %q", client.ServiceForFunctionContentType, ct)
+		}
+		svc := client.ServiceForFunction{}
+		err := json.Unmarshal(w.Body.Bytes(), &svc)
+		if err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+		expected := client.ServiceForFunction{
+			Address:         fsvc.Address,
+			PodEndpoints:    []string{"10.0.0.1:8888", "10.0.0.2:8888"},
+			ExecutorType:    fv1.ExecutorTypeWasm,
+			CacheGeneration: 42,
+			TTLSeconds:      int(podEndpointsTTL.Seconds()),
+		}
+		if !reflect.DeepEqual(svc, expected) {
+			t.Fatalf("expected %+v, got %+v", expected, svc)
+		}
+	})
+
+	t.Run("legacy", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/v2/getServiceForFunction", nil)
+		w := httptest.NewRecorder()
+		executor.writeResponse(w, req, podEndpointsStub{}, fsvc)
+
+		expected := "fn-svc.fission-function:8888,10.0.0.1:8888,10.0.0.2:8888"
+		if w.Body.String() != expected {
+			t.Fatalf("expected %q, got %q", expected, w.Body.String())
+		}
+	})
+}
+
+func TestStorePodIP(t *testing.T) {
+	const fnUID = "fn-uid"
+
+	signer := util.NewCallbackSigner([]byte("test"))
+	podIndexer := k8sCache.NewIndexer(k8sCache.MetaNamespaceKeyFunc, k8sCache.Indexers{})
+	for _, pod := range []*apiv1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "fn-pod",
+				Namespace: "fission-function",
+				Labels:    map[string]string{fv1.FUNCTION_UID: fnUID},
+			},
+			Status: apiv1.PodStatus{PodIP: "10.0.0.1"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "other-pod",
+				Namespace: "fission-function",
+			},
+			Status: apiv1.PodStatus{PodIP: "10.0.0.2"},
+		},
+	} {
+		if err := podIndexer.Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		token  string
+		body   string
+		status int
+		stored string
+	}{
+		{
+			name:   "ip and port",
+			token:  signer.Sign(fnUID),
+			body:   "10.0.0.1:8888",
+			status: http.StatusOK,
+			stored: "10.0.0.1",
+		},
+		{
+			name:   "json payload",
+			token:  signer.Sign(fnUID),
+			body:   `{"podIP": "10.0.0.1", "port": 8888}`,
+			status: http.StatusOK,
+			stored: "10.0.0.1",
+		},
+		{
+			name:   "invalid token",
+			token:  signer.Sign("other-fn-uid"),
+			body:   "10.0.0.1:8888",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "missing token",
+			body:   "10.0.0.1:8888",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "malformed ip",
+			token:  signer.Sign(fnUID),
+			body:   "not-an-ip",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid port",
+			token:  signer.Sign(fnUID),
+			body:   "10.0.0.1:70000",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "pod of another function",
+			token:  signer.Sign(fnUID),
+			body:   "10.0.0.2:8888",
+			status: http.StatusForbidden,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := &podIPRecorder{podIPs: make(map[string]string)}
+			executor := &Executor{
+				logger:         zap.NewNop(),
+				callbackSigner: signer,
+				podLister:      corelisters.NewPodLister(podIndexer),
+				executorTypes: map[fv1.ExecutorType]executortype.ExecutorType{
+					fv1.ExecutorTypeWasm: recorder,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/v2/storePodIP/"+fnUID+"?token="+test.token,
+				strings.NewReader(test.body))
+			req = mux.SetURLVars(req, map[string]string{"functionUid": fnUID})
+			w := httptest.NewRecorder()
+			executor.storePodIP(w, req)
+
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if recorder.podIPs[fnUID] != test.stored {
+				t.Fatalf("expected stored pod IP %q, got %q", test.stored, recorder.podIPs[fnUID])
+			}
+		})
+	}
+}
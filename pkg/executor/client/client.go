@@ -21,6 +21,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -50,11 +51,47 @@ type (
 		FnExecutorType fv1.ExecutorType
 		ServiceURL     string
 	}
+
+	// ServiceForFunction is the response of /v2/getServiceForFunction for
+	// clients accepting ServiceForFunctionContentType.
+	ServiceForFunction struct {
+		// Address is the host:port the function service can be reached at.
+		Address string `json:"address"`
+
+		// PodEndpoints are the host:port addresses of the function pods, set
+		// for executor types routing requests directly to function pods.
+		PodEndpoints []string `json:"podEndpoints,omitempty"`
+
+		// ExecutorType is the executor type of the function.
+		ExecutorType fv1.ExecutorType `json:"executorType"`
+
+		// CacheGeneration increases whenever the pod endpoints change, so that
+		// clients never replace cached endpoints with older ones.
+		CacheGeneration int64 `json:"cacheGeneration,omitempty"`
+
+		// TTLSeconds is how long clients should cache the response.
+		// Zero leaves it to the client.
+		TTLSeconds int `json:"ttlSeconds,omitempty"`
+	}
 )
 
+// ServiceForFunctionContentType is the content type of the versioned JSON
+// response of /v2/getServiceForFunction. Clients not accepting it get the
+// address as plain text, optionally followed by the pod endpoints separated
+// by commas.
+const ServiceForFunctionContentType = "application/vnd.fission.service-for-function.v1+json"
+
 // MakeClient initializes and returns a Client instance.
 func MakeClient(logger *zap.Logger, executorURL string) *Client {
 	hc := retryablehttp.NewClient()
+	hc.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		// The executor answers 503 once it gave up waiting for a function
+		// to become ready, retrying would only multiply the waiting time.
+		if err == nil && resp.StatusCode == http.StatusServiceUnavailable {
+			return false, nil
+		}
+		return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	}
 	c := &Client{
 		logger:      logger.Named("executor_client"),
 		executorURL: strings.TrimSuffix(executorURL, "/"),
@@ -66,37 +103,66 @@ func MakeClient(logger *zap.Logger, executorURL string) *Client {
 	return c
 }
 
-// GetServiceForFunction returns the service name for a given function.
-func (c *Client) GetServiceForFunction(ctx context.Context, fn *fv1.Function) (string, error) {
+// GetServiceForFunction returns the service of a given function. Responses
+// of executors not serving ServiceForFunctionContentType yet, e.g. during a
+// rolling upgrade, are parsed from the plain text format.
+func (c *Client) GetServiceForFunction(ctx context.Context, fn *fv1.Function) (*ServiceForFunction, error) {
 	executorURL := c.executorURL + "/v2/getServiceForFunction"
 
 	body, err := json.Marshal(fn)
 	if err != nil {
-		return "", errors.Wrap(err, "could not marshal request body for getting service for function")
+		return nil, errors.Wrap(err, "could not marshal request body for getting service for function")
 	}
 
 	req, err := retryablehttp.NewRequestWithContext(ctx, "POST", executorURL, bytes.NewReader(body))
 	if err != nil {
-		return "", errors.Wrap(err, "could not create request for getting service for function")
+		return nil, errors.Wrap(err, "could not create request for getting service for function")
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", ServiceForFunctionContentType)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", errors.Wrap(err, "error posting to getting service for function")
+		return nil, errors.Wrap(err, "error posting to getting service for function")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", ferror.MakeErrorFromHTTP(resp)
+		return nil, ferror.MakeErrorFromHTTP(resp)
 	}
 
-	svcName, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", errors.Wrap(err, "error reading response body from getting service for function")
+		return nil, errors.Wrap(err, "error reading response body from getting service for function")
 	}
 
-	return string(svcName), nil
+	if resp.Header.Get("Content-Type") != ServiceForFunctionContentType {
+		return ParseServiceForFunction(string(respBody), fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType), nil
+	}
+
+	svc := &ServiceForFunction{}
+	err = json.Unmarshal(respBody, svc)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding response body from getting service for function")
+	}
+	return svc, nil
+}
+
+// ParseServiceForFunction parses the plain text response of
+// /v2/getServiceForFunction, the service address optionally followed by
+// the pod endpoints separated by commas.
+func ParseServiceForFunction(address string, executorType fv1.ExecutorType) *ServiceForFunction {
+	result := strings.Split(address, ",")
+	svc := &ServiceForFunction{
+		Address:      result[0],
+		ExecutorType: executorType,
+	}
+	for _, endpoint := range result[1:] {
+		if len(endpoint) > 0 {
+			svc.PodEndpoints = append(svc.PodEndpoints, endpoint)
+		}
+	}
+	return svc
 }
 
 // UnTapService sends a request to /v2/unTapService.
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+)
+
+func TestGetServiceForFunction(t *testing.T) {
+	fn := &fv1.Function{}
+	fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType = fv1.ExecutorTypeWasm
+
+	for _, test := range []struct {
+		name        string
+		contentType string
+		body        string
+		expected    *ServiceForFunction
+	}{
+		{
+			name:        "json",
+			contentType: ServiceForFunctionContentType,
+			body:        `{"address":"svc.ns:8888","podEndpoints":["10.0.0.1:8888","10.0.0.2:8888"],"executorType":"wasm","cacheGeneration":42,"ttlSeconds":30}`,
+			expected: &ServiceForFunction{
+				Address:         "svc.ns:8888",
+				PodEndpoints:    []string{"10.0.0.1:8888", "10.0.0.2:8888"},
+				ExecutorType:    fv1.ExecutorTypeWasm,
+				CacheGeneration: 42,
+				TTLSeconds:      30,
+			},
+		},
+		{
+			name:        "legacy with pod endpoints",
+			contentType: "text/plain; charset=utf-8",
+			body:        "svc.ns:8888,10.0.0.1:8888,10.0.0.2:8888",
+			expected: &ServiceForFunction{
+				Address:      "svc.ns:8888",
+				PodEndpoints: []string{"10.0.0.1:8888", "10.0.0.2:8888"},
+				ExecutorType: fv1.ExecutorTypeWasm,
+			},
+		},
+		{
+			name:        "legacy address only",
+			contentType: "text/plain; charset=utf-8",
+			body:        "svc.ns:8888",
+			expected: &ServiceForFunction{
+				Address:      "svc.ns:8888",
+				ExecutorType: fv1.ExecutorTypeWasm,
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Accept") != ServiceForFunctionContentType {
+					t.Errorf("expected Accept %q, got %q", ServiceForFunctionContentType, r.Header.Get("Accept"))
+				}
+				w.Header().Set("Content-Type", test.contentType)
+				w.Write([]byte(test.body)) //nolint: errcheck
+			}))
+			defer server.Close()
+
+			c := MakeClient(zap.NewNop(), server.URL)
+			svc, err := c.GetServiceForFunction(context.Background(), fn)
+			if err != nil {
+				t.Fatalf("error getting service for function: %v", err)
+			}
+			if !reflect.DeepEqual(svc, test.expected) {
+				t.Fatalf("expected %+v, got %+v", test.expected, svc)
+			}
+		})
+	}
+}
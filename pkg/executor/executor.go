@@ -30,6 +30,8 @@ import (
 	"go.uber.org/zap"
 	apiv1 "k8s.io/api/core/v1"
 	k8sInformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	k8sCache "k8s.io/client-go/tools/cache"
 
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
@@ -46,6 +48,7 @@ import (
 	fetcherConfig "github.com/fission/fission/pkg/fetcher/config"
 	"github.com/fission/fission/pkg/generated/clientset/versioned"
 	genInformer "github.com/fission/fission/pkg/generated/informers/externalversions"
+	flisterv1 "github.com/fission/fission/pkg/generated/listers/core/v1"
 	"github.com/fission/fission/pkg/utils"
 	"github.com/fission/fission/pkg/utils/metrics"
 	otelUtils "github.com/fission/fission/pkg/utils/otel"
@@ -59,7 +62,17 @@ type (
 		executorTypes map[fv1.ExecutorType]executortype.ExecutorType
 		cms           *cms.ConfigSecretController
 
-		fissionClient versioned.Interface
+		fissionClient    versioned.Interface
+		kubernetesClient kubernetes.Interface
+
+		// callbackSigner verifies the tokens of callbacks made by function pods.
+		callbackSigner *util.CallbackSigner
+		// podLister lists the pods of wasm functions callbacks are checked against.
+		podLister corelisters.PodLister
+		// funcLister gets the functions usage reports are checked against.
+		funcLister flisterv1.FunctionLister
+		// wasmUsage records the usage of invocations of wasm functions.
+		wasmUsage *wasmUsageStore
 
 		requestChan chan *createFuncServiceRequest
 		fsCreateWg  sync.Map
@@ -79,13 +92,21 @@ type (
 
 // MakeExecutor returns an Executor for given ExecutorType(s).
 func MakeExecutor(ctx context.Context, logger *zap.Logger, cms *cms.ConfigSecretController,
-	fissionClient versioned.Interface, types map[fv1.ExecutorType]executortype.ExecutorType,
+	fissionClient versioned.Interface, kubernetesClient kubernetes.Interface,
+	callbackSigner *util.CallbackSigner, podLister corelisters.PodLister,
+	funcLister flisterv1.FunctionLister,
+	types map[fv1.ExecutorType]executortype.ExecutorType,
 	informers []k8sCache.SharedIndexInformer) (*Executor, error) {
 	executor := &Executor{
-		logger:        logger.Named("executor"),
-		cms:           cms,
-		fissionClient: fissionClient,
-		executorTypes: types,
+		logger:           logger.Named("executor"),
+		cms:              cms,
+		fissionClient:    fissionClient,
+		kubernetesClient: kubernetesClient,
+		callbackSigner:   callbackSigner,
+		podLister:        podLister,
+		funcLister:       funcLister,
+		wasmUsage:        makeWasmUsageStore(),
+		executorTypes:    types,
 
 		requestChan: make(chan *createFuncServiceRequest),
 	}
@@ -272,6 +293,11 @@ func StartExecutor(ctx context.Context, logger *zap.Logger, functionNamespace st
 
 	executorInstanceID := strings.ToLower(uniuri.NewLen(8))
 
+	callbackSigner, err := util.MakeCallbackSigner()
+	if err != nil {
+		return errors.Wrap(err, "error making callback signer")
+	}
+
 	var podSpecPatch *apiv1.PodSpec
 	namespace, err := utils.GetCurrentNamespace()
 	if err != nil {
@@ -344,11 +370,12 @@ func StartExecutor(ctx context.Context, logger *zap.Logger, functionNamespace st
 	}
 	wasmDeplnformer := wasmInformerFactory.Apps().V1().Deployments()
 	wasmSvcInformer := wasmInformerFactory.Core().V1().Services()
+	wasmPodInformer := wasmInformerFactory.Core().V1().Pods()
 	wsm, err := wasm.MakeWasm(
 		ctx, logger,
 		fissionClient, kubernetesClient,
-		functionNamespace, executorInstanceID, funcInformer,
-		wasmDeplnformer, wasmSvcInformer)
+		functionNamespace, executorInstanceID, funcInformer, envInformer,
+		wasmDeplnformer, wasmSvcInformer, wasmPodInformer, callbackSigner)
 	if err != nil {
 		return errors.Wrap(err, "wasm manager creation failed")
 	}
@@ -383,7 +410,8 @@ func StartExecutor(ctx context.Context, logger *zap.Logger, functionNamespace st
 
 	cms := cms.MakeConfigSecretController(ctx, logger, fissionClient, kubernetesClient, executorTypes, configmapInformer, secretInformer)
 
-	api, err := MakeExecutor(ctx, logger, cms, fissionClient, executorTypes,
+	api, err := MakeExecutor(ctx, logger, cms, fissionClient, kubernetesClient,
+		callbackSigner, wasmPodInformer.Lister(), funcInformer.Lister(), executorTypes,
 		[]k8sCache.SharedIndexInformer{
 			funcInformer.Informer(),
 			pkgInformer.Informer(),
@@ -398,10 +426,12 @@ func StartExecutor(ctx context.Context, logger *zap.Logger, functionNamespace st
 			cnmSvcInformer.Informer(),
 			wasmDeplnformer.Informer(),
 			wasmSvcInformer.Informer(),
+			wasmPodInformer.Informer(),
 		})
 	if err != nil {
 		return err
 	}
+	funcInformer.Informer().AddEventHandler(api.wasmUsageEventHandlers())
 	go reaper.CleanupRoleBindings(ctx, logger, kubernetesClient, fissionClient, functionNamespace, envBuilderNamespace, time.Minute*30)
 	go metrics.ServeMetrics(ctx, logger)
 	go api.Serve(ctx, port)
@@ -784,4 +784,8 @@ func getDeploymentObj(kubeobjs []apiv1.ObjectReference) *apiv1.ObjectReference {
 
 func (caaf *Container) StorePodIP(ctx context.Context, funcUID string,PodIP string) error {
 	return nil
-}
\ No newline at end of file
+}
+
+func (caaf *Container) GetPodEndpoints(ctx context.Context, fsvc *fscache.FuncSvc) ([]string, int64) {
+	return nil, 0
+}
@@ -66,4 +66,9 @@ type ExecutorType interface {
 
 	// StorePodIP  provides ways for basement to store function PODIP when it's first time to use
 	StorePodIP(ctx context.Context, funcUID string,PodIP string) error
+
+	// GetPodEndpoints returns the addresses of the pods of a function service for
+	// executor types routing requests directly to function pods, nil otherwise.
+	// The generation returned along increases whenever the addresses change.
+	GetPodEndpoints(ctx context.Context, fsvc *fscache.FuncSvc) (endpoints []string, generation int64)
 }
@@ -888,4 +888,8 @@ func (deploy *NewDeploy) scaleDeployment(ctx context.Context, deplNS string, dep
 
 func (deploy *NewDeploy) StorePodIP(ctx context.Context, funcUID string,PodIP string) error {
 	return nil
-}
\ No newline at end of file
+}
+
+func (deploy *NewDeploy) GetPodEndpoints(ctx context.Context, fsvc *fscache.FuncSvc) ([]string, int64) {
+	return nil, 0
+}
@@ -756,4 +756,8 @@ func (gpm *GenericPoolManager) NoActiveConnectionEventChecker(kubeClient kuberne
 
 func (gpm *GenericPoolManager) StorePodIP(ctx context.Context, funcUID string,PodIP string) error {
 	return nil
-}
\ No newline at end of file
+}
+
+func (gpm *GenericPoolManager) GetPodEndpoints(ctx context.Context, fsvc *fscache.FuncSvc) ([]string, int64) {
+	return nil, 0
+}
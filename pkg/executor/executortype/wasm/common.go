@@ -2,10 +2,15 @@ package wasm
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	multierror "github.com/hashicorp/go-multierror"
 	"go.uber.org/zap"
+	asv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	apiv1 "k8s.io/api/core/v1"
 	k8s_err "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -13,8 +18,45 @@ import (
 	"k8s.io/client-go/kubernetes"
 
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	hpautils "github.com/fission/fission/pkg/executor/util/hpa"
 )
 
+const (
+	// defaultTargetCPUPercent is the CPU utilization the HPA of a wasm
+	// function aims for when the function configures no metric.
+	defaultTargetCPUPercent = 80
+
+	// defaultScaleDownStabilizationSeconds is much shorter than the
+	// Kubernetes default of 5 minutes, since wasm runtimes start within
+	// milliseconds and scaling out again is cheap.
+	defaultScaleDownStabilizationSeconds = 60
+
+	// sharedSecretPath and sharedCfgMapPath are the directories the secrets
+	// and configmaps of a function are mounted under, laid out the same way
+	// fetcher lays them out for the other executor types, so that a WASI
+	// runtime can preopen them.
+	sharedSecretPath = "/secrets"
+	sharedCfgMapPath = "/configs"
+)
+
+// getExecutionStrategy returns the execution strategy of the function with
+// defaults suitable for wasm functions filled in for autoscaling.
+func getExecutionStrategy(fn *fv1.Function) *fv1.ExecutionStrategy {
+	strategy := fn.Spec.InvokeStrategy.ExecutionStrategy.DeepCopy()
+	if strategy.TargetCPUPercent == 0 && len(strategy.Metrics) == 0 { // nolint: staticcheck
+		strategy.Metrics = []asv2beta2.MetricSpec{hpautils.ConvertTargetCPUToCustomMetric(defaultTargetCPUPercent)}
+	}
+	if strategy.Behavior == nil {
+		window := int32(defaultScaleDownStabilizationSeconds)
+		strategy.Behavior = &asv2beta2.HorizontalPodAutoscalerBehavior{
+			ScaleDown: &asv2beta2.HPAScalingRules{
+				StabilizationWindowSeconds: &window,
+			},
+		}
+	}
+	return strategy
+}
+
 // getResources gets the resources(CPU, memory) set for the function
 func (wasm *Wasm) getResources(fn *fv1.Function) apiv1.ResourceRequirements {
 	resources := fn.Spec.Resources
@@ -48,6 +90,98 @@ func (wasm *Wasm) getResources(fn *fv1.Function) apiv1.ResourceRequirements {
 	return resources
 }
 
+// getSecretConfigVolumes returns the volumes and read-only mounts exposing
+// the secrets and configmaps of the function as files at
+// /secrets/<namespace>/<name> and /configs/<namespace>/<name>.
+func getSecretConfigVolumes(fn *fv1.Function) ([]apiv1.Volume, []apiv1.VolumeMount) {
+	volumes := make([]apiv1.Volume, 0, len(fn.Spec.Secrets)+len(fn.Spec.ConfigMaps))
+	mounts := make([]apiv1.VolumeMount, 0, len(fn.Spec.Secrets)+len(fn.Spec.ConfigMaps))
+
+	for i, secret := range fn.Spec.Secrets {
+		name := fmt.Sprintf("fission-secret-%d", i)
+		volumes = append(volumes, apiv1.Volume{
+			Name: name,
+			VolumeSource: apiv1.VolumeSource{
+				Secret: &apiv1.SecretVolumeSource{SecretName: secret.Name},
+			},
+		})
+		mounts = append(mounts, apiv1.VolumeMount{
+			Name:      name,
+			MountPath: filepath.Join(sharedSecretPath, secret.Namespace, secret.Name),
+			ReadOnly:  true,
+		})
+	}
+
+	for i, cfgmap := range fn.Spec.ConfigMaps {
+		name := fmt.Sprintf("fission-configmap-%d", i)
+		volumes = append(volumes, apiv1.Volume{
+			Name: name,
+			VolumeSource: apiv1.VolumeSource{
+				ConfigMap: &apiv1.ConfigMapVolumeSource{
+					LocalObjectReference: apiv1.LocalObjectReference{Name: cfgmap.Name},
+				},
+			},
+		})
+		mounts = append(mounts, apiv1.VolumeMount{
+			Name:      name,
+			MountPath: filepath.Join(sharedCfgMapPath, cfgmap.Namespace, cfgmap.Name),
+			ReadOnly:  true,
+		})
+	}
+
+	return volumes, mounts
+}
+
+// getWasmAnnotations returns the pod annotations the wasm runtime reads the
+// WasmSpec of the function from.
+func getWasmAnnotations(ws *fv1.WasmSpec) map[string]string {
+	annotations := make(map[string]string)
+	if len(ws.Module.URL) > 0 {
+		annotations[fv1.ANNOTATION_WASM_MODULE_URL] = ws.Module.URL
+	}
+	if len(ws.Module.Filename) > 0 {
+		annotations[fv1.ANNOTATION_WASM_MODULE_FILENAME] = ws.Module.Filename
+	}
+	if len(ws.Entrypoint) > 0 {
+		annotations[fv1.ANNOTATION_WASM_ENTRYPOINT] = ws.Entrypoint
+	}
+	if len(ws.Engine) > 0 {
+		annotations[fv1.ANNOTATION_WASM_ENGINE] = string(ws.Engine)
+	}
+	if len(ws.PreopenDirs) > 0 {
+		preopens := make([]string, 0, len(ws.PreopenDirs))
+		for _, dir := range ws.PreopenDirs {
+			guestPath := dir.GuestPath
+			if len(guestPath) == 0 {
+				guestPath = dir.Path
+			}
+			preopen := dir.Path + ":" + guestPath
+			if dir.ReadOnly {
+				preopen += ":ro"
+			}
+			preopens = append(preopens, preopen)
+		}
+		annotations[fv1.ANNOTATION_WASM_PREOPENS] = strings.Join(preopens, ",")
+	}
+	if ws.MaxMemory != nil {
+		annotations[fv1.ANNOTATION_WASM_MAX_MEMORY] = strconv.FormatInt(ws.MaxMemory.Value(), 10)
+	}
+	if ws.Fuel > 0 {
+		annotations[fv1.ANNOTATION_WASM_FUEL] = strconv.FormatInt(ws.Fuel, 10)
+	}
+	return annotations
+}
+
+// getWasmEnv returns the WASI environment variables of the function as
+// container environment variables, which the wasm runtime passes on.
+func getWasmEnv(ws *fv1.WasmSpec) []apiv1.EnvVar {
+	env := make([]apiv1.EnvVar, 0, len(ws.Env))
+	for _, e := range ws.Env {
+		env = append(env, apiv1.EnvVar{Name: e.Name, Value: e.Value})
+	}
+	return env
+}
+
 // cleanupWasm cleans all kubernetes objects related to function
 func (wasm *Wasm) cleanupWasm(ctx context.Context, ns string, name string) error {
 	result := &multierror.Error{}
@@ -135,3 +269,25 @@ func referencedResourcesRVSum(ctx context.Context, client kubernetes.Interface,
 
 	return rvCount, nil
 }
+
+// getRVCountPatch returns a strategic merge patch setting the resource
+// version count in the environment of the function container, which is
+// named after the function.
+func getRVCountPatch(containerName string, rvCount int) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []map[string]interface{}{
+						{
+							"name": containerName,
+							"env": []apiv1.EnvVar{
+								{Name: fv1.ResourceVersionCount, Value: strconv.Itoa(rvCount)},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+}
@@ -3,7 +3,9 @@ package wasm
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
+	"sort"
 	"time"
 
 	"go.uber.org/zap"
@@ -12,19 +14,19 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	k8s_err "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/intstr"
 
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	ferror "github.com/fission/fission/pkg/error"
 	"github.com/fission/fission/pkg/executor/util"
-
-	// "github.com/fission/fission/pkg/utils"
+	"github.com/fission/fission/pkg/utils"
 	otelUtils "github.com/fission/fission/pkg/utils/otel"
-	// "k8s.io/apimachinery/pkg/watch"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 )
 
-func (wasm *Wasm) createOrGetDeployment(ctx context.Context, fn *fv1.Function, deployName string, deployLabels map[string]string, deployAnnotations map[string]string, deployNamespace string) (*appsv1.Deployment, string,error) {
+func (wasm *Wasm) createOrGetDeployment(ctx context.Context, fn *fv1.Function, deployName string, deployLabels map[string]string, deployAnnotations map[string]string, deployNamespace string) (*appsv1.Deployment, error) {
 	logger := otelUtils.LoggerWithTraceID(ctx, wasm.logger)
-    var podIP string
 	// The specializationTimeout here refers to the creation of the pod and not the loading of function
 	// as in other executors.
 	specializationTimeout := fn.Spec.InvokeStrategy.ExecutionStrategy.SpecializationTimeout
@@ -39,16 +41,16 @@ func (wasm *Wasm) createOrGetDeployment(ctx context.Context, fn *fv1.Function, d
 
 	deployment, err := wasm.getDeploymentSpec(ctx, fn, &minScale, deployName, deployNamespace, deployLabels, deployAnnotations)
 	if err != nil {
-		return nil, podIP,err
+		return nil, err
 	}
 	existingDepl, err := wasm.kubernetesClient.AppsV1().Deployments(deployNamespace).Get(ctx, deployName, metav1.GetOptions{})
 	if err != nil && !k8s_err.IsNotFound(err) {
-		return nil, podIP,err
+		return nil, err
 	}
 
 	// Create new deployment if one does not previously exist
 	if k8s_err.IsNotFound(err) {
-		wasm.logger.Info("******k8s创建deployment")
+		wasm.logger.Debug("creating deployment", zap.String("deployment", deployName), zap.String("namespace", deployNamespace))
 		depl, err := wasm.kubernetesClient.AppsV1().Deployments(deployNamespace).Create(ctx, deployment, metav1.CreateOptions{})
 		if err != nil {
 			if k8s_err.IsAlreadyExists(err) {
@@ -60,21 +62,15 @@ func (wasm *Wasm) createOrGetDeployment(ctx context.Context, fn *fv1.Function, d
 					zap.String("function", fn.ObjectMeta.Name),
 					zap.String("deployment_name", deployName),
 					zap.String("deployment_namespace", deployNamespace))
-				return nil, podIP,err
+				return nil, err
 			}
 		}
 		otelUtils.SpanTrackEvent(ctx, "deploymentCreated", otelUtils.GetAttributesForDeployment(depl)...)
-		// 一下在实际工作中要使用！！！
-		// if minScale > 0 {
-		// 	depl, err = wasm.waitForDeploy(ctx, depl, minScale, specializationTimeout)
-		// }
-		podIP,err=wasm.waitForPodIP(ctx,string(fn.UID))
-		if err!=nil{
-			wasm.logger.Error("error getting podIP ", zap.Error(err), zap.String("podIP", podIP))
-			return depl,podIP, err
+		_, err = wasm.waitForPodIPs(ctx, fn)
+		if err != nil {
+			return nil, err
 		}
-
-		return depl, podIP,err
+		return depl, nil
 	}
 
 	// Try to adopt orphan deployment created by the old executor.
@@ -91,24 +87,31 @@ func (wasm *Wasm) createOrGetDeployment(ctx context.Context, fn *fv1.Function, d
 		if err != nil {
 			logger.Warn("error adopting cn", zap.Error(err),
 				zap.String("cn", deployName), zap.String("ns", deployNamespace))
-			return nil, podIP,err
+			return nil, err
 		}
 		// In this case, we just return without waiting for it for fast bootstraping.
-		return existingDepl, podIP,nil
+		return existingDepl, nil
 	}
 
 	if *existingDepl.Spec.Replicas < minScale {
 		err = wasm.scaleDeployment(ctx, existingDepl.Namespace, existingDepl.Name, minScale)
 		if err != nil {
 			logger.Error("error scaling up function deployment", zap.Error(err), zap.String("function", fn.ObjectMeta.Name))
-			return nil, podIP,err
+			return nil, err
 		}
 	}
 	if existingDepl.Status.AvailableReplicas < minScale {
 		existingDepl, err = wasm.waitForDeploy(ctx, existingDepl, minScale, specializationTimeout)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return existingDepl, podIP,err
+	_, err = wasm.waitForPodIPs(ctx, fn)
+	if err != nil {
+		return nil, err
+	}
+	return existingDepl, nil
 }
 
 func (wasm *Wasm) updateDeployment(ctx context.Context, deployment *appsv1.Deployment, ns string) error {
@@ -187,9 +190,6 @@ func (wasm *Wasm) getDeploymentSpec(ctx context.Context, fn *fv1.Function, targe
 		podLabels[k] = v
 	}
 
-
-    
-
 	// Set maxUnavailable and maxSurge to 20% is because we want
 	// fission to rollout newer function version gradually without
 	// affecting any online service. For example, if you set maxSurge
@@ -207,13 +207,15 @@ func (wasm *Wasm) getDeploymentSpec(ctx context.Context, fn *fv1.Function, targe
 	// rollback, set RevisionHistoryLimit to 0 to disable this feature.
 	revisionHistoryLimit := int32(0)
 
-	// resources := wasm.getResources(fn)
+	resources := wasm.getResources(fn)
 
-	// // Other executor types rely on Environments to add configmaps and secrets
-	// envFromSources, err := util.ConvertConfigSecrets(ctx, fn, wasm.kubernetesClient)
-	// if err != nil {
-	// 	return nil, err
-	// }
+	// Other executor types rely on Environments to add configmaps and secrets.
+	// Wasm functions get them both as environment variables and as files.
+	envFromSources, err := util.ConvertConfigSecrets(ctx, fn, wasm.kubernetesClient)
+	if err != nil {
+		return nil, err
+	}
+	volumes, volumeMounts := getSecretConfigVolumes(fn)
 
 	rvCount, err := referencedResourcesRVSum(ctx, wasm.kubernetesClient, fn.ObjectMeta.Namespace, fn.Spec.Secrets, fn.Spec.ConfigMaps)
 	if err != nil {
@@ -244,20 +246,57 @@ func (wasm *Wasm) getDeploymentSpec(ctx context.Context, fn *fv1.Function, targe
 				Value: fmt.Sprintf("%v", rvCount),
 			},
 		},
-		// EnvFrom: envFromSources,
+		EnvFrom:      envFromSources,
+		VolumeMounts: volumeMounts,
 		// https://istio.io/docs/setup/kubernetes/additional-setup/requirements/
-		// Resources: resources,
+		Resources: resources,
+	}
+	if fn.Spec.Wasm != nil {
+		for k, v := range getWasmAnnotations(fn.Spec.Wasm) {
+			podAnnotations[k] = v
+		}
+		container.Env = append(container.Env, getWasmEnv(fn.Spec.Wasm)...)
+		container.Args = fn.Spec.Wasm.Args
 	}
-	runtimeClass:="wasm"
+	container.Env = append(container.Env, wasm.getModuleCacheEnv()...)
+	container.Env = append(container.Env, wasm.getUsageReportEnv(fn)...)
+
+	runtimeClass := "wasm"
 	podSpec, err := util.MergePodSpec(&apiv1.PodSpec{
-		RuntimeClassName:                              &runtimeClass,
+		RuntimeClassName:              &runtimeClass,
 		Containers:                    []apiv1.Container{*container},
+		Volumes:                       volumes,
 		TerminationGracePeriodSeconds: &gracePeriodSeconds,
 	}, fn.Spec.PodSpec)
-	
+
+	if err != nil {
+		return nil, err
+	}
+
+	module, err := wasm.resolveModule(ctx, fn)
 	if err != nil {
 		return nil, err
 	}
+	// the runtime class pulls modules published as OCI artifacts by the
+	// digest pinned in the package
+	if len(module.image) > 0 {
+		podAnnotations[fv1.ANNOTATION_WASM_MODULE_OCI] = module.image
+		for i := range podSpec.Containers {
+			if podSpec.Containers[i].Name == fn.ObjectMeta.Name {
+				podSpec.Containers[i].Image = module.image
+			}
+		}
+	}
+	if len(module.sha256) > 0 {
+		podAnnotations[fv1.ANNOTATION_WASM_MODULE_SHA256] = module.sha256
+	}
+	if len(module.variants) > 0 {
+		podAnnotations[fv1.ANNOTATION_WASM_MODULE_VARIANTS], err = wasmmodule.EncodeVariants(module.variants)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	pod := apiv1.PodTemplateSpec{
 		ObjectMeta: metav1.ObjectMeta{
 			Labels:      podLabels,
@@ -311,97 +350,91 @@ func (wasm *Wasm) scaleDeployment(ctx context.Context, deplNS string, deplName s
 	return err
 }
 
+// waitForPodIPs blocks until the address of at least one pod of the function
+// is known and returns the IPs of all pods known so far. The wasm runtime
+// reports its address through the storePodIP callback, which wakes up the
+// waiter; ready pods seen by the pod informer are used as well in case the
+// callback never arrives. If neither source reports an address within the
+// function's specialization timeout, an error with ErrorServiceUnavailable
+// is returned so that the router can answer with 503.
+func (wasm *Wasm) waitForPodIPs(ctx context.Context, fn *fv1.Function) ([]string, error) {
+	logger := otelUtils.LoggerWithTraceID(ctx, wasm.logger)
+	uid := string(fn.ObjectMeta.UID)
 
-// func (wasm *Wasm) waitForPodIP(ctx context.Context, depl *appsv1.Deployment) (podIP string, err error) {
-// 	// 监听Pod变化
-// 	watcher, err := wasm.kubernetesClient.CoreV1().Pods(depl.Namespace).Watch(context.TODO(), metav1.ListOptions{
-// 		LabelSelector: metav1.FormatLabelSelector(depl.Spec.Selector),
-// 	})
-// 	if err != nil {
-// 		if utils.IsNetworkError(err) {
-// 			wasm.logger.Error("encountered network error, retrying later", zap.Error(err))
-// 			time.Sleep(5 * time.Second)
-// 		}
-// 		wasm.logger.Fatal("error watching pod list", zap.Error(err))
-// 	}
-
-// 	// 监听Pod事件
-// 	for {
-// 		pod, ok  := <-watcher.ResultChan() 
-// 		// := event.Object.(*apiv1.Pod)
-// 		if !ok {
-// 			continue
-// 		}
-		
-// 		if pod.Type==watch.Added {
-// 			wasm.logger.Info("************有新增pod事件**************")
-// 			podIP,err=wasm.sync(depl)
-// 			return podIP,err
-// 		}
-
-// 	}
-	
-// }
-
-// func (wasm *Wasm) sync(depl *appsv1.Deployment)(string,error){
-// 	maxRetries := 30
-// 	for i := 0; i < maxRetries; i++ {
-// 		podList, err := wasm.kubernetesClient.CoreV1().Pods(depl.Namespace).List(context.TODO(), metav1.ListOptions{
-// 			LabelSelector: metav1.FormatLabelSelector(depl.Spec.Selector),})
-// 		if err != nil {
-// 			wasm.logger.Fatal("error syncing new pod resources", zap.Error(err))
-// 			return "",err
-// 		}
-
-// 		// Create environment builders for all environments
-// 		for i := range podList.Items {
-// 			pod := podList.Items[i]
-// 			if pod.Status.PodIP!= ""{
-// 				wasm.logger.Info("***********成功拿到PodIP**********",zap.String("PodIP",pod.Status.PodIP))
-// 				return pod.Status.PodIP,nil
-// 			}
-// 		}
-// 		time.Sleep(50 * time.Millisecond)
-// 	}
-//   return "",nil
-
-// }
-
-func (wasm *Wasm) waitForPodIP(ctx context.Context,uid string) (podIP string, err error) {
-    //异步等待通道中获取podip的消息
-	// select {
-	// 	case data:= <-wasm.fnchannel[uid]:
-	// 		//从本地podip的cache中取podip
-	// 		if data==true{
-	// 			podIP,err=wasm.fpmap.lookup(uid)
-	// 			if err!=nil{
-	// 				wasm.logger.Fatal("error getting podip from cache", zap.Error(err))
-	// 			}
-	// 			wasm.logger.Info("***********成功拿到PodIP**********",zap.String("PodIP",podIP))
-	// 			close(wasm.fnchannel[uid])
-	// 			return podIP,err
-	// 		}
-	// 	case <-time.After(300 * time.Millisecond):
-	// 		wasm.logger.Fatal("********超时300ms,未拿到podIP*******")
-	// 		return "",nil
-	// }
-	
-    for {
-		if podIP,err=wasm.fpmap.lookup(uid);err!=nil{
-			continue
-		}else{
-			wasm.logger.Info("******getServiceForFunction拿到PODIP可以返回*********")
-			return podIP,err
+	// if no specializationTimeout is set, use default value
+	specializationTimeout := fn.Spec.InvokeStrategy.ExecutionStrategy.SpecializationTimeout
+	if specializationTimeout < fv1.DefaultSpecializationTimeOut {
+		specializationTimeout = fv1.DefaultSpecializationTimeOut
+	}
+	timer := time.NewTimer(time.Duration(specializationTimeout) * time.Second)
+	defer timer.Stop()
+
+	otelUtils.SpanTrackEvent(ctx, "waitForPodIP", otelUtils.GetAttributesForFunction(fn)...)
+
+	for {
+		// register before looking up, so that a notification arriving
+		// between the lookup and the select is not lost.
+		ch := wasm.podIPWaiter.register(uid)
+		podIPs, err := wasm.lookupPodIPs(fn)
+		if err == nil {
+			wasm.podIPWaiter.unregister(uid, ch)
+			otelUtils.SpanTrackEvent(ctx, "podIPReceived", otelUtils.GetAttributesForFunction(fn)...)
+			return podIPs, nil
+		}
+
+		select {
+		case <-ch:
+		case <-timer.C:
+			wasm.podIPWaiter.unregister(uid, ch)
+			logger.Error("pod address of function not reported within timeout window",
+				zap.String("function_name", fn.ObjectMeta.Name),
+				zap.String("function_namespace", fn.ObjectMeta.Namespace),
+				zap.Int("timeout", specializationTimeout))
+			return nil, ferror.MakeError(ferror.ErrorServiceUnavailable,
+				fmt.Sprintf("function %s/%s did not become ready within the specialization timeout of %d seconds",
+					fn.ObjectMeta.Namespace, fn.ObjectMeta.Name, specializationTimeout))
+		case <-ctx.Done():
+			wasm.podIPWaiter.unregister(uid, ch)
+			return nil, ctx.Err()
 		}
-		
 	}
 }
 
+// lookupPodIPs returns the pod IPs of the function reported by the wasm
+// runtimes or the pod informer. If none is known yet, e.g. after the function
+// was scaled down while idle, the IPs of the ready pods of the function in
+// the pod lister are remembered and returned instead.
+func (wasm *Wasm) lookupPodIPs(fn *fv1.Function) ([]string, error) {
+	uid := string(fn.ObjectMeta.UID)
+	podIPs, err := wasm.fpmap.lookup(uid)
+	if err == nil {
+		return podIPs, nil
+	}
 
-func (wasm *Wasm) getStoreURL(uid string)(url string){
-	ip:= os.Getenv("MASTER_IP")
-	port:= os.Getenv("NODE_PORT")
-	Url := fmt.Sprintf("http://%v:%v/v2/storePodIP/%v",ip,port,uid)
-	wasm.logger.Info("***********StoreURL构建成功!**********",zap.String("StoreUrl",Url))
-    return Url
-}
\ No newline at end of file
+	pods, err := wasm.podLister.List(labels.Set{fv1.FUNCTION_UID: uid}.AsSelector())
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		if utils.IsReadyPod(pod) && len(pod.Status.PodIP) > 0 {
+			wasm.fpmap.assign(uid, pod.Status.PodIP)
+			podIPs = append(podIPs, pod.Status.PodIP)
+		}
+	}
+	if len(podIPs) == 0 {
+		return nil, ferror.MakeError(ferror.ErrorNotFound, fmt.Sprintf("no pod address known for function %v", uid))
+	}
+	sort.Strings(podIPs)
+	return podIPs, nil
+}
+
+// getStoreURL returns the URL wasm runtime pods of the function report their
+// pod IP to. The URL carries a token signed for the function, so that only
+// pods handed the URL are able to update the pod IP of the function.
+func (wasm *Wasm) getStoreURL(uid string) string {
+	ip := os.Getenv("MASTER_IP")
+	port := os.Getenv("NODE_PORT")
+	query := url.Values{}
+	query.Set("token", wasm.callbackSigner.Sign(uid))
+	return fmt.Sprintf("http://%v:%v/v2/storePodIP/%v?%v", ip, port, uid, query.Encode())
+}
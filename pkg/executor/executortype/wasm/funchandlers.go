@@ -4,11 +4,17 @@ import (
 	"context"
 
 	"go.uber.org/zap"
+	apiv1 "k8s.io/api/core/v1"
 	k8sCache "k8s.io/client-go/tools/cache"
 
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/utils"
 )
 
+func isWasmFunction(fn *fv1.Function) bool {
+	return fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType == fv1.ExecutorTypeWasm
+}
+
 func (wasm *Wasm) FuncInformerHandler(ctx context.Context) k8sCache.ResourceEventHandlerFuncs {
 	return k8sCache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
@@ -47,25 +53,96 @@ func (wasm *Wasm) FuncInformerHandler(ctx context.Context) k8sCache.ResourceEven
 			}()
 		},
 		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
-			// oldFn := oldObj.(*fv1.Function)
-			// newFn := newObj.(*fv1.Function)
-			// fnExecutorType := oldFn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType
-			// if fnExecutorType != "" && fnExecutorType != fv1.ExecutorTypeWasm {
-			// 	return
-			// }
-			// go func() {
-			// 	log := wasm.logger.With(zap.String("function_name", newFn.ObjectMeta.Name),
-			// 		zap.String("function_namespace", newFn.ObjectMeta.Namespace),
-			// 		zap.String("old_function_name", oldFn.ObjectMeta.Name))
-			// 	log.Debug("start function update handler")
-			// 	err := wasm.updateFunction(ctx, oldFn, newFn)
-			// 	if err != nil {
-			// 		log.Error("error updating function",
-			// 			zap.Error(err))
-			// 	}
-			// 	log.Debug("end function update handler")
+			oldFn := oldObj.(*fv1.Function)
+			newFn := newObj.(*fv1.Function)
+			// updateFunction handles the executor type changing from or to wasm
+			if !isWasmFunction(oldFn) && !isWasmFunction(newFn) {
+				return
+			}
+			go func() {
+				log := wasm.logger.With(zap.String("function_name", newFn.ObjectMeta.Name),
+					zap.String("function_namespace", newFn.ObjectMeta.Namespace),
+					zap.String("old_function_name", oldFn.ObjectMeta.Name))
+				log.Debug("start function update handler")
+				err := wasm.updateFunction(ctx, oldFn, newFn)
+				if err != nil {
+					log.Error("error updating function",
+						zap.Error(err))
+				}
+				log.Debug("end function update handler")
+			}()
+		},
+	}
+}
 
-			// }()
+// PodInformerHandler keeps the pod IPs of functions in sync with their pods:
+// IPs of ready pods are added and requests waiting for the function are woken
+// up, IPs of pods turning unready, terminating or deleted are removed. It is
+// also the fallback for wasm runtimes that never call back through storePodIP.
+// Functions loaded into a host pod going away are forgotten along with it.
+func (wasm *Wasm) PodInformerHandler() k8sCache.ResourceEventHandlerFuncs {
+	functionUID := func(pod *apiv1.Pod) (string, bool) {
+		if pod.Labels[fv1.EXECUTOR_TYPE] != string(fv1.ExecutorTypeWasm) || len(pod.Status.PodIP) == 0 {
+			return "", false
+		}
+		uid, ok := pod.Labels[fv1.FUNCTION_UID]
+		return uid, ok
+	}
+	remove := func(pod *apiv1.Pod) {
+		if uid, ok := functionUID(pod); ok {
+			wasm.fpmap.removePodIP(uid, pod.Status.PodIP)
+		}
+		if _, ok := pod.Labels[fv1.WASM_HOST]; ok {
+			wasm.hostPodGone(pod)
+		}
+	}
+	return k8sCache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			pod, ok := obj.(*apiv1.Pod)
+			if !ok || !utils.IsReadyPod(pod) {
+				return
+			}
+			if uid, ok := functionUID(pod); ok {
+				wasm.fpmap.assign(uid, pod.Status.PodIP)
+				wasm.podIPWaiter.notify(uid)
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			oldPod, ok := oldObj.(*apiv1.Pod)
+			if !ok {
+				return
+			}
+			newPod, ok := newObj.(*apiv1.Pod)
+			if !ok {
+				return
+			}
+			if newPod.ObjectMeta.DeletionTimestamp != nil {
+				remove(newPod)
+				return
+			}
+			// a runtime may report its IP before the pod turns ready, so only
+			// pods which were ready before are dropped once they turn unready.
+			if !utils.IsReadyPod(newPod) {
+				if utils.IsReadyPod(oldPod) {
+					remove(oldPod)
+				}
+				return
+			}
+			if oldPod.Status.PodIP != newPod.Status.PodIP {
+				remove(oldPod)
+			}
+			if uid, ok := functionUID(newPod); ok {
+				wasm.fpmap.assign(uid, newPod.Status.PodIP)
+				wasm.podIPWaiter.notify(uid)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(k8sCache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*apiv1.Pod); ok {
+				remove(pod)
+			}
 		},
 	}
 }
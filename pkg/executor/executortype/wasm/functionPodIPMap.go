@@ -1,58 +1,110 @@
 package wasm
 
 import (
+	"sort"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
-	"github.com/fission/fission/pkg/cache"
+	ferror "github.com/fission/fission/pkg/error"
 )
 
 type (
+	// functionPodIPMap keeps the IPs of the ready pods of each function. It
+	// is fed by the storePodIP callbacks of the wasm runtimes and by the pod
+	// informer, which also drops the IPs of pods going away.
 	functionPodIPMap struct {
-		logger *zap.Logger
-		cache  *cache.Cache // map[functionuid]string
+		logger      *zap.Logger
+		lock        sync.RWMutex
+		podIPs      map[string]map[string]struct{} // map[functionuid]set[podIP]
+		generations map[string]int64               // map[functionuid]generation
 	}
-
 )
 
-func makeFunctionServiceMap(logger *zap.Logger, expiry time.Duration) *functionPodIPMap {
+func makeFunctionServiceMap(logger *zap.Logger) *functionPodIPMap {
 	return &functionPodIPMap{
-		logger: logger.Named("function_podip_map"),
-		cache:  cache.MakeCache(expiry, 0),
+		logger:      logger.Named("function_podip_map"),
+		podIPs:      make(map[string]map[string]struct{}),
+		generations: make(map[string]int64),
 	}
 }
 
-// func keyFromMetadata(m *metav1.ObjectMeta) *metadataKey {
-// 	return &metadataKey{
-// 		Name:            m.Name,
-// 		Namespace:       m.Namespace,
-// 		ResourceVersion: m.ResourceVersion,
-// 	}
-// }
-
-func (fmap *functionPodIPMap) lookup(fuid string) (string, error) {
-	// mk := keyFromMetadata(f)
-	item, err := fmap.cache.Get(fuid)
-	if err != nil {
-		return "", err
-	}
-	u := item.(string)
-	return u, nil
+// lookup returns the sorted pod IPs of the function.
+func (fmap *functionPodIPMap) lookup(fuid string) ([]string, error) {
+	fmap.lock.RLock()
+	defer fmap.lock.RUnlock()
+	ips, ok := fmap.podIPs[fuid]
+	if !ok || len(ips) == 0 {
+		return nil, ferror.MakeError(ferror.ErrorNotFound, "no pod IP found for function "+fuid)
+	}
+	podIPs := make([]string, 0, len(ips))
+	for ip := range ips {
+		podIPs = append(podIPs, ip)
+	}
+	sort.Strings(podIPs)
+	return podIPs, nil
+}
+
+// assign adds a pod IP to the function.
+func (fmap *functionPodIPMap) assign(fuid string, podIP string) {
+	fmap.lock.Lock()
+	defer fmap.lock.Unlock()
+	ips, ok := fmap.podIPs[fuid]
+	if !ok {
+		ips = make(map[string]struct{})
+		fmap.podIPs[fuid] = ips
+	}
+	if _, ok := ips[podIP]; ok {
+		return
+	}
+	ips[podIP] = struct{}{}
+	fmap.bumpGeneration(fuid)
+	fmap.logger.Debug("added pod IP of function", zap.String("function_uid", fuid), zap.String("pod_ip", podIP))
 }
 
-func (fmap *functionPodIPMap) assign(fuid string, PodIP string) {
-	// mk := keyFromMetadata(f)
-	old, err := fmap.cache.Set(fuid, PodIP)
-	if err != nil {
-		if PodIP == old.(string) {
-			return
-		}
-		fmap.logger.Error("error caching Pod IP for function with a different value", zap.Error(err))
-		// ignore error
+// removePodIP removes a pod IP from the function.
+func (fmap *functionPodIPMap) removePodIP(fuid string, podIP string) {
+	fmap.lock.Lock()
+	defer fmap.lock.Unlock()
+	ips, ok := fmap.podIPs[fuid]
+	if !ok {
+		return
 	}
+	if _, ok := ips[podIP]; !ok {
+		return
+	}
+	delete(ips, podIP)
+	if len(ips) == 0 {
+		delete(fmap.podIPs, fuid)
+	}
+	fmap.bumpGeneration(fuid)
+	fmap.logger.Debug("removed pod IP of function", zap.String("function_uid", fuid), zap.String("pod_ip", podIP))
+}
+
+// remove removes all pod IPs of the function.
+func (fmap *functionPodIPMap) remove(fuid string) {
+	fmap.lock.Lock()
+	defer fmap.lock.Unlock()
+	delete(fmap.podIPs, fuid)
+	delete(fmap.generations, fuid)
 }
 
-func (fmap *functionPodIPMap) remove(fuid string) error {
-	return fmap.cache.Delete(fuid)
+// generation returns the generation of the pod IPs of the function, which
+// increases whenever they change.
+func (fmap *functionPodIPMap) generation(fuid string) int64 {
+	fmap.lock.RLock()
+	defer fmap.lock.RUnlock()
+	return fmap.generations[fuid]
+}
+
+// bumpGeneration moves the generation of the function forward. Generations
+// are timestamps, so that they keep increasing across executor restarts.
+// Callers must hold the lock.
+func (fmap *functionPodIPMap) bumpGeneration(fuid string) {
+	gen := time.Now().UnixNano()
+	if prev := fmap.generations[fuid]; gen <= prev {
+		gen = prev + 1
+	}
+	fmap.generations[fuid] = gen
 }
@@ -0,0 +1,471 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	apiv1 "k8s.io/api/core/v1"
+	k8sErrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	ferror "github.com/fission/fission/pkg/error"
+	"github.com/fission/fission/pkg/executor/fscache"
+	"github.com/fission/fission/pkg/executor/metrics"
+	"github.com/fission/fission/pkg/utils"
+	otelUtils "github.com/fission/fission/pkg/utils/otel"
+)
+
+const (
+	defaultHostImage        = "fission/wasm-host"
+	defaultHostMemory       = "1Gi"
+	defaultHostMaxFunctions = 100
+	// defaultHostFunctionMemory caps the linear memory of shared functions
+	// without a max memory of their own.
+	defaultHostFunctionMemory = 64 << 20
+)
+
+type (
+	// wasmHostGroup is a group of wasm host pods of a runtime class. Unlike
+	// pool pods, a host loads the modules of many functions and routes
+	// requests to them by path, the wasm sandbox isolating the functions
+	// from each other. Functions are packed into the fullest host with room
+	// for them, a host has room for a function while it runs less than
+	// maxFunctions functions and the memory caps of its functions fit into
+	// the memory of the host.
+	wasmHostGroup struct {
+		runtimeClass string
+		image        string
+		replicas     int32
+		memory       resource.Quantity
+		maxFunctions int
+	}
+
+	// wasmHostFunction is a function loaded into a host.
+	wasmHostFunction struct {
+		host   string // namespace/name of the host pod
+		memory int64
+	}
+
+	// wasmHostSet keeps track of the functions loaded into the hosts of
+	// this executor instance.
+	wasmHostSet struct {
+		sync.Mutex
+		functions map[k8sTypes.UID]wasmHostFunction
+	}
+
+	// wasmUnloadRequest is the request hosts receive to unload the module
+	// of a function.
+	wasmUnloadRequest struct {
+		FunctionUID string `json:"functionUID"`
+	}
+)
+
+// makeWasmHostGroups returns the groups of wasm host pods configured through
+// WASM_HOST_COUNT, WASM_HOST_IMAGE, WASM_HOST_MEMORY, WASM_HOST_MAX_FUNCTIONS
+// and WASM_HOST_RUNTIME_CLASSES, a comma separated list of runtime classes
+// with one group each. A host count of 0, the default, disables the hosts.
+func makeWasmHostGroups(logger *zap.Logger) map[string]*wasmHostGroup {
+	groups := make(map[string]*wasmHostGroup)
+
+	count := 0
+	if len(os.Getenv("WASM_HOST_COUNT")) > 0 {
+		var err error
+		count, err = strconv.Atoi(os.Getenv("WASM_HOST_COUNT"))
+		if err != nil || count < 0 {
+			logger.Error("failed to parse 'WASM_HOST_COUNT', wasm hosts disabled", zap.String("value", os.Getenv("WASM_HOST_COUNT")))
+			return groups
+		}
+	}
+	if count == 0 {
+		return groups
+	}
+
+	image := os.Getenv("WASM_HOST_IMAGE")
+	if len(image) == 0 {
+		image = defaultHostImage
+	}
+	memoryStr := os.Getenv("WASM_HOST_MEMORY")
+	if len(memoryStr) == 0 {
+		memoryStr = defaultHostMemory
+	}
+	memory, err := resource.ParseQuantity(memoryStr)
+	if err != nil || memory.Sign() <= 0 {
+		logger.Error("failed to parse 'WASM_HOST_MEMORY', wasm hosts disabled", zap.String("value", memoryStr))
+		return groups
+	}
+	maxFunctions := defaultHostMaxFunctions
+	if len(os.Getenv("WASM_HOST_MAX_FUNCTIONS")) > 0 {
+		maxFunctions, err = strconv.Atoi(os.Getenv("WASM_HOST_MAX_FUNCTIONS"))
+		if err != nil || maxFunctions <= 0 {
+			logger.Error("failed to parse 'WASM_HOST_MAX_FUNCTIONS', wasm hosts disabled", zap.String("value", os.Getenv("WASM_HOST_MAX_FUNCTIONS")))
+			return groups
+		}
+	}
+
+	runtimeClasses := os.Getenv("WASM_HOST_RUNTIME_CLASSES")
+	if len(runtimeClasses) == 0 {
+		runtimeClasses = defaultPoolRuntimeClass
+	}
+	for _, runtimeClass := range strings.Split(runtimeClasses, ",") {
+		runtimeClass = strings.TrimSpace(runtimeClass)
+		if len(runtimeClass) == 0 {
+			continue
+		}
+		groups[runtimeClass] = &wasmHostGroup{
+			runtimeClass: runtimeClass,
+			image:        image,
+			replicas:     int32(count),
+			memory:       memory,
+			maxFunctions: maxFunctions,
+		}
+	}
+	return groups
+}
+
+func makeWasmHostSet() *wasmHostSet {
+	return &wasmHostSet{
+		functions: make(map[k8sTypes.UID]wasmHostFunction),
+	}
+}
+
+// hostOf returns the host the function is loaded into.
+func (hs *wasmHostSet) hostOf(uid k8sTypes.UID) (string, bool) {
+	hs.Lock()
+	defer hs.Unlock()
+	f, ok := hs.functions[uid]
+	return f.host, ok
+}
+
+// release forgets the function, making room for other functions in its host.
+func (hs *wasmHostSet) release(uid k8sTypes.UID) {
+	hs.Lock()
+	defer hs.Unlock()
+	delete(hs.functions, uid)
+}
+
+// releaseHost forgets the functions of a host and returns them.
+func (hs *wasmHostSet) releaseHost(host string) []k8sTypes.UID {
+	hs.Lock()
+	defer hs.Unlock()
+	var uids []k8sTypes.UID
+	for uid, f := range hs.functions {
+		if f.host == host {
+			uids = append(uids, uid)
+			delete(hs.functions, uid)
+		}
+	}
+	return uids
+}
+
+// reserve picks the fullest of the hosts with room for a function needing
+// memory bytes and assigns the function to it.
+func (hs *wasmHostSet) reserve(uid k8sTypes.UID, memory int64, hosts []string, group *wasmHostGroup) (string, error) {
+	hs.Lock()
+	defer hs.Unlock()
+
+	if f, ok := hs.functions[uid]; ok {
+		return f.host, nil
+	}
+
+	count := make(map[string]int)
+	used := make(map[string]int64)
+	for _, f := range hs.functions {
+		count[f.host]++
+		used[f.host] += f.memory
+	}
+
+	chosen := ""
+	for _, host := range hosts {
+		if count[host] >= group.maxFunctions || used[host]+memory > group.memory.Value() {
+			continue
+		}
+		if len(chosen) == 0 || count[host] > count[chosen] {
+			chosen = host
+		}
+	}
+	if len(chosen) == 0 {
+		return "", ferror.MakeError(ferror.ErrorNotFound,
+			fmt.Sprintf("no wasm host of runtime class %v has room for the function", group.runtimeClass))
+	}
+	hs.functions[uid] = wasmHostFunction{host: chosen, memory: memory}
+	return chosen, nil
+}
+
+func (group *wasmHostGroup) getHostLabels() map[string]string {
+	return map[string]string{
+		fv1.EXECUTOR_TYPE: string(fv1.ExecutorTypeWasm),
+		fv1.WASM_HOST:     group.runtimeClass,
+	}
+}
+
+func (group *wasmHostGroup) getDeployName() string {
+	return "wasm-host-" + group.runtimeClass
+}
+
+// getFunctionMemory returns the memory cap of the function in a host.
+func (group *wasmHostGroup) getFunctionMemory(fn *fv1.Function) int64 {
+	if fn.Spec.Wasm != nil && fn.Spec.Wasm.MaxMemory != nil {
+		return fn.Spec.Wasm.MaxMemory.Value()
+	}
+	return defaultHostFunctionMemory
+}
+
+// getHostRoutePrefix returns the path hosts serve the function under.
+func getHostRoutePrefix(uid k8sTypes.UID) string {
+	return "/fn/" + string(uid)
+}
+
+// setupHosts creates or updates the deployments of the host groups.
+func (wasm *Wasm) setupHosts(ctx context.Context) {
+	for _, group := range wasm.hostGroups {
+		resources := apiv1.ResourceRequirements{
+			Limits: apiv1.ResourceList{apiv1.ResourceMemory: group.memory},
+		}
+		deployment := wasm.getRuntimeDeploymentSpec(group.getDeployName(), group.getHostLabels(),
+			group.image, group.runtimeClass, group.replicas, resources)
+		err := wasm.createOrUpdateRuntimeDeployment(ctx, deployment)
+		if err != nil {
+			wasm.logger.Error("error setting up wasm hosts", zap.Error(err), zap.String("runtime_class", group.runtimeClass))
+			continue
+		}
+		wasm.logger.Info("wasm hosts ready to load functions",
+			zap.String("runtime_class", group.runtimeClass),
+			zap.Int32("replicas", group.replicas),
+			zap.Int("max_functions", group.maxFunctions))
+	}
+}
+
+// getHostGroup returns the host group the function is loaded into, or nil if
+// the function does not share a host. Like pool pods, hosts are generic, so
+// functions referencing secrets or configmaps always get a deployment.
+func (wasm *Wasm) getHostGroup(fn *fv1.Function) *wasmHostGroup {
+	if len(wasm.hostGroups) == 0 || fn.Spec.Wasm == nil {
+		return nil
+	}
+	if len(fn.Spec.Secrets) > 0 || len(fn.Spec.ConfigMaps) > 0 {
+		return nil
+	}
+	switch fn.Spec.Wasm.Mode {
+	case fv1.WasmModeShared:
+	case "":
+		if !wasm.envAllowsSharing(fn) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	runtimeClass := defaultPoolRuntimeClass
+	if fn.Spec.PodSpec != nil && fn.Spec.PodSpec.RuntimeClassName != nil {
+		runtimeClass = *fn.Spec.PodSpec.RuntimeClassName
+	}
+	return wasm.hostGroups[runtimeClass]
+}
+
+// envAllowsSharing reports whether the environment of the function allows
+// infinite functions per container.
+func (wasm *Wasm) envAllowsSharing(fn *fv1.Function) bool {
+	envName := fn.Spec.Environment.Name
+	if len(envName) == 0 {
+		return false
+	}
+	envNamespace := fn.Spec.Environment.Namespace
+	if len(envNamespace) == 0 {
+		envNamespace = fn.ObjectMeta.Namespace
+	}
+	env, err := wasm.envLister.Environments(envNamespace).Get(envName)
+	if err != nil {
+		if !k8sErrs.IsNotFound(err) {
+			wasm.logger.Error("error getting environment of function", zap.Error(err),
+				zap.String("environment", envName), zap.String("function", fn.ObjectMeta.Name))
+		}
+		return false
+	}
+	return env.Spec.AllowedFunctionsPerContainer == fv1.AllowedFunctionsPerContainerInfinite
+}
+
+// hostCreate loads the function into a host with room for it.
+func (wasm *Wasm) hostCreate(ctx context.Context, fn *fv1.Function, group *wasmHostGroup) (*fscache.FuncSvc, error) {
+	logger := otelUtils.LoggerWithTraceID(ctx, wasm.logger)
+	startTime := time.Now()
+
+	pods, err := wasm.podLister.Pods(wasm.namespace).List(labels.Set(group.getHostLabels()).AsSelector())
+	if err != nil {
+		return nil, err
+	}
+	hostPods := make(map[string]*apiv1.Pod)
+	hosts := make([]string, 0, len(pods))
+	for _, pod := range pods {
+		if pod.ObjectMeta.DeletionTimestamp != nil || len(pod.Status.PodIP) == 0 || !utils.IsReadyPod(pod) {
+			continue
+		}
+		key := pod.ObjectMeta.Namespace + "/" + pod.ObjectMeta.Name
+		hostPods[key] = pod
+		hosts = append(hosts, key)
+	}
+	// pick hosts in a stable order, so that functions pack into the same hosts
+	sort.Strings(hosts)
+
+	memory := group.getFunctionMemory(fn)
+	host, err := wasm.hosts.reserve(fn.ObjectMeta.UID, memory, hosts, group)
+	if err != nil {
+		return nil, err
+	}
+	pod, ok := hostPods[host]
+	if !ok {
+		// the function is loaded into a host which is not ready anymore
+		wasm.hosts.release(fn.ObjectMeta.UID)
+		return nil, errors.Errorf("wasm host %v of function is not ready", host)
+	}
+
+	err = wasm.loadIntoHost(ctx, pod, fn, memory)
+	if err != nil {
+		wasm.hosts.release(fn.ObjectMeta.UID)
+		return nil, errors.Wrapf(err, "error loading function into wasm host %v", pod.ObjectMeta.Name)
+	}
+
+	routePrefix := getHostRoutePrefix(fn.ObjectMeta.UID)
+	fsvc := &fscache.FuncSvc{
+		Name:     pod.ObjectMeta.Name,
+		Function: &fn.ObjectMeta,
+		// the route prefix keeps the addresses of the functions of a host
+		// apart in the cache, and tells the router the path to call
+		Address: net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(poolFunctionPort)) + routePrefix,
+		KubernetesObjects: []apiv1.ObjectReference{
+			{
+				Kind:            "pod",
+				Name:            pod.ObjectMeta.Name,
+				APIVersion:      pod.TypeMeta.APIVersion,
+				Namespace:       pod.ObjectMeta.Namespace,
+				ResourceVersion: pod.ObjectMeta.ResourceVersion,
+				UID:             pod.ObjectMeta.UID,
+			},
+		},
+		Executor: fv1.ExecutorTypeWasm,
+		PodPort:  poolFunctionPort,
+	}
+
+	_, err = wasm.fsCache.Add(*fsvc)
+	if err != nil {
+		logger.Error("error adding function to cache", zap.Error(err), zap.Any("function", fsvc.Function))
+		metrics.FuncError.WithLabelValues(fn.ObjectMeta.Name, fn.ObjectMeta.Namespace).Inc()
+		return fsvc, err
+	}
+
+	uid := string(fn.ObjectMeta.UID)
+	wasm.fpmap.assign(uid, pod.Status.PodIP)
+	wasm.podIPWaiter.notify(uid)
+
+	metrics.ColdStarts.WithLabelValues(fn.ObjectMeta.Name, fn.ObjectMeta.Namespace).Inc()
+	metrics.ColdStartDuration.WithLabelValues(fn.ObjectMeta.Name, fn.ObjectMeta.Namespace,
+		string(fv1.WasmModeShared)).Observe(time.Since(startTime).Seconds())
+
+	logger.Info("loaded function into wasm host",
+		zap.String("function", fn.ObjectMeta.Name),
+		zap.String("host", pod.ObjectMeta.Name),
+		zap.Int64("memory_limit", memory),
+		zap.Duration("elapsed_time", time.Since(startTime)))
+	return fsvc, nil
+}
+
+// loadIntoHost pushes the module of the function to the host, which serves
+// it under the route prefix of the function and caps its linear memory.
+func (wasm *Wasm) loadIntoHost(ctx context.Context, pod *apiv1.Pod, fn *fv1.Function, memory int64) error {
+	module, err := wasm.resolveModule(ctx, fn)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(wasmSpecializeRequest{
+		FunctionName:      fn.ObjectMeta.Name,
+		FunctionNamespace: fn.ObjectMeta.Namespace,
+		FunctionUID:       string(fn.ObjectMeta.UID),
+		Wasm:              *fn.Spec.Wasm,
+		ModuleImage:       module.image,
+		RoutePrefix:       getHostRoutePrefix(fn.ObjectMeta.UID),
+		MemoryLimit:       memory,
+		ModuleSHA256:      module.sha256,
+		ModuleVariants:    module.variants,
+		UsageReportURL:    wasm.getUsageReportURL(fn),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error encoding load request")
+	}
+	return wasm.postToRuntime(ctx, fn, pod, "/load", body)
+}
+
+// unloadFromHost unloads the function from its host, if it is loaded into
+// one, and reports whether it was.
+func (wasm *Wasm) unloadFromHost(ctx context.Context, fn *fv1.Function) (bool, error) {
+	host, ok := wasm.hosts.hostOf(fn.ObjectMeta.UID)
+	if !ok {
+		return false, nil
+	}
+	wasm.hosts.release(fn.ObjectMeta.UID)
+
+	namespace, name, found := strings.Cut(host, "/")
+	if !found {
+		return true, nil
+	}
+	pod, err := wasm.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		if k8sErrs.IsNotFound(err) {
+			// the module went away along with the host
+			return true, nil
+		}
+		return true, err
+	}
+	body, err := json.Marshal(wasmUnloadRequest{FunctionUID: string(fn.ObjectMeta.UID)})
+	if err != nil {
+		return true, err
+	}
+	err = wasm.postToRuntime(ctx, fn, pod, "/unload", body)
+	if err != nil {
+		return true, errors.Wrapf(err, "error unloading function from wasm host %v", name)
+	}
+	return true, nil
+}
+
+// hostPodGone forgets the functions loaded into a host pod which is going
+// away, their next request loads them into another host.
+func (wasm *Wasm) hostPodGone(pod *apiv1.Pod) {
+	uids := wasm.hosts.releaseHost(pod.ObjectMeta.Namespace + "/" + pod.ObjectMeta.Name)
+	for _, uid := range uids {
+		if fsvc, err := wasm.fsCache.GetByFunctionUID(uid); err == nil {
+			wasm.fsCache.DeleteEntry(fsvc)
+		}
+		wasm.fpmap.remove(string(uid))
+	}
+	if len(uids) > 0 {
+		wasm.logger.Info("wasm host went away, functions will be loaded into another host",
+			zap.String("host", pod.ObjectMeta.Name), zap.Int("functions", len(uids)))
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasm
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	apiv1 "k8s.io/api/core/v1"
+	k8s_err "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
+)
+
+const envWasmModuleCacheURL = "WASM_MODULE_CACHE_URL"
+
+// getModuleCacheEnv returns the environment variables pointing the wasm
+// runtime to the module cache on its node, or nil if there is no module
+// cache.
+func (wasm *Wasm) getModuleCacheEnv() []apiv1.EnvVar {
+	if len(wasm.moduleCacheURL) == 0 {
+		return nil
+	}
+	return []apiv1.EnvVar{
+		{
+			Name:  envWasmModuleCacheURL,
+			Value: wasm.moduleCacheURL,
+		},
+	}
+}
+
+// resolvedModule is where runtimes load the module of a function from.
+type resolvedModule struct {
+	// image is the digest pinned reference of modules published as OCI
+	// artifacts
+	image string
+	// sha256 is the checksum the module is verified against
+	sha256 string
+	// variants are the precompiled variants of the module
+	variants []wasmmodule.Variant
+}
+
+// resolveModule resolves the module of the function, getting its package
+// once for all the details the runtime needs.
+func (wasm *Wasm) resolveModule(ctx context.Context, fn *fv1.Function) (*resolvedModule, error) {
+	pkg, err := wasm.getFunctionPackage(ctx, fn)
+	if err != nil {
+		return nil, err
+	}
+	image, err := wasm.resolveModuleImage(ctx, fn, pkg)
+	if err != nil {
+		return nil, err
+	}
+	modulePkg := getModulePackage(fn, pkg)
+	return &resolvedModule{
+		image:    image,
+		sha256:   getModuleChecksum(modulePkg),
+		variants: getModuleVariants(modulePkg),
+	}, nil
+}
+
+// getFunctionPackage returns the package the function references, or nil if
+// it references none or the package does not exist.
+func (wasm *Wasm) getFunctionPackage(ctx context.Context, fn *fv1.Function) (*fv1.Package, error) {
+	pkgRef := fn.Spec.Package.PackageRef
+	if len(pkgRef.Name) == 0 {
+		return nil, nil
+	}
+	pkgNamespace := pkgRef.Namespace
+	if len(pkgNamespace) == 0 {
+		pkgNamespace = fn.ObjectMeta.Namespace
+	}
+
+	pkg, err := wasm.fissionClient.CoreV1().Packages(pkgNamespace).Get(ctx, pkgRef.Name, metav1.GetOptions{})
+	if err != nil {
+		if k8s_err.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "error getting package %v", pkgRef.Name)
+	}
+	return pkg, nil
+}
+
+// getModulePackage returns pkg if the module of the function is its
+// deployment archive, or nil if the module is not stored in the package.
+func getModulePackage(fn *fv1.Function, pkg *fv1.Package) *fv1.Package {
+	if pkg == nil || pkg.Spec.Deployment.Type != fv1.ArchiveTypeUrl {
+		return nil
+	}
+	moduleURL := fn.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_URL]
+	if fn.Spec.Wasm != nil && len(fn.Spec.Wasm.Module.URL) > 0 {
+		moduleURL = fn.Spec.Wasm.Module.URL
+	}
+	if pkg.Spec.Deployment.URL != moduleURL {
+		return nil
+	}
+	return pkg
+}
+
+// getModuleChecksum returns the sha256 sum of the module recorded in its
+// package, or an empty string if the module is not stored in a package.
+func getModuleChecksum(pkg *fv1.Package) string {
+	if pkg == nil || pkg.Spec.Deployment.Checksum.Type != fv1.ChecksumTypeSHA256 {
+		return ""
+	}
+	return pkg.Spec.Deployment.Checksum.Sum
+}
+
+// getModuleVariants returns the variants of the module the builder
+// precompiled, the runtime picks the one of its engine and node
+// architecture at pod start.
+func getModuleVariants(pkg *fv1.Package) []wasmmodule.Variant {
+	if pkg == nil {
+		return nil
+	}
+	var variants []wasmmodule.Variant
+	for _, v := range pkg.Spec.DeploymentVariants {
+		variant := wasmmodule.Variant{
+			Engine:       string(v.Engine),
+			Architecture: v.Architecture,
+			URL:          v.Archive.URL,
+		}
+		if v.Archive.Checksum.Type == fv1.ChecksumTypeSHA256 {
+			variant.SHA256 = v.Archive.Checksum.Sum
+		}
+		variants = append(variants, variant)
+	}
+	return variants
+}
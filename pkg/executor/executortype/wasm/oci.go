@@ -0,0 +1,83 @@
+package wasm
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
+)
+
+const sha256DigestPrefix = "sha256:"
+
+// resolveModuleImage returns the digest pinned reference of the module of
+// the function if it is an OCI artifact, or an empty string otherwise. pkg
+// is the package of the function, nil if it has none.
+func (wasm *Wasm) resolveModuleImage(ctx context.Context, fn *fv1.Function, pkg *fv1.Package) (string, error) {
+	image, err := wasm.resolvePackageImage(ctx, pkg)
+	if err != nil || len(image) > 0 || fn.Spec.Wasm == nil || len(fn.Spec.Wasm.Module.OCI) == 0 {
+		return image, err
+	}
+
+	// the module is referenced by the function only, so there is no package
+	// to pin the digest in
+	ref, err := wasmmodule.ParseOCIReference(fn.Spec.Wasm.Module.OCI)
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing OCI reference of function")
+	}
+	if len(ref.Digest) > 0 {
+		return ref.Pinned(ref.Digest), nil
+	}
+	digest, err := wasm.ociResolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", errors.Wrap(err, "error resolving OCI reference of function")
+	}
+	return ref.Pinned(digest), nil
+}
+
+// resolvePackageImage returns the digest pinned reference of the module of
+// the function if its package is an OCI artifact, or an empty string
+// otherwise. The digest is resolved and pinned in the package the first
+// time, so that the function keeps running the same module even if the tag
+// moves.
+func (wasm *Wasm) resolvePackageImage(ctx context.Context, pkg *fv1.Package) (string, error) {
+	if pkg == nil {
+		return "", nil
+	}
+	archive := pkg.Spec.Deployment
+	if archive.Type != fv1.ArchiveTypeOCI {
+		return "", nil
+	}
+
+	ref, err := wasmmodule.ParseOCIReference(archive.URL)
+	if err != nil {
+		return "", errors.Wrapf(err, "error parsing OCI reference of package %v", pkg.ObjectMeta.Name)
+	}
+	if archive.Checksum.Type == fv1.ChecksumTypeSHA256 && len(archive.Checksum.Sum) > 0 {
+		return ref.Pinned(sha256DigestPrefix + archive.Checksum.Sum), nil
+	}
+
+	digest, err := wasm.ociResolver.Resolve(ctx, ref)
+	if err != nil {
+		return "", errors.Wrapf(err, "error resolving OCI reference of package %v", pkg.ObjectMeta.Name)
+	}
+	pkg.Spec.Deployment.Checksum = fv1.Checksum{
+		Type: fv1.ChecksumTypeSHA256,
+		Sum:  strings.TrimPrefix(digest, sha256DigestPrefix),
+	}
+	_, err = wasm.fissionClient.CoreV1().Packages(pkg.ObjectMeta.Namespace).Update(ctx, pkg, metav1.UpdateOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "error pinning digest of package %v", pkg.ObjectMeta.Name)
+	}
+	wasm.logger.Info("pinned digest of wasm module",
+		zap.String("package", pkg.ObjectMeta.Name),
+		zap.String("namespace", pkg.ObjectMeta.Namespace),
+		zap.String("reference", ref.String()),
+		zap.String("digest", digest))
+
+	return ref.Pinned(digest), nil
+}
@@ -0,0 +1,59 @@
+package wasm
+
+import (
+	"sync"
+)
+
+// podIPWaiter lets goroutines block until the pod address of a function
+// becomes known, either because the wasm runtime called back through
+// storePodIP or because the pod informer saw a ready pod of the function.
+type podIPWaiter struct {
+	lock    sync.Mutex
+	waiters map[string][]chan struct{} // map[functionuid][]chan struct{}
+}
+
+func makePodIPWaiter() *podIPWaiter {
+	return &podIPWaiter{
+		waiters: make(map[string][]chan struct{}),
+	}
+}
+
+// register returns a channel which is closed on the next notify call for
+// the given function UID. Callers must register before checking the pod IP
+// cache; otherwise a notification that arrives in between is lost.
+func (w *podIPWaiter) register(fuid string) chan struct{} {
+	ch := make(chan struct{})
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.waiters[fuid] = append(w.waiters[fuid], ch)
+	return ch
+}
+
+// unregister removes a channel returned by register which has not been
+// notified, e.g. because the waiter gave up.
+func (w *podIPWaiter) unregister(fuid string, ch chan struct{}) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	chs := w.waiters[fuid]
+	for i, c := range chs {
+		if c == ch {
+			chs = append(chs[:i], chs[i+1:]...)
+			break
+		}
+	}
+	if len(chs) == 0 {
+		delete(w.waiters, fuid)
+		return
+	}
+	w.waiters[fuid] = chs
+}
+
+// notify wakes up all goroutines waiting for the given function UID.
+func (w *podIPWaiter) notify(fuid string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, ch := range w.waiters[fuid] {
+		close(ch)
+	}
+	delete(w.waiters, fuid)
+}
@@ -0,0 +1,512 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	k8sErrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	k8sTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	ferror "github.com/fission/fission/pkg/error"
+	"github.com/fission/fission/pkg/executor/fscache"
+	"github.com/fission/fission/pkg/executor/metrics"
+	"github.com/fission/fission/pkg/executor/util"
+	"github.com/fission/fission/pkg/utils"
+	otelUtils "github.com/fission/fission/pkg/utils/otel"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
+)
+
+const (
+	defaultPoolRuntimeClass = "wasm"
+	defaultPoolImage        = "fission/wasm-runtime"
+
+	// poolSpecializePort is the port the runtime of pool pods receives
+	// specialize requests on, the same as the fetcher of environment pods.
+	poolSpecializePort = 8000
+	// poolFunctionPort is the port specialized pool pods serve the function on.
+	poolFunctionPort = 8888
+
+	// runtimeRequestTimeout bounds the requests to the runtime of generic
+	// wasm pods, whatever the specialization timeout of the function, and
+	// runtimeDialTimeout the time to connect to an unreachable pod.
+	runtimeRequestTimeout = 5 * time.Minute
+	runtimeDialTimeout    = 5 * time.Second
+)
+
+type (
+	// wasmPool is a pool of generic wasm runtime pods of a runtime class,
+	// kept warm by a deployment. A cold start takes a ready pod out of the
+	// deployment by relabeling it, as poolmgr does with environment pods,
+	// and specializes it by pushing the module of the function to the
+	// runtime, so that no kubernetes object is created on the request path.
+	wasmPool struct {
+		runtimeClass string
+		image        string
+		size         int32
+
+		// chooseLock keeps concurrent cold starts in this executor from
+		// relabeling the same pod.
+		chooseLock sync.Mutex
+	}
+
+	// wasmSpecializeRequest is the request pool pods receive to load the
+	// module of a function.
+	wasmSpecializeRequest struct {
+		FunctionName      string       `json:"functionName"`
+		FunctionNamespace string       `json:"functionNamespace"`
+		FunctionUID       string       `json:"functionUID"`
+		Wasm              fv1.WasmSpec `json:"wasm"`
+		// ModuleImage is the digest pinned reference of modules published
+		// as OCI artifacts.
+		ModuleImage string `json:"moduleImage,omitempty"`
+		// StoreURL is where the runtime reports its pod IP to.
+		StoreURL string `json:"storeURL,omitempty"`
+		// RoutePrefix is the path shared hosts serve the function under.
+		RoutePrefix string `json:"routePrefix,omitempty"`
+		// MemoryLimit is the linear memory in bytes shared hosts cap the
+		// module at.
+		MemoryLimit int64 `json:"memoryLimit,omitempty"`
+		// ModuleSHA256 is the checksum the module is verified against.
+		ModuleSHA256 string `json:"moduleSHA256,omitempty"`
+		// ModuleVariants are the precompiled variants of the module.
+		ModuleVariants []wasmmodule.Variant `json:"moduleVariants,omitempty"`
+		// UsageReportURL is where the runtime reports the usage of
+		// invocations to.
+		UsageReportURL string `json:"usageReportURL,omitempty"`
+	}
+)
+
+// makeWasmPools returns the pools of wasm runtime pods configured through
+// WASM_POOL_SIZE, WASM_POOL_IMAGE and WASM_POOL_RUNTIME_CLASSES, a comma
+// separated list of runtime classes with one pool each. A pool size of 0,
+// the default, disables the pools.
+func makeWasmPools(logger *zap.Logger) map[string]*wasmPool {
+	pools := make(map[string]*wasmPool)
+
+	size := 0
+	if len(os.Getenv("WASM_POOL_SIZE")) > 0 {
+		var err error
+		size, err = strconv.Atoi(os.Getenv("WASM_POOL_SIZE"))
+		if err != nil || size < 0 {
+			logger.Error("failed to parse 'WASM_POOL_SIZE', wasm pod pool disabled", zap.String("value", os.Getenv("WASM_POOL_SIZE")))
+			return pools
+		}
+	}
+	if size == 0 {
+		return pools
+	}
+
+	image := os.Getenv("WASM_POOL_IMAGE")
+	if len(image) == 0 {
+		image = defaultPoolImage
+	}
+	runtimeClasses := os.Getenv("WASM_POOL_RUNTIME_CLASSES")
+	if len(runtimeClasses) == 0 {
+		runtimeClasses = defaultPoolRuntimeClass
+	}
+	for _, runtimeClass := range strings.Split(runtimeClasses, ",") {
+		runtimeClass = strings.TrimSpace(runtimeClass)
+		if len(runtimeClass) == 0 {
+			continue
+		}
+		pools[runtimeClass] = &wasmPool{
+			runtimeClass: runtimeClass,
+			image:        image,
+			size:         int32(size),
+		}
+	}
+	return pools
+}
+
+// getPool returns the pool the function is started from, or nil if the
+// function runs in deployment mode. Pool pods are generic, so functions
+// referencing secrets or configmaps, which are mounted into the pods, always
+// get a deployment.
+func (wasm *Wasm) getPool(fn *fv1.Function) *wasmPool {
+	if fn.Spec.Wasm == nil || fn.Spec.Wasm.Mode != fv1.WasmModePool {
+		return nil
+	}
+	if len(fn.Spec.Secrets) > 0 || len(fn.Spec.ConfigMaps) > 0 {
+		return nil
+	}
+	runtimeClass := defaultPoolRuntimeClass
+	if fn.Spec.PodSpec != nil && fn.Spec.PodSpec.RuntimeClassName != nil {
+		runtimeClass = *fn.Spec.PodSpec.RuntimeClassName
+	}
+	return wasm.pools[runtimeClass]
+}
+
+func (pool *wasmPool) getPoolLabels() map[string]string {
+	return map[string]string{
+		fv1.EXECUTOR_TYPE: string(fv1.ExecutorTypeWasm),
+		fv1.WASM_POOL:     pool.runtimeClass,
+		"managed":         "true",
+	}
+}
+
+func (pool *wasmPool) getDeployName() string {
+	return "wasm-pool-" + pool.runtimeClass
+}
+
+// setupPools creates or updates the deployments of the pools.
+func (wasm *Wasm) setupPools(ctx context.Context) {
+	for _, pool := range wasm.pools {
+		deployment := wasm.getRuntimeDeploymentSpec(pool.getDeployName(), pool.getPoolLabels(),
+			pool.image, pool.runtimeClass, pool.size, apiv1.ResourceRequirements{})
+		err := wasm.createOrUpdateRuntimeDeployment(ctx, deployment)
+		if err != nil {
+			wasm.logger.Error("error setting up wasm pod pool", zap.Error(err), zap.String("runtime_class", pool.runtimeClass))
+			continue
+		}
+		wasm.logger.Info("wasm pod pool ready to specialize",
+			zap.String("runtime_class", pool.runtimeClass),
+			zap.Int32("size", pool.size))
+	}
+}
+
+// createOrUpdateRuntimeDeployment creates or updates a deployment of generic
+// wasm runtime pods, like the ones of the pools.
+func (wasm *Wasm) createOrUpdateRuntimeDeployment(ctx context.Context, deployment *appsv1.Deployment) error {
+	existingDepl, err := wasm.kubernetesClient.AppsV1().Deployments(wasm.namespace).Get(ctx, deployment.ObjectMeta.Name, metav1.GetOptions{})
+	if k8sErrs.IsNotFound(err) {
+		_, err = wasm.kubernetesClient.AppsV1().Deployments(wasm.namespace).Create(ctx, deployment, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existingDepl.Annotations = deployment.Annotations
+	existingDepl.Labels = deployment.Labels
+	existingDepl.Spec.Replicas = deployment.Spec.Replicas
+	existingDepl.Spec.Template = deployment.Spec.Template
+	_, err = wasm.kubernetesClient.AppsV1().Deployments(wasm.namespace).Update(ctx, existingDepl, metav1.UpdateOptions{})
+	return err
+}
+
+func (wasm *Wasm) getRuntimeDeploymentSpec(name string, runtimeLabels map[string]string, image string,
+	runtimeClass string, replicas int32, resources apiv1.ResourceRequirements) *appsv1.Deployment {
+	annotations := map[string]string{
+		fv1.EXECUTOR_INSTANCEID_LABEL: wasm.instanceID,
+	}
+	podAnnotations := map[string]string{
+		fv1.EXECUTOR_INSTANCEID_LABEL: wasm.instanceID,
+	}
+	if wasm.useIstio {
+		podAnnotations["sidecar.istio.io/inject"] = "false"
+	}
+
+	gracePeriodSeconds := int64(6 * 60)
+
+	podSpec := apiv1.PodSpec{
+		RuntimeClassName: &runtimeClass,
+		Containers: []apiv1.Container{
+			{
+				Name:            "wasm-runtime",
+				Image:           image,
+				ImagePullPolicy: wasm.runtimeImagePullPolicy,
+				Ports: []apiv1.ContainerPort{
+					{Name: "specialize", ContainerPort: int32(poolSpecializePort)},
+					{Name: "http-env", ContainerPort: int32(poolFunctionPort)},
+				},
+				ReadinessProbe: &apiv1.Probe{
+					ProbeHandler: apiv1.ProbeHandler{
+						HTTPGet: &apiv1.HTTPGetAction{
+							Path: "/healthz",
+							Port: intstr.FromInt(poolSpecializePort),
+						},
+					},
+					PeriodSeconds:    1,
+					FailureThreshold: 30,
+				},
+				Env:       wasm.getModuleCacheEnv(),
+				Resources: resources,
+			},
+		},
+		TerminationGracePeriodSeconds: &gracePeriodSeconds,
+	}
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      runtimeLabels,
+			Annotations: annotations,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: runtimeLabels,
+			},
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      runtimeLabels,
+					Annotations: podAnnotations,
+				},
+				Spec: *(util.ApplyImagePullSecret("", podSpec)),
+			},
+		},
+	}
+}
+
+// poolCreate starts the function in a pod of the pool. The pod is deleted if
+// it fails to specialize, the deployment of the pool replaces it.
+func (wasm *Wasm) poolCreate(ctx context.Context, fn *fv1.Function, pool *wasmPool) (*fscache.FuncSvc, error) {
+	logger := otelUtils.LoggerWithTraceID(ctx, wasm.logger)
+	startTime := time.Now()
+
+	pod, err := wasm.choosePoolPod(ctx, fn, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wasm.specializePoolPod(ctx, pod, fn)
+	if err != nil {
+		logger.Error("error specializing wasm pool pod, deleting it", zap.Error(err),
+			zap.String("pod", pod.ObjectMeta.Name), zap.String("function", fn.ObjectMeta.Name))
+		delErr := wasm.kubernetesClient.CoreV1().Pods(pod.ObjectMeta.Namespace).Delete(ctx, pod.ObjectMeta.Name, metav1.DeleteOptions{})
+		if delErr != nil && !k8sErrs.IsNotFound(delErr) {
+			logger.Error("error deleting wasm pool pod", zap.Error(delErr), zap.String("pod", pod.ObjectMeta.Name))
+		}
+		return nil, err
+	}
+
+	fsvc := &fscache.FuncSvc{
+		Name:     pod.ObjectMeta.Name,
+		Function: &fn.ObjectMeta,
+		Address:  net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(poolFunctionPort)),
+		KubernetesObjects: []apiv1.ObjectReference{
+			{
+				Kind:            "pod",
+				Name:            pod.ObjectMeta.Name,
+				APIVersion:      pod.TypeMeta.APIVersion,
+				Namespace:       pod.ObjectMeta.Namespace,
+				ResourceVersion: pod.ObjectMeta.ResourceVersion,
+				UID:             pod.ObjectMeta.UID,
+			},
+		},
+		Executor: fv1.ExecutorTypeWasm,
+		PodPort:  poolFunctionPort,
+	}
+
+	_, err = wasm.fsCache.Add(*fsvc)
+	if err != nil {
+		logger.Error("error adding function to cache", zap.Error(err), zap.Any("function", fsvc.Function))
+		metrics.FuncError.WithLabelValues(fn.ObjectMeta.Name, fn.ObjectMeta.Namespace).Inc()
+		return fsvc, err
+	}
+
+	uid := string(fn.ObjectMeta.UID)
+	wasm.fpmap.assign(uid, pod.Status.PodIP)
+	wasm.podIPWaiter.notify(uid)
+
+	metrics.ColdStarts.WithLabelValues(fn.ObjectMeta.Name, fn.ObjectMeta.Namespace).Inc()
+	metrics.ColdStartDuration.WithLabelValues(fn.ObjectMeta.Name, fn.ObjectMeta.Namespace,
+		string(fv1.WasmModePool)).Observe(time.Since(startTime).Seconds())
+
+	logger.Info("specialized wasm pool pod",
+		zap.String("function", fn.ObjectMeta.Name),
+		zap.String("pod", pod.ObjectMeta.Name),
+		zap.Duration("elapsed_time", time.Since(startTime)))
+	return fsvc, nil
+}
+
+// choosePoolPod takes a ready pod out of the pool by relabeling it for the
+// function. The patch carries the resource version of the pod, so that it
+// fails if another executor instance picked the pod in the meantime.
+func (wasm *Wasm) choosePoolPod(ctx context.Context, fn *fv1.Function, pool *wasmPool) (*apiv1.Pod, error) {
+	logger := otelUtils.LoggerWithTraceID(ctx, wasm.logger)
+
+	pool.chooseLock.Lock()
+	defer pool.chooseLock.Unlock()
+
+	pods, err := wasm.podLister.Pods(wasm.namespace).List(labels.Set(pool.getPoolLabels()).AsSelector())
+	if err != nil {
+		return nil, err
+	}
+	// prefer the oldest pods, which are the most likely to have the engine
+	// warmed up
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].ObjectMeta.CreationTimestamp.Before(&pods[j].ObjectMeta.CreationTimestamp)
+	})
+
+	newLabels := map[string]string{
+		fv1.FUNCTION_NAME:      fn.ObjectMeta.Name,
+		fv1.FUNCTION_NAMESPACE: fn.ObjectMeta.Namespace,
+		fv1.FUNCTION_UID:       string(fn.ObjectMeta.UID),
+		"managed":              "false",
+	}
+	metadata := map[string]interface{}{
+		"labels": newLabels,
+		"annotations": map[string]string{
+			fv1.EXECUTOR_INSTANCEID_LABEL: wasm.instanceID,
+		},
+	}
+
+	for _, pod := range pods {
+		if pod.ObjectMeta.DeletionTimestamp != nil || len(pod.Status.PodIP) == 0 || !utils.IsReadyPod(pod) {
+			continue
+		}
+		if len(pod.ObjectMeta.ResourceVersion) > 0 {
+			metadata["resourceVersion"] = pod.ObjectMeta.ResourceVersion
+		} else {
+			delete(metadata, "resourceVersion")
+		}
+		patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+		if err != nil {
+			return nil, err
+		}
+		newPod, err := wasm.kubernetesClient.CoreV1().Pods(pod.ObjectMeta.Namespace).Patch(ctx, pod.ObjectMeta.Name,
+			k8sTypes.StrategicMergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			logger.Warn("failed to relabel wasm pool pod", zap.Error(err), zap.String("pod", pod.ObjectMeta.Name))
+			continue
+		}
+		if newPod.Labels[fv1.FUNCTION_UID] != string(fn.ObjectMeta.UID) {
+			continue
+		}
+		otelUtils.SpanTrackEvent(ctx, "podRelabel", otelUtils.GetAttributesForPod(newPod)...)
+		return newPod, nil
+	}
+
+	return nil, ferror.MakeError(ferror.ErrorNotFound,
+		fmt.Sprintf("no ready pod in wasm pool of runtime class %v", pool.runtimeClass))
+}
+
+// specializePoolPod pushes the module of the function to the runtime of the
+// pod, which loads it and starts serving the function.
+func (wasm *Wasm) specializePoolPod(ctx context.Context, pod *apiv1.Pod, fn *fv1.Function) error {
+	module, err := wasm.resolveModule(ctx, fn)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(wasmSpecializeRequest{
+		FunctionName:      fn.ObjectMeta.Name,
+		FunctionNamespace: fn.ObjectMeta.Namespace,
+		FunctionUID:       string(fn.ObjectMeta.UID),
+		Wasm:              *fn.Spec.Wasm,
+		ModuleImage:       module.image,
+		StoreURL:          wasm.getStoreURL(string(fn.ObjectMeta.UID)),
+		ModuleSHA256:      module.sha256,
+		ModuleVariants:    module.variants,
+		UsageReportURL:    wasm.getUsageReportURL(fn),
+	})
+	if err != nil {
+		return errors.Wrap(err, "error encoding specialize request")
+	}
+
+	err = wasm.postToRuntime(ctx, fn, pod, "/specialize", body)
+	if err != nil {
+		return errors.Wrapf(err, "error specializing pod %v", pod.ObjectMeta.Name)
+	}
+	otelUtils.SpanTrackEvent(ctx, "specializedPod", otelUtils.GetAttributesForPod(pod)...)
+	return nil
+}
+
+// makeRuntimeClient returns the client requests to the runtime of generic
+// wasm pods are sent with.
+func makeRuntimeClient() *http.Client {
+	return &http.Client{
+		Timeout: runtimeRequestTimeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{Timeout: runtimeDialTimeout}).DialContext,
+		},
+	}
+}
+
+// postToRuntime posts a JSON request to the runtime of a generic wasm pod,
+// waiting at most for the specialization timeout of the function.
+func (wasm *Wasm) postToRuntime(ctx context.Context, fn *fv1.Function, pod *apiv1.Pod, path string, body []byte) error {
+	specializationTimeout := fn.Spec.InvokeStrategy.ExecutionStrategy.SpecializationTimeout
+	if specializationTimeout < fv1.DefaultSpecializationTimeOut {
+		specializationTimeout = fv1.DefaultSpecializationTimeOut
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(specializationTimeout)*time.Second)
+	defer cancel()
+
+	runtimeURL := fmt.Sprintf("http://%v%v", net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(wasm.poolSpecializePort)), path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, runtimeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := wasm.runtimeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return errors.Errorf("runtime returned %v: %s", resp.Status, msg)
+	}
+	return nil
+}
+
+// deletePoolPods deletes the pool pods specialized for the function and
+// reports whether there were any.
+func (wasm *Wasm) deletePoolPods(ctx context.Context, fn *fv1.Function) (bool, error) {
+	if len(wasm.pools) == 0 {
+		return false, nil
+	}
+	selector, err := labels.Parse(fmt.Sprintf("%v,%v=%v", fv1.WASM_POOL, fv1.FUNCTION_UID, fn.ObjectMeta.UID))
+	if err != nil {
+		return false, err
+	}
+	pods, err := wasm.kubernetesClient.CoreV1().Pods(wasm.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return false, err
+	}
+	for _, pod := range pods.Items {
+		err = wasm.kubernetesClient.CoreV1().Pods(pod.ObjectMeta.Namespace).Delete(ctx, pod.ObjectMeta.Name, metav1.DeleteOptions{})
+		if err != nil && !k8sErrs.IsNotFound(err) {
+			return false, errors.Wrapf(err, "error deleting wasm pool pod %v", pod.ObjectMeta.Name)
+		}
+	}
+	return len(pods.Items) > 0, nil
+}
+
+func getPoolPodObj(kubeobjs []apiv1.ObjectReference) *apiv1.ObjectReference {
+	for _, kubeobj := range kubeobjs {
+		if strings.ToLower(kubeobj.Kind) == "pod" {
+			return &kubeobj
+		}
+	}
+	return nil
+}
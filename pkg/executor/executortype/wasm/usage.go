@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasm
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+)
+
+const (
+	envWasmUsageReportURL = "WASM_USAGE_REPORT_URL"
+	envWasmFunctionName   = "WASM_FUNCTION_NAME"
+	envWasmFunctionNS     = "WASM_FUNCTION_NAMESPACE"
+)
+
+// getUsageReportURL returns the URL wasm runtimes report the usage of
+// invocations of the function to, or an empty string if usage reporting is
+// disabled. Like the store URL, it carries a token signed for the function,
+// so that only runtimes handed the URL are able to report its usage.
+func (wasm *Wasm) getUsageReportURL(fn *fv1.Function) string {
+	if len(wasm.usageReportURL) == 0 {
+		return ""
+	}
+	uid := string(fn.ObjectMeta.UID)
+	query := url.Values{}
+	query.Set("token", wasm.callbackSigner.Sign(uid))
+	return fmt.Sprintf("%v/%v?%v", strings.TrimSuffix(wasm.usageReportURL, "/"), uid, query.Encode())
+}
+
+// getUsageReportEnv returns the environment variables pointing the wasm
+// runtime of the function to the executor endpoint it reports the usage of
+// invocations to, or nil if usage reporting is disabled. Runtimes of pools
+// and shared hosts get the URL in the specialize request instead.
+func (wasm *Wasm) getUsageReportEnv(fn *fv1.Function) []apiv1.EnvVar {
+	if len(wasm.usageReportURL) == 0 {
+		return nil
+	}
+	return []apiv1.EnvVar{
+		{Name: envWasmUsageReportURL, Value: wasm.getUsageReportURL(fn)},
+		{Name: envWasmFunctionNS, Value: fn.ObjectMeta.Namespace},
+		{Name: envWasmFunctionName, Value: fn.ObjectMeta.Name},
+	}
+}
@@ -2,33 +2,53 @@ package wasm
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
 
 	// "fmt"
+	"reflect"
 	"testing"
 	"time"
 
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
-	// "github.com/fission/fission/pkg/executor/util"
+	"github.com/fission/fission/pkg/executor/cms"
+	"github.com/fission/fission/pkg/executor/executortype"
+	"github.com/fission/fission/pkg/executor/fscache"
+	"github.com/fission/fission/pkg/executor/util"
 	fClient "github.com/fission/fission/pkg/generated/clientset/versioned/fake"
 	genInformer "github.com/fission/fission/pkg/generated/informers/externalversions"
 	"github.com/fission/fission/pkg/utils"
 	"github.com/fission/fission/pkg/utils/loggerfactory"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 	uuid "github.com/satori/go.uuid"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
 	k8sCache "k8s.io/client-go/tools/cache"
 )
 
 const (
-	defaultNamespace  string = "default"
-	functionNamespace string = "wasm-function"
-	newFunctionNamespace string ="newWasm-function"
-	newFunctionName      string ="newWasm-test-func"
-	pkgName           string = "wasm-test-pkg"
-	functionName      string = "wasm-test-func"
+	defaultNamespace     string = "default"
+	functionNamespace    string = "wasm-function"
+	newFunctionNamespace string = "newWasm-function"
+	newFunctionName      string = "newWasm-test-func"
+	pkgName              string = "wasm-test-pkg"
+	functionName         string = "wasm-test-func"
 )
 
 func runInformers(ctx context.Context, informers []k8sCache.SharedIndexInformer) {
@@ -38,14 +58,22 @@ func runInformers(ctx context.Context, informers []k8sCache.SharedIndexInformer)
 	}
 }
 
+// reportPodIP simulates the wasm runtime calling back through storePodIP
+// shortly after the deployment of the function got created.
+func reportPodIP(ctx context.Context, wasm *Wasm, fn *fv1.Function, podIP string) {
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_ = wasm.StorePodIP(ctx, string(fn.ObjectMeta.UID), podIP)
+	}()
+}
 
-func TestFnCreate(t *testing.T){
+func TestFnCreate(t *testing.T) {
 	logger := loggerfactory.GetLogger()
 	kubernetesClient := fake.NewSimpleClientset()
-    fissionClient := fClient.NewSimpleClientset()
+	fissionClient := fClient.NewSimpleClientset()
 	informerFactory := genInformer.NewSharedInformerFactory(fissionClient, time.Minute*30)
 	funcInformer := informerFactory.Core().V1().Functions()
-	// envInformer := informerFactory.Core().V1().Environments()
+	envInformer := informerFactory.Core().V1().Environments()
 
 	wasmInformerFactory, err := utils.GetInformerFactoryByExecutor(kubernetesClient, fv1.ExecutorTypeWasm, time.Minute*30)
 	if err != nil {
@@ -54,23 +82,19 @@ func TestFnCreate(t *testing.T){
 
 	deployInformer := wasmInformerFactory.Apps().V1().Deployments()
 	svcInformer := wasmInformerFactory.Core().V1().Services()
-	
+	podInformer := wasmInformerFactory.Core().V1().Pods()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-    //创建wasm组件
-	executor, err := MakeWasm(ctx, logger, fissionClient, kubernetesClient, functionNamespace,"test",funcInformer, deployInformer,svcInformer)
+	//创建wasm组件
+	executor, err := MakeWasm(ctx, logger, fissionClient, kubernetesClient, functionNamespace, "test", funcInformer, envInformer, deployInformer, svcInformer, podInformer, util.NewCallbackSigner([]byte("test")))
 	if err != nil {
 		t.Fatalf("new deploy manager creation failed: %s", err)
 	}
 
 	wasm := executor.(*Wasm)
 
-    //运行组件
-	go wasm.Run(ctx)
-	t.Log("New deploy manager started")
-
 	// runInformers(ctx, []k8sCache.SharedIndexInformer{
 	// 	funcInformer.Informer(),
 	// 	deployInformer.Informer(),
@@ -80,13 +104,14 @@ func TestFnCreate(t *testing.T){
 	wasmInformerFactory.Start(ctx.Done())
 
 	t.Log("Informers required for wasm manager started")
-    
 
-	if ok := k8sCache.WaitForCacheSync(ctx.Done(), wasm.deplListerSynced,wasm.svcListerSynced); !ok {
+	if ok := k8sCache.WaitForCacheSync(ctx.Done(), wasm.deplListerSynced, wasm.svcListerSynced); !ok {
 		t.Fatal("Timed out waiting for caches to sync")
 	}
-	
-    //模拟客户端CLI创建函数（wasm文件）
+	wasm.Run(ctx)
+	t.Log("New deploy manager started")
+
+	//模拟客户端CLI创建函数（wasm文件）
 	//创建一个wasm function
 	funcUID, err := uuid.NewV4()
 	if err != nil {
@@ -108,15 +133,14 @@ func TestFnCreate(t *testing.T){
 			},
 			Package: fv1.FunctionPackageRef{
 				PackageRef: fv1.PackageRef{
-					Namespace: defaultNamespace,
-					Name: pkgName,
-					ResourceVersion:"vtest",
+					Namespace:       defaultNamespace,
+					Name:            pkgName,
+					ResourceVersion: "vtest",
 				},
-
 			},
 		},
 	}
-	
+
 	//创建一个wasm的pakage
 	pkg := &fv1.Package{
 		ObjectMeta: metav1.ObjectMeta{
@@ -124,14 +148,14 @@ func TestFnCreate(t *testing.T){
 			Namespace: defaultNamespace,
 			UID:       "83c82da2-81e9-4ebd-867e-f383e65e603f",
 		},
-		Spec: fv1.PackageSpec{//有Deployment archive和source archive
+		Spec: fv1.PackageSpec{ //有Deployment archive和source archive
 			Deployment: fv1.Archive{
 				Type: fv1.ArchiveTypeUrl,
-				URL:   "/hhhh/test_wasm",
+				URL:  "/hhhh/test_wasm",
 			},
 		},
 	}
-	
+
 	//创建一个wasm的container
 	container := &apiv1.Container{
 		Name:  functionName,
@@ -149,8 +173,7 @@ func TestFnCreate(t *testing.T){
 		TerminationGracePeriodSeconds: &fnGracePeriod,
 	}
 
-
-    //模拟Controller创建CRD资源
+	//模拟Controller创建CRD资源
 	_, err = wasm.fissionClient.CoreV1().Packages(defaultNamespace).Create(ctx, pkg, metav1.CreateOptions{})
 	if err != nil {
 		t.Fatalf("creating package failed : %s", err)
@@ -162,46 +185,46 @@ func TestFnCreate(t *testing.T){
 
 	//底层真正部署函数
 	// funcSvc,err:=wasm.createFunction(ctx,function)
-	_,err=wasm.createFunction(ctx,function)
+	reportPodIP(ctx, wasm, function, "10.0.0.1")
+	_, err = wasm.createFunction(ctx, function)
 	if err != nil {
 		t.Fatalf("Error creating wasm function: %s", err)
 	}
 
 	t.Log("成功部署wasm 函数 !")
-	
-	objname:=wasm.getObjName(function)
-	fmt.Printf("wasm function deployment 创建成功：%s\n",objname)
+
+	objname := wasm.getObjName(function)
+	fmt.Printf("wasm function deployment 创建成功：%s\n", objname)
 	ns := wasm.namespace
 
-	dpl,err:=wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx,objname,metav1.GetOptions{})
+	dpl, err := wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx, objname, metav1.GetOptions{})
 	if err != nil {
 		t.Fatalf("Error getting wasm function deployment  %s", err)
 	}
 	fmt.Printf("验证。。。。\n")
 
-	fmt.Printf("wasm function deployment 创建成功：%s\n",dpl.Name)
+	fmt.Printf("wasm function deployment 创建成功：%s\n", dpl.Name)
 
-	//删除函数 
-	err=wasm.deleteFunction(ctx,function)
+	//删除函数
+	err = wasm.deleteFunction(ctx, function)
 	if err != nil {
 		t.Fatalf("Error deleting wasm function: %s", err)
 	}
-    //再去查看是否存在
+	//再去查看是否存在
 	// dpl,err=wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx,objname,metav1.GetOptions{})
 	// if err != nil {
 	// 	t.Fatalf("Error getting wasm function deployment  %s", err)
 	// }
 
-
 }
 
-func TestFnDelete(t *testing.T){
+func TestFnDelete(t *testing.T) {
 	logger := loggerfactory.GetLogger()
 	kubernetesClient := fake.NewSimpleClientset()
-    fissionClient := fClient.NewSimpleClientset()
+	fissionClient := fClient.NewSimpleClientset()
 	informerFactory := genInformer.NewSharedInformerFactory(fissionClient, time.Minute*30)
 	funcInformer := informerFactory.Core().V1().Functions()
-	// envInformer := informerFactory.Core().V1().Environments()
+	envInformer := informerFactory.Core().V1().Environments()
 
 	wasmInformerFactory, err := utils.GetInformerFactoryByExecutor(kubernetesClient, fv1.ExecutorTypeWasm, time.Minute*30)
 	if err != nil {
@@ -210,23 +233,19 @@ func TestFnDelete(t *testing.T){
 
 	deployInformer := wasmInformerFactory.Apps().V1().Deployments()
 	svcInformer := wasmInformerFactory.Core().V1().Services()
-	
+	podInformer := wasmInformerFactory.Core().V1().Pods()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-    //创建wasm组件
-	executor, err := MakeWasm(ctx, logger, fissionClient, kubernetesClient, functionNamespace,"test",funcInformer, deployInformer,svcInformer)
+	//创建wasm组件
+	executor, err := MakeWasm(ctx, logger, fissionClient, kubernetesClient, functionNamespace, "test", funcInformer, envInformer, deployInformer, svcInformer, podInformer, util.NewCallbackSigner([]byte("test")))
 	if err != nil {
 		t.Fatalf("new deploy manager creation failed: %s", err)
 	}
 
 	wasm := executor.(*Wasm)
 
-    //运行组件
-	go wasm.Run(ctx)
-	t.Log("New deploy manager started")
-
 	// runInformers(ctx, []k8sCache.SharedIndexInformer{
 	// 	funcInformer.Informer(),
 	// 	deployInformer.Informer(),
@@ -236,13 +255,14 @@ func TestFnDelete(t *testing.T){
 	wasmInformerFactory.Start(ctx.Done())
 
 	t.Log("Informers required for wasm manager started")
-    
 
-	if ok := k8sCache.WaitForCacheSync(ctx.Done(), wasm.deplListerSynced,wasm.svcListerSynced); !ok {
+	if ok := k8sCache.WaitForCacheSync(ctx.Done(), wasm.deplListerSynced, wasm.svcListerSynced); !ok {
 		t.Fatal("Timed out waiting for caches to sync")
 	}
-	
-    //模拟客户端CLI创建函数（wasm文件）
+	wasm.Run(ctx)
+	t.Log("New deploy manager started")
+
+	//模拟客户端CLI创建函数（wasm文件）
 	//创建一个wasm function
 	funcUID, err := uuid.NewV4()
 	if err != nil {
@@ -264,15 +284,14 @@ func TestFnDelete(t *testing.T){
 			},
 			Package: fv1.FunctionPackageRef{
 				PackageRef: fv1.PackageRef{
-					Namespace: defaultNamespace,
-					Name: pkgName,
-					ResourceVersion:"vtest",
+					Namespace:       defaultNamespace,
+					Name:            pkgName,
+					ResourceVersion: "vtest",
 				},
-
 			},
 		},
 	}
-	
+
 	//创建一个wasm的pakage
 	pkg := &fv1.Package{
 		ObjectMeta: metav1.ObjectMeta{
@@ -280,14 +299,14 @@ func TestFnDelete(t *testing.T){
 			Namespace: defaultNamespace,
 			UID:       "83c82da2-81e9-4ebd-867e-f383e65e603f",
 		},
-		Spec: fv1.PackageSpec{//有Deployment archive和source archive
+		Spec: fv1.PackageSpec{ //有Deployment archive和source archive
 			Deployment: fv1.Archive{
 				Type: fv1.ArchiveTypeUrl,
-				URL:   "/hhhh/test_wasm",
+				URL:  "/hhhh/test_wasm",
 			},
 		},
 	}
-	
+
 	//创建一个wasm的container
 	container := &apiv1.Container{
 		Name:  functionName,
@@ -305,8 +324,7 @@ func TestFnDelete(t *testing.T){
 		TerminationGracePeriodSeconds: &fnGracePeriod,
 	}
 
-
-    //模拟Controller创建CRD资源
+	//模拟Controller创建CRD资源
 	_, err = wasm.fissionClient.CoreV1().Packages(defaultNamespace).Create(ctx, pkg, metav1.CreateOptions{})
 	if err != nil {
 		t.Fatalf("creating package failed : %s", err)
@@ -318,45 +336,46 @@ func TestFnDelete(t *testing.T){
 
 	//底层真正部署函数
 	// funcSvc,err:=wasm.createFunction(ctx,function)
-	_,err=wasm.createFunction(ctx,function)
+	reportPodIP(ctx, wasm, function, "10.0.0.1")
+	_, err = wasm.createFunction(ctx, function)
 	if err != nil {
 		t.Fatalf("Error creating wasm function: %s", err)
 	}
 
 	t.Log("成功部署wasm 函数 !")
-	
-	objname:=wasm.getObjName(function)
-	fmt.Printf("wasm function deployment 创建成功：%s\n",objname)
+
+	objname := wasm.getObjName(function)
+	fmt.Printf("wasm function deployment 创建成功：%s\n", objname)
 	ns := wasm.namespace
 
-	dpl,err:=wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx,objname,metav1.GetOptions{})
+	dpl, err := wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx, objname, metav1.GetOptions{})
 	if err != nil {
 		t.Fatalf("Error getting wasm function deployment  %s", err)
 	}
 	fmt.Printf("验证。。。。\n")
 
-	fmt.Printf("wasm function deployment 创建成功：%s\n",dpl.Name)
+	fmt.Printf("wasm function deployment 创建成功：%s\n", dpl.Name)
 
-	//删除函数 
-	err=wasm.deleteFunction(ctx,function)
+	//删除函数
+	err = wasm.deleteFunction(ctx, function)
 	if err != nil {
 		t.Fatalf("Error deleting wasm function: %s", err)
 	}
-    //再去查看是否存在
-	dpl,err=wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx,objname,metav1.GetOptions{})
+	//再去查看是否存在
+	dpl, err = wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx, objname, metav1.GetOptions{})
 	if err != nil {
 		t.Log("Error getting wasm function deployment 说明删除成功 ")
 	}
 
 }
 
-func TestFnUpdate(t *testing.T){
+func TestFnUpdate(t *testing.T) {
 	logger := loggerfactory.GetLogger()
 	kubernetesClient := fake.NewSimpleClientset()
-    fissionClient := fClient.NewSimpleClientset()
+	fissionClient := fClient.NewSimpleClientset()
 	informerFactory := genInformer.NewSharedInformerFactory(fissionClient, time.Minute*30)
 	funcInformer := informerFactory.Core().V1().Functions()
-	// envInformer := informerFactory.Core().V1().Environments()
+	envInformer := informerFactory.Core().V1().Environments()
 
 	wasmInformerFactory, err := utils.GetInformerFactoryByExecutor(kubernetesClient, fv1.ExecutorTypeWasm, time.Minute*30)
 	if err != nil {
@@ -365,23 +384,19 @@ func TestFnUpdate(t *testing.T){
 
 	deployInformer := wasmInformerFactory.Apps().V1().Deployments()
 	svcInformer := wasmInformerFactory.Core().V1().Services()
-	
+	podInformer := wasmInformerFactory.Core().V1().Pods()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-    //创建wasm组件
-	executor, err := MakeWasm(ctx, logger, fissionClient, kubernetesClient, functionNamespace,"test",funcInformer, deployInformer,svcInformer)
+	//创建wasm组件
+	executor, err := MakeWasm(ctx, logger, fissionClient, kubernetesClient, functionNamespace, "test", funcInformer, envInformer, deployInformer, svcInformer, podInformer, util.NewCallbackSigner([]byte("test")))
 	if err != nil {
 		t.Fatalf("new deploy manager creation failed: %s", err)
 	}
 
 	wasm := executor.(*Wasm)
 
-    //运行组件
-	go wasm.Run(ctx)
-	t.Log("New deploy manager started")
-
 	// runInformers(ctx, []k8sCache.SharedIndexInformer{
 	// 	funcInformer.Informer(),
 	// 	deployInformer.Informer(),
@@ -391,13 +406,14 @@ func TestFnUpdate(t *testing.T){
 	wasmInformerFactory.Start(ctx.Done())
 
 	t.Log("Informers required for wasm manager started")
-    
 
-	if ok := k8sCache.WaitForCacheSync(ctx.Done(), wasm.deplListerSynced,wasm.svcListerSynced); !ok {
+	if ok := k8sCache.WaitForCacheSync(ctx.Done(), wasm.deplListerSynced, wasm.svcListerSynced); !ok {
 		t.Fatal("Timed out waiting for caches to sync")
 	}
-	
-    //模拟客户端CLI创建函数（wasm文件）
+	wasm.Run(ctx)
+	t.Log("New deploy manager started")
+
+	//模拟客户端CLI创建函数（wasm文件）
 	//创建一个wasm function
 	funcUID, err := uuid.NewV4()
 	if err != nil {
@@ -419,15 +435,14 @@ func TestFnUpdate(t *testing.T){
 			},
 			Package: fv1.FunctionPackageRef{
 				PackageRef: fv1.PackageRef{
-					Namespace: defaultNamespace,
-					Name: pkgName,
-					ResourceVersion:"vtest",
+					Namespace:       defaultNamespace,
+					Name:            pkgName,
+					ResourceVersion: "vtest",
 				},
-
 			},
 		},
 	}
-	
+
 	//创建一个wasm的pakage
 	pkg := &fv1.Package{
 		ObjectMeta: metav1.ObjectMeta{
@@ -435,14 +450,14 @@ func TestFnUpdate(t *testing.T){
 			Namespace: defaultNamespace,
 			UID:       "83c82da2-81e9-4ebd-867e-f383e65e603f",
 		},
-		Spec: fv1.PackageSpec{//有Deployment archive和source archive
+		Spec: fv1.PackageSpec{ //有Deployment archive和source archive
 			Deployment: fv1.Archive{
 				Type: fv1.ArchiveTypeUrl,
-				URL:   "/hhhh/test_wasm",
+				URL:  "/hhhh/test_wasm",
 			},
 		},
 	}
-	
+
 	//创建一个wasm的container
 	container := &apiv1.Container{
 		Name:  functionName,
@@ -460,8 +475,7 @@ func TestFnUpdate(t *testing.T){
 		TerminationGracePeriodSeconds: &fnGracePeriod,
 	}
 
-
-    //模拟Controller创建CRD资源
+	//模拟Controller创建CRD资源
 	_, err = wasm.fissionClient.CoreV1().Packages(defaultNamespace).Create(ctx, pkg, metav1.CreateOptions{})
 	if err != nil {
 		t.Fatalf("creating package failed : %s", err)
@@ -473,32 +487,33 @@ func TestFnUpdate(t *testing.T){
 
 	//底层真正部署函数
 	// funcSvc,err:=wasm.createFunction(ctx,function)
-	_,err=wasm.createFunction(ctx,function)
+	reportPodIP(ctx, wasm, function, "10.0.0.1")
+	_, err = wasm.createFunction(ctx, function)
 	if err != nil {
 		t.Fatalf("Error creating wasm function: %s", err)
 	}
 
 	t.Log("成功部署wasm 函数 !")
-	
-	objname:=wasm.getObjName(function)
-	fmt.Printf("wasm function deployment 创建成功：%s\n",objname)
+
+	objname := wasm.getObjName(function)
+	fmt.Printf("wasm function deployment 创建成功：%s\n", objname)
 	ns := wasm.namespace
 	if funcSpec.ObjectMeta.Namespace != metav1.NamespaceDefault {
 		ns = funcSpec.ObjectMeta.Namespace
 	}
 
-	dpl,err:=wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx,objname,metav1.GetOptions{})
+	dpl, err := wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx, objname, metav1.GetOptions{})
 	if err != nil {
 		t.Fatalf("Error getting wasm function deployment  %s", err)
 	}
 	fmt.Printf("验证。。。。\n")
 
-	fmt.Printf("wasm function deployment 创建成功：%s\n",dpl.Name)
+	fmt.Printf("wasm function deployment 创建成功：%s\n", dpl.Name)
 
-	//更新函数 
+	//更新函数
 
 	//构造新的函数
-	newFunSpec:=&fv1.Function{
+	newFunSpec := &fv1.Function{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      newFunctionName,
 			Namespace: defaultNamespace,
@@ -513,11 +528,10 @@ func TestFnUpdate(t *testing.T){
 			},
 			Package: fv1.FunctionPackageRef{
 				PackageRef: fv1.PackageRef{
-					Namespace: defaultNamespace,
-					Name: pkgName,
-					ResourceVersion:"vtest",
+					Namespace:       defaultNamespace,
+					Name:            pkgName,
+					ResourceVersion: "vtest",
 				},
-
 			},
 		},
 	}
@@ -528,14 +542,14 @@ func TestFnUpdate(t *testing.T){
 			Namespace: defaultNamespace,
 			UID:       "88c82da2-81e9-4ebd-867e-f383e65e603f",
 		},
-		Spec: fv1.PackageSpec{//有Deployment archive和source archive
+		Spec: fv1.PackageSpec{ //有Deployment archive和source archive
 			Deployment: fv1.Archive{
 				Type: fv1.ArchiveTypeUrl,
-				URL:   "/hhhh/test_wasm_update",
+				URL:  "/hhhh/test_wasm_update",
 			},
 		},
 	}
-    //创建一个wasm的container
+	//创建一个wasm的container
 	newContainer := &apiv1.Container{
 		Name:  newFunctionName,
 		Image: newPkg.Spec.Deployment.URL,
@@ -550,37 +564,1477 @@ func TestFnUpdate(t *testing.T){
 		Containers:                    []apiv1.Container{*newContainer},
 		TerminationGracePeriodSeconds: &fnGracePeriod,
 	}
-	_,err=wasm.createFunction(ctx,newFunSpec)
+	reportPodIP(ctx, wasm, newFunSpec, "10.0.0.2")
+	_, err = wasm.createFunction(ctx, newFunSpec)
 	if err != nil {
 		t.Fatalf("Error creating wasm newFunSpec: %s", err)
 	}
 
 	t.Log("成功部署newFunSpec wasm 函数 !")
 
-
 	//更新函数了
-	err=wasm.updateFunction(ctx,function,newFunSpec)
+	err = wasm.updateFunction(ctx, function, newFunSpec)
 	if err != nil {
 		t.Fatalf("Error deleting wasm function: %s", err)
 	}
-    //再去查看是否存在
-	dpl,err=wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx,objname,metav1.GetOptions{})
+	//再去查看是否存在
+	dpl, err = wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx, objname, metav1.GetOptions{})
 	if err != nil {
 		t.Log("不在旧的objname里面 ")
 	}
-	objname=wasm.getObjName(newFunSpec)
-	fmt.Printf("newwasm function deployment 创建成功：%s\n",objname)
+	objname = wasm.getObjName(newFunSpec)
+	fmt.Printf("newwasm function deployment 创建成功：%s\n", objname)
 	ns = wasm.namespace
 	if newFunSpec.ObjectMeta.Namespace != metav1.NamespaceDefault {
 		ns = newFunSpec.ObjectMeta.Namespace
 	}
-	dpl,err=wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx,objname,metav1.GetOptions{})
+	dpl, err = wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx, objname, metav1.GetOptions{})
 	if err != nil {
 		t.Log("也不在在新的objname里面 说明更新不成功 ")
+	} else {
+		fmt.Printf("验证。。。。\n")
+
+		fmt.Printf("wasm function deployment 更新成功：%s\n", dpl.Name)
 	}
 
-	fmt.Printf("验证。。。。\n")
+}
+
+// makeTestWasm starts a wasm executor type backed by fake clientsets along
+// with the informers it depends on.
+func makeTestWasm(ctx context.Context, t *testing.T, kubernetesClient *fake.Clientset, fissionClient *fClient.Clientset) *Wasm {
+	logger := loggerfactory.GetLogger()
+	informerFactory := genInformer.NewSharedInformerFactory(fissionClient, time.Minute*30)
+	funcInformer := informerFactory.Core().V1().Functions()
+	envInformer := informerFactory.Core().V1().Environments()
+
+	wasmInformerFactory, err := utils.GetInformerFactoryByExecutor(kubernetesClient, fv1.ExecutorTypeWasm, time.Minute*30)
+	if err != nil {
+		t.Fatalf("Error creating informer factory: %s", err)
+	}
+	deployInformer := wasmInformerFactory.Apps().V1().Deployments()
+	svcInformer := wasmInformerFactory.Core().V1().Services()
+	podInformer := wasmInformerFactory.Core().V1().Pods()
+
+	executor, err := MakeWasm(ctx, logger, fissionClient, kubernetesClient, functionNamespace, "test",
+		funcInformer, envInformer, deployInformer, svcInformer, podInformer, util.NewCallbackSigner([]byte("test")))
+	if err != nil {
+		t.Fatalf("wasm manager creation failed: %s", err)
+	}
+	wasm := executor.(*Wasm)
+
+	informerFactory.Start(ctx.Done())
+	wasmInformerFactory.Start(ctx.Done())
+
+	if ok := k8sCache.WaitForCacheSync(ctx.Done(), wasm.deplListerSynced, wasm.svcListerSynced, wasm.podListerSynced); !ok {
+		t.Fatal("Timed out waiting for caches to sync")
+	}
+	wasm.Run(ctx)
+	return wasm
+}
+
+func TestWaitForPodIP(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubernetesClient := fake.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fClient.NewSimpleClientset())
+
+	newFunction := func() *fv1.Function {
+		funcUID, err := uuid.NewV4()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &fv1.Function{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      functionName,
+				Namespace: defaultNamespace,
+				UID:       types.UID(funcUID.String()),
+			},
+			Spec: fv1.FunctionSpec{
+				InvokeStrategy: fv1.InvokeStrategy{
+					ExecutionStrategy: fv1.ExecutionStrategy{
+						ExecutorType: fv1.ExecutorTypeWasm,
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("storePodIP callback", func(t *testing.T) {
+		fn := newFunction()
+		reportPodIP(ctx, wasm, fn, "10.0.0.1")
+		podIPs, err := wasm.waitForPodIPs(ctx, fn)
+		if err != nil {
+			t.Fatalf("Error waiting for pod IP: %s", err)
+		}
+		if !reflect.DeepEqual(podIPs, []string{"10.0.0.1"}) {
+			t.Fatalf("Expected pod IPs [10.0.0.1], got %v", podIPs)
+		}
+		if len(wasm.podIPWaiter.waiters) != 0 {
+			t.Fatalf("Expected no waiters left, got %d", len(wasm.podIPWaiter.waiters))
+		}
+	})
+
+	t.Run("pod informer fallback", func(t *testing.T) {
+		fn := newFunction()
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			pod := &apiv1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "wasm-test-pod",
+					Namespace: functionNamespace,
+					Labels:    wasm.getDeployLabels(fn.ObjectMeta),
+				},
+				Status: apiv1.PodStatus{
+					PodIP: "10.0.0.2",
+					ContainerStatuses: []apiv1.ContainerStatus{
+						{Name: functionName, Ready: true},
+					},
+				},
+			}
+			_, err := kubernetesClient.CoreV1().Pods(functionNamespace).Create(ctx, pod, metav1.CreateOptions{})
+			if err != nil {
+				t.Errorf("Error creating pod: %s", err)
+			}
+		}()
+		podIPs, err := wasm.waitForPodIPs(ctx, fn)
+		if err != nil {
+			t.Fatalf("Error waiting for pod IP: %s", err)
+		}
+		if !reflect.DeepEqual(podIPs, []string{"10.0.0.2"}) {
+			t.Fatalf("Expected pod IPs [10.0.0.2], got %v", podIPs)
+		}
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		fn := newFunction()
+		waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer waitCancel()
+		_, err := wasm.waitForPodIPs(waitCtx, fn)
+		if err == nil {
+			t.Fatal("Expected error waiting for pod IP of function without pods")
+		}
+		if len(wasm.podIPWaiter.waiters) != 0 {
+			t.Fatalf("Expected no waiters left, got %d", len(wasm.podIPWaiter.waiters))
+		}
+	})
+}
+
+func TestPodEndpoints(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubernetesClient := fake.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fClient.NewSimpleClientset())
+
+	funcUID, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fnMeta := metav1.ObjectMeta{
+		Name:      functionName,
+		Namespace: defaultNamespace,
+		UID:       types.UID(funcUID.String()),
+	}
+	fsvc := &fscache.FuncSvc{
+		Function: &fnMeta,
+		PodPort:  8888,
+	}
+
+	// waitForEndpoints polls until the endpoints of the function match.
+	waitForEndpoints := func(expected []string) {
+		var endpoints []string
+		err := wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+			endpoints, _ = wasm.GetPodEndpoints(ctx, fsvc)
+			return reflect.DeepEqual(endpoints, expected), nil
+		})
+		if err != nil {
+			t.Fatalf("Expected endpoints %v, got %v", expected, endpoints)
+		}
+	}
+
+	for i, podIP := range []string{"10.0.0.1", "10.0.0.2"} {
+		pod := &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("wasm-test-pod-%d", i),
+				Namespace: functionNamespace,
+				Labels:    wasm.getDeployLabels(fnMeta),
+			},
+			Status: apiv1.PodStatus{
+				PodIP: podIP,
+				ContainerStatuses: []apiv1.ContainerStatus{
+					{Name: functionName, Ready: true},
+				},
+			},
+		}
+		_, err := kubernetesClient.CoreV1().Pods(functionNamespace).Create(ctx, pod, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatalf("Error creating pod: %s", err)
+		}
+	}
+	waitForEndpoints([]string{"10.0.0.1:8888", "10.0.0.2:8888"})
+
+	// a runtime reporting its IP before its pod is ready adds an endpoint
+	err = wasm.StorePodIP(ctx, string(fnMeta.UID), "10.0.0.3")
+	if err != nil {
+		t.Fatalf("Error storing pod IP: %s", err)
+	}
+	waitForEndpoints([]string{"10.0.0.1:8888", "10.0.0.2:8888", "10.0.0.3:8888"})
+
+	err = kubernetesClient.CoreV1().Pods(functionNamespace).Delete(ctx, "wasm-test-pod-0", metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatalf("Error deleting pod: %s", err)
+	}
+	waitForEndpoints([]string{"10.0.0.2:8888", "10.0.0.3:8888"})
+
+	pod, err := kubernetesClient.CoreV1().Pods(functionNamespace).Get(ctx, "wasm-test-pod-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Error getting pod: %s", err)
+	}
+	now := metav1.Now()
+	pod.ObjectMeta.DeletionTimestamp = &now
+	_, err = kubernetesClient.CoreV1().Pods(functionNamespace).Update(ctx, pod, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("Error updating pod: %s", err)
+	}
+	waitForEndpoints([]string{"10.0.0.3:8888"})
+
+	wasm.fpmap.remove(string(fnMeta.UID))
+	waitForEndpoints(nil)
+}
+
+func TestIdleObjectReaper(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubernetesClient := fake.NewSimpleClientset()
+	// the fake clientset does not implement the scale subresource, scale the
+	// deployment as the deployment controller would.
+	kubernetesClient.PrependReactor("update", "deployments", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		scale := action.(k8sTesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+		obj, err := kubernetesClient.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), action.GetNamespace(), scale.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		depl := obj.(*appsv1.Deployment)
+		depl.Spec.Replicas = &scale.Spec.Replicas
+		depl.Status.AvailableReplicas = scale.Spec.Replicas
+		return true, scale, kubernetesClient.Tracker().Update(appsv1.SchemeGroupVersion.WithResource("deployments"), depl, action.GetNamespace())
+	})
+	fissionClient := fClient.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fissionClient)
+
+	funcUID, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idleTimeout := 60
+	fn, err := fissionClient.CoreV1().Functions(defaultNamespace).Create(ctx, &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      functionName,
+			Namespace: defaultNamespace,
+			UID:       types.UID(funcUID.String()),
+		},
+		Spec: fv1.FunctionSpec{
+			InvokeStrategy: fv1.InvokeStrategy{
+				ExecutionStrategy: fv1.ExecutionStrategy{
+					ExecutorType: fv1.ExecutorTypeWasm,
+				},
+			},
+			IdleTimeout: &idleTimeout,
+			PodSpec: &apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{
+						Name:  functionName,
+						Image: "/test/wasm",
+						Ports: []apiv1.ContainerPort{
+							{Name: "function", ContainerPort: int32(8888)},
+						},
+					},
+				},
+				TerminationGracePeriodSeconds: new(int64),
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("creating function failed : %s", err)
+	}
+
+	// setIdleFor pretends the function was last invoked some time ago.
+	setIdleFor := func(d time.Duration) {
+		fsvcs, err := wasm.fsCache.ListOld(0)
+		if err != nil {
+			t.Fatalf("Error listing function services: %s", err)
+		}
+		for _, fsvc := range fsvcs {
+			if fsvc.Function.UID == fn.ObjectMeta.UID {
+				fsvc.Atime = time.Now().Add(-d)
+			}
+		}
+	}
+	replicas := func(fsvc *fscache.FuncSvc) int32 {
+		depl, err := kubernetesClient.AppsV1().Deployments(fsvc.KubernetesObjects[0].Namespace).
+			Get(ctx, fsvc.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Error getting deployment: %s", err)
+		}
+		return *depl.Spec.Replicas
+	}
+
+	reportPodIP(ctx, wasm, fn, "10.0.0.1")
+	fsvc, err := wasm.GetFuncSvc(ctx, fn)
+	if err != nil {
+		t.Fatalf("Error creating wasm function: %s", err)
+	}
+	if r := replicas(fsvc); r != 1 {
+		t.Fatalf("Expected 1 replica, got %d", r)
+	}
+
+	// functions invoked within their idle timeout are kept
+	setIdleFor(30 * time.Second)
+	wasm.doIdleObjectReaper(ctx)
+	time.Sleep(100 * time.Millisecond)
+	if _, err := wasm.fsCache.GetByFunctionUID(fn.ObjectMeta.UID); err != nil {
+		t.Fatalf("Expected function service of busy function to be cached: %s", err)
+	}
+	if r := replicas(fsvc); r != 1 {
+		t.Fatalf("Expected 1 replica, got %d", r)
+	}
+
+	// idle functions are scaled to zero and forgotten
+	setIdleFor(2 * time.Minute)
+	wasm.doIdleObjectReaper(ctx)
+	err = wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		return replicas(fsvc) == 0, nil
+	})
+	if err != nil {
+		t.Fatalf("Expected idle function to be scaled to zero, got %d replicas", replicas(fsvc))
+	}
+	if _, err := wasm.fsCache.GetByFunctionUID(fn.ObjectMeta.UID); err == nil {
+		t.Fatal("Expected function service of idle function to be removed from cache")
+	}
+	if _, err := wasm.fpmap.lookup(string(fn.ObjectMeta.UID)); err == nil {
+		t.Fatal("Expected pod IPs of idle function to be removed")
+	}
+
+	// the next request cold-starts the function
+	reportPodIP(ctx, wasm, fn, "10.0.0.2")
+	fsvc, err = wasm.GetFuncSvc(ctx, fn)
+	if err != nil {
+		t.Fatalf("Error cold-starting wasm function: %s", err)
+	}
+	if r := replicas(fsvc); r != 1 {
+		t.Fatalf("Expected 1 replica after cold start, got %d", r)
+	}
+	endpoints, _ := wasm.GetPodEndpoints(ctx, fsvc)
+	if !reflect.DeepEqual(endpoints, []string{"10.0.0.2:8888"}) {
+		t.Fatalf("Expected endpoints [10.0.0.2:8888], got %v", endpoints)
+	}
+}
+
+func TestFnHpa(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubernetesClient := fake.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fClient.NewSimpleClientset())
+
+	funcUID, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            functionName,
+			Namespace:       defaultNamespace,
+			UID:             types.UID(funcUID.String()),
+			ResourceVersion: "1",
+		},
+		Spec: fv1.FunctionSpec{
+			InvokeStrategy: fv1.InvokeStrategy{
+				ExecutionStrategy: fv1.ExecutionStrategy{
+					ExecutorType: fv1.ExecutorTypeWasm,
+					MinScale:     1,
+					MaxScale:     3,
+				},
+			},
+			PodSpec: &apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{
+						Name:  functionName,
+						Image: "/test/wasm",
+						Ports: []apiv1.ContainerPort{
+							{Name: "function", ContainerPort: int32(8888)},
+						},
+					},
+				},
+				TerminationGracePeriodSeconds: new(int64),
+			},
+		},
+	}
+
+	reportPodIP(ctx, wasm, fn, "10.0.0.1")
+	fsvc, err := wasm.fnCreate(ctx, fn)
+	if err != nil {
+		t.Fatalf("Error creating wasm function: %s", err)
+	}
+	if obj := fsvc.KubernetesObjects[len(fsvc.KubernetesObjects)-1]; obj.Kind != "horizontalpodautoscaler" {
+		t.Fatalf("Expected HPA in kubernetes objects of function, got %v", obj.Kind)
+	}
+
+	hpa, err := wasm.hpaops.GetHpa(ctx, functionNamespace, fsvc.Name)
+	if err != nil {
+		t.Fatalf("Error getting HPA: %s", err)
+	}
+	if *hpa.Spec.MinReplicas != 1 || hpa.Spec.MaxReplicas != 3 {
+		t.Fatalf("Expected replicas to be 1-3, got %d-%d", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+	if len(hpa.Spec.Metrics) != 1 || *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization != defaultTargetCPUPercent {
+		t.Fatalf("Expected default target CPU metric, got %v", hpa.Spec.Metrics)
+	}
+	if hpa.Spec.Behavior == nil || *hpa.Spec.Behavior.ScaleDown.StabilizationWindowSeconds != defaultScaleDownStabilizationSeconds {
+		t.Fatalf("Expected default scale down behavior, got %v", hpa.Spec.Behavior)
+	}
+
+	newFn := fn.DeepCopy()
+	newFn.ObjectMeta.ResourceVersion = "2"
+	newFn.Spec.InvokeStrategy.ExecutionStrategy.MaxScale = 5
+	newFn.Spec.InvokeStrategy.ExecutionStrategy.TargetCPUPercent = 50 // nolint: staticcheck
+	err = wasm.updateFunction(ctx, fn, newFn)
+	if err != nil {
+		t.Fatalf("Error updating wasm function: %s", err)
+	}
+
+	hpa, err = wasm.hpaops.GetHpa(ctx, functionNamespace, fsvc.Name)
+	if err != nil {
+		t.Fatalf("Error getting HPA: %s", err)
+	}
+	if hpa.Spec.MaxReplicas != 5 {
+		t.Fatalf("Expected max replicas to be 5, got %d", hpa.Spec.MaxReplicas)
+	}
+	if len(hpa.Spec.Metrics) != 1 || *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization != 50 {
+		t.Fatalf("Expected target CPU metric of 50, got %v", hpa.Spec.Metrics)
+	}
+}
+
+func TestFuncInformerUpdate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubernetesClient := fake.NewSimpleClientset()
+	fissionClient := fClient.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fissionClient)
+
+	funcUID, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, err := fissionClient.CoreV1().Functions(defaultNamespace).Create(ctx, &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            functionName,
+			Namespace:       defaultNamespace,
+			UID:             types.UID(funcUID.String()),
+			ResourceVersion: "1",
+			Annotations: map[string]string{
+				fv1.ANNOTATION_WASM_MODULE_URL: "http://storage/v1/archive?id=v1",
+			},
+		},
+		Spec: fv1.FunctionSpec{
+			InvokeStrategy: fv1.InvokeStrategy{
+				ExecutionStrategy: fv1.ExecutionStrategy{
+					ExecutorType: fv1.ExecutorTypeWasm,
+				},
+			},
+			Package: fv1.FunctionPackageRef{
+				PackageRef: fv1.PackageRef{
+					Namespace:       defaultNamespace,
+					Name:            pkgName,
+					ResourceVersion: "1",
+				},
+			},
+			PodSpec: &apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{
+						Name:  functionName,
+						Image: pkgName,
+						Ports: []apiv1.ContainerPort{
+							{Name: "function", ContainerPort: int32(8888)},
+						},
+					},
+				},
+				TerminationGracePeriodSeconds: new(int64),
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("creating function failed : %s", err)
+	}
+
+	reportPodIP(ctx, wasm, fn, "10.0.0.1")
+	fsvc, err := wasm.fnCreate(ctx, fn)
+	if err != nil {
+		t.Fatalf("Error creating wasm function: %s", err)
+	}
+
+	// waitForDeployment polls until the deployment of the function matches.
+	waitForDeployment := func(desc string, cond func(annotations map[string]string) bool) {
+		err := wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+			depl, err := kubernetesClient.AppsV1().Deployments(functionNamespace).Get(ctx, fsvc.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return cond(depl.Spec.Template.ObjectMeta.Annotations), nil
+		})
+		if err != nil {
+			t.Fatalf("Expected %s: %s", desc, err)
+		}
+	}
+
+	// a new module URL rolls out
+	newFn := fn.DeepCopy()
+	newFn.ObjectMeta.ResourceVersion = "2"
+	newFn.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_URL] = "http://storage/v1/archive?id=v2"
+	_, err = fissionClient.CoreV1().Functions(defaultNamespace).Update(ctx, newFn, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("updating function failed : %s", err)
+	}
+	waitForDeployment("new module URL to roll out", func(annotations map[string]string) bool {
+		return annotations[fv1.ANNOTATION_WASM_MODULE_URL] == "http://storage/v1/archive?id=v2"
+	})
+
+	// a new package version rolls out
+	newFn = newFn.DeepCopy()
+	newFn.ObjectMeta.ResourceVersion = "3"
+	newFn.Spec.Package.PackageRef.ResourceVersion = "2"
+	_, err = fissionClient.CoreV1().Functions(defaultNamespace).Update(ctx, newFn, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("updating function failed : %s", err)
+	}
+	waitForDeployment("new package version to roll out", func(annotations map[string]string) bool {
+		return annotations[fv1.FUNCTION_RESOURCE_VERSION] == "3"
+	})
+}
+
+func TestRefreshFuncPods(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubernetesClient := fake.NewSimpleClientset()
+	fissionClient := fClient.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fissionClient)
 
-	fmt.Printf("wasm function deployment 更新成功：%s\n",dpl.Name)
+	secret, err := kubernetesClient.CoreV1().Secrets(defaultNamespace).Create(ctx, &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "wasm-test-secret",
+			Namespace:       defaultNamespace,
+			ResourceVersion: "1",
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("creating secret failed : %s", err)
+	}
+	_, err = kubernetesClient.CoreV1().ConfigMaps(defaultNamespace).Create(ctx, &apiv1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "wasm-test-configmap",
+			Namespace:       defaultNamespace,
+			ResourceVersion: "2",
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("creating configmap failed : %s", err)
+	}
 
+	funcUID, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, err := fissionClient.CoreV1().Functions(defaultNamespace).Create(ctx, &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      functionName,
+			Namespace: defaultNamespace,
+			UID:       types.UID(funcUID.String()),
+		},
+		Spec: fv1.FunctionSpec{
+			InvokeStrategy: fv1.InvokeStrategy{
+				ExecutionStrategy: fv1.ExecutionStrategy{
+					ExecutorType: fv1.ExecutorTypeWasm,
+				},
+			},
+			Secrets:    []fv1.SecretReference{{Name: "wasm-test-secret", Namespace: defaultNamespace}},
+			ConfigMaps: []fv1.ConfigMapReference{{Name: "wasm-test-configmap", Namespace: defaultNamespace}},
+			PodSpec: &apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{
+						Name:  functionName,
+						Image: pkgName,
+						Ports: []apiv1.ContainerPort{
+							{Name: "function", ContainerPort: int32(8888)},
+						},
+					},
+				},
+				TerminationGracePeriodSeconds: new(int64),
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("creating function failed : %s", err)
+	}
+
+	reportPodIP(ctx, wasm, fn, "10.0.0.1")
+	fsvc, err := wasm.fnCreate(ctx, fn)
+	if err != nil {
+		t.Fatalf("Error creating wasm function: %s", err)
+	}
+
+	// checkRVCount checks the resource version count in the environment of
+	// the function container, and that the rest of the container is kept.
+	checkRVCount := func(expected string) {
+		depl, err := kubernetesClient.AppsV1().Deployments(functionNamespace).Get(ctx, fsvc.Name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Error getting deployment: %s", err)
+		}
+		containers := depl.Spec.Template.Spec.Containers
+		if len(containers) != 1 || containers[0].Name != functionName || containers[0].Image != pkgName {
+			t.Fatalf("Expected function container to be kept, got %v", containers)
+		}
+		for _, env := range containers[0].Env {
+			if env.Name == fv1.ResourceVersionCount {
+				if env.Value != expected {
+					t.Fatalf("Expected resource version count %s, got %s", expected, env.Value)
+				}
+				return
+			}
+		}
+		t.Fatalf("Expected resource version count %s, got none", expected)
+	}
+	checkRVCount("3")
+
+	// updating a referenced secret rolls the pods
+	newSecret := secret.DeepCopy()
+	newSecret.ObjectMeta.ResourceVersion = "5"
+	_, err = kubernetesClient.CoreV1().Secrets(defaultNamespace).Update(ctx, newSecret, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatalf("updating secret failed : %s", err)
+	}
+	handlers := cms.SecretEventHandlers(ctx, wasm.logger, fissionClient, kubernetesClient,
+		map[fv1.ExecutorType]executortype.ExecutorType{fv1.ExecutorTypeWasm: wasm})
+	handlers.OnUpdate(secret, newSecret)
+	checkRVCount("7")
+
+	// refreshing without changes keeps the deployment as is
+	err = wasm.RefreshFuncPods(ctx, wasm.logger, *fn)
+	if err != nil {
+		t.Fatalf("Error refreshing function pods: %s", err)
+	}
+	checkRVCount("7")
+}
+
+func TestGetDeploymentSpecSecretsAndResources(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubernetesClient := fake.NewSimpleClientset(
+		&apiv1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "wasm-test-secret", Namespace: defaultNamespace}},
+		&apiv1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "wasm-test-configmap", Namespace: defaultNamespace}},
+	)
+	fissionClient := fClient.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fissionClient)
+
+	fn := &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      functionName,
+			Namespace: defaultNamespace,
+		},
+		Spec: fv1.FunctionSpec{
+			InvokeStrategy: fv1.InvokeStrategy{
+				ExecutionStrategy: fv1.ExecutionStrategy{
+					ExecutorType: fv1.ExecutorTypeWasm,
+				},
+			},
+			Secrets:    []fv1.SecretReference{{Name: "wasm-test-secret", Namespace: defaultNamespace}},
+			ConfigMaps: []fv1.ConfigMapReference{{Name: "wasm-test-configmap", Namespace: defaultNamespace}},
+			Resources: apiv1.ResourceRequirements{
+				Requests: apiv1.ResourceList{
+					apiv1.ResourceCPU:    resource.MustParse("100m"),
+					apiv1.ResourceMemory: resource.MustParse("16Mi"),
+				},
+				Limits: apiv1.ResourceList{
+					apiv1.ResourceCPU:    resource.MustParse("200m"),
+					apiv1.ResourceMemory: resource.MustParse("32Mi"),
+				},
+			},
+			PodSpec: &apiv1.PodSpec{
+				Containers:                    []apiv1.Container{{Name: functionName, Image: pkgName}},
+				TerminationGracePeriodSeconds: new(int64),
+			},
+		},
+	}
+
+	minScale := int32(1)
+	depl, err := wasm.getDeploymentSpec(ctx, fn, &minScale, functionName, functionNamespace, nil, nil)
+	if err != nil {
+		t.Fatalf("Error getting deployment spec: %s", err)
+	}
+
+	podSpec := depl.Spec.Template.Spec
+	if podSpec.RuntimeClassName == nil || *podSpec.RuntimeClassName != "wasm" {
+		t.Fatalf("Expected runtime class wasm, got %v", podSpec.RuntimeClassName)
+	}
+	if len(podSpec.Containers) != 1 {
+		t.Fatalf("Expected a single container, got %v", podSpec.Containers)
+	}
+	container := podSpec.Containers[0]
+
+	if !reflect.DeepEqual(container.Resources, fn.Spec.Resources) {
+		t.Fatalf("Expected resources %v, got %v", fn.Spec.Resources, container.Resources)
+	}
+
+	expectedEnvFrom := []apiv1.EnvFromSource{
+		{ConfigMapRef: &apiv1.ConfigMapEnvSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "wasm-test-configmap"}}},
+		{SecretRef: &apiv1.SecretEnvSource{LocalObjectReference: apiv1.LocalObjectReference{Name: "wasm-test-secret"}}},
+	}
+	if !reflect.DeepEqual(container.EnvFrom, expectedEnvFrom) {
+		t.Fatalf("Expected env from %v, got %v", expectedEnvFrom, container.EnvFrom)
+	}
+
+	mountPaths := make(map[string]string)
+	for _, mount := range container.VolumeMounts {
+		if !mount.ReadOnly {
+			t.Fatalf("Expected volume mount %s to be read only", mount.Name)
+		}
+		mountPaths[mount.Name] = mount.MountPath
+	}
+	expectedMountPaths := map[string]string{
+		"fission-secret-0":    "/secrets/default/wasm-test-secret",
+		"fission-configmap-0": "/configs/default/wasm-test-configmap",
+	}
+	if !reflect.DeepEqual(mountPaths, expectedMountPaths) {
+		t.Fatalf("Expected volume mounts %v, got %v", expectedMountPaths, mountPaths)
+	}
+	if len(podSpec.Volumes) != 2 {
+		t.Fatalf("Expected 2 volumes, got %v", podSpec.Volumes)
+	}
+
+	// secrets of other namespaces are rejected
+	fn.Spec.Secrets[0].Namespace = "other"
+	_, err = wasm.getDeploymentSpec(ctx, fn, &minScale, functionName, functionNamespace, nil, nil)
+	if err == nil {
+		t.Fatal("Expected secret of another namespace to be rejected")
+	}
+}
+
+func TestGetDeploymentSpecOCIModule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"layers":[{"mediaType":"%v","digest":"sha256:%v"}]}`,
+		wasmmodule.WasmLayerMediaType, strings.Repeat("b", 64))
+	sum := sha256.Sum256([]byte(manifest))
+	digest := hex.EncodeToString(sum[:])
+
+	requests := 0
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v2/org/hello/manifests/v1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, manifest)
+	}))
+	defer registry.Close()
+	ref := strings.TrimPrefix(registry.URL, "http://") + "/org/hello"
+
+	kubernetesClient := fake.NewSimpleClientset()
+	fissionClient := fClient.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fissionClient)
+
+	_, err := fissionClient.CoreV1().Packages(defaultNamespace).Create(ctx, &fv1.Package{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pkgName,
+			Namespace: defaultNamespace,
+		},
+		Spec: fv1.PackageSpec{
+			Deployment: fv1.Archive{
+				Type: fv1.ArchiveTypeOCI,
+				URL:  ref + ":v1",
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("creating package failed : %s", err)
+	}
+
+	fn := &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      functionName,
+			Namespace: defaultNamespace,
+		},
+		Spec: fv1.FunctionSpec{
+			InvokeStrategy: fv1.InvokeStrategy{
+				ExecutionStrategy: fv1.ExecutionStrategy{
+					ExecutorType: fv1.ExecutorTypeWasm,
+				},
+			},
+			Package: fv1.FunctionPackageRef{
+				PackageRef: fv1.PackageRef{Name: pkgName, Namespace: defaultNamespace},
+			},
+			PodSpec: &apiv1.PodSpec{
+				Containers:                    []apiv1.Container{{Name: functionName, Image: ref + ":v1"}},
+				TerminationGracePeriodSeconds: new(int64),
+			},
+		},
+	}
+
+	pinned := ref + "@sha256:" + digest
+	for i := 0; i < 2; i++ {
+		minScale := int32(1)
+		depl, err := wasm.getDeploymentSpec(ctx, fn, &minScale, functionName, functionNamespace, nil, nil)
+		if err != nil {
+			t.Fatalf("Error getting deployment spec: %s", err)
+		}
+		if image := depl.Spec.Template.Spec.Containers[0].Image; image != pinned {
+			t.Fatalf("Expected image %s, got %s", pinned, image)
+		}
+		if annotation := depl.Spec.Template.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_OCI]; annotation != pinned {
+			t.Fatalf("Expected annotation %s, got %s", pinned, annotation)
+		}
+	}
+
+	// the digest is pinned in the package, so the registry is asked once
+	if requests != 1 {
+		t.Fatalf("Expected 1 registry request, got %d", requests)
+	}
+	pkg, err := fissionClient.CoreV1().Packages(defaultNamespace).Get(ctx, pkgName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting package failed : %s", err)
+	}
+	expected := fv1.Checksum{Type: fv1.ChecksumTypeSHA256, Sum: digest}
+	if pkg.Spec.Deployment.Checksum != expected {
+		t.Fatalf("Expected checksum %v, got %v", expected, pkg.Spec.Deployment.Checksum)
+	}
+}
+
+func TestGetDeploymentSpecWasmSpec(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubernetesClient := fake.NewSimpleClientset()
+	fissionClient := fClient.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fissionClient)
+
+	maxMemory := resource.MustParse("64Mi")
+	fn := &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      functionName,
+			Namespace: defaultNamespace,
+		},
+		Spec: fv1.FunctionSpec{
+			InvokeStrategy: fv1.InvokeStrategy{
+				ExecutionStrategy: fv1.ExecutionStrategy{
+					ExecutorType: fv1.ExecutorTypeWasm,
+				},
+			},
+			Wasm: &fv1.WasmSpec{
+				Module:     fv1.WasmModule{URL: "http://example.com/hello.wasm", Filename: "hello.wasm"},
+				Entrypoint: "handler",
+				Args:       []string{"--verbose"},
+				Env:        []fv1.WasmEnvVar{{Name: "GREETING", Value: "hello"}},
+				PreopenDirs: []fv1.WasmPreopenDir{
+					{Path: "/data", GuestPath: "/data"},
+					{Path: "/cache", GuestPath: "/tmp", ReadOnly: true},
+				},
+				Engine:    fv1.WasmEngineWasmtime,
+				MaxMemory: &maxMemory,
+				Fuel:      1000,
+			},
+			PodSpec: &apiv1.PodSpec{
+				Containers:                    []apiv1.Container{{Name: functionName, Image: pkgName}},
+				TerminationGracePeriodSeconds: new(int64),
+			},
+		},
+	}
+
+	minScale := int32(1)
+	depl, err := wasm.getDeploymentSpec(ctx, fn, &minScale, functionName, functionNamespace, nil, nil)
+	if err != nil {
+		t.Fatalf("Error getting deployment spec: %s", err)
+	}
+
+	expectedAnnotations := map[string]string{
+		fv1.ANNOTATION_WASM_MODULE_URL:      "http://example.com/hello.wasm",
+		fv1.ANNOTATION_WASM_MODULE_FILENAME: "hello.wasm",
+		fv1.ANNOTATION_WASM_ENTRYPOINT:      "handler",
+		fv1.ANNOTATION_WASM_ENGINE:          "wasmtime",
+		fv1.ANNOTATION_WASM_PREOPENS:        "/data:/data,/cache:/tmp:ro",
+		fv1.ANNOTATION_WASM_MAX_MEMORY:      "67108864",
+		fv1.ANNOTATION_WASM_FUEL:            "1000",
+	}
+	annotations := depl.Spec.Template.ObjectMeta.Annotations
+	for k, v := range expectedAnnotations {
+		if annotations[k] != v {
+			t.Fatalf("Expected pod annotation %s=%s, got %v", k, v, annotations)
+		}
+	}
+
+	container := depl.Spec.Template.Spec.Containers[0]
+	if !reflect.DeepEqual(container.Args, []string{"--verbose"}) {
+		t.Fatalf("Expected args [--verbose], got %v", container.Args)
+	}
+	found := false
+	for _, env := range container.Env {
+		if env.Name == "GREETING" && env.Value == "hello" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Expected env GREETING=hello, got %v", container.Env)
+	}
+}
+
+func TestGetDeploymentSpecModuleCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Setenv("WASM_MODULE_CACHE_URL", "http://wasm-module-cache.fission:8010")
+	kubernetesClient := fake.NewSimpleClientset()
+	fissionClient := fClient.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fissionClient)
+
+	moduleURL := "http://storagesvc.fission/v1/archive?id=hello"
+	moduleSum := strings.Repeat("c", 64)
+	_, err := fissionClient.CoreV1().Packages(defaultNamespace).Create(ctx, &fv1.Package{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pkgName,
+			Namespace: defaultNamespace,
+		},
+		Spec: fv1.PackageSpec{
+			Deployment: fv1.Archive{
+				Type:     fv1.ArchiveTypeUrl,
+				URL:      moduleURL,
+				Checksum: fv1.Checksum{Type: fv1.ChecksumTypeSHA256, Sum: moduleSum},
+			},
+			DeploymentVariants: []fv1.DeploymentVariant{
+				{
+					Engine:       fv1.WasmEngineWasmtime,
+					Architecture: "arm64",
+					Archive: fv1.Archive{
+						Type:     fv1.ArchiveTypeUrl,
+						URL:      moduleURL + "-arm64",
+						Checksum: fv1.Checksum{Type: fv1.ChecksumTypeSHA256, Sum: strings.Repeat("d", 64)},
+					},
+				},
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatalf("creating package failed : %s", err)
+	}
+
+	fn := &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      functionName,
+			Namespace: defaultNamespace,
+		},
+		Spec: fv1.FunctionSpec{
+			InvokeStrategy: fv1.InvokeStrategy{
+				ExecutionStrategy: fv1.ExecutionStrategy{
+					ExecutorType: fv1.ExecutorTypeWasm,
+				},
+			},
+			Package: fv1.FunctionPackageRef{
+				PackageRef: fv1.PackageRef{Name: pkgName, Namespace: defaultNamespace},
+			},
+			Wasm: &fv1.WasmSpec{
+				Module: fv1.WasmModule{URL: moduleURL, Filename: "hello.wasm"},
+			},
+			PodSpec: &apiv1.PodSpec{
+				Containers:                    []apiv1.Container{{Name: functionName, Image: pkgName}},
+				TerminationGracePeriodSeconds: new(int64),
+			},
+		},
+	}
+
+	fissionClient.ClearActions()
+	minScale := int32(1)
+	depl, err := wasm.getDeploymentSpec(ctx, fn, &minScale, functionName, functionNamespace, nil, nil)
+	if err != nil {
+		t.Fatalf("Error getting deployment spec: %s", err)
+	}
+	// the package is got once for all the details of the module
+	gets := 0
+	for _, action := range fissionClient.Actions() {
+		if action.Matches("get", "packages") {
+			gets++
+		}
+	}
+	if gets != 1 {
+		t.Fatalf("Expected 1 package get, got %d", gets)
+	}
+	if sum := depl.Spec.Template.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_SHA256]; sum != moduleSum {
+		t.Fatalf("Expected module checksum %s, got %s", moduleSum, sum)
+	}
+	variants, err := wasmmodule.DecodeVariants(depl.Spec.Template.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_VARIANTS])
+	if err != nil {
+		t.Fatalf("Error decoding module variants: %s", err)
+	}
+	expectedVariants := []wasmmodule.Variant{
+		{Engine: "wasmtime", Architecture: "arm64", URL: moduleURL + "-arm64", SHA256: strings.Repeat("d", 64)},
+	}
+	if !reflect.DeepEqual(variants, expectedVariants) {
+		t.Fatalf("Expected module variants %v, got %v", expectedVariants, variants)
+	}
+
+	env := depl.Spec.Template.Spec.Containers[0].Env
+	found := false
+	for _, e := range env {
+		if e.Name == envWasmModuleCacheURL {
+			if e.Value != "http://wasm-module-cache.fission:8010" {
+				t.Fatalf("Expected the node local module cache service, got %s", e.Value)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Expected env %s, got %v", envWasmModuleCacheURL, env)
+	}
+}
+
+func TestGetUsageReportEnv(t *testing.T) {
+	signer := util.NewCallbackSigner([]byte("test"))
+	wasm := &Wasm{callbackSigner: signer}
+	fn := &fv1.Function{ObjectMeta: metav1.ObjectMeta{Name: functionName, Namespace: defaultNamespace, UID: "fn-uid"}}
+	if env := wasm.getUsageReportEnv(fn); env != nil {
+		t.Fatalf("Expected no usage report env, got %v", env)
+	}
+	if reportURL := wasm.getUsageReportURL(fn); len(reportURL) != 0 {
+		t.Fatalf("Expected no usage report URL, got %v", reportURL)
+	}
+
+	wasm.usageReportURL = "http://executor.fission/v2/wasmUsage"
+	reportURL := "http://executor.fission/v2/wasmUsage/fn-uid?token=" + signer.Sign("fn-uid")
+	if u := wasm.getUsageReportURL(fn); u != reportURL {
+		t.Fatalf("Expected usage report URL %v, got %v", reportURL, u)
+	}
+	expected := []apiv1.EnvVar{
+		{Name: envWasmUsageReportURL, Value: reportURL},
+		{Name: envWasmFunctionNS, Value: defaultNamespace},
+		{Name: envWasmFunctionName, Value: functionName},
+	}
+	if env := wasm.getUsageReportEnv(fn); !reflect.DeepEqual(env, expected) {
+		t.Fatalf("Expected usage report env %v, got %v", expected, env)
+	}
+}
+
+func TestPoolCreate(t *testing.T) {
+	t.Setenv("WASM_POOL_SIZE", "2")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var specializeReq wasmSpecializeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/specialize" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&specializeReq); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}))
+	defer server.Close()
+
+	kubernetesClient := fake.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fClient.NewSimpleClientset())
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wasm.poolSpecializePort, err = strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := wasm.pools[defaultPoolRuntimeClass]
+	if pool == nil {
+		t.Fatal("expected a pool for the default runtime class")
+	}
+	err = wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		depl, err := kubernetesClient.AppsV1().Deployments(functionNamespace).Get(ctx, pool.getDeployName(), metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		return *depl.Spec.Replicas == 2 && *depl.Spec.Template.Spec.RuntimeClassName == defaultPoolRuntimeClass, nil
+	})
+	if err != nil {
+		t.Fatalf("pool deployment not created: %v", err)
+	}
+
+	poolPod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "wasm-pool-pod",
+			Namespace: functionNamespace,
+			Labels:    pool.getPoolLabels(),
+		},
+		Status: apiv1.PodStatus{
+			PodIP: "127.0.0.1",
+			Conditions: []apiv1.PodCondition{
+				{Type: apiv1.PodReady, Status: apiv1.ConditionTrue},
+			},
+			ContainerStatuses: []apiv1.ContainerStatus{{Ready: true}},
+		},
+	}
+	_, err = kubernetesClient.CoreV1().Pods(functionNamespace).Create(ctx, poolPod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, err := wasm.podLister.Pods(functionNamespace).Get(poolPod.Name)
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("pool pod not seen by the pod lister: %v", err)
+	}
+
+	funcUID, err := uuid.NewV4()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      functionName,
+			Namespace: defaultNamespace,
+			UID:       types.UID(funcUID.String()),
+		},
+		Spec: fv1.FunctionSpec{
+			InvokeStrategy: fv1.InvokeStrategy{
+				ExecutionStrategy: fv1.ExecutionStrategy{
+					ExecutorType: fv1.ExecutorTypeWasm,
+				},
+			},
+			PodSpec: &apiv1.PodSpec{},
+			Wasm: &fv1.WasmSpec{
+				Module:     fv1.WasmModule{URL: "http://storagesvc/hello.wasm", Filename: "hello.wasm"},
+				Entrypoint: "handler",
+				Mode:       fv1.WasmModePool,
+			},
+		},
+	}
+
+	fsvc, err := wasm.createFunction(ctx, fn)
+	if err != nil {
+		t.Fatalf("error creating function from pool: %v", err)
+	}
+	if fsvc.Address != "127.0.0.1:8888" || fsvc.PodPort != poolFunctionPort {
+		t.Fatalf("unexpected function service address %v, port %v", fsvc.Address, fsvc.PodPort)
+	}
+	if podObj := getPoolPodObj(fsvc.KubernetesObjects); podObj == nil || podObj.Name != poolPod.Name {
+		t.Fatalf("expected function service to reference the pool pod, got %+v", fsvc.KubernetesObjects)
+	}
+	if specializeReq.FunctionUID != string(fn.ObjectMeta.UID) ||
+		!reflect.DeepEqual(specializeReq.Wasm, *fn.Spec.Wasm) {
+		t.Fatalf("unexpected specialize request %+v", specializeReq)
+	}
+
+	pod, err := kubernetesClient.CoreV1().Pods(functionNamespace).Get(ctx, poolPod.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Labels["managed"] != "false" || pod.Labels[fv1.FUNCTION_UID] != string(fn.ObjectMeta.UID) {
+		t.Fatalf("pool pod was not relabeled for the function: %v", pod.Labels)
+	}
+	if _, err := kubernetesClient.AppsV1().Deployments(functionNamespace).Get(ctx, wasm.getObjName(fn), metav1.GetOptions{}); err == nil {
+		t.Fatal("expected no deployment to be created for a function started from the pool")
+	}
+
+	// the pool is empty now, deleting the function deletes its pod
+	err = wasm.fnDelete(ctx, fn)
+	if err != nil {
+		t.Fatalf("error deleting function: %v", err)
+	}
+	if _, err := kubernetesClient.CoreV1().Pods(functionNamespace).Get(ctx, poolPod.Name, metav1.GetOptions{}); err == nil {
+		t.Fatal("expected the pool pod of the function to be deleted")
+	}
+}
+
+func TestPostToRuntimeTimeout(t *testing.T) {
+	// the runtime of a stuck pod does not answer before the test ends
+	stuck := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stuck
+	}))
+	defer server.Close()
+	defer close(stuck)
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	specializePort, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wasm := &Wasm{
+		poolSpecializePort: specializePort,
+		runtimeClient:      &http.Client{Timeout: 100 * time.Millisecond},
+	}
+	pod := &apiv1.Pod{Status: apiv1.PodStatus{PodIP: "127.0.0.1"}}
+
+	start := time.Now()
+	err = wasm.postToRuntime(context.Background(), &fv1.Function{}, pod, "/specialize", []byte("{}"))
+	if err == nil {
+		t.Fatal("expected an error from a stuck runtime")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the request to time out with the client, took %v", elapsed)
+	}
+}
+
+func TestWasmHostSetReserve(t *testing.T) {
+	group := &wasmHostGroup{
+		runtimeClass: defaultPoolRuntimeClass,
+		memory:       resource.MustParse("128Mi"),
+		maxFunctions: 2,
+	}
+	hs := makeWasmHostSet()
+	hosts := []string{"ns/host-a", "ns/host-b"}
+
+	reserve := func(uid string, memory int64) string {
+		host, err := hs.reserve(types.UID(uid), memory, hosts, group)
+		if err != nil {
+			return ""
+		}
+		return host
+	}
+
+	// functions pack into the fullest host with room for them
+	if host := reserve("fn-1", 32<<20); host != "ns/host-a" {
+		t.Fatalf("expected fn-1 in host-a, got %q", host)
+	}
+	if host := reserve("fn-2", 32<<20); host != "ns/host-a" {
+		t.Fatalf("expected fn-2 to pack into host-a, got %q", host)
+	}
+	// host-a runs its maximum of functions
+	if host := reserve("fn-3", 32<<20); host != "ns/host-b" {
+		t.Fatalf("expected fn-3 in host-b, got %q", host)
+	}
+	// the memory caps of host-b would exceed its memory
+	if host := reserve("fn-4", 128<<20); host != "" {
+		t.Fatalf("expected no host to have room for fn-4, got %q", host)
+	}
+	// reserving again returns the host the function is loaded into
+	if host := reserve("fn-1", 32<<20); host != "ns/host-a" {
+		t.Fatalf("expected fn-1 to stay in host-a, got %q", host)
+	}
+
+	hs.release("fn-1")
+	if host := reserve("fn-4", 96<<20); host != "ns/host-a" {
+		t.Fatalf("expected fn-4 in host-a, got %q", host)
+	}
+
+	uids := hs.releaseHost("ns/host-a")
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	if !reflect.DeepEqual(uids, []types.UID{"fn-2", "fn-4"}) {
+		t.Fatalf("unexpected functions released with host-a: %v", uids)
+	}
+	if _, ok := hs.hostOf("fn-2"); ok {
+		t.Fatal("expected fn-2 to be released")
+	}
+	if host, ok := hs.hostOf("fn-3"); !ok || host != "ns/host-b" {
+		t.Fatalf("expected fn-3 to stay in host-b, got %q", host)
+	}
+}
+
+func TestHostCreate(t *testing.T) {
+	t.Setenv("WASM_HOST_COUNT", "1")
+	t.Setenv("WASM_HOST_MEMORY", "256Mi")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	loaded := make(chan wasmSpecializeRequest, 2)
+	unloaded := make(chan wasmUnloadRequest, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/load":
+			req := wasmSpecializeRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			loaded <- req
+		case "/unload":
+			req := wasmUnloadRequest{}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			unloaded <- req
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	kubernetesClient := fake.NewSimpleClientset()
+	fissionClient := fClient.NewSimpleClientset()
+	wasm := makeTestWasm(ctx, t, kubernetesClient, fissionClient)
+	_, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wasm.poolSpecializePort, err = strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := wasm.hostGroups[defaultPoolRuntimeClass]
+	if group == nil {
+		t.Fatal("expected a host group for the default runtime class")
+	}
+	err = wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		depl, err := kubernetesClient.AppsV1().Deployments(functionNamespace).Get(ctx, group.getDeployName(), metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		limit := depl.Spec.Template.Spec.Containers[0].Resources.Limits[apiv1.ResourceMemory]
+		return limit.Cmp(resource.MustParse("256Mi")) == 0, nil
+	})
+	if err != nil {
+		t.Fatalf("host deployment not created: %v", err)
+	}
+
+	hostPod := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "wasm-host-pod",
+			Namespace: functionNamespace,
+			Labels:    group.getHostLabels(),
+		},
+		Status: apiv1.PodStatus{
+			PodIP: "127.0.0.1",
+			Conditions: []apiv1.PodCondition{
+				{Type: apiv1.PodReady, Status: apiv1.ConditionTrue},
+			},
+			ContainerStatuses: []apiv1.ContainerStatus{{Ready: true}},
+		},
+	}
+	_, err = kubernetesClient.CoreV1().Pods(functionNamespace).Create(ctx, hostPod, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, err := wasm.podLister.Pods(functionNamespace).Get(hostPod.Name)
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("host pod not seen by the pod lister: %v", err)
+	}
+
+	// functions of an environment allowing infinite functions per
+	// container share hosts without asking for it
+	_, err = fissionClient.CoreV1().Environments(defaultNamespace).Create(ctx, &fv1.Environment{
+		ObjectMeta: metav1.ObjectMeta{Name: "wasm", Namespace: defaultNamespace},
+		Spec: fv1.EnvironmentSpec{
+			AllowedFunctionsPerContainer: fv1.AllowedFunctionsPerContainerInfinite,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, err := wasm.envLister.Environments(defaultNamespace).Get("wasm")
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatalf("environment not seen by the environment lister: %v", err)
+	}
+
+	newFunction := func(name string, ws *fv1.WasmSpec) *fv1.Function {
+		funcUID, err := uuid.NewV4()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &fv1.Function{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: defaultNamespace,
+				UID:       types.UID(funcUID.String()),
+			},
+			Spec: fv1.FunctionSpec{
+				Environment: fv1.EnvironmentReference{Name: "wasm", Namespace: defaultNamespace},
+				InvokeStrategy: fv1.InvokeStrategy{
+					ExecutionStrategy: fv1.ExecutionStrategy{
+						ExecutorType: fv1.ExecutorTypeWasm,
+					},
+				},
+				PodSpec: &apiv1.PodSpec{},
+				Wasm:    ws,
+			},
+		}
+	}
+	maxMemory := resource.MustParse("32Mi")
+	fns := []*fv1.Function{
+		newFunction("hello", &fv1.WasmSpec{
+			Module:    fv1.WasmModule{URL: "http://storagesvc/hello.wasm"},
+			Mode:      fv1.WasmModeShared,
+			MaxMemory: &maxMemory,
+		}),
+		newFunction("world", &fv1.WasmSpec{
+			Module: fv1.WasmModule{URL: "http://storagesvc/world.wasm"},
+		}),
+	}
+	for i, fn := range fns {
+		fsvc, err := wasm.createFunction(ctx, fn)
+		if err != nil {
+			t.Fatalf("error loading function %v into host: %v", fn.ObjectMeta.Name, err)
+		}
+		expectedAddress := "127.0.0.1:8888/fn/" + string(fn.ObjectMeta.UID)
+		if fsvc.Address != expectedAddress {
+			t.Fatalf("expected address %v, got %v", expectedAddress, fsvc.Address)
+		}
+		endpoints, _ := wasm.GetPodEndpoints(ctx, fsvc)
+		if !reflect.DeepEqual(endpoints, []string{expectedAddress}) {
+			t.Fatalf("unexpected pod endpoints %v", endpoints)
+		}
+
+		req := <-loaded
+		expectedMemory := []int64{32 << 20, defaultHostFunctionMemory}[i]
+		if req.FunctionUID != string(fn.ObjectMeta.UID) || req.MemoryLimit != expectedMemory ||
+			req.RoutePrefix != "/fn/"+string(fn.ObjectMeta.UID) {
+			t.Fatalf("unexpected load request %+v", req)
+		}
+		if host, ok := wasm.hosts.hostOf(fn.ObjectMeta.UID); !ok || host != functionNamespace+"/"+hostPod.Name {
+			t.Fatalf("expected function %v in host %v, got %q", fn.ObjectMeta.Name, hostPod.Name, host)
+		}
+	}
+
+	err = wasm.fnDelete(ctx, fns[0])
+	if err != nil {
+		t.Fatalf("error deleting function: %v", err)
+	}
+	if req := <-unloaded; req.FunctionUID != string(fns[0].ObjectMeta.UID) {
+		t.Fatalf("unexpected unload request %+v", req)
+	}
+	if _, err := kubernetesClient.CoreV1().Pods(functionNamespace).Get(ctx, hostPod.Name, metav1.GetOptions{}); err != nil {
+		t.Fatalf("expected the host to keep running: %v", err)
+	}
+
+	// functions are forgotten along with their host
+	err = kubernetesClient.CoreV1().Pods(functionNamespace).Delete(ctx, hostPod.Name, metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wait.PollImmediate(50*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, ok := wasm.hosts.hostOf(fns[1].ObjectMeta.UID)
+		return !ok, nil
+	})
+	if err != nil {
+		t.Fatal("expected the function of the deleted host to be released")
+	}
+	if _, err := wasm.fsCache.GetByFunctionUID(fns[1].ObjectMeta.UID); err == nil {
+		t.Fatal("expected the function of the deleted host to be removed from the cache")
+	}
 }
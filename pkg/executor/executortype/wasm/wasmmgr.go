@@ -3,6 +3,8 @@ package wasm
 import (
 	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"reflect"
 	"strconv"
@@ -31,20 +33,22 @@ import (
 	"github.com/fission/fission/pkg/executor/fscache"
 	"github.com/fission/fission/pkg/executor/metrics"
 	"github.com/fission/fission/pkg/executor/reaper"
+	"github.com/fission/fission/pkg/executor/util"
 	hpautils "github.com/fission/fission/pkg/executor/util/hpa"
 	"github.com/fission/fission/pkg/generated/clientset/versioned"
 	finformerv1 "github.com/fission/fission/pkg/generated/informers/externalversions/core/v1"
+	flisterv1 "github.com/fission/fission/pkg/generated/listers/core/v1"
 	"github.com/fission/fission/pkg/throttler"
 	"github.com/fission/fission/pkg/utils"
 	"github.com/fission/fission/pkg/utils/maps"
 	otelUtils "github.com/fission/fission/pkg/utils/otel"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 )
 
 var (
 	_ executortype.ExecutorType = &Wasm{}
 )
 
-
 type (
 	// Wasm represents an ExecutorType
 	Wasm struct {
@@ -53,6 +57,7 @@ type (
 		kubernetesClient kubernetes.Interface
 		fissionClient    versioned.Interface
 		fpmap            *functionPodIPMap
+		podIPWaiter      *podIPWaiter
 		instanceID       string
 		// fetcherConfig    *fetcherConfig.Config
 
@@ -68,11 +73,41 @@ type (
 
 		deplLister appslisters.DeploymentLister
 		svcLister  corelisters.ServiceLister
+		podLister  corelisters.PodLister
+		envLister  flisterv1.EnvironmentLister
 
 		deplListerSynced k8sCache.InformerSynced
 		svcListerSynced  k8sCache.InformerSynced
+		podListerSynced  k8sCache.InformerSynced
+		envListerSynced  k8sCache.InformerSynced
 
 		hpaops *hpautils.HpaOperations
+
+		callbackSigner *util.CallbackSigner
+
+		// ociResolver pins the digest of modules published as OCI artifacts
+		ociResolver *wasmmodule.OCIResolver
+
+		// pools of pre-warmed wasm runtime pods by runtime class, for
+		// functions in pool mode
+		pools              map[string]*wasmPool
+		poolSpecializePort int
+		// runtimeClient sends the specialize and load requests to the
+		// runtime of pool and host pods
+		runtimeClient *http.Client
+
+		// groups of wasm hosts by runtime class, for functions sharing
+		// host pods, and the functions loaded into the hosts
+		hostGroups map[string]*wasmHostGroup
+		hosts      *wasmHostSet
+
+		// moduleCacheURL is the URL of the node local module cache
+		// service, if it is deployed
+		moduleCacheURL string
+
+		// usageReportURL is the executor endpoint runtimes report the
+		// usage of invocations to, empty if reporting is disabled
+		usageReportURL string
 	}
 )
 
@@ -85,8 +120,11 @@ func MakeWasm(
 	namespace string,
 	instanceID string,
 	funcInformer finformerv1.FunctionInformer,
+	envInformer finformerv1.EnvironmentInformer,
 	deplInformer appsinformers.DeploymentInformer,
 	svcInformer coreinformers.ServiceInformer,
+	podInformer coreinformers.PodInformer,
+	callbackSigner *util.CallbackSigner,
 ) (executortype.ExecutorType, error) {
 	enableIstio := false
 	if len(os.Getenv("ENABLE_ISTIO")) > 0 {
@@ -96,20 +134,24 @@ func MakeWasm(
 		}
 		enableIstio = istio
 	}
- 
-	
-    PodIPMap := makeFunctionServiceMap(logger, time.Minute)
-	if PodIPMap!=nil{
-		logger.Info("*****PodIPMap成功创建！！！！**********")
-	}
 
 	wasm := &Wasm{
 		logger: logger.Named("Wasm"),
 
 		fissionClient:    fissionClient,
 		kubernetesClient: kubernetesClient,
-		fpmap:            PodIPMap,
+		fpmap:            makeFunctionServiceMap(logger),
+		podIPWaiter:      makePodIPWaiter(),
 		instanceID:       instanceID,
+		ociResolver:      wasmmodule.NewOCIResolver(),
+
+		pools:              makeWasmPools(logger),
+		poolSpecializePort: poolSpecializePort,
+		runtimeClient:      makeRuntimeClient(),
+		hostGroups:         makeWasmHostGroups(logger),
+		hosts:              makeWasmHostSet(),
+		moduleCacheURL:     os.Getenv(envWasmModuleCacheURL),
+		usageReportURL:     os.Getenv("WASM_USAGE_REPORT_URL"),
 
 		namespace: namespace,
 		fsCache:   fscache.MakeFunctionServiceCache(logger),
@@ -121,6 +163,8 @@ func MakeWasm(
 		defaultIdlePodReapTime: 1 * time.Minute,
 
 		hpaops: hpautils.NewHpaOperations(logger, kubernetesClient, instanceID),
+
+		callbackSigner: callbackSigner,
 	}
 	wasm.deplLister = deplInformer.Lister()
 	wasm.deplListerSynced = deplInformer.Informer().HasSynced
@@ -128,17 +172,25 @@ func MakeWasm(
 	wasm.svcLister = svcInformer.Lister()
 	wasm.svcListerSynced = svcInformer.Informer().HasSynced
 
+	wasm.podLister = podInformer.Lister()
+	wasm.podListerSynced = podInformer.Informer().HasSynced
+
+	wasm.envLister = envInformer.Lister()
+	wasm.envListerSynced = envInformer.Informer().HasSynced
+
 	funcInformer.Informer().AddEventHandler(wasm.FuncInformerHandler(ctx))
-	wasm.logger.Info("*****wasm开始运行成功！！！！**********")
+	podInformer.Informer().AddEventHandler(wasm.PodInformerHandler())
 	return wasm, nil
 }
 
 // Run start the function along with an object reaper.
 func (wasm *Wasm) Run(ctx context.Context) {
-	if ok := k8sCache.WaitForCacheSync(ctx.Done(), wasm.deplListerSynced, wasm.svcListerSynced); !ok {
+	if ok := k8sCache.WaitForCacheSync(ctx.Done(), wasm.deplListerSynced, wasm.svcListerSynced, wasm.podListerSynced, wasm.envListerSynced); !ok {
 		wasm.logger.Fatal("failed to wait for caches to sync")
 	}
-	// go wasm.idleObjectReaper(ctx)
+	wasm.setupPools(ctx)
+	wasm.setupHosts(ctx)
+	go wasm.idleObjectReaper(ctx)
 }
 
 // GetTypeName returns the executor type name.
@@ -223,12 +275,26 @@ func (wasm *Wasm) IsValid(ctx context.Context, fsvc *fscache.FuncSvc) bool {
 			if currentDeploy.Status.AvailableReplicas < 1 {
 				return false
 			}
+		} else if strings.ToLower(obj.Kind) == "pod" {
+			pod, err := wasm.podLister.Pods(obj.Namespace).Get(obj.Name)
+			if err != nil {
+				if !k8sErrs.IsNotFound(err) {
+					logger.Error("error validating function pod", zap.String("function", fsvc.Function.Name), zap.Error(err))
+				}
+				return false
+			}
+			if pod.ObjectMeta.DeletionTimestamp != nil || !utils.IsReadyPod(pod) {
+				return false
+			}
 		}
 	}
 	return true
 }
 
-// RefreshFuncPods deletes pods related to the function so that new pods are replenished
+// RefreshFuncPods rolls the pods of the function, so that the new pods pick
+// up the updated secrets and configmaps the function references. The
+// resource version sum of the referenced objects is patched into the
+// function container's environment, which makes the deployment roll out.
 func (wasm *Wasm) RefreshFuncPods(ctx context.Context, logger *zap.Logger, f fv1.Function) error {
 
 	funcLabels := wasm.getDeployLabels(f.ObjectMeta)
@@ -240,22 +306,29 @@ func (wasm *Wasm) RefreshFuncPods(ctx context.Context, logger *zap.Logger, f fv1
 		return err
 	}
 
+	// the referenced secrets and configmaps live in the namespace of the
+	// function, not in the one of the deployment, see getDeploymentSpec.
+	rvCount, err := referencedResourcesRVSum(ctx, wasm.kubernetesClient, f.ObjectMeta.Namespace, f.Spec.Secrets, f.Spec.ConfigMaps)
+	if err != nil {
+		return err
+	}
+	patch, err := getRVCountPatch(f.ObjectMeta.Name, rvCount)
+	if err != nil {
+		return err
+	}
+
 	// Ideally there should be only one deployment but for now we rely on label/selector to ensure that condition
 	for _, deployment := range dep.Items {
-		rvCount, err := referencedResourcesRVSum(ctx, wasm.kubernetesClient, deployment.Namespace, f.Spec.Secrets, f.Spec.ConfigMaps)
-		if err != nil {
-			return err
-		}
-
-		patch := fmt.Sprintf(`{"spec" : {"template": {"spec":{"Wasms":[{"name": "%s", "env":[{"name": "%s", "value": "%v"}]}]}}}}`,
-			f.ObjectMeta.Name, fv1.ResourceVersionCount, rvCount)
-
 		_, err = wasm.kubernetesClient.AppsV1().Deployments(deployment.ObjectMeta.Namespace).Patch(ctx, deployment.ObjectMeta.Name,
 			k8sTypes.StrategicMergePatchType,
-			[]byte(patch), metav1.PatchOptions{})
+			patch, metav1.PatchOptions{})
 		if err != nil {
 			return err
 		}
+		logger.Debug("refreshed pods of function",
+			zap.String("function", f.ObjectMeta.Name),
+			zap.String("deployment", deployment.ObjectMeta.Name),
+			zap.Int("resource_version_count", rvCount))
 	}
 	return nil
 }
@@ -272,7 +345,10 @@ func (wasm *Wasm) AdoptExistingResources(ctx context.Context) {
 
 	for i := range fnList.Items {
 		fn := &fnList.Items[i]
-		if fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType == fv1.ExecutorTypeWasm {
+		// the pool and host pods of the previous executor instance are cleaned
+		// up, functions running in them are started again on their next request
+		if fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType == fv1.ExecutorTypeWasm &&
+			wasm.getPool(fn) == nil && wasm.getHostGroup(fn) == nil {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -314,6 +390,17 @@ func (wasm *Wasm) CleanupOldExecutorObjects(ctx context.Context) {
 		errs = multierror.Append(errs, err)
 	}
 
+	// pods of function deployments carry the instance ID as well, so only
+	// pool and host pods are reaped here
+	for _, label := range []string{fv1.WASM_POOL, fv1.WASM_HOST} {
+		err = reaper.CleanupPods(ctx, wasm.logger, wasm.kubernetesClient, wasm.instanceID, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%v=%v,%v", fv1.EXECUTOR_TYPE, fv1.ExecutorTypeWasm, label),
+		})
+		if err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
 	if errs.ErrorOrNil() != nil {
 		// TODO retry reaper; logged and ignored for now
 		wasm.logger.Error("Failed to cleanup old executor objects", zap.Error(err))
@@ -327,7 +414,33 @@ func (wasm *Wasm) createFunction(ctx context.Context, fn *fv1.Function) (*fscach
 
 	fsvcObj, err := wasm.throttler.RunOnce(string(fn.ObjectMeta.UID), func(ableToCreate bool) (interface{}, error) {
 		if ableToCreate {
-			return wasm.fnCreate(ctx, fn)
+			if group := wasm.getHostGroup(fn); group != nil {
+				fsvc, err := wasm.hostCreate(ctx, fn, group)
+				if err == nil {
+					return fsvc, nil
+				}
+				wasm.logger.Warn("error loading function into wasm host, falling back to deployment",
+					zap.Error(err),
+					zap.String("function_name", fn.ObjectMeta.Name),
+					zap.String("function_namespace", fn.ObjectMeta.Namespace))
+			}
+			if pool := wasm.getPool(fn); pool != nil {
+				fsvc, err := wasm.poolCreate(ctx, fn, pool)
+				if err == nil {
+					return fsvc, nil
+				}
+				wasm.logger.Warn("error starting function from wasm pool, falling back to deployment",
+					zap.Error(err),
+					zap.String("function_name", fn.ObjectMeta.Name),
+					zap.String("function_namespace", fn.ObjectMeta.Namespace))
+			}
+			startTime := time.Now()
+			fsvc, err := wasm.fnCreate(ctx, fn)
+			if err == nil {
+				metrics.ColdStartDuration.WithLabelValues(fn.ObjectMeta.Name, fn.ObjectMeta.Namespace,
+					string(fv1.WasmModeDeployment)).Observe(time.Since(startTime).Seconds())
+			}
+			return fsvc, err
 		}
 		return wasm.fsCache.GetByFunctionUID(fn.ObjectMeta.UID)
 	})
@@ -377,7 +490,7 @@ func (wasm *Wasm) fnCreate(ctx context.Context, fn *fv1.Function) (*fscache.Func
 	if fn.ObjectMeta.Namespace != metav1.NamespaceDefault {
 		ns = fn.ObjectMeta.Namespace
 	}
-    // ch:=make(chan bool)
+	// ch:=make(chan bool)
 	// wasm.fnchannel[string(fn.UID)]=ch
 	// Envoy(istio-proxy) returns 404 directly before istio pilot
 	// propagates latest Envoy-specific configuration.
@@ -391,29 +504,25 @@ func (wasm *Wasm) fnCreate(ctx context.Context, fn *fv1.Function) (*fscache.Func
 		return nil, errors.Wrapf(err, "error creating service %v", objName)
 	}
 	svcAddress := fmt.Sprintf("%v.%v", svc.Name, svc.Namespace)
-	
-	depl, podIP,err := wasm.createOrGetDeployment(ctx, fn, objName, deployLabels, deployAnnotations, ns)
+
+	depl, err := wasm.createOrGetDeployment(ctx, fn, objName, deployLabels, deployAnnotations, ns)
 	if err != nil {
 		wasm.logger.Error("error creating deployment", zap.Error(err), zap.String("deployment", objName))
 		go cleanupFunc(ns, objName)
 		return nil, errors.Wrapf(err, "error creating deployment %v", objName)
 	}
 
-	podAddress := ""
-    if podIP != "" && len(depl.Spec.Template.Spec.Containers) > 0 && len(depl.Spec.Template.Spec.Containers[0].Ports) > 0 {
-       containerPort := depl.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort
-	   podAddress =  fmt.Sprintf("%v:%v", podIP, strconv.Itoa(int(containerPort)))
-	   wasm.logger.Info("******got podAddress****** ",zap.String("podAddress", podAddress))
-    }else{
-	   wasm.logger.Error("error getting podAddress ", zap.Error(err), zap.String("podIP", podIP))
+	var podPort int32
+	if len(depl.Spec.Template.Spec.Containers) > 0 && len(depl.Spec.Template.Spec.Containers[0].Ports) > 0 {
+		podPort = depl.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort
 	}
 
-	// hpa, err := wasm.hpaops.CreateOrGetHpa(ctx, objName, &fn.Spec.InvokeStrategy.ExecutionStrategy, depl, deployLabels, deployAnnotations)
-	// if err != nil {
-	// 	wasm.logger.Error("error creating HPA", zap.Error(err), zap.String("hpa", objName))
-	// 	go cleanupFunc(ns, objName)
-	// 	return nil, errors.Wrapf(err, "error creating the HPA %v", objName)
-	// }
+	hpa, err := wasm.hpaops.CreateOrGetHpa(ctx, objName, getExecutionStrategy(fn), depl, deployLabels, deployAnnotations)
+	if err != nil {
+		wasm.logger.Error("error creating HPA", zap.Error(err), zap.String("hpa", objName))
+		go cleanupFunc(ns, objName)
+		return nil, errors.Wrapf(err, "error creating the HPA %v", objName)
+	}
 
 	kubeObjRefs := []apiv1.ObjectReference{
 		{
@@ -433,14 +542,14 @@ func (wasm *Wasm) fnCreate(ctx context.Context, fn *fv1.Function) (*fscache.Func
 			ResourceVersion: svc.ObjectMeta.ResourceVersion,
 			UID:             svc.ObjectMeta.UID,
 		},
-		// {
-		// 	Kind:            "horizontalpodautoscaler",
-		// 	Name:            hpa.ObjectMeta.Name,
-		// 	APIVersion:      hpa.TypeMeta.APIVersion,
-		// 	Namespace:       hpa.ObjectMeta.Namespace,
-		// 	ResourceVersion: hpa.ObjectMeta.ResourceVersion,
-		// 	UID:             hpa.ObjectMeta.UID,
-		// },
+		{
+			Kind:            "horizontalpodautoscaler",
+			Name:            hpa.ObjectMeta.Name,
+			APIVersion:      hpa.TypeMeta.APIVersion,
+			Namespace:       hpa.ObjectMeta.Namespace,
+			ResourceVersion: hpa.ObjectMeta.ResourceVersion,
+			UID:             hpa.ObjectMeta.UID,
+		},
 	}
 
 	fsvc := &fscache.FuncSvc{
@@ -449,7 +558,7 @@ func (wasm *Wasm) fnCreate(ctx context.Context, fn *fv1.Function) (*fscache.Func
 		Address:           svcAddress,
 		KubernetesObjects: kubeObjRefs,
 		Executor:          fv1.ExecutorTypeWasm,
-		PodIpPort:         podAddress,
+		PodPort:           podPort,
 	}
 
 	_, err = wasm.fsCache.Add(*fsvc)
@@ -498,57 +607,13 @@ func (wasm *Wasm) updateFunction(ctx context.Context, oldFn *fv1.Function, newFn
 		return err
 	}
 
-	// if !reflect.DeepEqual(oldFn.Spec.InvokeStrategy, newFn.Spec.InvokeStrategy) {
-	// 	// to support backward compatibility, if the function was created in default ns, we fall back to creating the
-	// 	// deployment of the function in fission-function ns, so cleaning up resources there
-	// 	ns := wasm.namespace
-	// 	if newFn.ObjectMeta.Namespace != metav1.NamespaceDefault {
-	// 		ns = newFn.ObjectMeta.Namespace
-	// 	}
-
-	// 	fsvc, err := wasm.fsCache.GetByFunctionUID(newFn.ObjectMeta.UID)
-	// 	if err != nil {
-	// 		err = errors.Wrapf(err, "error updating function due to unable to find function service cache: %v", oldFn)
-	// 		return err
-	// 	}
-
-	// 	hpa, err := wasm.hpaops.GetHpa(ctx, ns, fsvc.Name)
-	// 	if err != nil {
-	// 		wasm.updateStatus(oldFn, err, "error getting HPA while updating function")
-	// 		return err
-	// 	}
-
-	// 	hpaChanged := false
-
-	// 	if newFn.Spec.InvokeStrategy.ExecutionStrategy.MinScale != oldFn.Spec.InvokeStrategy.ExecutionStrategy.MinScale {
-	// 		replicas := int32(newFn.Spec.InvokeStrategy.ExecutionStrategy.MinScale)
-	// 		hpa.Spec.MinReplicas = &replicas
-	// 		hpaChanged = true
-	// 	}
-
-	// 	if newFn.Spec.InvokeStrategy.ExecutionStrategy.MaxScale != oldFn.Spec.InvokeStrategy.ExecutionStrategy.MaxScale {
-	// 		hpa.Spec.MaxReplicas = int32(newFn.Spec.InvokeStrategy.ExecutionStrategy.MaxScale)
-	// 		hpaChanged = true
-	// 	}
-
-	// 	if !reflect.DeepEqual(newFn.Spec.InvokeStrategy.ExecutionStrategy.Metrics, oldFn.Spec.InvokeStrategy.ExecutionStrategy.Metrics) {
-	// 		hpa.Spec.Metrics = newFn.Spec.InvokeStrategy.ExecutionStrategy.Metrics
-	// 		hpaChanged = true
-	// 	}
-
-	// 	if !reflect.DeepEqual(newFn.Spec.InvokeStrategy.ExecutionStrategy.Behavior, oldFn.Spec.InvokeStrategy.ExecutionStrategy.Behavior) {
-	// 		hpa.Spec.Behavior = newFn.Spec.InvokeStrategy.ExecutionStrategy.Behavior
-	// 		hpaChanged = true
-	// 	}
-
-	// 	if hpaChanged {
-	// 		err := wasm.hpaops.UpdateHpa(ctx, hpa)
-	// 		if err != nil {
-	// 			wasm.updateStatus(oldFn, err, "error updating HPA while updating function")
-	// 			return err
-	// 		}
-	// 	}
-	// }
+	if !reflect.DeepEqual(oldFn.Spec.InvokeStrategy, newFn.Spec.InvokeStrategy) {
+		err := wasm.updateFuncHpa(ctx, newFn)
+		if err != nil {
+			wasm.updateStatus(oldFn, err, "error updating HPA while updating function")
+			return err
+		}
+	}
 
 	deployChanged := false
 
@@ -574,7 +639,19 @@ func (wasm *Wasm) updateFunction(ctx context.Context, oldFn *fv1.Function, newFn
 		}
 	}
 
-	if !reflect.DeepEqual(oldFn.Spec.PodSpec, newFn.Spec.PodSpec) {
+	if !reflect.DeepEqual(oldFn.Spec.PodSpec, newFn.Spec.PodSpec) ||
+		!reflect.DeepEqual(oldFn.Spec.Resources, newFn.Spec.Resources) ||
+		!reflect.DeepEqual(oldFn.Spec.Wasm, newFn.Spec.Wasm) {
+		deployChanged = true
+	}
+
+	// a new package version or module URL rolls out the new module, the
+	// resource version annotation of the deployment changes along.
+	if oldFn.Spec.Package != newFn.Spec.Package {
+		deployChanged = true
+	}
+	if oldFn.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_URL] != newFn.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_URL] ||
+		oldFn.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_FILENAME] != newFn.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_FILENAME] {
 		deployChanged = true
 	}
 
@@ -587,12 +664,30 @@ func (wasm *Wasm) updateFunction(ctx context.Context, oldFn *fv1.Function, newFn
 
 func (wasm *Wasm) updateFuncDeployment(ctx context.Context, fn *fv1.Function) error {
 
+	// idle functions scaled down by the reaper are not in the cache, their
+	// kubernetes objects are still named after the function though.
+	fnObjName := wasm.getObjName(fn)
 	fsvc, err := wasm.fsCache.GetByFunctionUID(fn.ObjectMeta.UID)
-	if err != nil {
-		err = errors.Wrapf(err, "error updating function due to unable to find function service cache: %v", fn)
-		return err
+	if err == nil {
+		if getPoolPodObj(fsvc.KubernetesObjects) != nil {
+			// pool and host pods are not updated in place, the next
+			// request starts the updated function in a new pod or host
+			wasm.logger.Info("recycling wasm pod due to function update",
+				zap.String("pod", fsvc.Name), zap.String("function", fn.ObjectMeta.Name))
+			_, err = wasm.fsCache.DeleteOld(fsvc, time.Second*0)
+			if err != nil {
+				return err
+			}
+			wasm.fpmap.remove(string(fn.ObjectMeta.UID))
+			unloaded, err := wasm.unloadFromHost(ctx, fn)
+			if unloaded {
+				return err
+			}
+			_, err = wasm.deletePoolPods(ctx, fn)
+			return err
+		}
+		fnObjName = fsvc.Name
 	}
-	fnObjName := fsvc.Name
 
 	deployLabels := wasm.getDeployLabels(fn.ObjectMeta)
 	wasm.logger.Info("updating deployment due to function update",
@@ -629,6 +724,46 @@ func (wasm *Wasm) updateFuncDeployment(ctx context.Context, fn *fv1.Function) er
 	return nil
 }
 
+// updateFuncHpa reconciles the HPA of the function with its execution
+// strategy. The HPA is created if it does not exist yet.
+func (wasm *Wasm) updateFuncHpa(ctx context.Context, fn *fv1.Function) error {
+	// to support backward compatibility, if the function was created in default ns, we fall back to creating the
+	// deployment of the function in fission-function ns
+	ns := wasm.namespace
+	if fn.ObjectMeta.Namespace != metav1.NamespaceDefault {
+		ns = fn.ObjectMeta.Namespace
+	}
+	objName := wasm.getObjName(fn)
+
+	hpa, err := wasm.hpaops.GetHpa(ctx, ns, objName)
+	if k8sErrs.IsNotFound(err) {
+		depl, err := wasm.kubernetesClient.AppsV1().Deployments(ns).Get(ctx, objName, metav1.GetOptions{})
+		if err != nil {
+			if k8sErrs.IsNotFound(err) {
+				// the HPA is created along with the deployment
+				return nil
+			}
+			return err
+		}
+		_, err = wasm.hpaops.CreateOrGetHpa(ctx, objName, getExecutionStrategy(fn), depl,
+			wasm.getDeployLabels(fn.ObjectMeta), wasm.getDeployAnnotations(fn.ObjectMeta))
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	updated, err := wasm.hpaops.ReconcileHpa(ctx, hpa, getExecutionStrategy(fn))
+	if err != nil {
+		return err
+	}
+	if updated {
+		wasm.logger.Info("updated HPA due to function update",
+			zap.String("hpa", objName), zap.String("function", fn.ObjectMeta.Name))
+	}
+	return nil
+}
+
 func (wasm *Wasm) fnDelete(ctx context.Context, fn *fv1.Function) error {
 	multierr := &multierror.Error{}
 
@@ -637,20 +772,18 @@ func (wasm *Wasm) fnDelete(ctx context.Context, fn *fv1.Function) error {
 	// is deleted and cause Wasm backend fails to delete the entry.
 	// Use GetByFunctionUID instead of GetByFunction here to find correct
 	// fsvc entry.
+	// Idle functions scaled down by the reaper are not in the cache anymore,
+	// their kubernetes objects still need to be cleaned up.
+	objName := wasm.getObjName(fn)
 	fsvc, err := wasm.fsCache.GetByFunctionUID(fn.ObjectMeta.UID)
-	if err != nil {
-		err = errors.Wrap(err, fmt.Sprintf("fsvc not found in cache: %v", fn.ObjectMeta))
-		return err
-	}
-
-	objName := fsvc.Name
-
-	_, err = wasm.fsCache.DeleteOld(fsvc, time.Second*0)
-	if err != nil {
-		multierr = multierror.Append(multierr,
-			errors.Wrapf(err, "error deleting the function from cache"))
+	if err == nil {
+		objName = fsvc.Name
+		_, err = wasm.fsCache.DeleteOld(fsvc, time.Second*0)
+		if err != nil {
+			multierr = multierror.Append(multierr,
+				errors.Wrapf(err, "error deleting the function from cache"))
+		}
 	}
-    //删除function有关的PodIP
 	wasm.fpmap.remove(string(fn.UID))
 	// to support backward compatibility, if the function was created in default ns, we fall back to creating the
 	// deployment of the function in fission-function ns, so cleaning up resources there
@@ -662,6 +795,12 @@ func (wasm *Wasm) fnDelete(ctx context.Context, fn *fv1.Function) error {
 	err = wasm.cleanupWasm(ctx, ns, objName)
 	multierr = multierror.Append(multierr, err)
 
+	_, err = wasm.deletePoolPods(ctx, fn)
+	multierr = multierror.Append(multierr, err)
+
+	_, err = wasm.unloadFromHost(ctx, fn)
+	multierr = multierror.Append(multierr, err)
+
 	return multierr.ErrorOrNil()
 }
 
@@ -703,8 +842,7 @@ func (wasm *Wasm) getDeployAnnotations(fnMeta metav1.ObjectMeta) map[string]stri
 	deployAnnotations := maps.CopyStringMap(fnMeta.Annotations)
 	deployAnnotations[fv1.EXECUTOR_INSTANCEID_LABEL] = wasm.instanceID
 	deployAnnotations[fv1.FUNCTION_RESOURCE_VERSION] = fnMeta.ResourceVersion
-	Url:=wasm.getStoreURL(string(fnMeta.UID))
-	deployAnnotations["fission-url"] = Url
+	deployAnnotations["fission-url"] = wasm.getStoreURL(string(fnMeta.UID))
 	return deployAnnotations
 }
 
@@ -754,44 +892,72 @@ func (wasm *Wasm) doIdleObjectReaper(ctx context.Context) {
 			continue
 		}
 
-		// go func() {
-		// 	deployObj := getDeploymentObj(fsvc.KubernetesObjects)
-		// 	if deployObj == nil {
-		// 		wasm.logger.Error("error finding function deployment", zap.Error(err), zap.String("function", fsvc.Function.Name))
-		// 		return
-		// 	}
-
-		// 	currentDeploy, err := wasm.kubernetesClient.AppsV1().
-		// 		Deployments(deployObj.Namespace).Get(ctx, deployObj.Name, metav1.GetOptions{})
-		// 	if err != nil {
-		// 		wasm.logger.Error("error getting function deployment", zap.Error(err), zap.String("function", fsvc.Function.Name))
-		// 		return
-		// 	}
-
-		// 	minScale := int32(fn.Spec.InvokeStrategy.ExecutionStrategy.MinScale)
-
-		// 	// do nothing if the current replicas is already lower than minScale
-		// 	if *currentDeploy.Spec.Replicas <= minScale {
-		// 		return
-		// 	}
-
-		// 	err = wasm.scaleDeployment(ctx, deployObj.Namespace, deployObj.Name, minScale)
-		// 	if err != nil {
-		// 		wasm.logger.Error("error scaling down function deployment", zap.Error(err), zap.String("function", fsvc.Function.Name))
-		// 	}
-		// }()
 		go func() {
-			log := wasm.logger.With(zap.String("function_name", fn.ObjectMeta.Name), zap.String("function_namespace", fn.ObjectMeta.Namespace))
-			log.Debug("start function delete handler")
-			err := wasm.deleteFunction(ctx, fn)
+			err := wasm.scaleDownIdleFunction(ctx, fn, fsvc, idlePodReapTime)
 			if err != nil {
-				log.Error("error deleting function", zap.Error(err))
+				wasm.logger.Error("error scaling down idle function", zap.Error(err),
+					zap.String("function_name", fn.ObjectMeta.Name),
+					zap.String("function_namespace", fn.ObjectMeta.Namespace))
 			}
-			log.Debug("end function delete handler")
 		}()
 	}
 }
 
+// scaleDownIdleFunction scales the deployment of an idle function down to its
+// MinScale, which may be zero, and forgets the function service and the pod
+// IPs of the function. The next request then goes through createFunction,
+// which scales the deployment up again and waits for the new pods. Functions
+// running in a pool pod get the pod deleted instead, functions loaded into a
+// host get unloaded.
+func (wasm *Wasm) scaleDownIdleFunction(ctx context.Context, fn *fv1.Function, fsvc *fscache.FuncSvc, idlePodReapTime time.Duration) error {
+	deployObj := getDeploymentObj(fsvc.KubernetesObjects)
+	podObj := getPoolPodObj(fsvc.KubernetesObjects)
+	if deployObj == nil && podObj == nil {
+		return errors.Errorf("no deployment found for function %s", fn.ObjectMeta.Name)
+	}
+
+	// the function may have been invoked since it was listed as idle
+	deleted, err := wasm.fsCache.DeleteOld(fsvc, idlePodReapTime)
+	if err != nil || !deleted {
+		return err
+	}
+	wasm.fpmap.remove(string(fn.ObjectMeta.UID))
+
+	// hosts keep running the other functions loaded into them
+	unloaded, err := wasm.unloadFromHost(ctx, fn)
+	if unloaded {
+		return err
+	}
+
+	// specialized pool pods are not reused, the pool deployment has
+	// replaced them already
+	if deployObj == nil {
+		err = wasm.kubernetesClient.CoreV1().Pods(podObj.Namespace).Delete(ctx, podObj.Name, metav1.DeleteOptions{})
+		if err != nil && !k8sErrs.IsNotFound(err) {
+			return errors.Wrap(err, "error deleting function pool pod")
+		}
+		return nil
+	}
+
+	currentDeploy, err := wasm.kubernetesClient.AppsV1().Deployments(deployObj.Namespace).Get(ctx, deployObj.Name, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrap(err, "error getting function deployment")
+	}
+
+	minScale := int32(fn.Spec.InvokeStrategy.ExecutionStrategy.MinScale)
+
+	// do nothing if the current replicas is already lower than minScale
+	if *currentDeploy.Spec.Replicas <= minScale {
+		return nil
+	}
+
+	err = wasm.scaleDeployment(ctx, deployObj.Namespace, deployObj.Name, minScale)
+	if err != nil {
+		return errors.Wrap(err, "error scaling down function deployment")
+	}
+	return nil
+}
+
 func getDeploymentObj(kubeobjs []apiv1.ObjectReference) *apiv1.ObjectReference {
 	for _, kubeobj := range kubeobjs {
 		switch strings.ToLower(kubeobj.Kind) {
@@ -802,31 +968,36 @@ func getDeploymentObj(kubeobjs []apiv1.ObjectReference) *apiv1.ObjectReference {
 	return nil
 }
 
+// StorePodIP adds the pod IP reported by a wasm runtime to the pod IPs of
+// the function and wakes up requests waiting for the function to come up.
+func (wasm *Wasm) StorePodIP(ctx context.Context, funcUID string, PodIP string) error {
+	wasm.fpmap.assign(funcUID, PodIP)
+	wasm.podIPWaiter.notify(funcUID)
 
-// TapService makes a TouchByAddress request to the cache.
-func (wasm *Wasm) StorePodIP(ctx context.Context, funcUID string,PodIP string) error {
-    
-	//将podIP存储在本地，删除之前存在的
-	 if _,err:=wasm.fpmap.lookup(funcUID);err==nil{
-		wasm.fpmap.remove(funcUID)
-	}
-	
-	//在存入新的podip
-	wasm.fpmap.assign(funcUID,PodIP)
-
-    
-	wasm.logger.Info("******成功同步podip**********", zap.String("podip:", PodIP))
-
-	
+	wasm.logger.Debug("stored pod IP of function", zap.String("function_uid", funcUID), zap.String("pod_ip", PodIP))
 	return nil
 }
 
-
-// func (wasm *Wasm) syncPodIP(ctx context.Context, funcUID string,PodIP string){
-//     //删除之前存在的
-// 	if _,err:=wasm.fpmap.lookup(funcUID);err==nil{
-// 		wasm.fpmap.remove(funcUID)
-// 	}
-    
-	
-// }
\ No newline at end of file
+// GetPodEndpoints returns the addresses of the known pods of the function
+// service, so that the router can spread requests across the replicas.
+func (wasm *Wasm) GetPodEndpoints(ctx context.Context, fsvc *fscache.FuncSvc) ([]string, int64) {
+	if fsvc.PodPort == 0 {
+		return nil, 0
+	}
+	uid := string(fsvc.Function.UID)
+	podIPs, err := wasm.fpmap.lookup(uid)
+	if err != nil {
+		return nil, 0
+	}
+	// functions sharing a host are served under the route prefix carried
+	// by their address
+	routePrefix := ""
+	if i := strings.Index(fsvc.Address, "/"); i >= 0 {
+		routePrefix = fsvc.Address[i:]
+	}
+	endpoints := make([]string, 0, len(podIPs))
+	for _, podIP := range podIPs {
+		endpoints = append(endpoints, net.JoinHostPort(podIP, strconv.Itoa(int(fsvc.PodPort)))+routePrefix)
+	}
+	return endpoints, wasm.fpmap.generation(uid)
+}
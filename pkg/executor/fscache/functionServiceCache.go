@@ -60,7 +60,7 @@ type (
 		KubernetesObjects []apiv1.ObjectReference // Kubernetes Objects (within the function namespace)
 		Executor          fv1.ExecutorType
 		CPULimit          resource.Quantity
-		PodIpPort         string
+		PodPort           int32 // Port function pods listen on, for executor types routing requests directly to pods.
 
 		Ctime time.Time
 		Atime time.Time
@@ -41,6 +41,15 @@ var (
 		},
 		functionLabels,
 	)
+	// mode: how the function was started, "deployment" or "pool"
+	ColdStartDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "fission_function_cold_start_duration_seconds",
+			Help:    "The time in seconds taken to start a function by function_name, function_namespace and mode.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+		},
+		[]string{"function_name", "function_namespace", "mode"},
+	)
 	FuncError = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "fission_function_cold_start_errors_total",
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// CallbackSigningKeyEnv is the environment variable holding the key used
+// to sign the callback URLs handed to function pods.
+const CallbackSigningKeyEnv = "CALLBACK_SIGNING_KEY"
+
+// CallbackSigner signs and verifies the per-function tokens carried by the
+// callback URLs executor hands to function pods, e.g. the storePodIP URL of
+// wasm functions. A token is the HMAC-SHA256 of the function UID.
+type CallbackSigner struct {
+	key []byte
+}
+
+// MakeCallbackSigner returns a CallbackSigner using the key set in
+// CALLBACK_SIGNING_KEY. The key must be set and shared by all executor
+// replicas, since the tokens are baked into function deployments and must
+// stay valid across restarts.
+func MakeCallbackSigner() (*CallbackSigner, error) {
+	key := os.Getenv(CallbackSigningKeyEnv)
+	if len(key) == 0 {
+		return nil, errors.Errorf("callback signing key is not set in %v", CallbackSigningKeyEnv)
+	}
+	return NewCallbackSigner([]byte(key)), nil
+}
+
+// NewCallbackSigner returns a CallbackSigner using the given key.
+func NewCallbackSigner(key []byte) *CallbackSigner {
+	return &CallbackSigner{key: key}
+}
+
+// Sign returns the token of the function with the given UID.
+func (s *CallbackSigner) Sign(fnUID string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(fnUID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether token is the valid token of the function with
+// the given UID.
+func (s *CallbackSigner) Verify(fnUID string, token string) bool {
+	sig, err := hex.DecodeString(token)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(fnUID))
+	return hmac.Equal(sig, mac.Sum(nil))
+}
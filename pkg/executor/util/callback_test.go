@@ -0,0 +1,55 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+)
+
+func TestCallbackSigner(t *testing.T) {
+	signer := NewCallbackSigner([]byte("secret"))
+	token := signer.Sign("fn-uid")
+
+	if !signer.Verify("fn-uid", token) {
+		t.Fatal("expected token to be valid for the function it was issued for")
+	}
+	if signer.Verify("other-fn-uid", token) {
+		t.Fatal("expected token to be invalid for another function")
+	}
+	if signer.Verify("fn-uid", "not-hex") {
+		t.Fatal("expected malformed token to be invalid")
+	}
+	if NewCallbackSigner([]byte("other-secret")).Verify("fn-uid", token) {
+		t.Fatal("expected token to be invalid for another key")
+	}
+}
+
+func TestMakeCallbackSigner(t *testing.T) {
+	t.Setenv(CallbackSigningKeyEnv, "")
+	if _, err := MakeCallbackSigner(); err == nil {
+		t.Fatal("expected an error when the signing key is not set")
+	}
+
+	t.Setenv(CallbackSigningKeyEnv, "secret")
+	signer, err := MakeCallbackSigner()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !NewCallbackSigner([]byte("secret")).Verify("fn-uid", signer.Sign("fn-uid")) {
+		t.Fatal("expected the signer to use the key set in the environment")
+	}
+}
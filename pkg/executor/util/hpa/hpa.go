@@ -23,6 +23,7 @@ import (
 	appsv1 "k8s.io/api/apps/v1"
 	asv2beta2 "k8s.io/api/autoscaling/v2beta2"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	k8s_err "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -72,14 +73,9 @@ func getScaleTargetRef(deployment *appsv1.Deployment) asv2beta2.CrossVersionObje
 	}
 }
 
-func (hpaops *HpaOperations) CreateOrGetHpa(ctx context.Context, hpaName string, execStrategy *fv1.ExecutionStrategy,
-	depl *appsv1.Deployment, deployLabels map[string]string, deployAnnotations map[string]string) (*asv2beta2.HorizontalPodAutoscaler, error) {
-
-	if depl == nil {
-		return nil, errors.New("failed to create HPA, found empty deployment")
-	}
-	logger := otelUtils.LoggerWithTraceID(ctx, hpaops.logger)
-
+// getHpaSpec returns the spec of an HPA scaling the target according to
+// execStrategy.
+func getHpaSpec(execStrategy *fv1.ExecutionStrategy, scaleTargetRef asv2beta2.CrossVersionObjectReference) asv2beta2.HorizontalPodAutoscalerSpec {
 	minRepl := int32(execStrategy.MinScale)
 	if minRepl == 0 {
 		minRepl = 1
@@ -98,19 +94,30 @@ func (hpaops *HpaOperations) CreateOrGetHpa(ctx context.Context, hpaName string,
 		hpaMetrics = append(hpaMetrics, execStrategy.Metrics...)
 	}
 
+	return asv2beta2.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: scaleTargetRef,
+		MinReplicas:    &minRepl,
+		MaxReplicas:    maxRepl,
+		Metrics:        hpaMetrics,
+		Behavior:       execStrategy.Behavior,
+	}
+}
+
+func (hpaops *HpaOperations) CreateOrGetHpa(ctx context.Context, hpaName string, execStrategy *fv1.ExecutionStrategy,
+	depl *appsv1.Deployment, deployLabels map[string]string, deployAnnotations map[string]string) (*asv2beta2.HorizontalPodAutoscaler, error) {
+
+	if depl == nil {
+		return nil, errors.New("failed to create HPA, found empty deployment")
+	}
+	logger := otelUtils.LoggerWithTraceID(ctx, hpaops.logger)
+
 	hpa := &asv2beta2.HorizontalPodAutoscaler{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        hpaName,
 			Labels:      deployLabels,
 			Annotations: deployAnnotations,
 		},
-		Spec: asv2beta2.HorizontalPodAutoscalerSpec{
-			ScaleTargetRef: getScaleTargetRef(depl),
-			MinReplicas:    &minRepl,
-			MaxReplicas:    maxRepl,
-			Metrics:        hpaMetrics,
-			Behavior:       execStrategy.Behavior,
-		},
+		Spec: getHpaSpec(execStrategy, getScaleTargetRef(depl)),
 	}
 
 	existingHpa, err := hpaops.GetHpa(ctx, depl.ObjectMeta.Namespace, hpaName)
@@ -153,6 +160,21 @@ func (hpaops *HpaOperations) UpdateHpa(ctx context.Context, hpa *asv2beta2.Horiz
 	return err
 }
 
+// ReconcileHpa updates the HPA to scale according to execStrategy, if it
+// does not already. It reports whether the HPA got updated.
+func (hpaops *HpaOperations) ReconcileHpa(ctx context.Context, hpa *asv2beta2.HorizontalPodAutoscaler, execStrategy *fv1.ExecutionStrategy) (bool, error) {
+	spec := getHpaSpec(execStrategy, hpa.Spec.ScaleTargetRef)
+	if equality.Semantic.DeepEqual(hpa.Spec, spec) {
+		return false, nil
+	}
+	hpa.Spec = spec
+	err := hpaops.UpdateHpa(ctx, hpa)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (hpaops *HpaOperations) DeleteHpa(ctx context.Context, ns string, name string) error {
 	return hpaops.kubernetesClient.AutoscalingV2beta2().HorizontalPodAutoscalers(ns).Delete(ctx, name, metav1.DeleteOptions{})
 }
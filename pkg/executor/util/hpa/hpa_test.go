@@ -134,6 +134,41 @@ func TestHpaOps(t *testing.T) {
 		t.Errorf("Expected max replicas to be 10, got %v", hpa.Spec.MaxReplicas)
 	}
 
+	// Test ReconcileHPA
+	execStrategy := &fv1.ExecutionStrategy{
+		ExecutorType: fv1.ExecutorTypeNewdeploy,
+		MinScale:     2,
+		MaxScale:     8,
+		Metrics:      []asv2beta2.MetricSpec{ConvertTargetCPUToCustomMetric(70)},
+	}
+	updated, err := hpaops.ReconcileHpa(ctx, hpa, execStrategy)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !updated {
+		t.Errorf("Expected HPA to be updated")
+	}
+	hpa, err = hpaops.GetHpa(ctx, ns, "test-hpa")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if *hpa.Spec.MinReplicas != 2 || hpa.Spec.MaxReplicas != 8 {
+		t.Errorf("Expected replicas to be 2-8, got %v-%v", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+	}
+	if len(hpa.Spec.Metrics) != 1 || *hpa.Spec.Metrics[0].Resource.Target.AverageUtilization != 70 {
+		t.Errorf("Expected target CPU metric of 70, got %v", hpa.Spec.Metrics)
+	}
+	if hpa.Spec.ScaleTargetRef.Name != "test-deployment" {
+		t.Errorf("Expected scale target to be kept, got %v", hpa.Spec.ScaleTargetRef.Name)
+	}
+	updated, err = hpaops.ReconcileHpa(ctx, hpa, execStrategy)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if updated {
+		t.Errorf("Expected HPA matching the execution strategy not to be updated")
+	}
+
 	// Test DeleteHPA
 	err = hpaops.DeleteHpa(ctx, ns, "test-hpa")
 	if err != nil {
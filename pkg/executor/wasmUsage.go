@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	k8sCache "k8s.io/client-go/tools/cache"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	otelUtils "github.com/fission/fission/pkg/utils/otel"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
+)
+
+// maxUsageReportSize bounds the body of usage reports
+const maxUsageReportSize = 4096
+
+type (
+	// wasmUsageStore records the usage wasm runtimes report for each
+	// invocation of a wasm function as summaries the CLI shows. There is a
+	// single executor, so the summaries cover all the invocations of a
+	// function.
+	wasmUsageStore struct {
+		lock      sync.RWMutex
+		summaries map[wasmUsageKey]*wasmmodule.UsageSummary
+	}
+
+	wasmUsageKey struct {
+		namespace string
+		name      string
+	}
+)
+
+func makeWasmUsageStore() *wasmUsageStore {
+	return &wasmUsageStore{
+		summaries: make(map[wasmUsageKey]*wasmmodule.UsageSummary),
+	}
+}
+
+func (store *wasmUsageStore) record(u wasmmodule.Usage) {
+	key := wasmUsageKey{namespace: u.Namespace, name: u.Function}
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	summary, ok := store.summaries[key]
+	if !ok {
+		summary = &wasmmodule.UsageSummary{}
+		store.summaries[key] = summary
+	}
+	summary.Add(u)
+}
+
+func (store *wasmUsageStore) get(namespace string, name string) wasmmodule.UsageSummary {
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+	summary, ok := store.summaries[wasmUsageKey{namespace: namespace, name: name}]
+	if !ok {
+		return wasmmodule.UsageSummary{}
+	}
+	return *summary
+}
+
+// delete forgets the usage of a deleted function.
+func (store *wasmUsageStore) delete(namespace string, name string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.summaries, wasmUsageKey{namespace: namespace, name: name})
+}
+
+// wasmUsageEventHandlers forgets the usage of deleted functions.
+func (executor *Executor) wasmUsageEventHandlers() k8sCache.ResourceEventHandlerFuncs {
+	return k8sCache.ResourceEventHandlerFuncs{
+		DeleteFunc: func(obj interface{}) {
+			if fn, ok := obj.(*fv1.Function); ok {
+				executor.wasmUsage.delete(fn.ObjectMeta.Namespace, fn.ObjectMeta.Name)
+			}
+		},
+	}
+}
+
+// reportWasmUsage records the usage wasm runtimes report for an
+// invocation. Requests must carry the token signed for the function in the
+// URL handed to the runtime, and the report must be for that function.
+func (executor *Executor) reportWasmUsage(w http.ResponseWriter, r *http.Request) {
+	logger := otelUtils.LoggerWithTraceID(r.Context(), executor.logger)
+
+	fnUID := mux.Vars(r)["functionUid"]
+	if !executor.callbackSigner.Verify(fnUID, r.URL.Query().Get("token")) {
+		logger.Warn("rejecting usage report with invalid token", zap.String("function_uid", fnUID))
+		http.Error(w, "Invalid callback token", http.StatusForbidden)
+		return
+	}
+
+	var u wasmmodule.Usage
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUsageReportSize)).Decode(&u)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error decoding usage report: %v", err), http.StatusBadRequest)
+		return
+	}
+	err = u.Validate()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fn, err := executor.funcLister.Functions(u.Namespace).Get(u.Function)
+	if err != nil || string(fn.ObjectMeta.UID) != fnUID {
+		logger.Debug("dropping usage report of unknown function",
+			zap.String("function_uid", fnUID),
+			zap.String("function_namespace", u.Namespace),
+			zap.String("function_name", u.Function))
+		http.Error(w, "function not found", http.StatusNotFound)
+		return
+	}
+	executor.wasmUsage.record(u)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// getWasmUsage returns the usage summary of the function named by the
+// query.
+func (executor *Executor) getWasmUsage(w http.ResponseWriter, r *http.Request) {
+	namespace := r.URL.Query().Get("namespace")
+	name := r.URL.Query().Get("name")
+	if len(namespace) == 0 || len(name) == 0 {
+		http.Error(w, "namespace and name are required", http.StatusBadRequest)
+		return
+	}
+	summary := executor.wasmUsage.get(namespace, name)
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(&summary)
+	if err != nil {
+		executor.logger.Error("error encoding usage summary", zap.Error(err))
+	}
+}
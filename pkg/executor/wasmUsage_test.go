@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package executor
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sCache "k8s.io/client-go/tools/cache"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/executor/util"
+	flisterv1 "github.com/fission/fission/pkg/generated/listers/core/v1"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
+)
+
+func TestWasmUsage(t *testing.T) {
+	const fnUID = "fn-uid"
+
+	signer := util.NewCallbackSigner([]byte("test"))
+	funcIndexer := k8sCache.NewIndexer(k8sCache.MetaNamespaceKeyFunc, k8sCache.Indexers{})
+	for _, fn := range []*fv1.Function{
+		{ObjectMeta: metav1.ObjectMeta{Name: "hello", Namespace: "default", UID: fnUID}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "other-uid"}},
+	} {
+		if err := funcIndexer.Add(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	executor := &Executor{
+		logger:         zap.NewNop(),
+		callbackSigner: signer,
+		funcLister:     flisterv1.NewFunctionLister(funcIndexer),
+		wasmUsage:      makeWasmUsageStore(),
+	}
+	handler := executor.GetHandler()
+
+	report := func(token string, body string) int {
+		query := url.Values{}
+		query.Set("token", token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v2/wasmUsage/"+fnUID+"?"+query.Encode(), strings.NewReader(body)))
+		return w.Code
+	}
+	token := signer.Sign(fnUID)
+	if code := report(token, `{"namespace":"default","function":"hello","wallTimeSeconds":0.02,"instantiationSeconds":0.005,"peakMemoryBytes":131072,"fuel":5000}`); code != http.StatusAccepted {
+		t.Fatalf("expected status code %d, got %d", http.StatusAccepted, code)
+	}
+	if code := report(token, `{"namespace":"default","function":"hello","wallTimeSeconds":0.04,"peakMemoryBytes":65536}`); code != http.StatusAccepted {
+		t.Fatalf("expected status code %d, got %d", http.StatusAccepted, code)
+	}
+	if code := report("", `{"namespace":"default","function":"hello","wallTimeSeconds":0.01}`); code != http.StatusForbidden {
+		t.Fatalf("expected status code %d without a token, got %d", http.StatusForbidden, code)
+	}
+	if code := report(signer.Sign("other-uid"), `{"namespace":"default","function":"hello","wallTimeSeconds":0.01}`); code != http.StatusForbidden {
+		t.Fatalf("expected status code %d with the token of another function, got %d", http.StatusForbidden, code)
+	}
+	if code := report(token, `{"namespace":"default","function":"other","wallTimeSeconds":0.01}`); code != http.StatusNotFound {
+		t.Fatalf("expected status code %d for a report of another function, got %d", http.StatusNotFound, code)
+	}
+	if code := report(token, `{"namespace":"default","function":"unknown","wallTimeSeconds":0.01}`); code != http.StatusNotFound {
+		t.Fatalf("expected status code %d for an unknown function, got %d", http.StatusNotFound, code)
+	}
+	if code := report(token, `{"namespace":"default","function":"hello","wallTimeSeconds":-1}`); code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d for an invalid report, got %d", http.StatusBadRequest, code)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/wasmUsage?namespace=default&name=hello", nil))
+	var summary wasmmodule.UsageSummary
+	err := json.Unmarshal(w.Body.Bytes(), &summary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Invocations != 2 || summary.MaxPeakMemoryBytes != 131072 || summary.TotalFuel == nil || *summary.TotalFuel != 5000 {
+		t.Fatalf("unexpected summary %+v", summary)
+	}
+
+	executor.wasmUsageEventHandlers().OnDelete(&fv1.Function{ObjectMeta: metav1.ObjectMeta{Name: "hello", Namespace: "default"}})
+	if summary := executor.wasmUsage.get("default", "hello"); summary.Invocations != 0 {
+		t.Fatalf("expected the summary to be deleted, got %+v", summary)
+	}}
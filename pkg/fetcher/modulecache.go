@@ -0,0 +1,459 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fetcher
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8sCache "k8s.io/client-go/tools/cache"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/crd"
+	ferror "github.com/fission/fission/pkg/error"
+	genInformer "github.com/fission/fission/pkg/generated/informers/externalversions"
+	flisterv1 "github.com/fission/fission/pkg/generated/listers/core/v1"
+	"github.com/fission/fission/pkg/utils"
+	"github.com/fission/fission/pkg/utils/httpserver"
+	"github.com/fission/fission/pkg/utils/metrics"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
+)
+
+const (
+	moduleCachePrefetchInterval = time.Minute
+	// modules not requested nor prefetched for this long are removed
+	moduleCacheTTL = 24 * time.Hour
+
+	moduleSourceRequest  = "request"
+	moduleSourcePrefetch = "prefetch"
+)
+
+var sha256Regex = regexp.MustCompile("^[0-9a-f]{64}$")
+
+var (
+	// source: "request" for modules asked for by wasm pods, "prefetch" for
+	// modules of functions with MinScale > 0
+	moduleCacheHits = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fission_wasm_module_cache_hits_total",
+			Help: "How many wasm modules are served from the node local cache by source.",
+		},
+		[]string{"source"},
+	)
+	moduleCacheMisses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "fission_wasm_module_cache_misses_total",
+			Help: "How many wasm modules are downloaded to the node local cache by source.",
+		},
+		[]string{"source"},
+	)
+)
+
+// ModuleCache is a node local, content addressed cache of wasm modules.
+// Modules are stored by their sha256 sum, so that wasm pods scaling out on a
+// node do not download the module from the storage service again.
+type ModuleCache struct {
+	logger     *zap.Logger
+	dir        string
+	httpClient *http.Client
+	// listers of the functions and packages whose modules are prefetched
+	functionLister flisterv1.FunctionLister
+	packageLister  flisterv1.PackageLister
+	// storageSvcURL is the storage service modules are downloaded from,
+	// modules elsewhere are not cached
+	storageSvcURL *url.URL
+
+	lock sync.Mutex
+	// sums maps module URLs to the sha256 sum of the module, for modules
+	// requested without a checksum
+	sums map[string]string
+	// fetchLocks serializes downloads of the same module URL, entries are
+	// removed once nobody is fetching the module
+	fetchLocks map[string]*fetchLock
+}
+
+type fetchLock struct {
+	sync.Mutex
+	// refs is the number of callers holding or waiting for the lock
+	refs int
+}
+
+// MakeModuleCache returns a module cache storing modules under dir, which
+// caches the modules served by the storage service at storageSvcURL. The
+// listers may be nil if modules are not prefetched.
+func MakeModuleCache(logger *zap.Logger, dir string, storageSvcURL string,
+	functionLister flisterv1.FunctionLister, packageLister flisterv1.PackageLister) (*ModuleCache, error) {
+	storageURL, err := url.Parse(storageSvcURL)
+	if err != nil || len(storageURL.Host) == 0 {
+		return nil, errors.Errorf("invalid storage service url %q", storageSvcURL)
+	}
+	for _, d := range []string{filepath.Join(dir, "sha256"), filepath.Join(dir, "tmp")} {
+		err := makeVolumeDir(d)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error creating module cache directory %v", d)
+		}
+	}
+	return &ModuleCache{
+		logger: logger.Named("wasm_module_cache"),
+		dir:    dir,
+		httpClient: &http.Client{
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			// redirects could lead away from the storage service
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		functionLister: functionLister,
+		packageLister:  packageLister,
+		storageSvcURL:  storageURL,
+		sums:           make(map[string]string),
+		fetchLocks:     make(map[string]*fetchLock),
+	}, nil
+}
+
+// Get returns the path of the module at moduleURL in the cache, downloading
+// the module if it is not cached yet. The module is verified against
+// checksum if it is set.
+func (mc *ModuleCache) Get(ctx context.Context, moduleURL string, checksum *fv1.Checksum) (string, error) {
+	return mc.get(ctx, moduleURL, checksum, moduleSourceRequest)
+}
+
+func (mc *ModuleCache) get(ctx context.Context, moduleURL string, checksum *fv1.Checksum, source string) (string, error) {
+	if checksum != nil && len(checksum.Sum) == 0 {
+		checksum = nil
+	}
+	if checksum != nil && checksum.Type != fv1.ChecksumTypeSHA256 {
+		return "", ferror.MakeError(ferror.ErrorInvalidArgument, "Unsupported checksum type")
+	}
+	if !mc.isStorageURL(moduleURL) {
+		return "", ferror.MakeError(ferror.ErrorInvalidArgument,
+			fmt.Sprintf("%v is not served by the storage service", moduleURL))
+	}
+
+	l := mc.lockFetch(moduleURL)
+	defer mc.unlockFetch(moduleURL, l)
+
+	if path, ok := mc.lookup(moduleURL, checksum); ok {
+		moduleCacheHits.WithLabelValues(source).Inc()
+		// keep modules in use from being pruned
+		now := time.Now()
+		_ = os.Chtimes(path, now, now)
+		return path, nil
+	}
+
+	moduleCacheMisses.WithLabelValues(source).Inc()
+	return mc.fetch(ctx, moduleURL, checksum)
+}
+
+// isStorageURL returns whether moduleURL points to the storage service.
+func (mc *ModuleCache) isStorageURL(moduleURL string) bool {
+	u, err := url.Parse(moduleURL)
+	if err != nil {
+		return false
+	}
+	base := mc.storageSvcURL
+	return u.Scheme == base.Scheme && u.User == nil && u.Host == base.Host &&
+		strings.HasPrefix(u.Path, strings.TrimSuffix(base.Path, "/")+"/")
+}
+
+// lockFetch locks the fetch lock of moduleURL.
+func (mc *ModuleCache) lockFetch(moduleURL string) *fetchLock {
+	mc.lock.Lock()
+	l, ok := mc.fetchLocks[moduleURL]
+	if !ok {
+		l = &fetchLock{}
+		mc.fetchLocks[moduleURL] = l
+	}
+	l.refs++
+	mc.lock.Unlock()
+
+	l.Lock()
+	return l
+}
+
+// unlockFetch unlocks the fetch lock of moduleURL and removes it if nobody
+// else is waiting for it.
+func (mc *ModuleCache) unlockFetch(moduleURL string, l *fetchLock) {
+	l.Unlock()
+
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	l.refs--
+	if l.refs == 0 {
+		delete(mc.fetchLocks, moduleURL)
+	}
+}
+
+// lookup returns the path of the module if it is in the cache.
+func (mc *ModuleCache) lookup(moduleURL string, checksum *fv1.Checksum) (string, bool) {
+	var sum string
+	if checksum != nil {
+		sum = checksum.Sum
+	} else {
+		mc.lock.Lock()
+		sum = mc.sums[moduleURL]
+		mc.lock.Unlock()
+	}
+	if len(sum) == 0 {
+		return "", false
+	}
+	path := mc.modulePath(sum)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// fetch downloads the module, verifies it and moves it to its content
+// addressed path.
+func (mc *ModuleCache) fetch(ctx context.Context, moduleURL string, checksum *fv1.Checksum) (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", errors.Wrap(err, "error generating uuid")
+	}
+	tmpPath := filepath.Join(mc.dir, "tmp", id.String())
+	defer os.Remove(tmpPath)
+
+	err = utils.DownloadUrl(ctx, mc.httpClient, moduleURL, tmpPath)
+	if err != nil {
+		e := "failed to download wasm module"
+		mc.logger.Error(e, zap.Error(err), zap.String("url", moduleURL))
+		return "", ferror.MakeError(ferror.ErrorInternal, fmt.Sprintf("%s: %v", e, err))
+	}
+	// the storage service answers unknown archives with an error page
+	if !wasmmodule.IsWasmFile(tmpPath) {
+		return "", ferror.MakeError(ferror.ErrorInvalidArgument,
+			fmt.Sprintf("%v is not a wasm binary", moduleURL))
+	}
+
+	fileChecksum, err := utils.GetFileChecksum(tmpPath)
+	if err != nil {
+		return "", errors.Wrap(err, "error calculating checksum of wasm module")
+	}
+	if checksum != nil {
+		err = verifyChecksum(fileChecksum, checksum)
+		if err != nil {
+			mc.logger.Error("wasm module checksum mismatch",
+				zap.String("url", moduleURL),
+				zap.String("expected", checksum.Sum),
+				zap.String("actual", fileChecksum.Sum))
+			return "", err
+		}
+	}
+
+	path := mc.modulePath(fileChecksum.Sum)
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return "", errors.Wrap(err, "error moving wasm module into the cache")
+	}
+
+	mc.lock.Lock()
+	mc.sums[moduleURL] = fileChecksum.Sum
+	mc.lock.Unlock()
+
+	mc.logger.Info("cached wasm module",
+		zap.String("url", moduleURL),
+		zap.String("sha256", fileChecksum.Sum))
+	return path, nil
+}
+
+func (mc *ModuleCache) modulePath(sum string) string {
+	return filepath.Join(mc.dir, "sha256", filepath.Base(sum))
+}
+
+// prefetch downloads the modules of wasm functions with MinScale > 0, so
+// that their pods find the module cached on whichever node they start on.
+func (mc *ModuleCache) prefetch(ctx context.Context) {
+	fns, err := mc.functionLister.List(labels.Everything())
+	if err != nil {
+		mc.logger.Error("error listing functions to prefetch wasm modules", zap.Error(err))
+		return
+	}
+
+	for _, fn := range fns {
+		strategy := fn.Spec.InvokeStrategy.ExecutionStrategy
+		if strategy.ExecutorType != fv1.ExecutorTypeWasm || strategy.MinScale <= 0 {
+			continue
+		}
+		moduleURL, checksum, err := mc.getFunctionModule(fn)
+		if err != nil {
+			mc.logger.Error("error getting wasm module of function",
+				zap.Error(err),
+				zap.String("function_name", fn.ObjectMeta.Name),
+				zap.String("function_namespace", fn.ObjectMeta.Namespace))
+			continue
+		}
+		if len(moduleURL) == 0 {
+			continue
+		}
+		_, err = mc.get(ctx, moduleURL, checksum, moduleSourcePrefetch)
+		if err != nil {
+			mc.logger.Error("error prefetching wasm module of function",
+				zap.Error(err),
+				zap.String("function_name", fn.ObjectMeta.Name),
+				zap.String("function_namespace", fn.ObjectMeta.Namespace))
+		}
+	}
+
+	mc.prune(moduleCacheTTL)
+}
+
+// getFunctionModule returns the URL of the module of the function and its
+// checksum, if the package of the function records one. Modules published as
+// OCI artifacts are pulled by the runtime class and have no URL.
+func (mc *ModuleCache) getFunctionModule(fn *fv1.Function) (string, *fv1.Checksum, error) {
+	moduleURL := fn.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_URL]
+	if fn.Spec.Wasm != nil && len(fn.Spec.Wasm.Module.URL) > 0 {
+		moduleURL = fn.Spec.Wasm.Module.URL
+	}
+	if len(moduleURL) == 0 {
+		return "", nil, nil
+	}
+
+	pkgRef := fn.Spec.Package.PackageRef
+	if len(pkgRef.Name) == 0 {
+		return moduleURL, nil, nil
+	}
+	pkgNamespace := pkgRef.Namespace
+	if len(pkgNamespace) == 0 {
+		pkgNamespace = fn.ObjectMeta.Namespace
+	}
+	pkg, err := mc.packageLister.Packages(pkgNamespace).Get(pkgRef.Name)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "error getting package %v", pkgRef.Name)
+	}
+	archive := pkg.Spec.Deployment
+	if archive.Type != fv1.ArchiveTypeUrl || archive.URL != moduleURL || len(archive.Checksum.Sum) == 0 {
+		return moduleURL, nil, nil
+	}
+	return moduleURL, &archive.Checksum, nil
+}
+
+// prune removes modules neither requested nor prefetched within ttl.
+func (mc *ModuleCache) prune(ttl time.Duration) {
+	entries, err := os.ReadDir(filepath.Join(mc.dir, "sha256"))
+	if err != nil {
+		mc.logger.Error("error listing cached wasm modules", zap.Error(err))
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < ttl {
+			continue
+		}
+		err = os.Remove(mc.modulePath(entry.Name()))
+		if err != nil {
+			mc.logger.Error("error pruning cached wasm module", zap.Error(err), zap.String("sha256", entry.Name()))
+			continue
+		}
+
+		mc.lock.Lock()
+		for moduleURL, sum := range mc.sums {
+			if sum == entry.Name() {
+				delete(mc.sums, moduleURL)
+			}
+		}
+		mc.lock.Unlock()
+		mc.logger.Info("pruned wasm module", zap.String("sha256", entry.Name()))
+	}
+}
+
+// moduleHandler serves the module given by the url query parameter from
+// the cache. The sha256 query parameter is the expected checksum of the
+// module, so that nobody can put modules in the cache other than the ones
+// their packages record.
+func (mc *ModuleCache) moduleHandler(w http.ResponseWriter, r *http.Request) {
+	moduleURL := r.URL.Query().Get("url")
+	if len(moduleURL) == 0 {
+		http.Error(w, "missing url query parameter", http.StatusBadRequest)
+		return
+	}
+	sum := r.URL.Query().Get("sha256")
+	if !sha256Regex.MatchString(sum) {
+		http.Error(w, "missing or invalid sha256 query parameter", http.StatusBadRequest)
+		return
+	}
+	checksum := &fv1.Checksum{Type: fv1.ChecksumTypeSHA256, Sum: sum}
+
+	path, err := mc.Get(r.Context(), moduleURL, checksum)
+	if err != nil {
+		code, msg := ferror.GetHTTPError(err)
+		http.Error(w, msg, code)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/wasm")
+	http.ServeFile(w, r, path)
+}
+
+func (mc *ModuleCache) healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+// Handler returns the HTTP handler of the module cache.
+func (mc *ModuleCache) Handler() http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/module", mc.moduleHandler).Methods("GET")
+	r.HandleFunc("/healthz", mc.healthHandler).Methods("GET")
+	return r
+}
+
+// StartModuleCache runs the node local wasm module cache, which serves
+// modules of the storage service at storageSvcURL to wasm pods on port and
+// prefetches the modules of functions with MinScale > 0.
+func StartModuleCache(ctx context.Context, logger *zap.Logger, dir string, storageSvcURL string, port int) error {
+	fissionClient, _, _, _, err := crd.MakeFissionClient()
+	if err != nil {
+		return errors.Wrap(err, "error making the fission client")
+	}
+	informerFactory := genInformer.NewSharedInformerFactory(fissionClient, time.Minute*30)
+	functionInformer := informerFactory.Core().V1().Functions()
+	packageInformer := informerFactory.Core().V1().Packages()
+	mc, err := MakeModuleCache(logger, dir, storageSvcURL, functionInformer.Lister(), packageInformer.Lister())
+	if err != nil {
+		return err
+	}
+	informerFactory.Start(ctx.Done())
+	if ok := k8sCache.WaitForCacheSync(ctx.Done(),
+		functionInformer.Informer().HasSynced, packageInformer.Informer().HasSynced); !ok {
+		return errors.New("timed out waiting for the function and package caches to sync")
+	}
+
+	go metrics.ServeMetrics(ctx, logger)
+	go wait.UntilWithContext(ctx, mc.prefetch, moduleCachePrefetchInterval)
+	go httpserver.StartServer(ctx, mc.logger, "wasm-module-cache", fmt.Sprintf("%d", port), mc.Handler())
+
+	logger.Info("wasm module cache started", zap.String("directory", dir), zap.Int("port", port))
+	return nil
+}
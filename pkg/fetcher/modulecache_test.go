@@ -0,0 +1,304 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fetcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sCache "k8s.io/client-go/tools/cache"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	ferror "github.com/fission/fission/pkg/error"
+	flisterv1 "github.com/fission/fission/pkg/generated/listers/core/v1"
+)
+
+var testModule = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00, 0x07, 0x01, 0x00}
+
+func testModuleChecksum() *fv1.Checksum {
+	sum := sha256.Sum256(testModule)
+	return &fv1.Checksum{Type: fv1.ChecksumTypeSHA256, Sum: hex.EncodeToString(sum[:])}
+}
+
+// serveModules serves testModule at /module.wasm and counts the downloads.
+func serveModules(t *testing.T) (*httptest.Server, *int32) {
+	var downloads int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/module.wasm" {
+			http.Error(w, "archive not found", http.StatusNotFound)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		w.Write(testModule)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, &downloads
+}
+
+func TestModuleCacheGet(t *testing.T) {
+	ts, downloads := serveModules(t)
+	mc, err := MakeModuleCache(zap.NewNop(), t.TempDir(), ts.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	moduleURL := ts.URL + "/module.wasm"
+	checksum := testModuleChecksum()
+
+	misses := testutil.ToFloat64(moduleCacheMisses.WithLabelValues(moduleSourceRequest))
+	hits := testutil.ToFloat64(moduleCacheHits.WithLabelValues(moduleSourceRequest))
+
+	path, err := mc.Get(ctx, moduleURL, checksum)
+	if err != nil {
+		t.Fatalf("error getting module: %v", err)
+	}
+	if filepath.Base(path) != checksum.Sum {
+		t.Fatalf("expected module to be stored by its checksum, got %v", path)
+	}
+	// the module is found by URL and by checksum once cached
+	for _, c := range []*fv1.Checksum{nil, checksum} {
+		p, err := mc.Get(ctx, moduleURL, c)
+		if err != nil {
+			t.Fatalf("error getting cached module: %v", err)
+		}
+		if p != path {
+			t.Fatalf("expected %v, got %v", path, p)
+		}
+	}
+
+	if n := atomic.LoadInt32(downloads); n != 1 {
+		t.Fatalf("expected module to be downloaded once, got %v", n)
+	}
+	if n := len(mc.fetchLocks); n != 0 {
+		t.Fatalf("expected fetch locks to be removed, got %v", n)
+	}
+	if d := testutil.ToFloat64(moduleCacheMisses.WithLabelValues(moduleSourceRequest)) - misses; d != 1 {
+		t.Fatalf("expected 1 miss, got %v", d)
+	}
+	if d := testutil.ToFloat64(moduleCacheHits.WithLabelValues(moduleSourceRequest)) - hits; d != 2 {
+		t.Fatalf("expected 2 hits, got %v", d)
+	}
+}
+
+func TestModuleCacheGetConcurrent(t *testing.T) {
+	ts, downloads := serveModules(t)
+	mc, err := MakeModuleCache(zap.NewNop(), t.TempDir(), ts.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := mc.Get(context.Background(), ts.URL+"/module.wasm", testModuleChecksum())
+			if err != nil {
+				t.Errorf("error getting module: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(downloads); n != 1 {
+		t.Fatalf("expected module to be downloaded once, got %v", n)
+	}
+	if n := len(mc.fetchLocks); n != 0 {
+		t.Fatalf("expected fetch locks to be removed, got %v", n)
+	}
+}
+
+func TestModuleCacheGetInvalid(t *testing.T) {
+	ts, _ := serveModules(t)
+	dir := t.TempDir()
+	mc, err := MakeModuleCache(zap.NewNop(), dir, ts.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	_, err = mc.Get(ctx, ts.URL+"/module.wasm", &fv1.Checksum{Type: fv1.ChecksumTypeSHA256, Sum: "1234"})
+	if fe, ok := err.(ferror.Error); !ok || fe.Code != ferror.ErrorChecksumFail {
+		t.Fatalf("expected checksum failure, got %v", err)
+	}
+	_, err = mc.Get(ctx, ts.URL+"/missing.wasm", nil)
+	if fe, ok := err.(ferror.Error); !ok || fe.Code != ferror.ErrorInvalidArgument {
+		t.Fatalf("expected the error page to be rejected, got %v", err)
+	}
+	// only modules of the storage service are cached
+	other, otherDownloads := serveModules(t)
+	for _, moduleURL := range []string{
+		other.URL + "/module.wasm",
+		"file:///etc/passwd",
+		strings.Replace(ts.URL, "http://", "http://user@", 1) + "/module.wasm",
+	} {
+		_, err = mc.Get(ctx, moduleURL, testModuleChecksum())
+		if fe, ok := err.(ferror.Error); !ok || fe.Code != ferror.ErrorInvalidArgument {
+			t.Fatalf("expected %v to be rejected, got %v", moduleURL, err)
+		}
+	}
+	if n := atomic.LoadInt32(otherDownloads); n != 0 {
+		t.Fatalf("expected no download outside the storage service, got %v", n)
+	}
+
+	// nothing is left behind in the cache
+	for _, d := range []string{"sha256", "tmp"} {
+		entries, err := os.ReadDir(filepath.Join(dir, d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("expected %v to be empty, got %v entries", d, len(entries))
+		}
+	}
+}
+
+func TestModuleCacheHandler(t *testing.T) {
+	ts, _ := serveModules(t)
+	mc, err := MakeModuleCache(zap.NewNop(), t.TempDir(), ts.URL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := httptest.NewServer(mc.Handler())
+	defer cache.Close()
+
+	query := url.Values{}
+	query.Set("url", ts.URL+"/module.wasm")
+	query.Set("sha256", testModuleChecksum().Sum)
+	resp, err := http.Get(cache.URL + "/v1/module?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != string(testModule) {
+		t.Fatalf("expected module, got status %v and %v bytes", resp.StatusCode, len(body))
+	}
+
+	for _, q := range []url.Values{
+		{},
+		{"url": {ts.URL + "/module.wasm"}},
+		{"url": {ts.URL + "/module.wasm"}, "sha256": {"../module"}},
+	} {
+		resp, err = http.Get(cache.URL + "/v1/module?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("expected bad request for %v, got %v", q, resp.StatusCode)
+		}
+	}
+}
+
+func TestModuleCachePrefetch(t *testing.T) {
+	ts, downloads := serveModules(t)
+	moduleURL := ts.URL + "/module.wasm"
+
+	pkg := &fv1.Package{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello-pkg", Namespace: metav1.NamespaceDefault},
+		Spec: fv1.PackageSpec{
+			Deployment: fv1.Archive{
+				Type:     fv1.ArchiveTypeUrl,
+				URL:      moduleURL,
+				Checksum: *testModuleChecksum(),
+			},
+		},
+	}
+	function := func(name string, executorType fv1.ExecutorType, minScale int) *fv1.Function {
+		return &fv1.Function{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+			Spec: fv1.FunctionSpec{
+				Package: fv1.FunctionPackageRef{
+					PackageRef: fv1.PackageRef{Name: pkg.ObjectMeta.Name},
+				},
+				InvokeStrategy: fv1.InvokeStrategy{
+					ExecutionStrategy: fv1.ExecutionStrategy{
+						ExecutorType: executorType,
+						MinScale:     minScale,
+					},
+				},
+				Wasm: &fv1.WasmSpec{Module: fv1.WasmModule{URL: moduleURL}},
+			},
+		}
+	}
+	functionIndexer := k8sCache.NewIndexer(k8sCache.MetaNamespaceKeyFunc, k8sCache.Indexers{})
+	for _, fn := range []*fv1.Function{
+		function("warm", fv1.ExecutorTypeWasm, 1),
+		function("cold", fv1.ExecutorTypeWasm, 0),
+		function("newdeploy", fv1.ExecutorTypeNewdeploy, 1),
+	} {
+		if err := functionIndexer.Add(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	packageIndexer := k8sCache.NewIndexer(k8sCache.MetaNamespaceKeyFunc, k8sCache.Indexers{})
+	if err := packageIndexer.Add(pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	mc, err := MakeModuleCache(zap.NewNop(), dir, ts.URL,
+		flisterv1.NewFunctionLister(functionIndexer), flisterv1.NewPackageLister(packageIndexer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	misses := testutil.ToFloat64(moduleCacheMisses.WithLabelValues(moduleSourcePrefetch))
+	mc.prefetch(ctx)
+	if d := testutil.ToFloat64(moduleCacheMisses.WithLabelValues(moduleSourcePrefetch)) - misses; d != 1 {
+		t.Fatalf("expected the module of the warm function only to be fetched, got %v misses", d)
+	}
+	path := mc.modulePath(testModuleChecksum().Sum)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected module to be prefetched: %v", err)
+	}
+
+	mc.prefetch(ctx)
+	if n := atomic.LoadInt32(downloads); n != 1 {
+		t.Fatalf("expected module to be downloaded once, got %v", n)
+	}
+
+	// modules nobody asked for within the TTL are pruned
+	old := time.Now().Add(-2 * moduleCacheTTL)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	mc.prune(moduleCacheTTL)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected module to be pruned, got %v", err)
+	}
+}
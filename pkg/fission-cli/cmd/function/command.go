@@ -56,12 +56,12 @@ func Commands() *cobra.Command {
 	getCmd := &cobra.Command{
 		Use:     "get",
 		Aliases: []string{},
-		Short:   "Get function source code",
+		Short:   "Get function source code, or the usage summary of a wasm function with --usage",
 		RunE:    wrapper.Wrapper(Get),
 	}
 	wrapper.SetFlags(getCmd, flag.FlagSet{
 		Required: []flag.Flag{flag.FnName},
-		Optional: []flag.Flag{flag.NamespaceFunction},
+		Optional: []flag.Flag{flag.NamespaceFunction, flag.FnWasmUsage},
 	})
 
 	getmetaCmd := &cobra.Command{
@@ -234,8 +234,9 @@ func Commands() *cobra.Command {
 		RunE:    wrapper.Wrapper(RunWasm),
 	}
 	wrapper.SetFlags(runWasmCmd, flag.FlagSet{
-		Required: []flag.Flag{flag.FnName, flag.PkgCode },
+		Required: []flag.Flag{flag.FnName},
 		Optional: []flag.Flag{
+			flag.PkgCode, flag.PkgOCI,
 			flag.FnPort, flag.FnCommand, flag.FnArgs,
 			flag.FnCfgMap, flag.FnSecret,
 			flag.FnExecutionTimeout,
@@ -244,6 +245,10 @@ func Commands() *cobra.Command {
 		    flag.FnEntryPoint,flag.FnPkgName,
 			flag.FnTerminationGracePeriod,flag.PkgDeployArchive,
 			flag.PkgBuildCmd,flag.PkgSrcArchive,
+			flag.PkgWasmLanguage, flag.PkgWasmPrecompile, flag.PkgWasmArch,
+			flag.FnWasmEnv, flag.FnWasmPreopen, flag.FnWasmEngine,
+			flag.FnWasmMaxMemory, flag.FnWasmFuel, flag.FnWasmMode,
+			flag.FnEnvName, flag.NamespaceEnvironment,
 
 			// flag for wasm to use.
 			flag.RunTimeMinCPU, flag.RunTimeMaxCPU, flag.RunTimeMinMemory,
@@ -254,6 +259,33 @@ func Commands() *cobra.Command {
 		},
 	})
 
+	updateWasmCmd := &cobra.Command{
+		Use:     "update-wasm",
+		Aliases: []string{"updatewm"},
+		Short:   "Alpha: Update a webassembly function",
+		RunE:    wrapper.Wrapper(UpdateWasm),
+	}
+	wrapper.SetFlags(updateWasmCmd, flag.FlagSet{
+		Required: []flag.Flag{flag.FnName},
+		Optional: []flag.Flag{
+			flag.PkgCode, flag.PkgOCI, flag.PkgDeployArchive,
+			flag.PkgSrcArchive, flag.PkgBuildCmd, flag.FnPkgName,
+			flag.PkgWasmLanguage, flag.PkgWasmPrecompile, flag.PkgWasmArch,
+			flag.FnEntryPoint, flag.FnPort, flag.FnArgs,
+			flag.FnSecret, flag.FnCfgMap,
+			flag.FnExecutionTimeout, flag.FnIdleTimeout,
+			flag.Labels, flag.Annotation,
+			flag.FnWasmEnv, flag.FnWasmPreopen, flag.FnWasmEngine,
+			flag.FnWasmMaxMemory, flag.FnWasmFuel, flag.FnWasmMode,
+
+			flag.RunTimeMinCPU, flag.RunTimeMaxCPU, flag.RunTimeMinMemory,
+			flag.RunTimeMaxMemory, flag.ReplicasMin, flag.ReplicasMax,
+			flag.RunTimeTargetCPU,
+
+			flag.NamespaceFunction,
+		},
+	})
+
 	listPodsCmd := &cobra.Command{
 		Use:     "pods",
 		Aliases: []string{"pod", "po"},
@@ -272,7 +304,7 @@ func Commands() *cobra.Command {
 		Short:   "Create, update and manage functions",
 	}
 	command.AddCommand(createCmd, getCmd, getmetaCmd, updateCmd, deleteCmd, listCmd, logsCmd, testCmd,
-		runContainerCmd,runKuasarWasmCmd,updateContainerCmd,runWasmCmd, listPodsCmd)
+		runContainerCmd,runKuasarWasmCmd,updateContainerCmd,runWasmCmd,updateWasmCmd, listPodsCmd)
 
 	return command
 }
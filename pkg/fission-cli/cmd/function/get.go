@@ -17,14 +17,23 @@ limitations under the License.
 package function
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"text/tabwriter"
 
 	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
 	"github.com/fission/fission/pkg/fission-cli/cliwrapper/cli"
 	"github.com/fission/fission/pkg/fission-cli/cmd"
 	flagkey "github.com/fission/fission/pkg/fission-cli/flag/key"
+	"github.com/fission/fission/pkg/fission-cli/util"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 )
 
 type GetSubCommand struct {
@@ -44,6 +53,24 @@ func (opts *GetSubCommand) do(input cli.Input) error {
 		return errors.Wrap(err, "error getting function")
 	}
 
+	if input.Bool(flagkey.FnWasmUsage) {
+		if fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType != fv1.ExecutorTypeWasm {
+			return errors.Errorf("function %v is not a wasm function", fn.ObjectMeta.Name)
+		}
+
+		// Portforward to the executor, which records the usage of wasm functions
+		localExecutorPort, err := util.SetupPortForward(util.GetFissionNamespace(), "svc=executor", input.String(flagkey.KubeContext))
+		if err != nil {
+			return err
+		}
+		summary, err := getWasmUsage("http://127.0.0.1:"+localExecutorPort, fn)
+		if err != nil {
+			return err
+		}
+		printWasmUsage(os.Stdout, fn, summary)
+		return nil
+	}
+
 	pkg, err := opts.Client().V1().Package().Get(&metav1.ObjectMeta{
 		Name:      fn.Spec.Package.PackageRef.Name,
 		Namespace: fn.Spec.Package.PackageRef.Namespace,
@@ -56,3 +83,41 @@ func (opts *GetSubCommand) do(input cli.Input) error {
 
 	return nil
 }
+
+// getWasmUsage returns the usage summary of the invocations of the wasm
+// function from the executor at executorURL.
+func getWasmUsage(executorURL string, fn *fv1.Function) (*wasmmodule.UsageSummary, error) {
+	query := url.Values{}
+	query.Set("namespace", fn.ObjectMeta.Namespace)
+	query.Set("name", fn.ObjectMeta.Name)
+	resp, err := http.Get(executorURL + "/v2/wasmUsage?" + query.Encode())
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting wasm function usage")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, errors.Errorf("error getting wasm function usage: %v %s", resp.Status, body)
+	}
+
+	var summary wasmmodule.UsageSummary
+	err = json.NewDecoder(resp.Body).Decode(&summary)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding wasm function usage")
+	}
+	return &summary, nil
+}
+
+func printWasmUsage(out io.Writer, fn *fv1.Function, summary *wasmmodule.UsageSummary) {
+	fuel := "-"
+	if summary.TotalFuel != nil {
+		fuel = fmt.Sprintf("%v", *summary.TotalFuel)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", "NAME", "INVOCATIONS", "AVGWALLTIME", "MAXWALLTIME", "AVGINSTANTIATION", "MAXPEAKMEMORY", "FUEL")
+	fmt.Fprintf(w, "%v\t%v\t%.3fs\t%.3fs\t%.3fs\t%v\t%v\n", fn.ObjectMeta.Name, summary.Invocations,
+		summary.AvgWallTimeSeconds(), summary.MaxWallTimeSeconds, summary.AvgInstantiationSeconds(),
+		summary.MaxPeakMemoryBytes, fuel)
+	w.Flush()
+}
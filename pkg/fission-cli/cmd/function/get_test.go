@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+)
+
+func TestGetWasmUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/wasmUsage" || r.URL.Query().Get("namespace") != "default" || r.URL.Query().Get("name") != "hello" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"invocations":4,"totalWallTimeSeconds":0.2,"maxWallTimeSeconds":0.08,"totalInstantiationSeconds":0.02,"maxPeakMemoryBytes":131072,"totalFuel":12000}`))
+	}))
+	defer server.Close()
+
+	fn := &fv1.Function{ObjectMeta: metav1.ObjectMeta{Name: "hello", Namespace: "default"}}
+	summary, err := getWasmUsage(server.URL, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	printWasmUsage(&out, fn, summary)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a header and a row, got %q", out.String())
+	}
+	if fields := strings.Fields(lines[1]); strings.Join(fields, " ") != "hello 4 0.050s 0.080s 0.005s 131072 12000" {
+		t.Fatalf("unexpected usage row %q", lines[1])
+	}
+
+	fn.ObjectMeta.Name = "unknown"
+	if _, err := getWasmUsage(server.URL, fn); err == nil {
+		t.Fatal("expected an error for a failed request")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	uuid "github.com/satori/go.uuid"
 	apiv1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	
 	_package "github.com/fission/fission/pkg/fission-cli/cmd/package"
@@ -98,8 +99,14 @@ func (opts *RunWasmSubCommand) complete(input cli.Input) error {
 
     //以下是为wasm文件创建package和archive
 	// var pkgMetadata *metav1.ObjectMeta
-	envName:="wasm"
-	envNamespace:="default"
+	envName := _package.WasmEnvironmentName
+	if len(input.String(flagkey.FnEnvironmentName)) > 0 {
+		envName = input.String(flagkey.FnEnvironmentName)
+	}
+	envNamespace := metav1.NamespaceDefault
+	if len(input.String(flagkey.NamespaceEnvironment)) > 0 {
+		envNamespace = input.String(flagkey.NamespaceEnvironment)
+	}
 	var pkg *fv1.Package
 
 	if len(pkgName) > 0 {
@@ -142,6 +149,21 @@ func (opts *RunWasmSubCommand) complete(input cli.Input) error {
 		// 	console.Warn("Function's environment is different than package's environment, package's environment will be used for creating function")
 		// }
 		// envNamespace = pkg.Spec.Environment.Namespace
+	} else if ociReference := input.String(flagkey.PkgOCI); len(ociReference) > 0 {
+		if len(input.String(flagkey.PkgCode)) > 0 || len(input.StringSlice(flagkey.PkgDeployArchive)) > 0 {
+			return errors.Errorf("--%v can not be used together with --%v or --%v", flagkey.PkgOCI, flagkey.PkgCode, flagkey.PkgDeployArchive)
+		}
+		id, err := uuid.NewV4()
+		if err != nil {
+			return errors.Wrap(err, "error generating uuid")
+		}
+		pkgName := generatePackageName(fnName, id.String())
+
+		pkg, err = _package.CreateWasmOCIPackage(input, opts.Client(), pkgName, fnNamespace, envName, envNamespace,
+			ociReference, opts.specFile)
+		if err != nil {
+			return errors.Wrap(err, "error creating package")
+		}
 	} else {
 		// need to specify environment for creating new package
 		// envName = input.String(flagkey.FnEnvironmentName)
@@ -194,7 +216,7 @@ func (opts *RunWasmSubCommand) complete(input cli.Input) error {
 		}
 		// return error when both src & deploy archive are empty
 		if len(srcArchiveFiles) == 0 && len(deployArchiveFiles) == 0 {
-			return errors.New("need --code or --deploy  argument")
+			return errors.New("need --code, --deploy or --oci argument")
 		}
 
 		buildcmd := input.String(flagkey.PkgBuildCmd)
@@ -208,7 +230,7 @@ func (opts *RunWasmSubCommand) complete(input cli.Input) error {
 		// pkgMetadata, err = _package.CreateFakePackage(input, opts.Client(), pkgName, fnNamespace, envName, envNamespace,
 		// 	srcArchiveFiles, deployArchiveFiles, buildcmd, specDir, opts.specFile, noZip)
 		pkg, err = _package.CreateWasmPackage(input, opts.Client(), pkgName, fnNamespace, envName, envNamespace,
-		srcArchiveFiles, deployArchiveFiles, buildcmd, specDir, opts.specFile, noZip)
+		srcArchiveFiles, deployArchiveFiles, buildcmd, specDir, opts.specFile, noZip, entrypoint)
 		if err != nil {
 			return errors.Wrap(err, "error creating package")
 		}
@@ -217,11 +239,10 @@ func (opts *RunWasmSubCommand) complete(input cli.Input) error {
 
 
 	var port int
-	var command, args string
+	var args string
 
 	
 	port = input.Int(flagkey.FnPort)
-	// command = input.String(flagkey.FnCommand)
 	args = input.String(flagkey.FnArgs)
 
 	var secrets []fv1.SecretReference
@@ -299,16 +320,30 @@ func (opts *RunWasmSubCommand) complete(input cli.Input) error {
 		return err
 	}
 
-	//加上wasm模块必须的annotation
-	urlAnnotation:=pkg.Spec.Deployment.URL
-	nameAnnotation:=pkg.Name+".wasm"
-	opts.function.ObjectMeta.Annotations=make(map[string]string)
-    opts.function.ObjectMeta.Annotations["wasm.module.url"]=urlAnnotation
-	opts.function.ObjectMeta.Annotations["wasm.module.filename"]=nameAnnotation
-    
+	moduleImage := pkg.Name
+	module := fv1.WasmModule{
+		URL:      pkg.Spec.Deployment.URL,
+		Filename: pkg.Name + ".wasm",
+	}
+	if pkg.Spec.Deployment.Type == fv1.ArchiveTypeOCI {
+		// the wasm executor replaces the image with the digest pinned reference
+		moduleImage = pkg.Spec.Deployment.URL
+		module = fv1.WasmModule{OCI: pkg.Spec.Deployment.URL}
+	}
+
+	opts.function.Spec.Wasm, err = getWasmSpec(input, nil)
+	if err != nil {
+		return err
+	}
+	opts.function.Spec.Wasm.Module = module
+	opts.function.Spec.Wasm.Entrypoint = entrypoint
+	if args != "" {
+		opts.function.Spec.Wasm.Args = strings.Split(args, " ")
+	}
+
 	container := &apiv1.Container{
 		Name:  fnName,
-		Image: pkg.Name,
+		Image: moduleImage,
 		Ports: []apiv1.ContainerPort{
 			{
 				Name:          "http-env",
@@ -316,13 +351,7 @@ func (opts *RunWasmSubCommand) complete(input cli.Input) error {
 			},
 		},
 	}
-	command=nameAnnotation
-	if command != "" {
-		container.Command = strings.Split(command, " ")
-	}
-	if args != "" {
-		container.Args = strings.Split(args, " ")
-	}
+	container.Command = []string{pkg.Name + ".wasm"}
 
     opts.function.Spec.Environment = fv1.EnvironmentReference{
 		Name:             envName,
@@ -381,3 +410,79 @@ func (opts *RunWasmSubCommand) run(input cli.Input) error {
 	fmt.Printf("function '%v' created\n", opts.function.ObjectMeta.Name)
 	return nil
 }
+
+// getWasmSpec returns a copy of the wasm spec with the wasm flags set by
+// the user applied to it.
+func getWasmSpec(input cli.Input, existing *fv1.WasmSpec) (*fv1.WasmSpec, error) {
+	ws := &fv1.WasmSpec{}
+	if existing != nil {
+		ws = existing.DeepCopy()
+	}
+
+	if input.IsSet(flagkey.FnWasmEnv) {
+		ws.Env = nil
+		for _, kv := range input.StringSlice(flagkey.FnWasmEnv) {
+			name, value, found := strings.Cut(kv, "=")
+			if !found {
+				return nil, errors.Errorf("invalid wasm environment variable '%v', expected KEY=VALUE", kv)
+			}
+			ws.Env = append(ws.Env, fv1.WasmEnvVar{Name: name, Value: value})
+		}
+	}
+
+	if input.IsSet(flagkey.FnWasmPreopen) {
+		ws.PreopenDirs = nil
+		for _, p := range input.StringSlice(flagkey.FnWasmPreopen) {
+			dir, err := parseWasmPreopen(p)
+			if err != nil {
+				return nil, err
+			}
+			ws.PreopenDirs = append(ws.PreopenDirs, *dir)
+		}
+	}
+
+	if input.IsSet(flagkey.FnWasmEngine) {
+		ws.Engine = fv1.WasmEngine(input.String(flagkey.FnWasmEngine))
+	}
+
+	if input.IsSet(flagkey.FnWasmMaxMemory) {
+		ws.MaxMemory = nil
+		if m := input.String(flagkey.FnWasmMaxMemory); len(m) > 0 {
+			q, err := resource.ParseQuantity(m)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid wasm max memory '%v'", m)
+			}
+			ws.MaxMemory = &q
+		}
+	}
+
+	if input.IsSet(flagkey.FnWasmMode) {
+		ws.Mode = fv1.WasmMode(input.String(flagkey.FnWasmMode))
+	}
+
+	if input.IsSet(flagkey.FnWasmFuel) {
+		ws.Fuel = input.Int64(flagkey.FnWasmFuel)
+	}
+
+	return ws, nil
+}
+
+// parseWasmPreopen parses a preopened directory in the form
+// path[:guestpath][:ro]. The guest path defaults to the pod path.
+func parseWasmPreopen(s string) (*fv1.WasmPreopenDir, error) {
+	parts := strings.Split(s, ":")
+	dir := &fv1.WasmPreopenDir{}
+	if len(parts) > 1 && parts[len(parts)-1] == "ro" {
+		dir.ReadOnly = true
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) > 2 || len(parts[0]) == 0 {
+		return nil, errors.Errorf("invalid wasm preopened directory '%v', expected path[:guestpath][:ro]", s)
+	}
+	dir.Path = parts[0]
+	dir.GuestPath = parts[0]
+	if len(parts) == 2 && len(parts[1]) > 0 {
+		dir.GuestPath = parts[1]
+	}
+	return dir, nil
+}
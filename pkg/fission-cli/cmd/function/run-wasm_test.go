@@ -3,8 +3,11 @@ package function
 import (
 	// "fmt"
 	"fmt"
+	"reflect"
 	"testing"
 
+	"k8s.io/apimachinery/pkg/api/resource"
+
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
 	"github.com/fission/fission/pkg/controller/client"
 	"github.com/fission/fission/pkg/controller/client/rest"
@@ -50,4 +53,54 @@ func TestRunwasmComplete(t *testing.T) {
 		t.Log("创建失败")
 	}
 	t.Log("创建成功")
-}
\ No newline at end of file
+}
+
+func TestGetWasmSpec(t *testing.T) {
+	flags := dummy.TestFlagSet()
+	flags.Set(flagkey.FnWasmEnv, []string{"A=1", "B=x=y"})
+	flags.Set(flagkey.FnWasmPreopen, []string{"/data", "/cache:/tmp:ro"})
+	flags.Set(flagkey.FnWasmEngine, "wasmedge")
+	flags.Set(flagkey.FnWasmMaxMemory, "64Mi")
+	flags.Set(flagkey.FnWasmFuel, int64(1000))
+	flags.Set(flagkey.FnWasmMode, "pool")
+
+	existing := &fv1.WasmSpec{
+		Module:     fv1.WasmModule{URL: "http://example.com/hello.wasm"},
+		Entrypoint: "handler",
+	}
+	ws, err := getWasmSpec(flags, existing)
+	if err != nil {
+		t.Fatalf("error getting wasm spec: %v", err)
+	}
+	maxMemory := resource.MustParse("64Mi")
+	expected := &fv1.WasmSpec{
+		Module:     existing.Module,
+		Entrypoint: "handler",
+		Env:        []fv1.WasmEnvVar{{Name: "A", Value: "1"}, {Name: "B", Value: "x=y"}},
+		PreopenDirs: []fv1.WasmPreopenDir{
+			{Path: "/data", GuestPath: "/data"},
+			{Path: "/cache", GuestPath: "/tmp", ReadOnly: true},
+		},
+		Engine:    fv1.WasmEngineWasmEdge,
+		MaxMemory: &maxMemory,
+		Fuel:      1000,
+		Mode:      fv1.WasmModePool,
+	}
+	if !reflect.DeepEqual(ws, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, ws)
+	}
+	if len(existing.Env) != 0 {
+		t.Fatal("existing wasm spec was modified")
+	}
+
+	for name, value := range map[string][]string{
+		flagkey.FnWasmEnv:     {"A"},
+		flagkey.FnWasmPreopen: {"/a:/b:/c"},
+	} {
+		flags := dummy.TestFlagSet()
+		flags.Set(name, value)
+		if _, err := getWasmSpec(flags, nil); err == nil {
+			t.Fatalf("expected an error for --%v %v", name, value)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package function
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	apiv1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/fission-cli/cliwrapper/cli"
+	"github.com/fission/fission/pkg/fission-cli/cmd"
+	_package "github.com/fission/fission/pkg/fission-cli/cmd/package"
+	"github.com/fission/fission/pkg/fission-cli/console"
+	flagkey "github.com/fission/fission/pkg/fission-cli/flag/key"
+	"github.com/fission/fission/pkg/fission-cli/util"
+)
+
+type UpdateWasmSubCommand struct {
+	cmd.CommandActioner
+	function *fv1.Function
+}
+
+func UpdateWasm(input cli.Input) error {
+	return (&UpdateWasmSubCommand{}).do(input)
+}
+
+func (opts *UpdateWasmSubCommand) do(input cli.Input) error {
+	err := opts.complete(input)
+	if err != nil {
+		return err
+	}
+	return opts.run(input)
+}
+
+func (opts *UpdateWasmSubCommand) complete(input cli.Input) error {
+	fnName := input.String(flagkey.FnName)
+	fnNamespace := input.String(flagkey.NamespaceFunction)
+
+	function, err := opts.Client().V1().Function().Get(&metav1.ObjectMeta{
+		Name:      fnName,
+		Namespace: fnNamespace,
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("read function '%v'", fnName))
+	}
+	if fv1.ExecutorTypeWasm != function.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType {
+		return fmt.Errorf("executor type for function is not %s", fv1.ExecutorTypeWasm)
+	}
+	if function.Spec.PodSpec == nil || len(function.Spec.PodSpec.Containers) != 1 {
+		return errors.Errorf("function %s must have exactly one container", fnName)
+	}
+
+	port := input.Int(flagkey.FnPort)
+	args := input.String(flagkey.FnArgs)
+	entrypoint := input.String(flagkey.FnEntrypoint)
+
+	secretNames := input.StringSlice(flagkey.FnSecret)
+	cfgMapNames := input.StringSlice(flagkey.FnCfgMap)
+
+	if len(secretNames) > 0 {
+		var secrets []fv1.SecretReference
+
+		// check that the referenced secret is in the same ns as the function, if not give a warning.
+		for _, secretName := range secretNames {
+			err := opts.Client().V1().Misc().SecretExists(&metav1.ObjectMeta{
+				Namespace: fnNamespace,
+				Name:      secretName,
+			})
+			if k8serrors.IsNotFound(err) {
+				console.Warn(fmt.Sprintf("secret %s not found in Namespace: %s. Secret needs to be present in the same namespace as function", secretName, fnNamespace))
+			}
+			secrets = append(secrets, fv1.SecretReference{
+				Name:      secretName,
+				Namespace: fnNamespace,
+			})
+		}
+		function.Spec.Secrets = secrets
+	}
+
+	if len(cfgMapNames) > 0 {
+		var configMaps []fv1.ConfigMapReference
+
+		// check that the referenced cfgmap is in the same ns as the function, if not give a warning.
+		for _, cfgMapName := range cfgMapNames {
+			err := opts.Client().V1().Misc().ConfigMapExists(&metav1.ObjectMeta{
+				Namespace: fnNamespace,
+				Name:      cfgMapName,
+			})
+			if k8serrors.IsNotFound(err) {
+				console.Warn(fmt.Sprintf("ConfigMap %s not found in Namespace: %s. ConfigMap needs to be present in the same namespace as the function", cfgMapName, fnNamespace))
+			}
+			configMaps = append(configMaps, fv1.ConfigMapReference{
+				Name:      cfgMapName,
+				Namespace: fnNamespace,
+			})
+		}
+		function.Spec.ConfigMaps = configMaps
+	}
+
+	if input.IsSet(flagkey.FnExecutionTimeout) {
+		fnTimeout := input.Int(flagkey.FnExecutionTimeout)
+		if fnTimeout <= 0 {
+			return errors.Errorf("--%v must be greater than 0", flagkey.FnExecutionTimeout)
+		}
+		function.Spec.FunctionTimeout = fnTimeout
+	}
+
+	if input.IsSet(flagkey.FnIdleTimeout) {
+		fnTimeout := input.Int(flagkey.FnIdleTimeout)
+		function.Spec.IdleTimeout = &fnTimeout
+	}
+
+	strategy, err := getInvokeStrategy(input, &function.Spec.InvokeStrategy)
+	if err != nil {
+		return err
+	}
+	function.Spec.InvokeStrategy = *strategy
+
+	resReqs, err := util.GetResourceReqs(input, &function.Spec.Resources)
+	if err != nil {
+		return err
+	}
+	function.Spec.Resources = *resReqs
+
+	wasmSpec, err := getWasmSpec(input, function.Spec.Wasm)
+	if err != nil {
+		return err
+	}
+	if function.Spec.Wasm != nil || !reflect.DeepEqual(wasmSpec, &fv1.WasmSpec{}) {
+		function.Spec.Wasm = wasmSpec
+	}
+
+	if len(entrypoint) > 0 {
+		function.Spec.Package.FunctionName = entrypoint
+		if function.Spec.Wasm != nil {
+			function.Spec.Wasm.Entrypoint = entrypoint
+		}
+	}
+
+	newPackage, err := opts.setPackage(input, function)
+	if err != nil {
+		return err
+	}
+
+	// the spec is validated before a new package is created, so that an
+	// invalid spec leaves no unused package behind. The module of a new
+	// package replaces the one of the spec.
+	if function.Spec.Wasm != nil {
+		wasmSpec := function.Spec.Wasm.DeepCopy()
+		if newPackage {
+			wasmSpec.Module = fv1.WasmModule{}
+		}
+		err = wasmSpec.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if newPackage {
+		pkg, err := opts.createPackage(input, function)
+		if err != nil {
+			return err
+		}
+		setWasmPackage(function, pkg)
+	}
+
+	container := &function.Spec.PodSpec.Containers[0]
+	if port != 0 {
+		container.Ports = []apiv1.ContainerPort{
+			{
+				Name:          "http-env",
+				ContainerPort: int32(port),
+			},
+		}
+	}
+	if args != "" {
+		if function.Spec.Wasm != nil {
+			function.Spec.Wasm.Args = strings.Split(args, " ")
+		} else {
+			container.Args = strings.Split(args, " ")
+		}
+	}
+
+	opts.function = function
+
+	err = util.ApplyLabelsAndAnnotations(input, &opts.function.ObjectMeta)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// setPackage points the function to the package given with --pkgname, and
+// reports whether a new package is to be created instead, when a module is
+// given with --code, --deploy or --oci.
+func (opts *UpdateWasmSubCommand) setPackage(input cli.Input, function *fv1.Function) (bool, error) {
+	pkgName := input.String(flagkey.FnPackageName)
+	ociReference := input.String(flagkey.PkgOCI)
+	code := input.String(flagkey.PkgCode)
+	deployArchiveFiles := input.StringSlice(flagkey.PkgDeployArchive)
+	srcArchiveFiles := input.StringSlice(flagkey.PkgSrcArchive)
+
+	sources := 0
+	for _, set := range []bool{len(pkgName) > 0, len(ociReference) > 0,
+		len(code) > 0 || len(deployArchiveFiles) > 0 || len(srcArchiveFiles) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return false, errors.Errorf("only one of --%v, --%v or --%v/--%v can be used",
+			flagkey.FnPackageName, flagkey.PkgOCI, flagkey.PkgCode, flagkey.PkgDeployArchive)
+	}
+	if len(pkgName) == 0 {
+		return sources > 0, nil
+	}
+
+	fnNamespace := function.ObjectMeta.Namespace
+	pkg, err := opts.Client().V1().Package().Get(&metav1.ObjectMeta{
+		Namespace: fnNamespace,
+		Name:      pkgName,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("read package in '%v' in Namespace: %s. Package needs to be present in the same namespace as function", pkgName, fnNamespace))
+	}
+	setWasmPackage(function, pkg)
+	return false, nil
+}
+
+// createPackage creates the package of the module given with --code,
+// --deploy or --oci.
+func (opts *UpdateWasmSubCommand) createPackage(input cli.Input, function *fv1.Function) (*fv1.Package, error) {
+	fnName := function.ObjectMeta.Name
+	fnNamespace := function.ObjectMeta.Namespace
+	envName := function.Spec.Environment.Name
+	if len(envName) == 0 {
+		envName = _package.WasmEnvironmentName
+	}
+	envNamespace := function.Spec.Environment.Namespace
+	if len(envNamespace) == 0 {
+		envNamespace = metav1.NamespaceDefault
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating uuid")
+	}
+	pkgName := generatePackageName(fnName, id.String())
+
+	var pkg *fv1.Package
+	if ociReference := input.String(flagkey.PkgOCI); len(ociReference) > 0 {
+		pkg, err = _package.CreateWasmOCIPackage(input, opts.Client(), pkgName,
+			fnNamespace, envName, envNamespace, ociReference, "")
+	} else {
+		deployArchiveFiles := input.StringSlice(flagkey.PkgDeployArchive)
+		if code := input.String(flagkey.PkgCode); len(code) > 0 {
+			deployArchiveFiles = append(deployArchiveFiles, code)
+		}
+		pkg, err = _package.CreateWasmPackage(input, opts.Client(), pkgName,
+			fnNamespace, envName, envNamespace, input.StringSlice(flagkey.PkgSrcArchive), deployArchiveFiles,
+			input.String(flagkey.PkgBuildCmd), "", "", true, function.Spec.Package.FunctionName)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating package")
+	}
+	return pkg, nil
+}
+
+// setWasmPackage points the function to the module of the package, the wasm
+// executor rolls the function pods out to the new module.
+func setWasmPackage(function *fv1.Function, pkg *fv1.Package) {
+	function.Spec.Package.PackageRef = fv1.PackageRef{
+		Namespace:       pkg.ObjectMeta.Namespace,
+		Name:            pkg.ObjectMeta.Name,
+		ResourceVersion: pkg.ObjectMeta.ResourceVersion,
+	}
+
+	moduleImage := pkg.ObjectMeta.Name
+	module := fv1.WasmModule{
+		URL:      pkg.Spec.Deployment.URL,
+		Filename: pkg.ObjectMeta.Name + ".wasm",
+	}
+	if pkg.Spec.Deployment.Type == fv1.ArchiveTypeOCI {
+		moduleImage = pkg.Spec.Deployment.URL
+		module = fv1.WasmModule{OCI: pkg.Spec.Deployment.URL}
+	}
+
+	if function.Spec.Wasm == nil {
+		function.Spec.Wasm = &fv1.WasmSpec{Entrypoint: function.Spec.Package.FunctionName}
+	}
+	function.Spec.Wasm.Module = module
+
+	// the module annotations of functions created before the wasm spec
+	// would otherwise still point to the old module
+	delete(function.ObjectMeta.Annotations, fv1.ANNOTATION_WASM_MODULE_URL)
+	delete(function.ObjectMeta.Annotations, fv1.ANNOTATION_WASM_MODULE_FILENAME)
+
+	container := &function.Spec.PodSpec.Containers[0]
+	container.Image = moduleImage
+	container.Command = []string{pkg.ObjectMeta.Name + ".wasm"}
+}
+
+func (opts *UpdateWasmSubCommand) run(input cli.Input) error {
+	_, err := opts.Client().V1().Function().Update(opts.function)
+	if err != nil {
+		return errors.Wrap(err, "error updating function")
+	}
+
+	fmt.Printf("Function '%v' updated\n", opts.function.ObjectMeta.Name)
+	return nil
+}
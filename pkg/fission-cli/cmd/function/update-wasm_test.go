@@ -0,0 +1,85 @@
+package function
+
+import (
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+)
+
+func TestSetWasmPackage(t *testing.T) {
+	newFunction := func() *fv1.Function {
+		return &fv1.Function{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hello",
+				Namespace: "default",
+				Annotations: map[string]string{
+					fv1.ANNOTATION_WASM_MODULE_URL:      "http://storage/old",
+					fv1.ANNOTATION_WASM_MODULE_FILENAME: "hello-old.wasm",
+					"team":                              "wasm",
+				},
+			},
+			Spec: fv1.FunctionSpec{
+				Package: fv1.FunctionPackageRef{
+					FunctionName: "handler",
+					PackageRef:   fv1.PackageRef{Namespace: "default", Name: "hello-old"},
+				},
+				PodSpec: &apiv1.PodSpec{
+					Containers: []apiv1.Container{{
+						Name:    "hello",
+						Image:   "hello-old",
+						Command: []string{"hello-old.wasm"},
+						Ports:   []apiv1.ContainerPort{{Name: "http-env", ContainerPort: 8080}},
+					}},
+				},
+			},
+		}
+	}
+
+	fn := newFunction()
+	setWasmPackage(fn, &fv1.Package{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello-new", Namespace: "default", ResourceVersion: "2"},
+		Spec: fv1.PackageSpec{
+			Deployment: fv1.Archive{Type: fv1.ArchiveTypeUrl, URL: "http://storage/new"},
+		},
+	})
+	expectedRef := fv1.PackageRef{Namespace: "default", Name: "hello-new", ResourceVersion: "2"}
+	if fn.Spec.Package.PackageRef != expectedRef {
+		t.Fatalf("expected package ref %v, got %v", expectedRef, fn.Spec.Package.PackageRef)
+	}
+	expectedWasm := &fv1.WasmSpec{
+		Module:     fv1.WasmModule{URL: "http://storage/new", Filename: "hello-new.wasm"},
+		Entrypoint: "handler",
+	}
+	if !reflect.DeepEqual(fn.Spec.Wasm, expectedWasm) {
+		t.Fatalf("expected wasm spec %+v, got %+v", expectedWasm, fn.Spec.Wasm)
+	}
+	if !reflect.DeepEqual(fn.ObjectMeta.Annotations, map[string]string{"team": "wasm"}) {
+		t.Fatalf("expected module annotations to be removed, got %v", fn.ObjectMeta.Annotations)
+	}
+	container := fn.Spec.PodSpec.Containers[0]
+	if container.Image != "hello-new" || !reflect.DeepEqual(container.Command, []string{"hello-new.wasm"}) {
+		t.Fatalf("unexpected container %+v", container)
+	}
+	if len(container.Ports) != 1 || container.Ports[0].ContainerPort != 8080 {
+		t.Fatalf("expected container port to be kept, got %v", container.Ports)
+	}
+
+	fn = newFunction()
+	fn.Spec.Wasm = &fv1.WasmSpec{Entrypoint: "handler", Fuel: 100}
+	setWasmPackage(fn, &fv1.Package{
+		ObjectMeta: metav1.ObjectMeta{Name: "hello-oci", Namespace: "default"},
+		Spec: fv1.PackageSpec{
+			Deployment: fv1.Archive{Type: fv1.ArchiveTypeOCI, URL: "ghcr.io/org/hello:v2"},
+		},
+	})
+	if fn.Spec.Wasm.Module != (fv1.WasmModule{OCI: "ghcr.io/org/hello:v2"}) || fn.Spec.Wasm.Fuel != 100 {
+		t.Fatalf("unexpected wasm spec %+v", fn.Spec.Wasm)
+	}
+	if fn.Spec.PodSpec.Containers[0].Image != "ghcr.io/org/hello:v2" {
+		t.Fatalf("expected the OCI reference as image, got %v", fn.Spec.PodSpec.Containers[0].Image)
+	}
+}
@@ -34,7 +34,7 @@ func Commands() *cobra.Command {
 		Optional: []flag.Flag{flag.HtUrl, flag.HtName, flag.HtMethod, flag.HtIngress,
 			flag.HtIngressRule, flag.HtIngressAnnotation, flag.HtIngressTLS,
 			flag.HtFnWeight, flag.HtHost, flag.NamespaceFunction, flag.SpecSave, flag.SpecDry,
-			flag.HtPrefix, flag.HtKeepPrefix},
+			flag.HtPrefix, flag.HtKeepPrefix, flag.HtLbStrategy, flag.HtLbHashHeader, flag.HtLbHashCookie},
 	})
 
 	getCmd := &cobra.Command{
@@ -58,7 +58,7 @@ func Commands() *cobra.Command {
 		Optional: []flag.Flag{flag.HtUrl, flag.HtFnName,
 			flag.HtMethod, flag.HtIngress, flag.HtIngressRule, flag.HtIngressAnnotation,
 			flag.HtIngressTLS, flag.HtFnWeight, flag.HtHost, flag.NamespaceTrigger,
-			flag.HtPrefix, flag.HtKeepPrefix},
+			flag.HtPrefix, flag.HtKeepPrefix, flag.HtLbStrategy, flag.HtLbHashHeader, flag.HtLbHashCookie},
 	})
 
 	deleteCmd := &cobra.Command{
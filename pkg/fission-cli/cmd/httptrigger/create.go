@@ -171,6 +171,12 @@ func (opts *CreateSubCommand) complete(input cli.Input) error {
 
 	host := input.String(flagkey.HtHost)
 
+	lbConfig, err := GetLoadBalancerConfig(input.String(flagkey.HtLbStrategy),
+		input.String(flagkey.HtLbHashHeader), input.String(flagkey.HtLbHashCookie), nil)
+	if err != nil {
+		return errors.Wrap(err, "error parsing load balancer configuration")
+	}
+
 	opts.trigger = &fv1.HTTPTrigger{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      triggerName,
@@ -185,6 +191,7 @@ func (opts *CreateSubCommand) complete(input cli.Input) error {
 			IngressConfig:     *ingressConfig,
 			Prefix:            &prefix,
 			KeepPrefix:        input.Bool(flagkey.HtKeepPrefix),
+			LoadBalancer:      lbConfig,
 		},
 	}
 
@@ -85,6 +85,46 @@ func GetIngressConfig(annotations []string, rule string, tls string,
 	return oldIngressConfig, nil
 }
 
+// GetLoadBalancerConfig returns a LoadBalancerConfig based on user inputs applied
+// on top of oldConfig; return error if any. Empty inputs leave oldConfig intact,
+// the strategy "-" removes the config.
+func GetLoadBalancerConfig(strategy string, hashHeader string, hashCookie string,
+	oldConfig *fv1.LoadBalancerConfig) (*fv1.LoadBalancerConfig, error) {
+
+	if strategy == "-" {
+		return nil, nil
+	}
+	if len(strategy) == 0 && len(hashHeader) == 0 && len(hashCookie) == 0 {
+		return oldConfig, nil
+	}
+
+	if len(hashHeader) > 0 && len(hashCookie) > 0 {
+		return nil, fmt.Errorf("only one of hash header or hash cookie can be set")
+	}
+
+	config := &fv1.LoadBalancerConfig{}
+	if oldConfig != nil {
+		*config = *oldConfig
+	}
+	if len(strategy) > 0 {
+		config.Strategy = fv1.LoadBalancerStrategy(strategy)
+		if config.Strategy != fv1.LoadBalancerStrategyConsistentHash {
+			config.HashHeader, config.HashCookie = "", ""
+		}
+	}
+	if len(hashHeader) > 0 {
+		config.HashHeader, config.HashCookie = hashHeader, ""
+	}
+	if len(hashCookie) > 0 {
+		config.HashHeader, config.HashCookie = "", hashCookie
+	}
+	err := config.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
 func getIngressAnnotations(annotations []string) (remove bool, anns map[string]string, err error) {
 	if len(annotations) == 0 {
 		return false, nil, nil
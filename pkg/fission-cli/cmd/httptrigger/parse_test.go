@@ -584,3 +584,90 @@ func Test_getIngressTLS(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetLoadBalancerConfig(t *testing.T) {
+	type args struct {
+		strategy   string
+		hashHeader string
+		hashCookie string
+		oldConfig  *fv1.LoadBalancerConfig
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *fv1.LoadBalancerConfig
+		wantErr bool
+	}{
+		{
+			name: "no inputs",
+			args: args{},
+			want: nil,
+		},
+		{
+			name: "least outstanding",
+			args: args{strategy: "leastoutstanding"},
+			want: &fv1.LoadBalancerConfig{Strategy: fv1.LoadBalancerStrategyLeastOutstanding},
+		},
+		{
+			name: "consistent hash on header",
+			args: args{strategy: "consistenthash", hashHeader: "X-User"},
+			want: &fv1.LoadBalancerConfig{Strategy: fv1.LoadBalancerStrategyConsistentHash, HashHeader: "X-User"},
+		},
+		{
+			name:    "consistent hash without key",
+			args:    args{strategy: "consistenthash"},
+			wantErr: true,
+		},
+		{
+			name:    "consistent hash on header and cookie",
+			args:    args{strategy: "consistenthash", hashHeader: "X-User", hashCookie: "session"},
+			wantErr: true,
+		},
+		{
+			name:    "hash key with round robin",
+			args:    args{strategy: "roundrobin", hashCookie: "session"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown strategy",
+			args:    args{strategy: "random"},
+			wantErr: true,
+		},
+		{
+			name: "replace hash header with cookie",
+			args: args{
+				hashCookie: "session",
+				oldConfig:  &fv1.LoadBalancerConfig{Strategy: fv1.LoadBalancerStrategyConsistentHash, HashHeader: "X-User"},
+			},
+			want: &fv1.LoadBalancerConfig{Strategy: fv1.LoadBalancerStrategyConsistentHash, HashCookie: "session"},
+		},
+		{
+			name: "change strategy drops hash key",
+			args: args{
+				strategy:  "roundrobin",
+				oldConfig: &fv1.LoadBalancerConfig{Strategy: fv1.LoadBalancerStrategyConsistentHash, HashHeader: "X-User"},
+			},
+			want: &fv1.LoadBalancerConfig{Strategy: fv1.LoadBalancerStrategyRoundRobin},
+		},
+		{
+			name: "remove config",
+			args: args{
+				strategy:  "-",
+				oldConfig: &fv1.LoadBalancerConfig{Strategy: fv1.LoadBalancerStrategyLeastOutstanding},
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetLoadBalancerConfig(tt.args.strategy, tt.args.hashHeader, tt.args.hashCookie, tt.args.oldConfig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetLoadBalancerConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetLoadBalancerConfig() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
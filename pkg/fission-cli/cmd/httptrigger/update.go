@@ -125,6 +125,15 @@ func (opts *UpdateSubCommand) complete(input cli.Input) error {
 		ht.Spec.Host = input.String(flagkey.HtHost)
 	}
 
+	if input.IsSet(flagkey.HtLbStrategy) || input.IsSet(flagkey.HtLbHashHeader) || input.IsSet(flagkey.HtLbHashCookie) {
+		lbConfig, err := GetLoadBalancerConfig(input.String(flagkey.HtLbStrategy),
+			input.String(flagkey.HtLbHashHeader), input.String(flagkey.HtLbHashCookie), ht.Spec.LoadBalancer)
+		if err != nil {
+			return errors.Wrap(err, "error parsing load balancer configuration")
+		}
+		ht.Spec.LoadBalancer = lbConfig
+	}
+
 	if input.IsSet(flagkey.HtIngressRule) || input.IsSet(flagkey.HtIngressAnnotation) || input.IsSet(flagkey.HtIngressTLS) {
 		fallbackURL := ""
 		if ht.Spec.Prefix != nil && *ht.Spec.Prefix != "" {
@@ -125,6 +125,14 @@ func (opts *CreateSubCommand) complete(input cli.Input) error {
 
 	secret := input.String(flagkey.MqtSecret)
 
+	batch, err := updateBatch(input, nil)
+	if err != nil {
+		return err
+	}
+	if batch != nil && (mqType != fv1.MessageQueueTypeKafka || mqtKind == "keda") {
+		return errors.Errorf("batch delivery is only supported by kafka triggers with --%v fission", flagkey.MqtKind)
+	}
+
 	if input.Bool(flagkey.SpecSave) {
 		specDir := util.GetSpecDir(input)
 		specIgnore := util.GetSpecIgnore(input)
@@ -176,6 +184,7 @@ func (opts *CreateSubCommand) complete(input cli.Input) error {
 			Metadata:         metadata,
 			Secret:           secret,
 			MqtKind:          mqtKind,
+			Batch:            batch,
 		},
 	}
 
@@ -215,3 +224,45 @@ func checkMQTopicAvailability(mqType fv1.MessageQueueType, mqtKind string, topic
 	}
 	return nil
 }
+
+// updateBatch applies the batch flags to batch, returning the resulting batch
+// configuration. Setting --batchmaxrecords to 0 disables batch delivery.
+func updateBatch(input cli.Input, batch *fv1.MessageQueueTriggerBatch) (*fv1.MessageQueueTriggerBatch, error) {
+	others := input.IsSet(flagkey.MqtBatchMaxBytes) || input.IsSet(flagkey.MqtBatchMaxWait) || input.IsSet(flagkey.MqtBatchFormat)
+	if !input.IsSet(flagkey.MqtBatchMaxRecords) && !others {
+		return batch, nil
+	}
+	if input.IsSet(flagkey.MqtBatchMaxRecords) && input.Int(flagkey.MqtBatchMaxRecords) == 0 {
+		if others {
+			return nil, errors.Errorf("batch flags can't be set when --%v is 0", flagkey.MqtBatchMaxRecords)
+		}
+		return nil, nil
+	}
+
+	if batch == nil {
+		if !input.IsSet(flagkey.MqtBatchMaxRecords) {
+			return nil, errors.Errorf("--%v is required to enable batch delivery", flagkey.MqtBatchMaxRecords)
+		}
+		batch = &fv1.MessageQueueTriggerBatch{}
+	} else {
+		batch = batch.DeepCopy()
+	}
+	if input.IsSet(flagkey.MqtBatchMaxRecords) {
+		batch.MaxRecords = input.Int(flagkey.MqtBatchMaxRecords)
+	}
+	if input.IsSet(flagkey.MqtBatchMaxBytes) {
+		batch.MaxBytes = input.Int(flagkey.MqtBatchMaxBytes)
+	}
+	if input.IsSet(flagkey.MqtBatchMaxWait) {
+		batch.MaxWait = metav1.Duration{Duration: input.Duration(flagkey.MqtBatchMaxWait)}
+	}
+	if input.IsSet(flagkey.MqtBatchFormat) {
+		batch.Format = fv1.BatchFormat(input.String(flagkey.MqtBatchFormat))
+	}
+
+	err := batch.Validate()
+	if err != nil {
+		return nil, fv1.AggregateValidationErrors("MessageQueueTrigger", err)
+	}
+	return batch, nil
+}
@@ -130,6 +130,15 @@ func (opts *UpdateSubCommand) complete(input cli.Input) error {
 		updated = true
 	}
 
+	batch, err := updateBatch(input, mqt.Spec.Batch)
+	if err != nil {
+		return err
+	}
+	if batch != mqt.Spec.Batch {
+		mqt.Spec.Batch = batch
+		updated = true
+	}
+
 	if !updated {
 		return errors.New("Nothing changed, see 'help' for more details")
 	}
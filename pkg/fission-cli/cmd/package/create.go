@@ -35,6 +35,7 @@ import (
 	"github.com/fission/fission/pkg/fission-cli/console"
 	flagkey "github.com/fission/fission/pkg/fission-cli/flag/key"
 	"github.com/fission/fission/pkg/fission-cli/util"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 )
 
 type CreateSubCommand struct {
@@ -137,6 +138,15 @@ func CreatePackage(input cli.Input, client client.Interface, pkgName string, pkg
 	}
 	var pkgStatus fv1.BuildStatus = fv1.BuildStatusSucceeded
 
+	var annotations map[string]string
+	if envName == WasmEnvironmentName {
+		var err error
+		annotations, err = inspectWasmCode(deployArchiveFiles, noZip, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if len(deployArchiveFiles) > 0 {
 		if len(specFile) > 0 { // we should do this in all cases, i think
 			pkgStatus = fv1.BuildStatusNone
@@ -176,8 +186,9 @@ func CreatePackage(input cli.Input, client client.Interface, pkgName string, pkg
 
 	pkg := &fv1.Package{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      pkgName,
-			Namespace: pkgNamespace,
+			Name:        pkgName,
+			Namespace:   pkgNamespace,
+			Annotations: annotations,
 		},
 		Spec: pkgSpec,
 		Status: fv1.PackageStatus{
@@ -220,7 +231,7 @@ func CreatePackage(input cli.Input, client client.Interface, pkgName string, pkg
 }
 // TODO: get all necessary value from CLI input directly
 func CreateWasmPackage(input cli.Input, client client.Interface, pkgName string, pkgNamespace string, envName string, envNamespace string,
-	srcArchiveFiles []string, deployArchiveFiles []string, buildcmd string, specDir string, specFile string, noZip bool) (*fv1.Package, error) {
+	srcArchiveFiles []string, deployArchiveFiles []string, buildcmd string, specDir string, specFile string, noZip bool, entrypoint string) (*fv1.Package, error) {
 
 	insecure := input.Bool(flagkey.PkgInsecure)
 	deployChecksum := input.String(flagkey.PkgDeployChecksum)
@@ -234,6 +245,19 @@ func CreateWasmPackage(input cli.Input, client client.Interface, pkgName string,
 	}
 	var pkgStatus fv1.BuildStatus = fv1.BuildStatusSucceeded
 
+	annotations, err := inspectWasmCode(deployArchiveFiles, noZip, entrypoint)
+	if err != nil {
+		return nil, err
+	}
+
+	wasmBuild, err := getWasmBuildSpec(input)
+	if err != nil {
+		return nil, err
+	}
+	if wasmBuild != nil && len(srcArchiveFiles) == 0 {
+		return nil, errors.Errorf("--%v requires a source archive to build the module from", flagkey.PkgWasmLanguage)
+	}
+
 	if len(deployArchiveFiles) > 0 {
 		if len(specFile) > 0 { // we should do this in all cases, i think
 			pkgStatus = fv1.BuildStatusNone
@@ -253,6 +277,7 @@ func CreateWasmPackage(input cli.Input, client client.Interface, pkgName string,
 			return nil, errors.Wrap(err, "error creating deploy archive")
 		}
 		pkgSpec.Source = *source
+		pkgSpec.Wasm = wasmBuild
 		pkgStatus = fv1.BuildStatusPending // set package build status to pending
 		if len(pkgName) == 0 {
 			pkgName = util.KubifyName(fmt.Sprintf("%v-%v", path.Base(srcArchiveFiles[0]), uniuri.NewLen(4)))
@@ -273,8 +298,9 @@ func CreateWasmPackage(input cli.Input, client client.Interface, pkgName string,
 
 	pkg := &fv1.Package{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      pkgName,
-			Namespace: pkgNamespace,
+			Name:        pkgName,
+			Namespace:   pkgNamespace,
+			Annotations: annotations,
 		},
 		Spec: pkgSpec,
 		Status: fv1.PackageStatus{
@@ -283,6 +309,55 @@ func CreateWasmPackage(input cli.Input, client client.Interface, pkgName string,
 		},
 	}
 
+	return saveWasmPackage(input, client, pkg, specFile)
+}
+
+// CreateWasmOCIPackage creates a package referencing a wasm module published
+// as an OCI artifact. The wasm executor pins the digest of the artifact in
+// the package unless the reference already carries one.
+func CreateWasmOCIPackage(input cli.Input, client client.Interface, pkgName string, pkgNamespace string, envName string, envNamespace string,
+	ociReference string, specFile string) (*fv1.Package, error) {
+
+	ref, err := wasmmodule.ParseOCIReference(ociReference)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := fv1.Archive{
+		Type: fv1.ArchiveTypeOCI,
+		URL:  ref.String(),
+	}
+	if len(ref.Digest) > 0 {
+		archive.Checksum = fv1.Checksum{
+			Type: fv1.ChecksumTypeSHA256,
+			Sum:  strings.TrimPrefix(ref.Digest, "sha256:"),
+		}
+	}
+
+	pkg := &fv1.Package{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pkgName,
+			Namespace: pkgNamespace,
+		},
+		Spec: fv1.PackageSpec{
+			Environment: fv1.EnvironmentReference{
+				Namespace: envNamespace,
+				Name:      envName,
+			},
+			Deployment: archive,
+		},
+		Status: fv1.PackageStatus{
+			BuildStatus:         fv1.BuildStatusSucceeded,
+			LastUpdateTimestamp: metav1.Time{Time: time.Now().UTC()},
+		},
+	}
+
+	return saveWasmPackage(input, client, pkg, specFile)
+}
+
+// saveWasmPackage prints, saves to spec or creates the package depending on
+// the flags of the command.
+func saveWasmPackage(input cli.Input, client client.Interface, pkg *fv1.Package, specFile string) (*fv1.Package, error) {
 	if input.Bool(flagkey.SpecDry) {
 		return pkg, spec.SpecDry(*pkg)
 	}
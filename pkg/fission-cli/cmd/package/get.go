@@ -21,6 +21,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
@@ -89,6 +90,8 @@ func (opts *GetSubCommand) run(input cli.Input) error {
 		}
 		defer readCloser.Close()
 		reader = readCloser
+	} else if pkg.Spec.Deployment.Type == fv1.ArchiveTypeOCI {
+		return errors.Errorf("package %v references the OCI artifact %v, pull it from its registry instead", pkg.ObjectMeta.Name, archive.URL)
 	}
 
 	if len(opts.output) > 0 {
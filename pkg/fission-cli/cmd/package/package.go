@@ -41,6 +41,41 @@ import (
 	"github.com/fission/fission/pkg/utils"
 )
 
+// WasmEnvironmentName is the environment packages of wasm functions refer to.
+const WasmEnvironmentName = "wasm"
+
+// inspectWasmCode inspects the single wasm module passed with --code and
+// returns the package annotations describing it. Modules fetched from a URL
+// are left to the wasm runtime.
+func inspectWasmCode(deployArchiveFiles []string, noZip bool, entrypoint string) (map[string]string, error) {
+	if !noZip || len(deployArchiveFiles) != 1 || utils.IsURL(deployArchiveFiles[0]) {
+		return nil, nil
+	}
+	return pkgutil.InspectWasmModule(deployArchiveFiles[0], entrypoint)
+}
+
+// getWasmBuildSpec returns the wasm build spec given with --wasmlang, or
+// nil if the module is not built from source.
+func getWasmBuildSpec(input cli.Input) (*fv1.WasmBuildSpec, error) {
+	lang := input.String(flagkey.PkgWasmLanguage)
+	if len(lang) == 0 {
+		if input.IsSet(flagkey.PkgWasmPrecompile) || input.IsSet(flagkey.PkgWasmArch) {
+			return nil, errors.Errorf("--%v and --%v require --%v", flagkey.PkgWasmPrecompile, flagkey.PkgWasmArch, flagkey.PkgWasmLanguage)
+		}
+		return nil, nil
+	}
+	spec := &fv1.WasmBuildSpec{
+		Language:      fv1.WasmLanguage(lang),
+		Precompile:    fv1.WasmEngine(input.String(flagkey.PkgWasmPrecompile)),
+		Architectures: input.StringSlice(flagkey.PkgWasmArch),
+	}
+	err := spec.Validate()
+	if err != nil {
+		return nil, fv1.AggregateValidationErrors("Package", err)
+	}
+	return spec, nil
+}
+
 // CreateArchive returns a fv1.Archive made from an archive .  If specFile, then
 // create an archive upload spec in the specs directory; otherwise
 // upload the archive using client.  noZip avoids zipping the
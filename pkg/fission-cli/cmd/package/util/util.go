@@ -33,6 +33,7 @@ import (
 	"github.com/fission/fission/pkg/controller/client"
 	storageSvcClient "github.com/fission/fission/pkg/storagesvc/client"
 	"github.com/fission/fission/pkg/utils"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 	"github.com/fission/fission/pkg/fission-cli/console"
 )
 
@@ -194,6 +195,32 @@ func PrintPackageSummary(writer io.Writer, pkg *fv1.Package) {
 	fmt.Fprintf(w, "%v\t%v\n", "Name:", pkg.ObjectMeta.Name)
 	fmt.Fprintf(w, "%v\t%v\n", "Environment:", pkg.Spec.Environment.Name)
 	fmt.Fprintf(w, "%v\t%v\n", "Status:", pkg.Status.BuildStatus)
+	if kind, ok := pkg.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_KIND]; ok {
+		fmt.Fprintf(w, "%v\t%v\n", "Wasm Kind:", kind)
+		fmt.Fprintf(w, "%v\t%v\n", "Wasm WASI:", pkg.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_WASI])
+		fmt.Fprintf(w, "%v\t%v\n", "Wasm Imports:", pkg.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_IMPORTS])
+		fmt.Fprintf(w, "%v\t%v\n", "Wasm Exports:", pkg.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_EXPORTS])
+	}
 	fmt.Fprintf(w, "%v\n%v", "Build Logs:", buildlog)
 	w.Flush()
 }
+
+// InspectWasmModule parses the wasm module in the given file, checks that it
+// exports the entrypoint if one is given, and returns the package annotations
+// describing the module.
+func InspectWasmModule(fileName string, entrypoint string) (map[string]string, error) {
+	m, err := wasmmodule.ParseFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(entrypoint) > 0 && !m.HasExport(entrypoint) {
+		return nil, errors.Errorf("entrypoint '%v' is not exported by wasm module %v, exports: %v",
+			entrypoint, fileName, strings.Join(m.ExportNames(), ", "))
+	}
+	return map[string]string{
+		fv1.ANNOTATION_WASM_MODULE_KIND:    m.Kind,
+		fv1.ANNOTATION_WASM_MODULE_WASI:    m.WASI,
+		fv1.ANNOTATION_WASM_MODULE_IMPORTS: strings.Join(m.ImportNames(), ","),
+		fv1.ANNOTATION_WASM_MODULE_EXPORTS: strings.Join(m.ExportNames(), ","),
+	}, nil
+}
@@ -2,6 +2,9 @@ package util
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -32,3 +35,77 @@ func TestPrintPackageSummary(t *testing.T) {
 		t.Errorf("PrintPackageBuildLog() = %v, want %v", gotWriter, expected)
 	}
 }
+
+func TestPrintPackageSummaryWasm(t *testing.T) {
+	pkg := &fv1.Package{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "foobar",
+			Annotations: map[string]string{
+				fv1.ANNOTATION_WASM_MODULE_KIND:    "module",
+				fv1.ANNOTATION_WASM_MODULE_WASI:    "preview1",
+				fv1.ANNOTATION_WASM_MODULE_IMPORTS: "wasi_snapshot_preview1.fd_write",
+				fv1.ANNOTATION_WASM_MODULE_EXPORTS: "_start",
+			},
+		},
+		Spec:   fv1.PackageSpec{Environment: fv1.EnvironmentReference{Name: "wasm"}},
+		Status: fv1.PackageStatus{BuildStatus: "succeeded"},
+	}
+
+	expected := `Name:         foobar\nEnvironment:  wasm\nStatus:       succeeded\nWasm Kind:    module\nWasm WASI:    preview1\nWasm Imports: wasi_snapshot_preview1.fd_write\nWasm Exports: _start\nBuild Logs:\n`
+	writer := &bytes.Buffer{}
+	PrintPackageSummary(writer, pkg)
+
+	gotWriter := strings.ReplaceAll(writer.String(), "\n", `\n`)
+	if gotWriter != expected {
+		t.Errorf("PrintPackageSummary() = %v, want %v", gotWriter, expected)
+	}
+}
+
+func TestInspectWasmModule(t *testing.T) {
+	// a module importing fd_write from WASI preview1 and exporting _start
+	module := []byte{
+		0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+		0x02, 0x23, 0x01,
+		0x16, 'w', 'a', 's', 'i', '_', 's', 'n', 'a', 'p', 's', 'h', 'o', 't', '_', 'p', 'r', 'e', 'v', 'i', 'e', 'w', '1',
+		0x08, 'f', 'd', '_', 'w', 'r', 'i', 't', 'e',
+		0x00, 0x00,
+		0x07, 0x0a, 0x01,
+		0x06, '_', 's', 't', 'a', 'r', 't',
+		0x00, 0x01,
+	}
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "hello.wasm")
+	err := os.WriteFile(fileName, module, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	annotations, err := InspectWasmModule(fileName, "_start")
+	if err != nil {
+		t.Fatalf("error inspecting module: %v", err)
+	}
+	expected := map[string]string{
+		fv1.ANNOTATION_WASM_MODULE_KIND:    "module",
+		fv1.ANNOTATION_WASM_MODULE_WASI:    "preview1",
+		fv1.ANNOTATION_WASM_MODULE_IMPORTS: "wasi_snapshot_preview1.fd_write",
+		fv1.ANNOTATION_WASM_MODULE_EXPORTS: "_start",
+	}
+	if !reflect.DeepEqual(annotations, expected) {
+		t.Fatalf("expected %v, got %v", expected, annotations)
+	}
+
+	_, err = InspectWasmModule(fileName, "main")
+	if err == nil {
+		t.Fatal("expected missing entrypoint to be rejected")
+	}
+
+	notWasm := filepath.Join(dir, "hello.txt")
+	err = os.WriteFile(notWasm, []byte("hello world"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = InspectWasmModule(notWasm, "")
+	if err == nil {
+		t.Fatal("expected a file that is not wasm to be rejected")
+	}
+}
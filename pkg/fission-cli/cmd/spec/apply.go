@@ -41,6 +41,7 @@ import (
 	flagkey "github.com/fission/fission/pkg/fission-cli/flag/key"
 	"github.com/fission/fission/pkg/fission-cli/util"
 	"github.com/fission/fission/pkg/utils"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 )
 
 type ApplySubCommand struct {
@@ -353,6 +354,25 @@ func applyArchives(fclient client.Interface, specDir string, fr *FissionResource
 			}
 		}
 	}
+
+	// resolve references to urls in the modules of wasm functions
+	for i := range fr.Functions {
+		fn := &fr.Functions[i]
+		if fn.Spec.Wasm != nil && strings.HasPrefix(fn.Spec.Wasm.Module.URL, ARCHIVE_URL_PREFIX) {
+			availableAr, ok := archiveFiles[fn.Spec.Wasm.Module.URL]
+			if !ok {
+				return errors.Errorf("unknown archive name %v", strings.TrimPrefix(fn.Spec.Wasm.Module.URL, ARCHIVE_URL_PREFIX))
+			}
+			fn.Spec.Wasm.Module.URL = availableAr.URL
+		}
+		if u := fn.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_URL]; strings.HasPrefix(u, ARCHIVE_URL_PREFIX) {
+			availableAr, ok := archiveFiles[u]
+			if !ok {
+				return errors.Errorf("unknown archive name %v", strings.TrimPrefix(u, ARCHIVE_URL_PREFIX))
+			}
+			fn.ObjectMeta.Annotations[fv1.ANNOTATION_WASM_MODULE_URL] = availableAr.URL
+		}
+	}
 	return nil
 }
 
@@ -383,7 +403,7 @@ func applyResources(fclient client.Interface, specDir string, fr *FissionResourc
 	// of the package. This ensures that various caches can invalidate themselves
 	// when the package changes.
 	for i, f := range fr.Functions {
-		if f.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType == fv1.ExecutorTypeContainer {
+		if f.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType == fv1.ExecutorTypeContainer || isWasmModuleOnly(&f) {
 			continue
 		}
 		k := mapKey(&metav1.ObjectMeta{
@@ -453,8 +473,8 @@ func localArchiveFromSpec(specDir string, aus *spectypes.ArchiveUploadSpec) (*fv
 	// to do a filepath.Walk and call path.Match on each path...
 	files := make([]string, 0)
 
-	//checking if file is a zip
-	if match, _ := utils.IsZip(aus.IncludeGlobs[0]); match && len(aus.IncludeGlobs) == 1 {
+	//checking if file is a zip or a wasm module
+	if match, _ := utils.IsZip(aus.IncludeGlobs[0]); (match || wasmmodule.IsWasmFile(aus.IncludeGlobs[0])) && len(aus.IncludeGlobs) == 1 {
 		files = append(files, aus.IncludeGlobs[0])
 	} else {
 		for _, relativeGlob := range aus.IncludeGlobs {
@@ -509,8 +529,12 @@ func localArchiveFromSpec(specDir string, aus *spectypes.ArchiveUploadSpec) (*fv
 		return nil, err
 	}
 
+	// wasm modules are fetched by the wasm runtime from their URL, so they
+	// are never turned into literals and always keep their checksum.
+	isWasm := isSingleFile && wasmmodule.IsWasmFile(archiveFileName)
+
 	// figure out if we're making a literal or a URL-based archive
-	if size < fv1.ArchiveLiteralSizeLimit {
+	if size < fv1.ArchiveLiteralSizeLimit && !isWasm {
 		contents, err := pkgutil.GetContents(archiveFileName)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,56 @@
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	spectypes "github.com/fission/fission/pkg/fission-cli/cmd/spec/types"
+	"github.com/fission/fission/pkg/utils"
+)
+
+func TestLocalArchiveFromSpecWasm(t *testing.T) {
+	rootDir := t.TempDir()
+	specDir := filepath.Join(rootDir, "specs")
+
+	// a small module, which would be turned into a literal if it wasn't wasm
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	err := os.WriteFile(filepath.Join(rootDir, "hello.wasm"), module, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(rootDir, "hello.txt"), []byte("hello"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ar, err := localArchiveFromSpec(specDir, &spectypes.ArchiveUploadSpec{
+		Name:         "hello-wasm",
+		IncludeGlobs: []string{"hello.wasm"},
+	})
+	if err != nil {
+		t.Fatalf("error creating archive: %v", err)
+	}
+	if ar.Type != fv1.ArchiveTypeUrl || ar.URL != filepath.Join(rootDir, "hello.wasm") {
+		t.Fatalf("expected the module to be used as is, got %+v", ar)
+	}
+	csum, err := utils.GetFileChecksum(filepath.Join(rootDir, "hello.wasm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ar.Checksum != *csum {
+		t.Fatalf("expected checksum %v, got %v", *csum, ar.Checksum)
+	}
+
+	ar, err = localArchiveFromSpec(specDir, &spectypes.ArchiveUploadSpec{
+		Name:         "hello-txt",
+		IncludeGlobs: []string{"hello.txt"},
+	})
+	if err != nil {
+		t.Fatalf("error creating archive: %v", err)
+	}
+	if ar.Type != fv1.ArchiveTypeLiteral {
+		t.Fatalf("expected small files to be literals, got %+v", ar)
+	}
+}
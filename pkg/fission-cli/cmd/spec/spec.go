@@ -273,6 +273,66 @@ func crdToYaml(resource interface{}) (metav1.ObjectMeta, string, []byte, error)
 	return meta, kind, data, nil
 }
 
+// isWasmModuleOnly reports whether the function is a wasm function whose
+// module is referenced by the function itself instead of a package.
+func isWasmModuleOnly(f *fv1.Function) bool {
+	return f.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType == fv1.ExecutorTypeWasm &&
+		len(f.Spec.Package.PackageRef.Name) == 0 && f.Spec.Wasm != nil
+}
+
+// validateWasmFunction checks that the module of a wasm function can be
+// fetched by the wasm runtime: it must be a single, unzipped wasm module
+// referenced by URL or as an OCI artifact.
+func (fr *FissionResources) validateWasmFunction(f *fv1.Function) error {
+	result := utils.MultiErrorWithFormat()
+	loc := fr.SourceMap.Locations["Function"][f.ObjectMeta.Namespace][f.ObjectMeta.Name]
+
+	if len(f.Spec.Package.PackageRef.Name) == 0 {
+		if f.Spec.Wasm == nil || (len(f.Spec.Wasm.Module.URL) == 0 && len(f.Spec.Wasm.Module.OCI) == 0) {
+			result = multierror.Append(result, fmt.Errorf(
+				"%v: wasm function '%v' references neither a package nor a module",
+				loc, f.ObjectMeta.Name))
+		}
+		return result.ErrorOrNil()
+	}
+
+	var pkg *fv1.Package
+	for i, p := range fr.Packages {
+		if p.ObjectMeta.Name == f.Spec.Package.PackageRef.Name &&
+			p.ObjectMeta.Namespace == f.Spec.Package.PackageRef.Namespace {
+			pkg = &fr.Packages[i]
+			break
+		}
+	}
+	if pkg == nil {
+		// unknown packages are reported by the generic function checks
+		return nil
+	}
+
+	deployment := pkg.Spec.Deployment
+	switch {
+	case deployment.Type == fv1.ArchiveTypeLiteral && len(deployment.Literal) > 0:
+		result = multierror.Append(result, fmt.Errorf(
+			"%v: wasm function '%v' references package '%v' with a literal deployment archive, wasm modules must be referenced by URL or as OCI artifacts",
+			loc, f.ObjectMeta.Name, pkg.ObjectMeta.Name))
+	case len(deployment.URL) == 0:
+		result = multierror.Append(result, fmt.Errorf(
+			"%v: wasm function '%v' references package '%v' without a deployment archive",
+			loc, f.ObjectMeta.Name, pkg.ObjectMeta.Name))
+	case strings.HasPrefix(deployment.URL, ARCHIVE_URL_PREFIX):
+		aname := strings.TrimPrefix(deployment.URL, ARCHIVE_URL_PREFIX)
+		for _, aus := range fr.ArchiveUploadSpecs {
+			if aus.Name == aname && len(aus.IncludeGlobs) != 1 {
+				result = multierror.Append(result, fmt.Errorf(
+					"%v: archive '%v' of wasm function '%v' must include a single wasm module, got %v",
+					fr.SourceMap.Locations["ArchiveUploadSpec"][""][aname], aname, f.ObjectMeta.Name, aus.IncludeGlobs))
+			}
+		}
+	}
+
+	return result.ErrorOrNil()
+}
+
 // validateFunctionReference checks a function reference
 func (fr *FissionResources) validateFunctionReference(functions map[string]bool, kind string, meta *metav1.ObjectMeta, funcRef fv1.FunctionReference) error {
 	if funcRef.Type == fv1.FunctionReferenceTypeFunctionName {
@@ -346,6 +406,24 @@ func (fr *FissionResources) Validate(input cli.Input) ([]string, error) {
 		result = multierror.Append(result, p.Validate())
 	}
 
+	// mark archives the modules of wasm functions reference
+	for _, f := range fr.Functions {
+		if f.Spec.Wasm == nil || !strings.HasPrefix(f.Spec.Wasm.Module.URL, ARCHIVE_URL_PREFIX) {
+			continue
+		}
+		aname := strings.TrimPrefix(f.Spec.Wasm.Module.URL, ARCHIVE_URL_PREFIX)
+		if _, ok := archives[aname]; !ok {
+			result = multierror.Append(result, fmt.Errorf(
+				"%v: function '%v' references unknown wasm module archive '%v%v'",
+				fr.SourceMap.Locations["Function"][f.ObjectMeta.Namespace][f.ObjectMeta.Name],
+				f.ObjectMeta.Name,
+				ARCHIVE_URL_PREFIX,
+				aname))
+		} else {
+			archives[aname] = true
+		}
+	}
+
 	// error on unreferenced archives
 	for name, referenced := range archives {
 		if !referenced {
@@ -361,7 +439,7 @@ func (fr *FissionResources) Validate(input cli.Input) ([]string, error) {
 	for _, f := range fr.Functions {
 		functions[MapKey(&f.ObjectMeta)] = false
 
-		if f.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType != fv1.ExecutorTypeContainer {
+		if f.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType != fv1.ExecutorTypeContainer && !isWasmModuleOnly(&f) {
 			pkgMeta := &metav1.ObjectMeta{
 				Name:      f.Spec.Package.PackageRef.Name,
 				Namespace: f.Spec.Package.PackageRef.Namespace,
@@ -420,6 +498,10 @@ func (fr *FissionResources) Validate(input cli.Input) ([]string, error) {
 				warnings = append(warnings, fmt.Sprintf("Secret %s is referred in the spec but not present in the cluster", s.Name))
 			}
 		}
+		if f.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType == fv1.ExecutorTypeWasm {
+			result = multierror.Append(result, fr.validateWasmFunction(&f))
+		}
+
 		result = multierror.Append(result, f.Validate())
 	}
 
@@ -490,7 +572,9 @@ func (fr *FissionResources) Validate(input cli.Input) ([]string, error) {
 	}
 
 	for _, f := range fr.Functions {
-		if _, ok := environments[fmt.Sprintf("%s:%s", f.Spec.Environment.Name, f.Spec.Environment.Namespace)]; !ok {
+		// wasm functions run in the wasm runtime class, not in an environment
+		if _, ok := environments[fmt.Sprintf("%s:%s", f.Spec.Environment.Name, f.Spec.Environment.Namespace)]; !ok &&
+			f.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType != fv1.ExecutorTypeWasm {
 			warnings = append(warnings, "Environment %s is referenced in function %s but not declared in specs", f.Spec.Environment.Name, f.ObjectMeta.Name)
 		}
 		strategy := f.Spec.InvokeStrategy.ExecutionStrategy
@@ -0,0 +1,74 @@
+package spec
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	spectypes "github.com/fission/fission/pkg/fission-cli/cmd/spec/types"
+)
+
+func TestValidateWasmFunction(t *testing.T) {
+	newFunction := func(pkgName string) *fv1.Function {
+		return &fv1.Function{
+			ObjectMeta: metav1.ObjectMeta{Name: "hello", Namespace: "default"},
+			Spec: fv1.FunctionSpec{
+				InvokeStrategy: fv1.InvokeStrategy{
+					ExecutionStrategy: fv1.ExecutionStrategy{ExecutorType: fv1.ExecutorTypeWasm},
+				},
+				Package: fv1.FunctionPackageRef{
+					PackageRef: fv1.PackageRef{Name: pkgName, Namespace: "default"},
+				},
+			},
+		}
+	}
+	newPackage := func(name string, deployment fv1.Archive) fv1.Package {
+		return fv1.Package{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       fv1.PackageSpec{Deployment: deployment},
+		}
+	}
+
+	fr := &FissionResources{
+		Packages: []fv1.Package{
+			newPackage("module", fv1.Archive{Type: fv1.ArchiveTypeUrl, URL: ARCHIVE_URL_PREFIX + "module"}),
+			newPackage("zipped", fv1.Archive{Type: fv1.ArchiveTypeUrl, URL: ARCHIVE_URL_PREFIX + "zipped"}),
+			newPackage("oci", fv1.Archive{Type: fv1.ArchiveTypeOCI, URL: "ghcr.io/org/hello:v1"}),
+			newPackage("literal", fv1.Archive{Type: fv1.ArchiveTypeLiteral, Literal: []byte("hello")}),
+			newPackage("source-only", fv1.Archive{}),
+		},
+		ArchiveUploadSpecs: []spectypes.ArchiveUploadSpec{
+			{Name: "module", IncludeGlobs: []string{"hello.wasm"}},
+			{Name: "zipped", IncludeGlobs: []string{"hello.wasm", "lib/*"}},
+		},
+	}
+
+	for pkgName, valid := range map[string]bool{
+		"module":      true,
+		"oci":         true,
+		"unknown":     true,
+		"zipped":      false,
+		"literal":     false,
+		"source-only": false,
+	} {
+		err := fr.validateWasmFunction(newFunction(pkgName))
+		if valid && err != nil {
+			t.Errorf("expected package %v to be valid, got %v", pkgName, err)
+		} else if !valid && err == nil {
+			t.Errorf("expected package %v to be rejected", pkgName)
+		}
+	}
+
+	fn := newFunction("")
+	if fr.validateWasmFunction(fn) == nil {
+		t.Error("expected a function without package nor module to be rejected")
+	}
+	fn.Spec.Wasm = &fv1.WasmSpec{Module: fv1.WasmModule{OCI: "ghcr.io/org/hello:v1"}}
+	if err := fr.validateWasmFunction(fn); err != nil {
+		t.Errorf("expected a function referencing its module to be valid, got %v", err)
+	}
+	if !isWasmModuleOnly(fn) {
+		t.Error("expected the function to reference its module only")
+	}
+}
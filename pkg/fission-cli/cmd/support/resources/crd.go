@@ -113,7 +113,7 @@ func (res CrdDumper) Dump(dumpDir string) {
 	case CrdMessageQueueTrigger:
 		var triggers []fv1.MessageQueueTrigger
 
-		for _, mqType := range []string{fv1.MessageQueueTypeKafka} {
+		for _, mqType := range []string{fv1.MessageQueueTypeKafka, fv1.MessageQueueTypeNatsJetStream, fv1.MessageQueueTypeRedis} {
 			l, err := res.client.V1().MessageQueueTrigger().List(mqType, metav1.NamespaceAll)
 			if err != nil {
 				console.Warn(fmt.Sprintf("Error getting %v list: %v", res.crdType, err))
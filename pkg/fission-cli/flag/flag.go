@@ -129,6 +129,13 @@ var (
 	FnSubPath               = Flag{Type: String, Name: flagkey.FnSubPath, Usage: "Sub Path to check if function internally supports routing"}
 	// Termination Grace Period configurable at function creation/update only for container functions
 	FnTerminationGracePeriod = Flag{Type: Int64, Name: flagkey.FnGracePeriod, Usage: "Grace time (in seconds) for pod to perform connection draining before termination (default value will be used if negative value is given)", DefaultValue: 360}
+	FnWasmEnv                = Flag{Type: StringSlice, Name: flagkey.FnWasmEnv, Usage: "WASI environment variable of the wasm module: --wasmenv KEY=VALUE. To mention multiple variables --wasmenv A=1 --wasmenv B=2"}
+	FnWasmPreopen            = Flag{Type: StringSlice, Name: flagkey.FnWasmPreopen, Usage: "Directory of the pod preopened for the wasm module: --wasmpreopen path[:guestpath][:ro]"}
+	FnWasmEngine             = Flag{Type: String, Name: flagkey.FnWasmEngine, Usage: "Wasm engine hint for the runtime: wasmtime, wasmedge or wasmer"}
+	FnWasmMaxMemory          = Flag{Type: String, Name: flagkey.FnWasmMaxMemory, Usage: "Maximum linear memory of the wasm module, like 64Mi"}
+	FnWasmFuel               = Flag{Type: Int64, Name: flagkey.FnWasmFuel, Usage: "Maximum fuel (instructions) the wasm module may consume per request, 0 for no limit"}
+	FnWasmMode               = Flag{Type: String, Name: flagkey.FnWasmMode, Usage: "How the executor starts the wasm function: deployment, pool to specialize a pre-warmed runtime pod, or shared to load it into a host pod shared with other functions"}
+	FnWasmUsage              = Flag{Type: Bool, Name: flagkey.FnWasmUsage, Usage: "Show the usage summary of the invocations of a wasm function instead of its source code"}
 
 	HtName              = Flag{Type: String, Name: flagkey.HtName, Usage: "HTTP trigger name"}
 	HtMethod            = Flag{Type: StringSlice, Name: flagkey.HtMethod, Usage: "HTTP Methods: GET,POST,PUT,DELETE,HEAD. To mention single method: --method GET and for multiple methods --method GET --method POST. [DEPRECATED for 'fn create', use 'route create' instead]", DefaultValue: []string{http.MethodGet}}
@@ -143,6 +150,9 @@ var (
 	HtFnFilter          = Flag{Type: String, Name: flagkey.HtFilter, Usage: "Name of the function for trigger(s)"}
 	HtPrefix            = Flag{Type: String, Name: flagkey.HtPrefix, Usage: "Prefix with which functions are exposed. NOTE: Prefix takes precedence over URL/RelativeURL [DEPRECATED for 'fn create', use 'route create' instead]"}
 	HtKeepPrefix        = Flag{Type: Bool, Name: flagkey.HtKeepPrefix, Usage: "Keep the prefix in the URL while forwarding request to the function"}
+	HtLbStrategy        = Flag{Type: String, Name: flagkey.HtLbStrategy, Usage: "Strategy to spread requests across the pods of functions routed to directly (e.g. wasm), one of roundrobin|leastoutstanding|consistenthash ('-' to reset)"}
+	HtLbHashHeader      = Flag{Type: String, Name: flagkey.HtLbHashHeader, Usage: "Request header the consistenthash load balancing strategy hashes on"}
+	HtLbHashCookie      = Flag{Type: String, Name: flagkey.HtLbHashCookie, Usage: "Request cookie the consistenthash load balancing strategy hashes on"}
 
 	TokUsername = Flag{Type: String, Name: flagkey.TokUsername, Usage: "Username to generate token for function invocation"}
 	TokPassword = Flag{Type: String, Name: flagkey.TokPassword, Usage: "Password to generate token for function invocation"}
@@ -155,7 +165,7 @@ var (
 
 	MqtName            = Flag{Type: String, Name: flagkey.MqtName, Usage: "Message queue trigger name"}
 	MqtFnName          = Flag{Type: String, Name: flagkey.MqtFnName, Usage: "Function name"}
-	MqtMQType          = Flag{Type: String, Name: flagkey.MqtMQType, Usage: "For mqtype \"fission\" => kafka\n\t\t\t\t\t For mqtype \"keda\" => kafka, aws-sqs-queue, aws-kinesis-stream, gcp-pubsub, stan, nats-jetstream, rabbitmq, redis", DefaultValue: "kafka"}
+	MqtMQType          = Flag{Type: String, Name: flagkey.MqtMQType, Usage: "For mqtype \"fission\" => kafka, nats-jetstream, redis\n\t\t\t\t\t For mqtype \"keda\" => kafka, aws-sqs-queue, aws-kinesis-stream, gcp-pubsub, stan, nats-jetstream, rabbitmq, redis", DefaultValue: "kafka"}
 	MqtTopic           = Flag{Type: String, Name: flagkey.MqtTopic, Usage: "Message queue Topic the trigger listens on"}
 	MqtRespTopic       = Flag{Type: String, Name: flagkey.MqtRespTopic, Usage: "Topic that the function response is sent on (response discarded if unspecified)"}
 	MqtErrorTopic      = Flag{Type: String, Name: flagkey.MqtErrorTopic, Usage: "Topic that the function error messages are sent to (errors discarded if unspecified"}
@@ -168,6 +178,10 @@ var (
 	MqtMetadata        = Flag{Type: StringSlice, Name: flagkey.MqtMetadata, Usage: "Metadata needed for connecting to source system in format: --metadata key1=value1 --metadata key2=value2"}
 	MqtSecret          = Flag{Type: String, Name: flagkey.MqtSecret, Usage: "Name of secret object", DefaultValue: ""}
 	MqtKind            = Flag{Type: String, Name: flagkey.MqtKind, Usage: "Kind of Message Queue Trigger, e.g. fission, keda", DefaultValue: "keda"}
+	MqtBatchMaxRecords = Flag{Type: Int, Name: flagkey.MqtBatchMaxRecords, Usage: "Deliver messages to the function in batches of up to this many records, 0 disables batching (kafka with mqtkind fission only)"}
+	MqtBatchMaxBytes   = Flag{Type: Int, Name: flagkey.MqtBatchMaxBytes, Usage: "Maximum total size in bytes of the records of a batch, 0 for unlimited"}
+	MqtBatchMaxWait    = Flag{Type: Duration, Name: flagkey.MqtBatchMaxWait, Usage: "Maximum time to wait for a batch to fill up before it is delivered, e.g. 500ms (default 1s)"}
+	MqtBatchFormat     = Flag{Type: String, Name: flagkey.MqtBatchFormat, Usage: "Format of the batch request body: json or ndjson (default json)"}
 
 	EnvName                   = Flag{Type: String, Name: flagkey.EnvName, Usage: "Environment name"}
 	EnvPoolsize               = Flag{Type: Int, Name: flagkey.EnvPoolsize, Usage: "Size of the pool", DefaultValue: 3}
@@ -194,10 +208,14 @@ var (
 	PkgForce          = Flag{Type: Bool, Name: flagkey.PkgForce, Short: "f", Usage: "Force update a package even if it is used by one or more functions"}
 	PkgEnvironment    = Flag{Type: String, Name: flagkey.PkgEnvironment, Usage: "Environment name"}
 	PkgBuildCmd       = Flag{Type: String, Name: flagkey.PkgBuildCmd, Usage: "Build command for builder to run with"}
+	PkgWasmLanguage   = Flag{Type: String, Name: flagkey.PkgWasmLanguage, Usage: "Source language the builder compiles into a wasm module: rust, tinygo or assemblyscript"}
+	PkgWasmPrecompile = Flag{Type: String, Name: flagkey.PkgWasmPrecompile, Usage: "Wasm engine the builder precompiles the module for: wasmtime, wasmedge or wasmer"}
+	PkgWasmArch       = Flag{Type: StringSlice, Name: flagkey.PkgWasmArch, Usage: "Node architecture the builder precompiles the module for, amd64 or arm64: --precompilearch amd64 --precompilearch arm64"}
 	PkgOutput         = Flag{Type: String, Name: flagkey.PkgOutput, Short: "o", Usage: "Output filename to save archive content"}
 	PkgStatus         = Flag{Type: String, Name: flagkey.PkgStatus, Usage: `Filter packages by status`}
 	PkgOrphan         = Flag{Type: Bool, Name: flagkey.PkgOrphan, Usage: "Orphan packages that are not referenced by any function"}
 	PkgCode           = Flag{Type: String, Name: flagkey.PkgCode, Usage: "URL or local path for single file source code"}
+	PkgOCI            = Flag{Type: String, Name: flagkey.PkgOCI, Usage: "Reference of a wasm module published as an OCI artifact, like registry/repo:tag"}
 	PkgDeployArchive  = Flag{Type: StringSlice, Name: flagkey.PkgDeployArchive, Aliases: []string{"deploy"}, Usage: "URL or local paths for binary archive"}
 	PkgDeployChecksum = Flag{Type: String, Name: flagkey.PkgDeployChecksum, Usage: "SHA256 checksum of deploy archive when providing URL"}
 	PkgSrcArchive     = Flag{Type: StringSlice, Name: flagkey.PkgSrcArchive, Aliases: []string{"source", "src"}, Usage: "URL or local paths for source archive"}
@@ -79,6 +79,13 @@ const (
 	FnOnceOnly              = "onceonly"
 	FnSubPath               = "subpath"
 	FnGracePeriod           = "graceperiod"
+	FnWasmEnv               = "wasmenv"
+	FnWasmPreopen           = "wasmpreopen"
+	FnWasmEngine            = "wasmengine"
+	FnWasmMaxMemory         = "wasmmaxmemory"
+	FnWasmFuel              = "wasmfuel"
+	FnWasmMode              = "wasmmode"
+	FnWasmUsage             = "usage"
 
 	HtName              = resourceName
 	HtMethod            = "method"
@@ -93,6 +100,9 @@ const (
 	HtFilter            = HtFnName
 	HtPrefix            = "prefix"
 	HtKeepPrefix        = "keepprefix"
+	HtLbStrategy        = "lbstrategy"
+	HtLbHashHeader      = "lbhashheader"
+	HtLbHashCookie      = "lbhashcookie"
 
 	TokUsername = "username"
 	TokPassword = "password"
@@ -118,6 +128,10 @@ const (
 	MqtMetadata        = "metadata"
 	MqtSecret          = "secret"
 	MqtKind            = "mqtkind"
+	MqtBatchMaxRecords = "batchmaxrecords"
+	MqtBatchMaxBytes   = "batchmaxbytes"
+	MqtBatchMaxWait    = "batchmaxwait"
+	MqtBatchFormat     = "batchformat"
 
 	EnvName            = resourceName
 	EnvPoolsize        = "poolsize"
@@ -144,12 +158,16 @@ const (
 	PkgForce          = force
 	PkgEnvironment    = "env"
 	PkgCode           = "code"
+	PkgOCI            = "oci"
 	PkgSrcArchive     = "sourcearchive"
 	PkgDeployArchive  = "deployarchive"
 	PkgSrcChecksum    = "srcchecksum"
 	PkgDeployChecksum = "deploychecksum"
 	PkgInsecure       = "insecure"
 	PkgBuildCmd       = "buildcmd"
+	PkgWasmLanguage   = "wasmlang"
+	PkgWasmPrecompile = "precompile"
+	PkgWasmArch       = "precompilearch"
 	PkgOutput         = Output
 	PkgStatus         = "status"
 	PkgOrphan         = "orphan"
@@ -55,6 +55,7 @@ type (
 		kubernetesClient kubernetes.Interface
 		requestChannel   chan *kubeWatcherRequest
 		publisher        publisher.Publisher
+		cloudEvents      publisher.CloudEventsMode
 	}
 
 	watchSubscription struct {
@@ -65,6 +66,7 @@ type (
 		stopped             *int32
 		kubernetesClient    kubernetes.Interface
 		publisher           publisher.Publisher
+		cloudEvents         publisher.CloudEventsMode
 	}
 
 	kubeWatcherRequest struct {
@@ -77,12 +79,13 @@ type (
 	}
 )
 
-func MakeKubeWatcher(ctx context.Context, logger *zap.Logger, kubernetesClient kubernetes.Interface, publisher publisher.Publisher) *KubeWatcher {
+func MakeKubeWatcher(ctx context.Context, logger *zap.Logger, kubernetesClient kubernetes.Interface, poster publisher.Publisher) *KubeWatcher {
 	kw := &KubeWatcher{
 		logger:           logger.Named("kube_watcher"),
 		watches:          make(map[types.UID]watchSubscription),
 		kubernetesClient: kubernetesClient,
-		publisher:        publisher,
+		publisher:        poster,
+		cloudEvents:      publisher.CloudEventsModeFromEnv(logger),
 		requestChannel:   make(chan *kubeWatcherRequest),
 	}
 	go kw.svc(ctx)
@@ -178,7 +181,7 @@ func createKubernetesWatch(ctx context.Context, kubeClient kubernetes.Interface,
 
 func (kw *KubeWatcher) addWatch(ctx context.Context, w *fv1.KubernetesWatchTrigger) error {
 	kw.logger.Info("adding watch", zap.String("name", w.ObjectMeta.Name), zap.Any("function", w.Spec.FunctionReference))
-	ws, err := MakeWatchSubscription(ctx, kw.logger.Named("watchsubscription"), w, kw.kubernetesClient, kw.publisher)
+	ws, err := MakeWatchSubscription(ctx, kw.logger.Named("watchsubscription"), w, kw.kubernetesClient, kw.publisher, kw.cloudEvents)
 	if err != nil {
 		return err
 	}
@@ -198,7 +201,8 @@ func (kw *KubeWatcher) removeWatch(w *fv1.KubernetesWatchTrigger) error {
 	return nil
 }
 
-func MakeWatchSubscription(ctx context.Context, logger *zap.Logger, w *fv1.KubernetesWatchTrigger, kubeClient kubernetes.Interface, publisher publisher.Publisher) (*watchSubscription, error) {
+func MakeWatchSubscription(ctx context.Context, logger *zap.Logger, w *fv1.KubernetesWatchTrigger, kubeClient kubernetes.Interface,
+	publisher publisher.Publisher, cloudEvents publisher.CloudEventsMode) (*watchSubscription, error) {
 	var stopped int32 = 0
 	ws := &watchSubscription{
 		logger:              logger.Named("watch_subscription"),
@@ -207,6 +211,7 @@ func MakeWatchSubscription(ctx context.Context, logger *zap.Logger, w *fv1.Kuber
 		stopped:             &stopped,
 		kubernetesClient:    kubeClient,
 		publisher:           publisher,
+		cloudEvents:         cloudEvents,
 		lastResourceVersion: "",
 	}
 
@@ -305,11 +310,12 @@ func (ws *watchSubscription) eventDispatchLoop(ctx context.Context) {
 		}
 
 		// Event and object type aren't in the serialized object
+		objectType := reflect.TypeOf(ev.Object).Elem().Name()
 		headers := map[string]string{
-			"Content-Type":             "application/json",
 			"X-Kubernetes-Event-Type":  string(ev.Type),
-			"X-Kubernetes-Object-Type": reflect.TypeOf(ev.Object).Elem().Name(),
+			"X-Kubernetes-Object-Type": objectType,
 		}
+		event := ws.cloudEvent(ev, objectType, buf.Bytes())
 
 		// TODO support other function ref types. Or perhaps delegate to router?
 		if ws.watch.Spec.FunctionReference.Type != fv1.FunctionReferenceTypeFunctionName {
@@ -323,8 +329,28 @@ func (ws *watchSubscription) eventDispatchLoop(ctx context.Context) {
 		// the triggers can only be created in the same namespace as the function.
 		// so essentially, function namespace = trigger namespace.
 		url := utils.UrlForFunction(ws.watch.Spec.FunctionReference.Name, ws.watch.ObjectMeta.Namespace)
-		ws.publisher.Publish(buf.String(), headers, url)
+		err = publisher.PublishCloudEvent(ws.publisher, ws.cloudEvents, event, headers, url)
+		if err != nil {
+			ws.logger.Error("failed to publish event", zap.Error(err), zap.String("watch_name", ws.watch.ObjectMeta.Name))
+		}
+	}
+}
+
+// cloudEvent returns the event of a watch event, identified by the uid and
+// resource version of the object.
+func (ws *watchSubscription) cloudEvent(ev watch.Event, objectType string, data []byte) *publisher.CloudEvent {
+	event := publisher.NewCloudEvent(publisher.CloudEventSource("kuberneteswatchtriggers", ws.watch.ObjectMeta.Namespace, ws.watch.ObjectMeta.Name),
+		publisher.CloudEventTypeKubeWatchPrefix+strings.ToLower(string(ev.Type)), data, "application/json")
+	obj, err := meta.Accessor(ev.Object)
+	if err != nil {
+		return event
+	}
+	event.ID = fmt.Sprintf("%s/%s", obj.GetUID(), obj.GetResourceVersion())
+	event.Subject = strings.ToLower(objectType) + "/" + obj.GetName()
+	if len(obj.GetNamespace()) > 0 {
+		event.Subject = strings.ToLower(objectType) + "/" + obj.GetNamespace() + "/" + obj.GetName()
 	}
+	return event
 }
 
 func (ws *watchSubscription) stop() {
@@ -0,0 +1,41 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package messageQueue
+
+import (
+	"time"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/publisher"
+)
+
+// MessageCloudEvent returns the event of a message consumed for a trigger.
+// The id identifies the message in its queue, like the topic, partition and
+// offset of a Kafka record, so a redelivered message keeps its id. A random
+// id is used if empty, the time defaults to now if zero.
+func MessageCloudEvent(trigger *fv1.MessageQueueTrigger, id string, t time.Time, data []byte) *publisher.CloudEvent {
+	event := publisher.NewCloudEvent(publisher.CloudEventSource("messagequeuetriggers", trigger.ObjectMeta.Namespace, trigger.ObjectMeta.Name),
+		publisher.CloudEventTypeMessage, data, trigger.Spec.ContentType)
+	event.Subject = trigger.Spec.Topic
+	if len(id) > 0 {
+		event.ID = id
+	}
+	if !t.IsZero() {
+		event.Time = t.UTC()
+	}
+	return event
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package messageQueue
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/publisher"
+	"github.com/fission/fission/pkg/utils"
+)
+
+type (
+	// Invoker invokes the function of a message queue trigger with the
+	// messages of the trigger through the router.
+	Invoker struct {
+		logger         *zap.Logger
+		trigger        *fv1.MessageQueueTrigger
+		httpClient     *http.Client
+		fissionHeaders map[string]string
+		fnUrl          string
+		// maxDeliver is the number of times a message is delivered before
+		// it is given up on and published to the error topic
+		maxDeliver  int64
+		cloudEvents publisher.CloudEventsMode
+	}
+
+	// Message is a message of a queue to invoke a function with.
+	Message struct {
+		// ID identifies the message in its queue, e.g. by stream and
+		// sequence
+		ID     string
+		Time   time.Time
+		Data   []byte
+		Header http.Header
+	}
+
+	// PublishFunc publishes a message with the headers to a topic.
+	PublishFunc func(topic string, data []byte, header http.Header)
+)
+
+// MakeInvoker returns an invoker of the function of the trigger. Invocations
+// time out after timeout, which message queues set below the time after which
+// they deliver a message again.
+func MakeInvoker(logger *zap.Logger, trigger *fv1.MessageQueueTrigger, routerUrl string,
+	timeout time.Duration, cloudEvents publisher.CloudEventsMode) *Invoker {
+	inv := &Invoker{
+		logger:      logger,
+		trigger:     trigger,
+		httpClient:  &http.Client{Timeout: timeout},
+		maxDeliver:  int64(trigger.Spec.MaxRetries) + 1,
+		cloudEvents: cloudEvents,
+	}
+	if inv.maxDeliver < 1 {
+		inv.maxDeliver = 1
+	}
+	inv.fissionHeaders = map[string]string{
+		"X-Fission-MQTrigger-Topic":      trigger.Spec.Topic,
+		"X-Fission-MQTrigger-RespTopic":  trigger.Spec.ResponseTopic,
+		"X-Fission-MQTrigger-ErrorTopic": trigger.Spec.ErrorTopic,
+		"Content-Type":                   trigger.Spec.ContentType,
+	}
+	inv.fnUrl = routerUrl + "/" + strings.TrimPrefix(utils.UrlForFunction(trigger.Spec.FunctionReference.Name, trigger.ObjectMeta.Namespace), "/")
+	logger.Debug("function HTTP URL", zap.String("url", inv.fnUrl))
+	return inv
+}
+
+// FunctionURL returns the URL the function is invoked at.
+func (inv *Invoker) FunctionURL() string {
+	return inv.fnUrl
+}
+
+// MaxDeliver returns the number of times a message is delivered before it
+// is given up on and published to the error topic.
+func (inv *Invoker) MaxDeliver() int64 {
+	return inv.maxDeliver
+}
+
+// Invoke calls the function with the message and returns the body and
+// headers of the response, or an error if the function did not return 2xx.
+func (inv *Invoker) Invoke(msg *Message) ([]byte, http.Header, error) {
+	payload, eventHeaders, err := MessageCloudEvent(inv.trigger, msg.ID, msg.Time, msg.Data).Encode(inv.cloudEvents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, inv.fnUrl, bytes.NewReader(payload))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create HTTP request to invoke function")
+	}
+	for k, values := range msg.Header {
+		for _, v := range values {
+			req.Header.Add(k, v)
+		}
+	}
+	for k, v := range inv.fissionHeaders {
+		req.Header.Set(k, v)
+	}
+	for k, v := range eventHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := inv.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "sending function invocation request failed")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "request body error")
+	}
+
+	inv.logger.Debug("got response from function invocation",
+		zap.String("function_url", inv.fnUrl),
+		zap.String("body", string(body)))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, errors.Errorf("request returned failure: %v", resp.StatusCode)
+	}
+	return body, resp.Header, nil
+}
+
+// DeadLetter publishes the error of the last invocation of a message from
+// source, which was delivered deliveries times, to the error topic of the
+// trigger.
+func (inv *Invoker) DeadLetter(err error, source string, deliveries int64, publish PublishFunc) {
+	if len(inv.trigger.Spec.ErrorTopic) == 0 {
+		inv.logger.Error("message received to publish to error topic, but no error topic was set",
+			zap.String("message", err.Error()), zap.String("function_url", inv.fnUrl))
+		return
+	}
+	publish(inv.trigger.Spec.ErrorTopic, []byte(err.Error()), http.Header{
+		"MessageSource":  {source},
+		"RecycleCounter": {fmt.Sprintf("%d", deliveries)},
+	})
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package messageQueue
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/publisher"
+	"github.com/fission/fission/pkg/utils/loggerfactory"
+)
+
+func TestInvoker(t *testing.T) {
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/fission-function/hello" || r.Header.Get("X-Fission-MQTrigger-Topic") != "orders" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if string(body) == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Order", r.Header.Get("X-Order"))
+		w.Write([]byte("processed " + string(body)))
+	}))
+	defer router.Close()
+
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: metav1.NamespaceDefault},
+		Spec: fv1.MessageQueueTriggerSpec{
+			FunctionReference: fv1.FunctionReference{Type: fv1.FunctionReferenceTypeFunctionName, Name: "hello"},
+			Topic:             "orders",
+			ErrorTopic:        "errors",
+			MaxRetries:        2,
+		},
+	}
+	inv := MakeInvoker(loggerfactory.GetLogger(), trigger, router.URL, time.Second, publisher.CloudEventsModeNone)
+	if inv.MaxDeliver() != 3 {
+		t.Fatalf("expected 3 deliveries, got %d", inv.MaxDeliver())
+	}
+
+	body, header, err := inv.Invoke(&Message{
+		ID:     "orders/1",
+		Data:   []byte("order"),
+		Header: http.Header{"X-Order": {"42"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "processed order" || header.Get("X-Order") != "42" {
+		t.Fatalf("unexpected response %q, %v", body, header)
+	}
+
+	_, _, err = inv.Invoke(&Message{ID: "orders/2", Data: []byte("fail")})
+	if err == nil {
+		t.Fatal("expected failed invocations to return an error")
+	}
+
+	var published http.Header
+	inv.DeadLetter(errors.New("request returned failure: 500"), "orders", 3, func(topic string, data []byte, header http.Header) {
+		if topic != "errors" || string(data) != "request returned failure: 500" {
+			t.Errorf("unexpected error message %q to %s", data, topic)
+		}
+		published = header
+	})
+	if expected := (http.Header{"MessageSource": {"orders"}, "RecycleCounter": {"3"}}); !reflect.DeepEqual(published, expected) {
+		t.Fatalf("unexpected error message headers %v", published)
+	}
+}
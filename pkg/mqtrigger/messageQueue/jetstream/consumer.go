@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jetstream
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"go.uber.org/zap"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/mqtrigger"
+	"github.com/fission/fission/pkg/mqtrigger/messageQueue"
+	"github.com/fission/fission/pkg/publisher"
+)
+
+const (
+	// nakDelay is how long a failed message waits before its first
+	// redelivery, the delay doubles with every delivery up to maxNakDelay
+	nakDelay    = time.Second
+	maxNakDelay = time.Minute
+)
+
+type consumer struct {
+	logger  *zap.Logger
+	trigger *fv1.MessageQueueTrigger
+	js      nats.JetStreamContext
+	invoker *messageQueue.Invoker
+}
+
+func newConsumer(logger *zap.Logger, trigger *fv1.MessageQueueTrigger, js nats.JetStreamContext, routerUrl string,
+	ackWait time.Duration, cloudEvents publisher.CloudEventsMode) *consumer {
+	logger = logger.With(zap.String("trigger", trigger.ObjectMeta.Name), zap.String("topic", trigger.Spec.Topic))
+	return &consumer{
+		logger:  logger,
+		trigger: trigger,
+		js:      js,
+		// invocations time out before ackWait, so that messages are acked
+		// or nakked before JetStream redelivers them
+		invoker: messageQueue.MakeInvoker(logger, trigger, routerUrl, ackWait*9/10, cloudEvents),
+	}
+}
+
+// handle invokes the function with a message. The message is acked once
+// the function succeeds and redelivered with a growing delay otherwise,
+// until it was delivered maxDeliver times; then the error is published to
+// the error topic.
+func (c *consumer) handle(msg *nats.Msg) {
+	body, header, err := c.invoke(msg)
+	if err == nil {
+		if len(c.trigger.Spec.ResponseTopic) > 0 {
+			c.publish(c.trigger.Spec.ResponseTopic, body, header)
+		}
+		if err := msg.Ack(); err != nil {
+			c.logger.Error("failed to ack message", zap.Error(err))
+		}
+		mqtrigger.IncreaseMessageCount(c.trigger.ObjectMeta.Name, c.trigger.ObjectMeta.Namespace)
+		return
+	}
+
+	var numDelivered uint64 = 1
+	if meta, metaErr := msg.Metadata(); metaErr == nil {
+		numDelivered = meta.NumDelivered
+	}
+	c.logger.Warn("function invocation failed",
+		zap.Error(err),
+		zap.String("function_url", c.invoker.FunctionURL()),
+		zap.Uint64("delivery", numDelivered))
+	if int64(numDelivered) < c.invoker.MaxDeliver() {
+		if err := msg.NakWithDelay(redeliveryDelay(numDelivered)); err != nil {
+			c.logger.Error("failed to nak message", zap.Error(err))
+		}
+		return
+	}
+
+	c.invoker.DeadLetter(err, msg.Subject, int64(numDelivered), c.publish)
+	// retries are exhausted, stop redelivering the message
+	if err := msg.Term(); err != nil {
+		c.logger.Error("failed to terminate message", zap.Error(err))
+	}
+}
+
+// redeliveryDelay returns how long a message which failed on its
+// delivery-th delivery waits before it is delivered again.
+func redeliveryDelay(delivery uint64) time.Duration {
+	delay := nakDelay
+	for i := uint64(1); i < delivery && delay < maxNakDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxNakDelay {
+		delay = maxNakDelay
+	}
+	return delay
+}
+
+// invoke calls the function with the message and returns the body and
+// headers of the response, or an error if the function did not return 2xx.
+func (c *consumer) invoke(msg *nats.Msg) ([]byte, http.Header, error) {
+	// a message is identified by its stream sequence
+	m := &messageQueue.Message{
+		Data:   msg.Data,
+		Header: http.Header(msg.Header),
+	}
+	if meta, err := msg.Metadata(); err == nil {
+		m.ID = fmt.Sprintf("%s/%d", meta.Stream, meta.Sequence.Stream)
+		m.Time = meta.Timestamp
+	}
+	return c.invoker.Invoke(m)
+}
+
+func (c *consumer) publish(subject string, data []byte, header http.Header) {
+	_, err := c.js.PublishMsg(&nats.Msg{
+		Subject: subject,
+		Data:    data,
+		Header:  nats.Header(header),
+	})
+	if err != nil {
+		c.logger.Warn("failed to publish message",
+			zap.Error(err),
+			zap.String("subject", subject),
+			zap.String("function_url", c.invoker.FunctionURL()))
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jetstream
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/mqtrigger/factory"
+	"github.com/fission/fission/pkg/mqtrigger/messageQueue"
+	"github.com/fission/fission/pkg/mqtrigger/validator"
+	"github.com/fission/fission/pkg/publisher"
+)
+
+func init() {
+	factory.Register(fv1.MessageQueueTypeNatsJetStream, &Factory{})
+	validator.Register(fv1.MessageQueueTypeNatsJetStream, IsTopicValid)
+}
+
+// defaultAckWait is how long JetStream waits for a message to be acked
+// before redelivering it, if MESSAGE_QUEUE_NATS_ACK_WAIT is not set.
+// Function invocations time out shortly before it.
+const defaultAckWait = 5 * time.Minute
+
+type (
+	JetStream struct {
+		logger    *zap.Logger
+		routerUrl string
+		url       string
+		secrets   *messageQueue.TriggerSecrets
+		ackWait   time.Duration
+		// cloudEvents is how messages are encoded as CloudEvents
+		cloudEvents publisher.CloudEventsMode
+	}
+
+	Factory struct{}
+
+	Subscription struct {
+		conn *nats.Conn
+		sub  *nats.Subscription
+	}
+)
+
+func (factory *Factory) Create(logger *zap.Logger, mqCfg messageQueue.Config, routerUrl string) (messageQueue.MessageQueue, error) {
+	return New(logger, mqCfg, routerUrl)
+}
+
+func New(logger *zap.Logger, mqCfg messageQueue.Config, routerUrl string) (messageQueue.MessageQueue, error) {
+	if len(routerUrl) == 0 || len(mqCfg.Url) == 0 {
+		return nil, errors.New("the router URL or MQ URL is empty")
+	}
+
+	ackWait := defaultAckWait
+	if s := os.Getenv("MESSAGE_QUEUE_NATS_ACK_WAIT"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			logger.Warn("error parsing nats ack wait - falling back to default",
+				zap.Error(err),
+				zap.String("ack_wait", s),
+				zap.Duration("default", defaultAckWait))
+		} else {
+			ackWait = d
+		}
+	}
+
+	js := &JetStream{
+		logger:    logger.Named("nats-jetstream"),
+		routerUrl: routerUrl,
+		url:       mqCfg.Url,
+		secrets:   messageQueue.MakeTriggerSecrets(mqCfg.Secrets, nil),
+		ackWait:   ackWait,
+
+		cloudEvents: publisher.CloudEventsModeFromEnv(logger),
+	}
+	logger.Info("created nats jetstream queue", zap.String("url", js.url), zap.Duration("ack_wait", js.ackWait))
+	return js, nil
+}
+
+func (js *JetStream) Subscribe(trigger *fv1.MessageQueueTrigger) (messageQueue.Subscription, error) {
+	js.logger.Debug("inside nats jetstream subscribe", zap.Any("trigger", trigger))
+
+	secrets, err := js.secrets.Get(context.Background(), trigger)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := js.connectOptions(trigger, secrets)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := nats.Connect(js.url, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error connecting to nats server %v", js.url)
+	}
+	jsCtx, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "error getting jetstream context")
+	}
+
+	c := newConsumer(js.logger, trigger, jsCtx, js.routerUrl, js.ackWait, js.cloudEvents)
+	// messages are redelivered until the function succeeds or the
+	// retries are exhausted, the durable consumer keeps the progress
+	// across restarts
+	sub, err := jsCtx.Subscribe(trigger.Spec.Topic, c.handle,
+		nats.Durable(durableName(trigger)),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+		nats.AckWait(js.ackWait),
+		nats.MaxDeliver(int(c.invoker.MaxDeliver())))
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrapf(err, "error subscribing to subject %v", trigger.Spec.Topic)
+	}
+
+	js.logger.Info("created a new durable consumer", zap.String("url", js.url),
+		zap.String("topic", trigger.Spec.Topic),
+		zap.String("response topic", trigger.Spec.ResponseTopic),
+		zap.String("error topic", trigger.Spec.ErrorTopic),
+		zap.String("trigger", trigger.ObjectMeta.Name),
+		zap.String("function namespace", trigger.ObjectMeta.Namespace),
+		zap.String("function name", trigger.Spec.FunctionReference.Name))
+
+	return &Subscription{conn: conn, sub: sub}, nil
+}
+
+func (js *JetStream) Unsubscribe(subscription messageQueue.Subscription) error {
+	s := subscription.(*Subscription)
+	defer s.conn.Close()
+	// the trigger is deleted, so is its durable consumer
+	return s.sub.Unsubscribe()
+}
+
+// durableName returns the name of the durable consumer of the trigger,
+// which must not contain '.', '*' or '>'.
+func durableName(trigger *fv1.MessageQueueTrigger) string {
+	return "fission-" + string(trigger.ObjectMeta.UID)
+}
+
+// connectOptions returns the options connecting with the credentials in
+// secrets:
+//   - caCert, userCert and userKey for TLS
+//   - creds, the content of a NATS credentials file
+//   - token
+//   - username and password
+func (js *JetStream) connectOptions(trigger *fv1.MessageQueueTrigger, secrets map[string][]byte) ([]nats.Option, error) {
+	opts := []nats.Option{
+		nats.Name("fission-mqtrigger-" + trigger.ObjectMeta.Namespace + "-" + trigger.ObjectMeta.Name),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				js.logger.Warn("disconnected from nats server", zap.Error(err), zap.String("trigger", trigger.ObjectMeta.Name))
+			}
+		}),
+	}
+
+	tlsConfig, err := messageQueue.TLSConfig(js.logger, secrets)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+
+	switch {
+	case len(secrets["creds"]) > 0:
+		userJWT, err := nkeys.ParseDecoratedJWT(secrets["creds"])
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing the user JWT of the nats credentials")
+		}
+		kp, err := nkeys.ParseDecoratedUserNKey(secrets["creds"])
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing the user nkey of the nats credentials")
+		}
+		opts = append(opts, nats.UserJWT(
+			func() (string, error) { return userJWT, nil },
+			func(nonce []byte) ([]byte, error) { return kp.Sign(nonce) }))
+	case len(secrets["token"]) > 0:
+		opts = append(opts, nats.Token(strings.TrimSpace(string(secrets["token"]))))
+	case len(secrets["username"]) > 0:
+		opts = append(opts, nats.UserInfo(string(secrets["username"]), string(secrets["password"])))
+	}
+	return opts, nil
+}
+
+// IsTopicValid checks the topic is a NATS subject: non empty tokens
+// separated by '.', without whitespace, where '>' may only be the last
+// token.
+func IsTopicValid(topic string) bool {
+	if len(topic) == 0 || strings.ContainsAny(topic, " \t\r\n") {
+		return false
+	}
+	tokens := strings.Split(topic, ".")
+	for i, token := range tokens {
+		if len(token) == 0 {
+			return false
+		}
+		if strings.ContainsAny(token, "*>") && len(token) > 1 {
+			return false
+		}
+		if token == ">" && i != len(tokens)-1 {
+			return false
+		}
+	}
+	return true
+}
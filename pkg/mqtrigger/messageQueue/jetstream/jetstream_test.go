@@ -0,0 +1,272 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package jetstream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/mqtrigger/messageQueue"
+	"github.com/fission/fission/pkg/publisher"
+	"github.com/fission/fission/pkg/utils/loggerfactory"
+)
+
+const testToken = "s3cr3t"
+
+// runServer starts an embedded nats server with jetstream, requiring
+// testToken.
+func runServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:          "127.0.0.1",
+		Port:          -1,
+		JetStream:     true,
+		StoreDir:      t.TempDir(),
+		Authorization: testToken,
+		NoLog:         true,
+		NoSigs:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func TestJetStream(t *testing.T) {
+	s := runServer(t)
+
+	nc, err := nats.Connect(s.ClientURL(), nats.Token(testToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = js.AddStream(&nats.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>", "responses", "errors"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var failures int32
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/fission-function/hello" || r.Header.Get("X-Fission-MQTrigger-Topic") != "orders.created" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if string(body) == "fail" {
+			atomic.AddInt32(&failures, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Order", r.Header.Get("X-Order"))
+		w.Write([]byte("processed " + string(body)))
+	}))
+	defer router.Close()
+
+	mq, err := New(loggerfactory.GetLogger(), messageQueue.Config{Url: s.ClientURL()}, router.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the credentials come from the secret of the trigger
+	mq.(*JetStream).secrets = messageQueue.MakeTriggerSecrets(nil, fake.NewSimpleClientset(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "nats-creds", Namespace: metav1.NamespaceDefault},
+		Data:       map[string][]byte{"token": []byte(testToken)},
+	}))
+
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: metav1.NamespaceDefault, UID: "6e8f1f0b-0c2e-4f6c-9b0e-5f4c2a4d7c11"},
+		Spec: fv1.MessageQueueTriggerSpec{
+			FunctionReference: fv1.FunctionReference{Type: fv1.FunctionReferenceTypeFunctionName, Name: "hello"},
+			MessageQueueType:  fv1.MessageQueueTypeNatsJetStream,
+			Topic:             "orders.created",
+			ResponseTopic:     "responses",
+			ErrorTopic:        "errors",
+			MaxRetries:        2,
+			Secret:            "nats-creds",
+		},
+	}
+	sub, err := mq.Subscribe(trigger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responses, err := js.SubscribeSync("responses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, err := js.SubscribeSync("errors")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := nats.NewMsg("orders.created")
+	msg.Header.Set("X-Order", "42")
+	msg.Data = []byte("order")
+	if _, err := js.PublishMsg(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.Publish("orders.created", []byte("fail")); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := responses.NextMsg(10 * time.Second)
+	if err != nil {
+		t.Fatalf("expected a response: %v", err)
+	}
+	if string(resp.Data) != "processed order" || resp.Header.Get("X-Order") != "42" {
+		t.Fatalf("unexpected response %q with headers %v", resp.Data, resp.Header)
+	}
+
+	errMsg, err := errs.NextMsg(10 * time.Second)
+	if err != nil {
+		t.Fatalf("expected an error message: %v", err)
+	}
+	if errMsg.Header.Get("MessageSource") != "orders.created" || errMsg.Header.Get("RecycleCounter") != "3" {
+		t.Fatalf("unexpected error message headers %v", errMsg.Header)
+	}
+	// the failing message is delivered once and retried twice
+	if n := atomic.LoadInt32(&failures); n != 3 {
+		t.Fatalf("expected 3 deliveries of the failing message, got %d", n)
+	}
+
+	// both messages are acked or terminated, the failing one right after
+	// its error is published
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		info, err := js.ConsumerInfo("ORDERS", durableName(trigger))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.NumAckPending == 0 && info.NumPending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected no pending messages, got %d unacked and %d undelivered", info.NumAckPending, info.NumPending)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	err = mq.Unsubscribe(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.ConsumerInfo("ORDERS", durableName(trigger)); err == nil {
+		t.Fatal("expected the durable consumer to be deleted")
+	}
+}
+
+func TestJetStreamSecret(t *testing.T) {
+	s := runServer(t)
+
+	mq, err := New(loggerfactory.GetLogger(), messageQueue.Config{Url: s.ClientURL()}, "http://router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mq.(*JetStream).secrets = messageQueue.MakeTriggerSecrets(nil, fake.NewSimpleClientset())
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: metav1.NamespaceDefault, UID: "uid"},
+		Spec: fv1.MessageQueueTriggerSpec{
+			FunctionReference: fv1.FunctionReference{Type: fv1.FunctionReferenceTypeFunctionName, Name: "hello"},
+			Topic:             "orders.created",
+			Secret:            "missing",
+		},
+	}
+	if _, err := mq.Subscribe(trigger); err == nil {
+		t.Fatal("expected an error for a missing secret")
+	}
+
+	// without credentials the server refuses the connection
+	trigger.Spec.Secret = ""
+	if _, err := mq.Subscribe(trigger); err == nil {
+		t.Fatal("expected an error connecting without credentials")
+	}
+}
+
+func TestIsTopicValid(t *testing.T) {
+	for topic, valid := range map[string]bool{
+		"orders":           true,
+		"orders.created":   true,
+		"orders.*.created": true,
+		"orders.>":         true,
+		"":                 false,
+		"orders..created":  false,
+		"orders.>.created": false,
+		"orders created":   false,
+		"orders.cre*ted":   false,
+	} {
+		if IsTopicValid(topic) != valid {
+			t.Errorf("expected IsTopicValid(%q) to be %v", topic, valid)
+		}
+	}
+}
+
+func TestRedeliveryDelay(t *testing.T) {
+	for delivery, expected := range map[uint64]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		7:  time.Minute,
+		64: time.Minute,
+	} {
+		if d := redeliveryDelay(delivery); d != expected {
+			t.Errorf("expected delay %v after delivery %d, got %v", expected, delivery, d)
+		}
+	}
+}
+
+func TestInvokeTimeout(t *testing.T) {
+	stuck := make(chan struct{})
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stuck
+	}))
+	defer router.Close()
+	defer close(stuck)
+
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: metav1.NamespaceDefault},
+		Spec: fv1.MessageQueueTriggerSpec{
+			FunctionReference: fv1.FunctionReference{Type: fv1.FunctionReferenceTypeFunctionName, Name: "hello"},
+			Topic:             "orders.created",
+		},
+	}
+	c := newConsumer(loggerfactory.GetLogger(), trigger, nil, router.URL, 200*time.Millisecond, publisher.CloudEventsModeNone)
+	start := time.Now()
+	if _, _, err := c.invoke(nats.NewMsg("orders.created")); err == nil {
+		t.Fatal("expected the invocation to time out")
+	}
+	if d := time.Since(start); d >= 200*time.Millisecond {
+		t.Fatalf("expected the invocation to time out before the ack wait, took %v", d)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Shopify/sarama"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/publisher"
+)
+
+// batchSizeHeader tells the function how many records the batch holds.
+const batchSizeHeader = "X-Fission-MQTrigger-Batch-Size"
+
+type (
+	// batchRecord is a record of a batch as sent to the function. Keys and
+	// values that are not valid UTF-8 are sent base64 encoded in keyBase64
+	// and valueBase64 instead.
+	batchRecord struct {
+		Topic       string              `json:"topic"`
+		Partition   int32               `json:"partition"`
+		Offset      int64               `json:"offset"`
+		Timestamp   *time.Time          `json:"timestamp,omitempty"`
+		Key         *string             `json:"key,omitempty"`
+		KeyBase64   []byte              `json:"keyBase64,omitempty"`
+		Headers     map[string][]string `json:"headers,omitempty"`
+		Value       *string             `json:"value,omitempty"`
+		ValueBase64 []byte              `json:"valueBase64,omitempty"`
+	}
+
+	// batchResponse is what a function may answer to a batch to report the
+	// records it failed to process. Records missing from the results, or all
+	// of them if the response is not a batchResponse, are considered
+	// processed.
+	batchResponse struct {
+		Results []batchResult `json:"results"`
+	}
+
+	// batchResult is the outcome of a record of a batch.
+	batchResult struct {
+		Partition int32  `json:"partition"`
+		Offset    int64  `json:"offset"`
+		Success   bool   `json:"success"`
+		Error     string `json:"error,omitempty"`
+	}
+)
+
+func newBatchRecord(msg *sarama.ConsumerMessage) batchRecord {
+	r := batchRecord{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+	}
+	if !msg.Timestamp.IsZero() {
+		ts := msg.Timestamp
+		r.Timestamp = &ts
+	}
+	if msg.Key != nil {
+		if utf8.Valid(msg.Key) {
+			key := string(msg.Key)
+			r.Key = &key
+		} else {
+			r.KeyBase64 = msg.Key
+		}
+	}
+	if len(msg.Headers) > 0 {
+		r.Headers = make(map[string][]string, len(msg.Headers))
+		for _, h := range msg.Headers {
+			r.Headers[string(h.Key)] = append(r.Headers[string(h.Key)], string(h.Value))
+		}
+	}
+	if utf8.Valid(msg.Value) {
+		value := string(msg.Value)
+		r.Value = &value
+	} else {
+		r.ValueBase64 = msg.Value
+	}
+	return r
+}
+
+// encodeBatch encodes the messages as a JSON array or as NDJSON, returning the
+// body along with its content type.
+func encodeBatch(format fv1.BatchFormat, msgs []*sarama.ConsumerMessage) ([]byte, string, error) {
+	records := make([]batchRecord, 0, len(msgs))
+	for _, msg := range msgs {
+		records = append(records, newBatchRecord(msg))
+	}
+
+	if format == fv1.BatchFormatNDJSON {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, r := range records {
+			// Encode terminates every record with a newline
+			if err := enc.Encode(r); err != nil {
+				return nil, "", err
+			}
+		}
+		return buf.Bytes(), "application/x-ndjson", nil
+	}
+
+	body, err := json.Marshal(records)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, "application/json", nil
+}
+
+// failedRecords returns the errors of the records the function reported as
+// failed, keyed by the index of the record in the batch.
+func failedRecords(body []byte, msgs []*sarama.ConsumerMessage) map[int]error {
+	var resp batchResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil
+	}
+
+	index := make(map[int64]int, len(msgs))
+	for i, msg := range msgs {
+		index[msg.Offset] = i
+	}
+
+	failed := make(map[int]error)
+	for _, r := range resp.Results {
+		i, ok := index[r.Offset]
+		if !ok || r.Success || msgs[i].Partition != r.Partition {
+			continue
+		}
+		msg := "function reported failure"
+		if len(r.Error) > 0 {
+			msg = r.Error
+		}
+		failed[i] = errors.Errorf("record at partition %v offset %v failed: %v", r.Partition, r.Offset, msg)
+	}
+	return failed
+}
+
+// kafkaBatchHandler invokes the function with a batch of messages. The response
+// is published once for the whole batch, only the records the function reports
+// as failed are sent to the error topic. If the invocation itself fails every
+// record of the batch is. It returns true once all the messages were delivered
+// or dead-lettered, false if the session ended first.
+func (ch *MqtConsumerGroupHandler) kafkaBatchHandler(ctx context.Context, msgs []*sarama.ConsumerMessage) bool {
+	var payload []byte
+	var contentType string
+	var err error
+	if ch.cloudEvents != publisher.CloudEventsModeNone {
+		// binary mode can't carry several events, batches of events are
+		// always structured
+		events := make([]*publisher.CloudEvent, 0, len(msgs))
+		for _, msg := range msgs {
+			events = append(events, ch.cloudEvent(msg))
+		}
+		payload, contentType, err = publisher.EncodeCloudEventsBatch(events)
+	} else {
+		payload, contentType, err = encodeBatch(ch.trigger.Spec.Batch.Format, msgs)
+	}
+	if err != nil {
+		ch.logger.Error("failed to encode batch of messages",
+			zap.Error(err),
+			zap.String("trigger", ch.trigger.ObjectMeta.Name))
+		return ch.deadLetterAll(ctx, msgs, errors.Wrap(err, "error encoding batch"))
+	}
+
+	body, header, err := ch.invoke(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.fnUrl, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range ch.fissionHeaders {
+			req.Header.Set(k, v)
+		}
+		// the body is the batch, its content type is the batch encoding
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(batchSizeHeader, strconv.Itoa(len(msgs)))
+		return req, nil
+	})
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return ch.deadLetterAll(ctx, msgs, err)
+	}
+
+	ch.logger.Debug("got response from function batch invocation",
+		zap.String("function_url", ch.fnUrl),
+		zap.String("trigger", ch.trigger.ObjectMeta.Name),
+		zap.Int("records", len(msgs)),
+		zap.String("body", string(body)))
+
+	ch.publishResponse(body, header)
+
+	failed := failedRecords(body, msgs)
+	for i := range msgs {
+		if err, ok := failed[i]; ok && !ch.deadLetter(ctx, err) {
+			return false
+		}
+	}
+	return true
+}
+
+// deadLetterAll publishes err to the error topic once for every message.
+func (ch *MqtConsumerGroupHandler) deadLetterAll(ctx context.Context, msgs []*sarama.ConsumerMessage, err error) bool {
+	for range msgs {
+		if !ch.deadLetter(ctx, err) {
+			return false
+		}
+	}
+	return true
+}
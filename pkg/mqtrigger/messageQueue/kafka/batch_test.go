@@ -0,0 +1,288 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/publisher"
+)
+
+func TestConsumeClaimBatch(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		var records []batchRecord
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			t.Errorf("error decoding batch: %v", err)
+		}
+		if size := r.Header.Get(batchSizeHeader); size != strconv.Itoa(len(records)) {
+			t.Errorf("batch size header %q for %d records", size, len(records))
+		}
+
+		var offsets []int64
+		resp := batchResponse{}
+		for _, rec := range records {
+			offsets = append(offsets, rec.Offset)
+			result := batchResult{Partition: rec.Partition, Offset: rec.Offset, Success: *rec.Value != "bad"}
+			if !result.Success {
+				result.Error = "bad record"
+			}
+			resp.Results = append(resp.Results, result)
+		}
+		mu.Lock()
+		batches = append(batches, offsets)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	// one response per batch, then the failed record of the second batch
+	for i := 0; i < 2; i++ {
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(topicChecker("output", ""))
+	}
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(topicChecker("errors", "record at partition 0 offset 3 failed: bad record"))
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(topicChecker("output", ""))
+
+	ch := newBatchTestHandler(t, server, producer, &fv1.MessageQueueTriggerBatch{MaxRecords: 2, MaxWait: metav1.Duration{Duration: 50 * time.Millisecond}})
+	session := consume(t, ch, newClaim("a", "b", "c", "bad", "e"))
+
+	if marked := session.markedOffsets(); !reflect.DeepEqual(marked, []int64{1, 3, 4}) {
+		t.Fatalf("expected the last offset of every batch to be marked, got %v", marked)
+	}
+	if expected := [][]int64{{0, 1}, {2, 3}, {4}}; !reflect.DeepEqual(batches, expected) {
+		t.Fatalf("expected batches %v, got %v", expected, batches)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumeClaimBatchMaxBytes(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		mu.Lock()
+		sizes = append(sizes, r.Header.Get(batchSizeHeader))
+		mu.Unlock()
+		w.Write([]byte("not a batch response"))
+	}))
+	defer server.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	for i := 0; i < 2; i++ {
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(topicChecker("output", "not a batch response"))
+	}
+
+	ch := newBatchTestHandler(t, server, producer, &fv1.MessageQueueTriggerBatch{
+		MaxRecords: 10,
+		MaxBytes:   6,
+		MaxWait:    metav1.Duration{Duration: 50 * time.Millisecond},
+		Format:     fv1.BatchFormatNDJSON,
+	})
+	session := consume(t, ch, newClaim("abc", "def", "gh"))
+
+	if marked := session.markedOffsets(); !reflect.DeepEqual(marked, []int64{1, 2}) {
+		t.Fatalf("expected offsets 1 and 2 to be marked, got %v", marked)
+	}
+	if expected := []string{"2", "1"}; !reflect.DeepEqual(sizes, expected) {
+		t.Fatalf("expected batch sizes %v, got %v", expected, sizes)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumeClaimBatchFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	for i := 0; i < 3; i++ {
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(topicChecker("errors", "request returned failure: 500"))
+	}
+
+	ch := newBatchTestHandler(t, server, producer, &fv1.MessageQueueTriggerBatch{MaxRecords: 3})
+	session := consume(t, ch, newClaim("a", "b", "c"))
+
+	if marked := session.markedOffsets(); !reflect.DeepEqual(marked, []int64{2}) {
+		t.Fatalf("expected offset 2 to be marked, got %v", marked)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumeClaimBatchCloudEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/cloudevents-batch+json" {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		var events []map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+			t.Errorf("error decoding batch: %v", err)
+		}
+		if len(events) != 2 || events[0]["id"] != "input/0/0" || events[1]["id"] != "input/0/1" ||
+			events[1]["data"] != "b" || events[1]["offset"] != "1" {
+			t.Errorf("unexpected events %v", events)
+		}
+		json.NewEncoder(w).Encode(batchResponse{Results: []batchResult{{Partition: 0, Offset: 0, Error: "failed"}}})
+	}))
+	defer server.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(topicChecker("output", ""))
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(topicChecker("errors", "record at partition 0 offset 0 failed: failed"))
+
+	ch := newBatchTestHandler(t, server, producer, &fv1.MessageQueueTriggerBatch{MaxRecords: 2})
+	ch.cloudEvents = publisher.CloudEventsModeBinary
+	session := consume(t, ch, newClaim("a", "b"))
+
+	if marked := session.markedOffsets(); !reflect.DeepEqual(marked, []int64{1}) {
+		t.Fatalf("expected offset 1 to be marked, got %v", marked)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	ts := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	msgs := []*sarama.ConsumerMessage{
+		{
+			Topic: "input", Partition: 1, Offset: 7, Timestamp: ts, Key: []byte("k"), Value: []byte(`{"a":1}`),
+			Headers: []*sarama.RecordHeader{{Key: []byte("h"), Value: []byte("1")}, {Key: []byte("h"), Value: []byte("2")}},
+		},
+		{Topic: "input", Partition: 1, Offset: 8, Value: []byte{0xff, 0xfe}},
+	}
+
+	body, contentType, err := encodeBatch(fv1.BatchFormatNDJSON, msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %q", contentType)
+	}
+
+	var records []batchRecord
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		var r batchRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("error decoding line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 lines, got %q", string(body))
+	}
+
+	first := records[0]
+	if first.Partition != 1 || first.Offset != 7 || *first.Key != "k" || *first.Value != `{"a":1}` ||
+		!first.Timestamp.Equal(ts) || !reflect.DeepEqual(first.Headers["h"], []string{"1", "2"}) {
+		t.Fatalf("unexpected first record %+v", first)
+	}
+	second := records[1]
+	if second.Value != nil || !bytes.Equal(second.ValueBase64, []byte{0xff, 0xfe}) || second.Key != nil || second.Timestamp != nil {
+		t.Fatalf("unexpected second record %+v", second)
+	}
+
+	body, contentType, err = encodeBatch("", msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" || !strings.HasPrefix(string(body), "[") {
+		t.Fatalf("expected a JSON array, got %q (%v)", string(body), contentType)
+	}
+}
+
+func TestFailedRecords(t *testing.T) {
+	msgs := []*sarama.ConsumerMessage{{Partition: 0, Offset: 4}, {Partition: 0, Offset: 5}, {Partition: 0, Offset: 6}}
+
+	failed := failedRecords([]byte(`{"results":[{"partition":0,"offset":4,"success":true},{"partition":0,"offset":5,"error":"boom"},{"partition":0,"offset":6},{"partition":0,"offset":9}]}`), msgs)
+	if len(failed) != 2 || failed[1] == nil || failed[2] == nil {
+		t.Fatalf("expected records 1 and 2 to fail, got %v", failed)
+	}
+	if failed[1].Error() != "record at partition 0 offset 5 failed: boom" {
+		t.Fatalf("unexpected error %q", failed[1].Error())
+	}
+
+	if failed := failedRecords([]byte("ok"), msgs); len(failed) != 0 {
+		t.Fatalf("expected no failures for a response that is not a batch response, got %v", failed)
+	}
+}
+
+func newBatchTestHandler(t *testing.T, server *httptest.Server, producer sarama.SyncProducer, batch *fv1.MessageQueueTriggerBatch) MqtConsumerGroupHandler {
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "mqt", Namespace: "default"},
+		Spec: fv1.MessageQueueTriggerSpec{
+			FunctionReference: fv1.FunctionReference{Type: fv1.FunctionReferenceTypeFunctionName, Name: "hello"},
+			Topic:             "input",
+			ResponseTopic:     "output",
+			ErrorTopic:        "errors",
+			ContentType:       "text/plain",
+			Batch:             batch,
+		},
+	}
+	ch := NewMqtConsumerGroupHandler(sarama.V2_0_0_0, zap.NewNop(), trigger, producer, server.URL, 1)
+	ch.retryBackoff = time.Millisecond
+	ch.maxRetryBackoff = 10 * time.Millisecond
+	return ch
+}
+
+// topicChecker checks a message is sent to topic, with the value if not empty.
+func topicChecker(topic, value string) mocks.MessageChecker {
+	return func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != topic {
+			return errors.Errorf("expected a message on %q, got one on %q", topic, msg.Topic)
+		}
+		if len(value) == 0 {
+			return nil
+		}
+		v, _ := msg.Value.Encode()
+		if got := strings.TrimSpace(string(v)); got != value {
+			return errors.Errorf("expected %q on %q, got %q", value, topic, got)
+		}
+		return nil
+	}
+}
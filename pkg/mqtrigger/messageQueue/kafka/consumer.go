@@ -17,11 +17,16 @@ limitations under the License.
 package kafka
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/Shopify/sarama"
 	"github.com/pkg/errors"
@@ -29,9 +34,27 @@ import (
 
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
 	"github.com/fission/fission/pkg/mqtrigger"
+	"github.com/fission/fission/pkg/mqtrigger/messageQueue"
+	"github.com/fission/fission/pkg/publisher"
 	"github.com/fission/fission/pkg/utils"
 )
 
+const (
+	// defaultMaxInFlight processes the messages of a partition one at a time
+	defaultMaxInFlight = 1
+
+	// bounds of the exponential backoff between invocation attempts
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultMaxRetryBackoff = 30 * time.Second
+
+	// defaultBatchMaxWait is how long a batch is collected if the trigger
+	// sets no limit
+	defaultBatchMaxWait = time.Second
+
+	// maxRetryAfter caps the wait requested by a function through Retry-After
+	maxRetryAfter = 5 * time.Minute
+)
+
 type MqtConsumerGroupHandler struct {
 	version        sarama.KafkaVersion
 	logger         *zap.Logger
@@ -40,19 +63,60 @@ type MqtConsumerGroupHandler struct {
 	producer       sarama.SyncProducer
 	fnUrl          string
 	ready          chan bool
+	// maxInFlight is the number of messages of a partition invoked concurrently
+	maxInFlight     int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	httpClient      *http.Client
+	// limits of the batches the messages are delivered in, batches of a
+	// single message unless the trigger is in batch mode
+	batchMaxRecords int
+	batchMaxBytes   int
+	batchMaxWait    time.Duration
+	// cloudEvents is how messages are encoded as CloudEvents
+	cloudEvents publisher.CloudEventsMode
+}
+
+// pendingMessages are messages of a partition invoked together, whose offsets
+// can't be marked until they and every message before them are done.
+type pendingMessages struct {
+	msgs []*sarama.ConsumerMessage
+	done chan struct{}
+	// handled is set once the messages were delivered or dead-lettered
+	handled bool
 }
 
 func NewMqtConsumerGroupHandler(version sarama.KafkaVersion,
 	logger *zap.Logger,
 	trigger *fv1.MessageQueueTrigger,
 	producer sarama.SyncProducer,
-	routerUrl string) MqtConsumerGroupHandler {
+	routerUrl string,
+	maxInFlight int) MqtConsumerGroupHandler {
+	if maxInFlight < 1 {
+		maxInFlight = defaultMaxInFlight
+	}
 	ch := MqtConsumerGroupHandler{
-		version:  version,
-		logger:   logger,
-		trigger:  trigger,
-		producer: producer,
-		ready:    make(chan bool),
+		version:         version,
+		logger:          logger,
+		trigger:         trigger,
+		producer:        producer,
+		ready:           make(chan bool),
+		maxInFlight:     maxInFlight,
+		retryBackoff:    defaultRetryBackoff,
+		maxRetryBackoff: defaultMaxRetryBackoff,
+		httpClient:      http.DefaultClient,
+		batchMaxRecords: 1,
+	}
+	if batch := trigger.Spec.Batch; batch != nil {
+		ch.batchMaxRecords = batch.MaxRecords
+		ch.batchMaxBytes = batch.MaxBytes
+		ch.batchMaxWait = batch.MaxWait.Duration
+		if ch.batchMaxRecords < 1 {
+			ch.batchMaxRecords = 1
+		}
+		if ch.batchMaxWait <= 0 {
+			ch.batchMaxWait = defaultBatchMaxWait
+		}
 	}
 	// Support other function ref types
 	if ch.trigger.Spec.FunctionReference.Type != fv1.FunctionReferenceTypeFunctionName {
@@ -98,160 +162,379 @@ func (ch MqtConsumerGroupHandler) Cleanup(session sarama.ConsumerGroupSession) e
 	return nil
 }
 
-// ConsumeClaims implemented to satisfy the sarama.ConsumerGroupHandler interface
+// ConsumeClaims implemented to satisfy the sarama.ConsumerGroupHandler interface.
+// Messages of the claimed partition are invoked in the order they arrive, with at
+// most maxInFlight invocations running at once. In batch mode an invocation is a
+// batch of messages. The offset of a message is only marked once it and all the
+// messages before it were delivered or dead-lettered, so a restarted session
+// resumes from the oldest unfinished message.
 func (ch MqtConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
 
 	trigger := ch.trigger.Name
 	triggerNamespace := ch.trigger.Namespace
 	topic := claim.Topic()
-	partition := string(claim.Partition())
+	partition := strconv.Itoa(int(claim.Partition()))
 
 	// initially set metrics to -1
 	mqtrigger.SetMessageLagCount(trigger, triggerNamespace, topic, partition, -1)
 
+	ctx := session.Context()
+	var window []*pendingMessages
+
+	// markDone marks the offsets of the finished messages at the head of the window.
+	// It returns false if a message could not be handled, later offsets must not be
+	// marked then.
+	markDone := func() bool {
+		for len(window) > 0 {
+			p := window[0]
+			select {
+			case <-p.done:
+			default:
+				return true
+			}
+			if !p.handled {
+				return false
+			}
+			last := p.msgs[len(p.msgs)-1]
+			session.MarkMessage(last, "")
+			mqtrigger.SetMessageLagCount(trigger, triggerNamespace, topic, partition,
+				claim.HighWaterMarkOffset()-last.Offset-1)
+			window = window[1:]
+		}
+		return true
+	}
+
+	// the batch being collected, a single message unless in batch mode
+	var (
+		batch      []*sarama.ConsumerMessage
+		batchBytes int
+		batchReady bool
+		batchTimer *time.Timer
+		batchWait  <-chan time.Time
+	)
+	dispatch := func() {
+		if batchTimer != nil {
+			batchTimer.Stop()
+			batchTimer, batchWait = nil, nil
+		}
+		p := &pendingMessages{msgs: batch, done: make(chan struct{})}
+		window = append(window, p)
+		batch, batchBytes, batchReady = nil, 0, false
+		go func() {
+			if ch.trigger.Spec.Batch != nil {
+				p.handled = ch.kafkaBatchHandler(ctx, p.msgs)
+			} else {
+				p.handled = ch.kafkaMsgHandler(ctx, p.msgs[0])
+			}
+			if p.handled {
+				for range p.msgs {
+					mqtrigger.IncreaseMessageCount(trigger, triggerNamespace)
+				}
+			}
+			close(p.done)
+		}()
+	}
+	defer func() {
+		if batchTimer != nil {
+			batchTimer.Stop()
+		}
+	}()
+
 	// Do not move the code below to a goroutine.
 	// The `ConsumeClaim` itself is called within a goroutine
+	messages := claim.Messages()
 	for {
-		select {
-		case msg := <-claim.Messages():
-			if msg != nil {
-				ch.kafkaMsgHandler(msg)
-				session.MarkMessage(msg, "")
-				mqtrigger.IncreaseMessageCount(trigger, triggerNamespace)
-			}
+		if !markDone() {
+			return nil
+		}
+		if batchReady && len(window) < ch.maxInFlight {
+			dispatch()
+		}
+		// the claim ended and every message read from it is done
+		if messages == nil && len(batch) == 0 && len(window) == 0 {
+			return nil
+		}
 
-			mqtrigger.SetMessageLagCount(trigger, triggerNamespace, topic, partition,
-				claim.HighWaterMarkOffset()-msg.Offset-1)
+		// oldest is nil when nothing is in flight, blocking forever in the select
+		var oldest chan struct{}
+		if len(window) > 0 {
+			oldest = window[0].done
+		}
+		// stop reading until the oldest message is done once the batch is ready
+		// and the window is full
+		in := messages
+		if batchReady {
+			in = nil
+		}
 
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				messages = nil
+				batchReady = len(batch) > 0
+				continue
+			}
+			if msg == nil {
+				continue
+			}
+			batch = append(batch, msg)
+			batchBytes += len(msg.Value)
+			if len(batch) >= ch.batchMaxRecords || (ch.batchMaxBytes > 0 && batchBytes >= ch.batchMaxBytes) {
+				batchReady = true
+			} else if batchTimer == nil {
+				batchTimer = time.NewTimer(ch.batchMaxWait)
+				batchWait = batchTimer.C
+			}
+		case <-batchWait:
+			batchTimer, batchWait = nil, nil
+			batchReady = true
+		case <-oldest:
 		// Should return when `session.Context()` is done.
-		case <-session.Context().Done():
+		case <-ctx.Done():
 			return nil
 		}
 	}
 }
 
-func (ch *MqtConsumerGroupHandler) kafkaMsgHandler(msg *sarama.ConsumerMessage) {
-	value := string(msg.Value)
+// kafkaMsgHandler invokes the function with the message, publishing the response
+// or the error. It returns true once the message was delivered or dead-lettered,
+// false if the session ended first.
+func (ch *MqtConsumerGroupHandler) kafkaMsgHandler(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	payload, eventHeaders, err := ch.cloudEvent(msg).Encode(ch.cloudEvents)
+	if err != nil {
+		return ch.deadLetter(ctx, err)
+	}
 
-	// Create request
-	req, err := http.NewRequest("POST", ch.fnUrl, strings.NewReader(value))
+	body, header, err := ch.invoke(ctx, func(ctx context.Context) (*http.Request, error) {
+		return ch.newRequest(ctx, msg, payload, eventHeaders)
+	})
+	if ctx.Err() != nil {
+		return false
+	}
 	if err != nil {
-		ch.logger.Error("failed to create HTTP request to invoke function",
-			zap.Error(err),
-			zap.String("function_url", ch.fnUrl))
+		return ch.deadLetter(ctx, err)
+	}
+
+	ch.logger.Debug("got response from function invocation",
+		zap.String("function_url", ch.fnUrl),
+		zap.String("trigger", ch.trigger.ObjectMeta.Name),
+		zap.String("body", string(body)))
+
+	ch.publishResponse(body, header)
+	return true
+}
+
+// publishResponse publishes the response of the function to the response topic,
+// if the trigger has one.
+func (ch *MqtConsumerGroupHandler) publishResponse(body []byte, header http.Header) {
+	if len(ch.trigger.Spec.ResponseTopic) == 0 {
 		return
 	}
 
-	// Set the headers came from Kafka record
-	// Using Header.Add() as msg.Headers may have keys with more than one value
+	// Generate Kafka record headers
+	var kafkaRecordHeaders []sarama.RecordHeader
 	if ch.version.IsAtLeast(sarama.V0_11_0_0) {
-		for _, h := range msg.Headers {
-			req.Header.Add(string(h.Key), string(h.Value))
+		for k, v := range header {
+			// One key may have multiple values
+			for _, v := range v {
+				kafkaRecordHeaders = append(kafkaRecordHeaders, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+			}
 		}
 	} else {
 		ch.logger.Warn("headers are not supported by current Kafka version, needs v0.11+: no record headers to add in HTTP request",
 			zap.Any("current_version", ch.version))
 	}
 
-	for k, v := range ch.fissionHeaders {
-		req.Header.Set(k, v)
+	_, _, err := ch.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   ch.trigger.Spec.ResponseTopic,
+		Value:   sarama.StringEncoder(body),
+		Headers: kafkaRecordHeaders,
+	})
+	if err != nil {
+		ch.logger.Warn("failed to publish response body from function invocation to topic",
+			zap.Error(err),
+			zap.String("topic", ch.trigger.Spec.Topic),
+			zap.String("function_url", ch.fnUrl))
 	}
+}
+
+// invoke calls the function up to MaxRetries+1 times, building a new request for
+// every attempt and backing off between them. It returns the body and headers of
+// the first successful response.
+func (ch *MqtConsumerGroupHandler) invoke(ctx context.Context, newRequest func(context.Context) (*http.Request, error)) ([]byte, http.Header, error) {
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		req, err := newRequest(ctx)
+		if err != nil {
+			ch.logger.Error("failed to create HTTP request to invoke function",
+				zap.Error(err),
+				zap.String("function_url", ch.fnUrl))
+			return nil, nil, err
+		}
 
-	// Make the request
-	var resp *http.Response
-	for attempt := 0; attempt <= ch.trigger.Spec.MaxRetries; attempt++ {
-		// Make the request
-		resp, err = http.DefaultClient.Do(req)
+		resp, err := ch.httpClient.Do(req)
 		if err != nil {
 			ch.logger.Error("sending function invocation request failed",
 				zap.Error(err),
 				zap.String("function_url", ch.fnUrl),
 				zap.String("trigger", ch.trigger.ObjectMeta.Name))
-			continue
+			lastErr = errors.Errorf("request exceed retries: %v", ch.trigger.Spec.MaxRetries)
+		} else {
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			switch {
+			case err != nil:
+				lastErr = errors.Wrapf(err, "request body error: %v", string(body))
+			case resp.StatusCode < 200 || resp.StatusCode >= 300:
+				lastErr = errors.Errorf("request returned failure: %v", resp.StatusCode)
+				if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+					retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+				}
+			default:
+				return body, resp.Header, nil
+			}
 		}
-		if resp == nil {
-			continue
+
+		if attempt >= ch.trigger.Spec.MaxRetries {
+			return nil, nil, lastErr
 		}
-		if err == nil && resp.StatusCode == http.StatusOK {
-			// Success, quit retrying
-			break
+
+		wait := retryAfter
+		if wait <= 0 {
+			wait = ch.backoff(attempt)
+		}
+		ch.logger.Debug("retrying function invocation",
+			zap.Error(lastErr),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("wait", wait),
+			zap.String("trigger", ch.trigger.ObjectMeta.Name))
+		if !sleep(ctx, wait) {
+			return nil, nil, ctx.Err()
 		}
 	}
+}
 
-	generateErrorHeaders := func(errString string) []sarama.RecordHeader {
-		var errorHeaders []sarama.RecordHeader
-		if ch.version.IsAtLeast(sarama.V0_11_0_0) {
-			if count, ok := errorMessageMap[errString]; ok {
-				errorMessageMap[errString] = count + 1
-			} else {
-				errorMessageMap[errString] = 1
-			}
-			errorHeaders = append(errorHeaders, sarama.RecordHeader{Key: []byte("MessageSource"), Value: []byte(ch.trigger.Spec.Topic)})
-			errorHeaders = append(errorHeaders, sarama.RecordHeader{Key: []byte("RecycleCounter"), Value: []byte(strconv.Itoa(errorMessageMap[errString]))})
-		}
-		return errorHeaders
+// newRequest creates the function invocation request, with a body of its own.
+func (ch *MqtConsumerGroupHandler) newRequest(ctx context.Context, msg *sarama.ConsumerMessage,
+	payload []byte, eventHeaders map[string]string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ch.fnUrl, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
 	}
 
-	if resp == nil {
-		errorString := fmt.Sprintf("request exceed retries: %v", ch.trigger.Spec.MaxRetries)
-		errorHeaders := generateErrorHeaders(errorString)
-		errorHandler(ch.logger, ch.trigger, ch.producer, ch.fnUrl,
-			fmt.Errorf(errorString), errorHeaders)
-		return
+	// Set the headers came from Kafka record
+	// Using Header.Add() as msg.Headers may have keys with more than one value
+	if ch.version.IsAtLeast(sarama.V0_11_0_0) {
+		for _, h := range msg.Headers {
+			req.Header.Add(string(h.Key), string(h.Value))
+		}
+	} else {
+		ch.logger.Warn("headers are not supported by current Kafka version, needs v0.11+: no record headers to add in HTTP request",
+			zap.Any("current_version", ch.version))
 	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
 
-	ch.logger.Debug("got response from function invocation",
-		zap.String("function_url", ch.fnUrl),
-		zap.String("trigger", ch.trigger.ObjectMeta.Name),
-		zap.String("body", string(body)))
+	for k, v := range ch.fissionHeaders {
+		req.Header.Set(k, v)
+	}
+	for k, v := range eventHeaders {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
 
-	if err != nil {
-		errorString := "request body error: " + string(body)
-		errorHeaders := generateErrorHeaders(errorString)
-		errorHandler(ch.logger, ch.trigger, ch.producer, ch.fnUrl,
-			errors.Wrapf(err, errorString), errorHeaders)
-		return
+// cloudEvent returns the event of a record, identified by its topic,
+// partition and offset.
+func (ch *MqtConsumerGroupHandler) cloudEvent(msg *sarama.ConsumerMessage) *publisher.CloudEvent {
+	event := messageQueue.MessageCloudEvent(ch.trigger, fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset),
+		msg.Timestamp, msg.Value)
+	event.Extensions = map[string]string{
+		"partition": strconv.Itoa(int(msg.Partition)),
+		"offset":    strconv.FormatInt(msg.Offset, 10),
 	}
-	if resp.StatusCode != 200 {
-		errorString := fmt.Sprintf("request returned failure: %v, request body error: %v", resp.StatusCode, body)
-		errorHeaders := generateErrorHeaders(errorString)
-		errorHandler(ch.logger, ch.trigger, ch.producer, ch.fnUrl,
-			fmt.Errorf("request returned failure: %v", resp.StatusCode), errorHeaders)
-		return
+	if len(msg.Key) > 0 && utf8.Valid(msg.Key) {
+		event.Extensions["partitionkey"] = string(msg.Key)
 	}
-	if len(ch.trigger.Spec.ResponseTopic) > 0 {
-		// Generate Kafka record headers
-		var kafkaRecordHeaders []sarama.RecordHeader
-		if ch.version.IsAtLeast(sarama.V0_11_0_0) {
-			for k, v := range resp.Header {
-				// One key may have multiple values
-				for _, v := range v {
-					kafkaRecordHeaders = append(kafkaRecordHeaders, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
-				}
-			}
-		} else {
-			ch.logger.Warn("headers are not supported by current Kafka version, needs v0.11+: no record headers to add in HTTP request",
-				zap.Any("current_version", ch.version))
+	return event
+}
+
+// deadLetter publishes the invocation error to the error topic, retrying until it
+// succeeds or the session ends. It returns true once the message is dead-lettered.
+func (ch *MqtConsumerGroupHandler) deadLetter(ctx context.Context, err error) bool {
+	errorHeaders := ch.generateErrorHeaders(err.Error())
+	for attempt := 0; ; attempt++ {
+		if errorHandler(ch.logger, ch.trigger, ch.producer, ch.fnUrl, err, errorHeaders) == nil {
+			return true
 		}
+		if !sleep(ctx, ch.backoff(attempt)) {
+			return false
+		}
+	}
+}
 
-		_, _, err := ch.producer.SendMessage(&sarama.ProducerMessage{
-			Topic:   ch.trigger.Spec.ResponseTopic,
-			Value:   sarama.StringEncoder(body),
-			Headers: kafkaRecordHeaders,
-		})
-		if err != nil {
-			ch.logger.Warn("failed to publish response body from function invocation to topic",
-				zap.Error(err),
-				zap.String("topic", ch.trigger.Spec.Topic),
-				zap.String("function_url", ch.fnUrl))
-			return
+func (ch *MqtConsumerGroupHandler) generateErrorHeaders(errString string) []sarama.RecordHeader {
+	var errorHeaders []sarama.RecordHeader
+	if ch.version.IsAtLeast(sarama.V0_11_0_0) {
+		errorMessageMu.Lock()
+		errorMessageMap[errString]++
+		count := errorMessageMap[errString]
+		errorMessageMu.Unlock()
+		errorHeaders = append(errorHeaders, sarama.RecordHeader{Key: []byte("MessageSource"), Value: []byte(ch.trigger.Spec.Topic)})
+		errorHeaders = append(errorHeaders, sarama.RecordHeader{Key: []byte("RecycleCounter"), Value: []byte(strconv.Itoa(count))})
+	}
+	return errorHeaders
+}
+
+// backoff returns a random wait of up to retryBackoff*2^attempt, capped at
+// maxRetryBackoff.
+func (ch *MqtConsumerGroupHandler) backoff(attempt int) time.Duration {
+	d := ch.maxRetryBackoff
+	if attempt < 32 {
+		if exp := ch.retryBackoff << uint(attempt); exp > 0 && exp < d {
+			d = exp
 		}
 	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d))) + 1
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an
+// HTTP date. It returns 0 if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0
+	}
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
 }
 
-func errorHandler(logger *zap.Logger, trigger *fv1.MessageQueueTrigger, producer sarama.SyncProducer, funcUrl string, err error, errorTopicHeaders []sarama.RecordHeader) {
+// sleep waits for d, returning false if the context is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func errorHandler(logger *zap.Logger, trigger *fv1.MessageQueueTrigger, producer sarama.SyncProducer, funcUrl string, err error, errorTopicHeaders []sarama.RecordHeader) error {
 	if len(trigger.Spec.ErrorTopic) > 0 {
 		_, _, e := producer.SendMessage(&sarama.ProducerMessage{
 			Topic:   trigger.Spec.ErrorTopic,
@@ -264,9 +547,11 @@ func errorHandler(logger *zap.Logger, trigger *fv1.MessageQueueTrigger, producer
 				zap.String("trigger", trigger.ObjectMeta.Name),
 				zap.String("message", err.Error()),
 				zap.String("topic", trigger.Spec.Topic))
+			return e
 		}
 	} else {
 		logger.Error("message received to publish to error topic, but no error topic was set",
 			zap.String("message", err.Error()), zap.String("trigger", trigger.ObjectMeta.Name), zap.String("function_url", funcUrl))
 	}
+	return nil
 }
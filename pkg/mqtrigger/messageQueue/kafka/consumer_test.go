@@ -0,0 +1,352 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kafka
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/Shopify/sarama/mocks"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/publisher"
+)
+
+type fakeSession struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	marked []int64
+}
+
+func (s *fakeSession) Claims() map[string][]int32 { return nil }
+func (s *fakeSession) MemberID() string           { return "member" }
+func (s *fakeSession) GenerationID() int32        { return 1 }
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeSession) Commit() {}
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+}
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.marked = append(s.marked, msg.Offset)
+}
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) markedOffsets() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.marked...)
+}
+
+type fakeClaim struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *fakeClaim) Topic() string                            { return "input" }
+func (c *fakeClaim) Partition() int32                         { return 0 }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return int64(cap(c.messages)) }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func newClaim(values ...string) *fakeClaim {
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(values))}
+	for i, v := range values {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "input", Offset: int64(i), Value: []byte(v)}
+	}
+	close(claim.messages)
+	return claim
+}
+
+func newTestHandler(t *testing.T, server *httptest.Server, producer sarama.SyncProducer, maxRetries, maxInFlight int) MqtConsumerGroupHandler {
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "mqt", Namespace: "default"},
+		Spec: fv1.MessageQueueTriggerSpec{
+			FunctionReference: fv1.FunctionReference{Type: fv1.FunctionReferenceTypeFunctionName, Name: "hello"},
+			Topic:             "input",
+			ResponseTopic:     "output",
+			ErrorTopic:        "errors",
+			MaxRetries:        maxRetries,
+			ContentType:       "text/plain",
+		},
+	}
+	ch := NewMqtConsumerGroupHandler(sarama.V2_0_0_0, zap.NewNop(), trigger, producer, server.URL, maxInFlight)
+	ch.retryBackoff = time.Millisecond
+	ch.maxRetryBackoff = 10 * time.Millisecond
+	return ch
+}
+
+func consume(t *testing.T, ch MqtConsumerGroupHandler, claim *fakeClaim) *fakeSession {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+	if err := ch.ConsumeClaim(session, claim); err != nil {
+		t.Fatalf("ConsumeClaim returned error: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("ConsumeClaim did not return once the claim was drained")
+	}
+	return session
+}
+
+func assertMarked(t *testing.T, session *fakeSession, n int) {
+	t.Helper()
+	marked := session.markedOffsets()
+	if len(marked) != n {
+		t.Fatalf("expected %d marked offsets, got %v", n, marked)
+	}
+	for i, offset := range marked {
+		if offset != int64(i) {
+			t.Fatalf("offsets marked out of order: %v", marked)
+		}
+	}
+}
+
+func TestConsumeClaimInFlightWindow(t *testing.T) {
+	var inFlight, maxSeen int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt32(&maxSeen)
+			if n <= seen || atomic.CompareAndSwapInt32(&maxSeen, seen, n) {
+				break
+			}
+		}
+		body, _ := io.ReadAll(r.Body)
+		// finish the earlier messages last to exercise in order marking
+		i, _ := strconv.Atoi(string(body))
+		time.Sleep(time.Duration(5-i) * 10 * time.Millisecond)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	for i := 0; i < 5; i++ {
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			if msg.Topic != "output" {
+				return errors.Errorf("unexpected topic %q", msg.Topic)
+			}
+			return nil
+		})
+	}
+
+	ch := newTestHandler(t, server, producer, 0, 2)
+	session := consume(t, ch, newClaim("0", "1", "2", "3", "4"))
+	assertMarked(t, session, 5)
+	if maxSeen := atomic.LoadInt32(&maxSeen); maxSeen > 2 {
+		t.Fatalf("expected at most 2 invocations in flight, got %d", maxSeen)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumeClaimRetryAfter(t *testing.T) {
+	var attempts int32
+	var first time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("attempt got body %q", string(body))
+		}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			first = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if time.Since(first) < time.Second {
+			t.Errorf("retried after %v, before Retry-After elapsed", time.Since(first))
+		}
+		w.Header().Set("X-Result", "done")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		value, _ := msg.Value.Encode()
+		if msg.Topic != "output" || string(value) != "ok" {
+			return errors.Errorf("unexpected response %q on %q", string(value), msg.Topic)
+		}
+		for _, h := range msg.Headers {
+			if string(h.Key) == "X-Result" && string(h.Value) == "done" {
+				return nil
+			}
+		}
+		return errors.New("response headers were not published")
+	})
+
+	ch := newTestHandler(t, server, producer, 3, 1)
+	session := consume(t, ch, newClaim("payload"))
+	assertMarked(t, session, 1)
+	if attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", attempts)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumeClaimDeadLetter(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "payload" {
+			t.Errorf("attempt got body %q", string(body))
+		}
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	// the first dead-letter publish fails, the offset must not be marked until it succeeds
+	producer.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		if msg.Topic != "errors" {
+			return errors.Errorf("unexpected topic %q", msg.Topic)
+		}
+		for _, h := range msg.Headers {
+			if string(h.Key) == "MessageSource" && string(h.Value) == "input" {
+				return nil
+			}
+		}
+		return errors.New("missing MessageSource header")
+	})
+
+	ch := newTestHandler(t, server, producer, 2, 1)
+	session := consume(t, ch, newClaim("payload"))
+	assertMarked(t, session, 1)
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumeClaimSessionEnd(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	ch := newTestHandler(t, server, producer, 100, 1)
+	ch.retryBackoff = time.Second
+	ch.maxRetryBackoff = time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+	if err := ch.ConsumeClaim(session, newClaim("payload")); err != nil {
+		t.Fatalf("ConsumeClaim returned error: %v", err)
+	}
+	if marked := session.markedOffsets(); len(marked) != 0 {
+		t.Fatalf("expected no offset to be marked, got %v", marked)
+	}
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(10 * time.Second).Format(http.TimeFormat), 10 * time.Second},
+		{now.Add(-10 * time.Second).Format(http.TimeFormat), 0},
+		{"3600", maxRetryAfter},
+	} {
+		if got := parseRetryAfter(tc.value, now); got != tc.expected {
+			t.Errorf("parseRetryAfter(%q) = %v, expected %v", tc.value, got, tc.expected)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	ch := MqtConsumerGroupHandler{retryBackoff: 100 * time.Millisecond, maxRetryBackoff: time.Second}
+	for attempt := 0; attempt < 70; attempt++ {
+		d := ch.backoff(attempt)
+		limit := ch.maxRetryBackoff
+		if attempt < 4 {
+			limit = ch.retryBackoff << uint(attempt)
+		}
+		if d <= 0 || d > limit {
+			t.Fatalf("backoff(%d) = %v, expected within (0, %v]", attempt, d, limit)
+		}
+	}
+}
+
+func TestConsumeClaimCloudEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		expected := map[string]string{
+			"ce-specversion":            "1.0",
+			"ce-id":                     "input/0/0",
+			"ce-source":                 "/apis/fission.io/v1/namespaces/default/messagequeuetriggers/mqt",
+			"ce-type":                   "io.fission.messagequeuetrigger.message",
+			"ce-subject":                "input",
+			"ce-partition":              "0",
+			"ce-offset":                 "0",
+			"Content-Type":              "text/plain",
+			"X-Fission-Mqtrigger-Topic": "input",
+		}
+		for k, v := range expected {
+			if got := r.Header.Get(k); got != v {
+				t.Errorf("expected header %v %q, got %q", k, v, got)
+			}
+		}
+		if len(r.Header.Get("ce-time")) == 0 {
+			t.Error("missing ce-time header")
+		}
+		if string(body) != "payload" {
+			t.Errorf("expected the message as body, got %q", string(body))
+		}
+	}))
+	defer server.Close()
+
+	producer := mocks.NewSyncProducer(t, nil)
+	producer.ExpectSendMessageAndSucceed()
+
+	ch := newTestHandler(t, server, producer, 0, 1)
+	ch.cloudEvents = publisher.CloudEventsModeBinary
+	session := consume(t, ch, newClaim("payload"))
+	assertMarked(t, session, 1)
+	if err := producer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/Shopify/sarama"
 	"github.com/pkg/errors"
@@ -33,6 +34,7 @@ import (
 	"github.com/fission/fission/pkg/mqtrigger/factory"
 	"github.com/fission/fission/pkg/mqtrigger/messageQueue"
 	"github.com/fission/fission/pkg/mqtrigger/validator"
+	"github.com/fission/fission/pkg/publisher"
 )
 
 func init() {
@@ -46,6 +48,7 @@ var (
 
 	// Map for ErrorTopic messages to maintain recycle counter
 	errorMessageMap = make(map[string]int)
+	errorMessageMu  sync.Mutex
 )
 
 type (
@@ -56,6 +59,10 @@ type (
 		version   sarama.KafkaVersion
 		authKeys  map[string][]byte
 		tls       bool
+		// maxInFlight is the number of messages of a partition invoked concurrently
+		maxInFlight int
+		// cloudEvents is how messages are encoded as CloudEvents
+		cloudEvents publisher.CloudEventsMode
 	}
 
 	Factory struct{}
@@ -91,6 +98,20 @@ func New(logger *zap.Logger, mqCfg messageQueue.Config, routerUrl string) (messa
 		routerUrl: routerUrl,
 		brokers:   strings.Split(mqCfg.Url, ","),
 		version:   kafkaVersion,
+
+		maxInFlight: defaultMaxInFlight,
+		cloudEvents: publisher.CloudEventsModeFromEnv(logger),
+	}
+
+	if maxInFlight := os.Getenv("MESSAGE_QUEUE_KAFKA_MAX_IN_FLIGHT"); len(maxInFlight) > 0 {
+		n, err := strconv.Atoi(maxInFlight)
+		if err != nil || n < 1 {
+			logger.Warn("invalid MESSAGE_QUEUE_KAFKA_MAX_IN_FLIGHT, expected a positive integer - falling back to default",
+				zap.String("received", maxInFlight),
+				zap.Int("default", defaultMaxInFlight))
+		} else {
+			kafka.maxInFlight = n
+		}
 	}
 
 	if tls, _ := strconv.ParseBool(os.Getenv("TLS_ENABLED")); tls {
@@ -109,7 +130,7 @@ func New(logger *zap.Logger, mqCfg messageQueue.Config, routerUrl string) (messa
 	}
 
 	logger.Info("created kafka queue", zap.Any("kafka brokers", kafka.brokers),
-		zap.Any("kafka version", kafka.version))
+		zap.Any("kafka version", kafka.version), zap.Int("max in flight", kafka.maxInFlight))
 	return kafka, nil
 }
 
@@ -169,7 +190,8 @@ func (kafka Kafka) Subscribe(trigger *fv1.MessageQueueTrigger) (messageQueue.Sub
 	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
-	ch := NewMqtConsumerGroupHandler(kafka.version, kafka.logger, trigger, producer, kafka.routerUrl)
+	ch := NewMqtConsumerGroupHandler(kafka.version, kafka.logger, trigger, producer, kafka.routerUrl, kafka.maxInFlight)
+	ch.cloudEvents = kafka.cloudEvents
 
 	// consume messages
 	go func() {
@@ -0,0 +1,307 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/mqtrigger"
+	"github.com/fission/fission/pkg/mqtrigger/messageQueue"
+	"github.com/fission/fission/pkg/publisher"
+)
+
+const (
+	// payloadField is the field of stream entries holding the message
+	// body, the other fields are passed to the function as headers
+	payloadField = "payload"
+	// readBlock is how long reads wait for new messages, so the consumer
+	// notices when it is unsubscribed
+	readBlock = time.Second
+	// readCount is how many messages are read or reclaimed at once.
+	// Messages are handled one after another, so the ones read along
+	// would stay pending for longer than claimIdle behind slow invocations
+	// and get reclaimed by other consumers.
+	readCount = 1
+)
+
+type consumer struct {
+	logger    *zap.Logger
+	trigger   *fv1.MessageQueueTrigger
+	client    *goredis.Client
+	invoker   *messageQueue.Invoker
+	group     string
+	name      string
+	claimIdle time.Duration
+}
+
+// consumerInfo is a consumer of a consumer group as listed by XINFO
+// CONSUMERS.
+type consumerInfo struct {
+	name    string
+	pending int64
+	idle    time.Duration
+}
+
+func newConsumer(logger *zap.Logger, trigger *fv1.MessageQueueTrigger, client *goredis.Client,
+	group string, name string, claimIdle time.Duration, routerUrl string, cloudEvents publisher.CloudEventsMode) *consumer {
+	logger = logger.With(zap.String("trigger", trigger.ObjectMeta.Name), zap.String("topic", trigger.Spec.Topic))
+	return &consumer{
+		logger:  logger,
+		trigger: trigger,
+		client:  client,
+		// invocations time out before claimIdle, so that messages are
+		// acked before they are reclaimed
+		invoker:   messageQueue.MakeInvoker(logger, trigger, routerUrl, claimIdle*9/10, cloudEvents),
+		group:     group,
+		name:      name,
+		claimIdle: claimIdle,
+	}
+}
+
+// run reads new messages of the consumer group until ctx is done. Every
+// half claimIdle it reclaims the messages pending for longer than
+// claimIdle, whose consumer crashed or whose function failed, and removes
+// the consumers left behind by crashed managers.
+func (c *consumer) run(ctx context.Context) {
+	var lastClaim time.Time
+	for ctx.Err() == nil {
+		if time.Since(lastClaim) >= c.claimIdle/2 {
+			c.reclaim(ctx)
+			c.removeIdleConsumers(ctx)
+			lastClaim = time.Now()
+		}
+
+		streams, err := c.client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    c.group,
+			Consumer: c.name,
+			Streams:  []string{c.trigger.Spec.Topic, ">"},
+			Count:    readCount,
+			Block:    readBlock,
+		}).Result()
+		if err != nil {
+			if err == goredis.Nil || ctx.Err() != nil {
+				continue
+			}
+			c.logger.Error("error reading from stream", zap.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(readBlock):
+			}
+			continue
+		}
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				c.handle(ctx, msg, 1)
+			}
+		}
+	}
+}
+
+// reclaim takes over the messages pending for longer than claimIdle and
+// handles them again.
+func (c *consumer) reclaim(ctx context.Context) {
+	start := "0-0"
+	for {
+		msgs, next, err := c.client.XAutoClaim(ctx, &goredis.XAutoClaimArgs{
+			Stream:   c.trigger.Spec.Topic,
+			Group:    c.group,
+			MinIdle:  c.claimIdle,
+			Start:    start,
+			Count:    readCount,
+			Consumer: c.name,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.Error("error reclaiming pending messages", zap.Error(err))
+			}
+			return
+		}
+		for _, msg := range msgs {
+			c.handle(ctx, msg, c.deliveryCount(ctx, msg.ID))
+		}
+		if len(msgs) == 0 || next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+// removeIdleConsumers deletes the consumers of the group other than this
+// one which have no pending messages and have been idle for longer than
+// claimIdle. Consumers are named after the hosts of the managers, so every
+// restart would leave one behind otherwise.
+func (c *consumer) removeIdleConsumers(ctx context.Context) {
+	// the XINFO CONSUMERS reply differs between redis versions, it is
+	// parsed here instead of by the client
+	reply, err := c.client.Do(ctx, "XINFO", "CONSUMERS", c.trigger.Spec.Topic, c.group).Slice()
+	if err != nil {
+		if ctx.Err() == nil {
+			c.logger.Error("error listing consumers", zap.Error(err))
+		}
+		return
+	}
+	for _, info := range parseConsumerInfos(reply) {
+		if info.name == c.name || info.pending > 0 || info.idle <= c.claimIdle {
+			continue
+		}
+		err := c.client.XGroupDelConsumer(ctx, c.trigger.Spec.Topic, c.group, info.name).Err()
+		if err != nil {
+			c.logger.Error("error removing idle consumer", zap.Error(err), zap.String("consumer", info.name))
+			continue
+		}
+		c.logger.Info("removed idle consumer", zap.String("consumer", info.name), zap.Duration("idle", info.idle))
+	}
+}
+
+// parseConsumerInfos parses an XINFO CONSUMERS reply. Consumers whose idle
+// time is not reported are taken as active.
+func parseConsumerInfos(reply []interface{}) []consumerInfo {
+	var infos []consumerInfo
+	for _, entry := range reply {
+		fields, ok := entry.([]interface{})
+		if !ok {
+			continue
+		}
+		var info consumerInfo
+		for i := 0; i+1 < len(fields); i += 2 {
+			key, _ := fields[i].(string)
+			switch key {
+			case "name":
+				info.name, _ = fields[i+1].(string)
+			case "pending":
+				info.pending, _ = fields[i+1].(int64)
+			case "idle":
+				idle, _ := fields[i+1].(int64)
+				info.idle = time.Duration(idle) * time.Millisecond
+			}
+		}
+		if len(info.name) > 0 {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+// deliveryCount returns how many times the message has been delivered.
+func (c *consumer) deliveryCount(ctx context.Context, id string) int64 {
+	pending, err := c.client.XPendingExt(ctx, &goredis.XPendingExtArgs{
+		Stream: c.trigger.Spec.Topic,
+		Group:  c.group,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		c.logger.Warn("error getting delivery count of message", zap.Error(err), zap.String("id", id))
+		return 1
+	}
+	return pending[0].RetryCount
+}
+
+// handle invokes the function with a message. The message is acked once
+// the function succeeds and stays pending otherwise, to be reclaimed,
+// until it was delivered maxDeliver times; then the error is published to
+// the error stream.
+func (c *consumer) handle(ctx context.Context, msg goredis.XMessage, deliveries int64) {
+	body, header, err := c.invoke(msg)
+	if err == nil {
+		if len(c.trigger.Spec.ResponseTopic) > 0 {
+			c.publish(ctx, c.trigger.Spec.ResponseTopic, body, header)
+		}
+		c.ack(ctx, msg.ID)
+		mqtrigger.IncreaseMessageCount(c.trigger.ObjectMeta.Name, c.trigger.ObjectMeta.Namespace)
+		return
+	}
+
+	c.logger.Warn("function invocation failed",
+		zap.Error(err),
+		zap.String("function_url", c.invoker.FunctionURL()),
+		zap.String("id", msg.ID),
+		zap.Int64("delivery", deliveries))
+	if deliveries < c.invoker.MaxDeliver() {
+		return
+	}
+
+	c.invoker.DeadLetter(err, c.trigger.Spec.Topic, deliveries, func(topic string, data []byte, header http.Header) {
+		c.publish(ctx, topic, data, header)
+	})
+	// retries are exhausted, stop redelivering the message
+	c.ack(ctx, msg.ID)
+}
+
+// invoke calls the function with the message and returns the body and
+// headers of the response, or an error if the function did not return 2xx.
+func (c *consumer) invoke(msg goredis.XMessage) ([]byte, http.Header, error) {
+	// a message is identified by its stream entry id
+	m := &messageQueue.Message{
+		ID:     c.trigger.Spec.Topic + "/" + msg.ID,
+		Time:   entryTime(msg.ID),
+		Header: http.Header{},
+	}
+	for k, v := range msg.Values {
+		if k == payloadField {
+			m.Data = []byte(fmt.Sprint(v))
+		} else {
+			m.Header.Set(k, fmt.Sprint(v))
+		}
+	}
+	return c.invoker.Invoke(m)
+}
+
+// entryTime returns the time a stream entry was added, the milliseconds
+// part of its id, or zero if the id has another format.
+func entryTime(id string) time.Time {
+	ms, err := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+func (c *consumer) ack(ctx context.Context, id string) {
+	err := c.client.XAck(ctx, c.trigger.Spec.Topic, c.group, id).Err()
+	if err != nil {
+		c.logger.Error("failed to ack message", zap.Error(err), zap.String("id", id))
+	}
+}
+
+// publish adds a message to stream, with the headers as fields.
+func (c *consumer) publish(ctx context.Context, stream string, data []byte, header http.Header) {
+	values := map[string]interface{}{payloadField: string(data)}
+	for k, v := range header {
+		values[k] = strings.Join(v, ",")
+	}
+	err := c.client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: stream,
+		Values: values,
+	}).Err()
+	if err != nil {
+		c.logger.Warn("failed to publish message",
+			zap.Error(err),
+			zap.String("stream", stream),
+			zap.String("function_url", c.invoker.FunctionURL()))
+	}
+}
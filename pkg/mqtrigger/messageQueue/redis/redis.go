@@ -0,0 +1,224 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redis
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/mqtrigger/factory"
+	"github.com/fission/fission/pkg/mqtrigger/messageQueue"
+	"github.com/fission/fission/pkg/mqtrigger/validator"
+	"github.com/fission/fission/pkg/publisher"
+)
+
+func init() {
+	factory.Register(fv1.MessageQueueTypeRedis, &Factory{})
+	validator.Register(fv1.MessageQueueTypeRedis, IsTopicValid)
+}
+
+// defaultClaimIdle is how long a message stays pending before another
+// delivery is attempted, if MESSAGE_QUEUE_REDIS_CLAIM_IDLE is not set.
+// Function invocations time out shortly before it, and consumers idle for
+// longer without pending messages are removed.
+const defaultClaimIdle = 5 * time.Minute
+
+type (
+	Redis struct {
+		logger    *zap.Logger
+		routerUrl string
+		options   *goredis.Options
+		secrets   *messageQueue.TriggerSecrets
+		claimIdle time.Duration
+		// consumerName identifies the consumer of the manager in the
+		// consumer groups of triggers
+		consumerName string
+		// cloudEvents is how messages are encoded as CloudEvents
+		cloudEvents publisher.CloudEventsMode
+	}
+
+	Factory struct{}
+
+	Subscription struct {
+		cancel context.CancelFunc
+		done   chan struct{}
+		client *goredis.Client
+		stream string
+		group  string
+	}
+)
+
+func (factory *Factory) Create(logger *zap.Logger, mqCfg messageQueue.Config, routerUrl string) (messageQueue.MessageQueue, error) {
+	return New(logger, mqCfg, routerUrl)
+}
+
+func New(logger *zap.Logger, mqCfg messageQueue.Config, routerUrl string) (messageQueue.MessageQueue, error) {
+	if len(routerUrl) == 0 || len(mqCfg.Url) == 0 {
+		return nil, errors.New("the router URL or MQ URL is empty")
+	}
+
+	// the url is either a redis:// or rediss:// URL or the address of
+	// the server
+	options := &goredis.Options{Addr: mqCfg.Url}
+	if strings.Contains(mqCfg.Url, "://") {
+		var err error
+		options, err = goredis.ParseURL(mqCfg.Url)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing redis URL")
+		}
+	}
+
+	claimIdle := defaultClaimIdle
+	if s := os.Getenv("MESSAGE_QUEUE_REDIS_CLAIM_IDLE"); len(s) > 0 {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			logger.Warn("error parsing redis claim idle time - falling back to default",
+				zap.Error(err),
+				zap.String("claim_idle", s),
+				zap.Duration("default", defaultClaimIdle))
+		} else {
+			claimIdle = d
+		}
+	}
+
+	consumerName, err := os.Hostname()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting hostname for the consumer name")
+	}
+
+	r := &Redis{
+		logger:       logger.Named("redis"),
+		routerUrl:    routerUrl,
+		options:      options,
+		secrets:      messageQueue.MakeTriggerSecrets(mqCfg.Secrets, nil),
+		claimIdle:    claimIdle,
+		consumerName: consumerName,
+		cloudEvents:  publisher.CloudEventsModeFromEnv(logger),
+	}
+	logger.Info("created redis streams queue", zap.String("address", options.Addr),
+		zap.Duration("claim_idle", claimIdle), zap.String("consumer", consumerName))
+	return r, nil
+}
+
+func (r *Redis) Subscribe(trigger *fv1.MessageQueueTrigger) (messageQueue.Subscription, error) {
+	r.logger.Debug("inside redis subscribe", zap.Any("trigger", trigger))
+
+	ctx := context.Background()
+	client, err := r.newClient(ctx, trigger)
+	if err != nil {
+		return nil, err
+	}
+
+	// each trigger consumes the stream in a consumer group of its own,
+	// starting with the messages added after the group is created
+	group := groupName(trigger)
+	err = client.XGroupCreateMkStream(ctx, trigger.Spec.Topic, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		client.Close()
+		return nil, errors.Wrapf(err, "error creating consumer group of stream %v", trigger.Spec.Topic)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	c := newConsumer(r.logger, trigger, client, group, r.consumerName, r.claimIdle, r.routerUrl, r.cloudEvents)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.run(ctx)
+	}()
+
+	r.logger.Info("created a new consumer group", zap.String("address", r.options.Addr),
+		zap.String("topic", trigger.Spec.Topic),
+		zap.String("response topic", trigger.Spec.ResponseTopic),
+		zap.String("error topic", trigger.Spec.ErrorTopic),
+		zap.String("trigger", trigger.ObjectMeta.Name),
+		zap.String("function namespace", trigger.ObjectMeta.Namespace),
+		zap.String("function name", trigger.Spec.FunctionReference.Name))
+
+	return &Subscription{
+		cancel: cancel,
+		done:   done,
+		client: client,
+		stream: trigger.Spec.Topic,
+		group:  group,
+	}, nil
+}
+
+func (r *Redis) Unsubscribe(subscription messageQueue.Subscription) error {
+	s := subscription.(*Subscription)
+	s.cancel()
+	<-s.done
+	defer s.client.Close()
+	// the trigger is deleted, so is its consumer group
+	return s.client.XGroupDestroy(context.Background(), s.stream, s.group).Err()
+}
+
+// newClient connects to the server with the credentials of the trigger:
+// caCert, userCert and userKey for TLS, and username and password.
+func (r *Redis) newClient(ctx context.Context, trigger *fv1.MessageQueueTrigger) (*goredis.Client, error) {
+	secrets, err := r.secrets.Get(ctx, trigger)
+	if err != nil {
+		return nil, err
+	}
+
+	options := *r.options
+	tlsConfig, err := messageQueue.TLSConfig(r.logger, secrets)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		options.TLSConfig = tlsConfig
+	}
+	if len(secrets["password"]) > 0 {
+		options.Username = string(secrets["username"])
+		options.Password = string(secrets["password"])
+	}
+
+	client := goredis.NewClient(&options)
+	err = client.Ping(ctx).Err()
+	if err != nil {
+		client.Close()
+		return nil, errors.Wrapf(err, "error connecting to redis server %v", options.Addr)
+	}
+	return client, nil
+}
+
+// groupName returns the name of the consumer group of the trigger.
+func groupName(trigger *fv1.MessageQueueTrigger) string {
+	return "fission-" + string(trigger.ObjectMeta.UID)
+}
+
+// IsTopicValid checks the topic is a non empty stream key without
+// whitespace or control characters.
+func IsTopicValid(topic string) bool {
+	if len(topic) == 0 {
+		return false
+	}
+	for _, r := range topic {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,360 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redis
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/mqtrigger/messageQueue"
+	"github.com/fission/fission/pkg/publisher"
+	"github.com/fission/fission/pkg/utils/loggerfactory"
+)
+
+// waitFor polls cond until it holds or fails the test after 10s.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	t.Setenv("MESSAGE_QUEUE_REDIS_CLAIM_IDLE", "100ms")
+	ctx := context.Background()
+
+	s := miniredis.RunT(t)
+	s.RequireAuth("pw")
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr(), Password: "pw"})
+	defer client.Close()
+
+	var failures int32
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/fission-function/hello" || r.Header.Get("X-Fission-MQTrigger-Topic") != "orders" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if string(body) == "fail" {
+			atomic.AddInt32(&failures, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Order", r.Header.Get("X-Order"))
+		w.Write([]byte("processed " + string(body)))
+	}))
+	defer router.Close()
+
+	mq, err := New(loggerfactory.GetLogger(), messageQueue.Config{Url: "redis://" + s.Addr()}, router.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the credentials come from the secret of the trigger
+	mq.(*Redis).secrets = messageQueue.MakeTriggerSecrets(nil, fake.NewSimpleClientset(&apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis-creds", Namespace: metav1.NamespaceDefault},
+		Data:       map[string][]byte{"password": []byte("pw")},
+	}))
+
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: metav1.NamespaceDefault, UID: "3b0c6a52-8f1e-4c55-a8e4-2f8d1c5b9e07"},
+		Spec: fv1.MessageQueueTriggerSpec{
+			FunctionReference: fv1.FunctionReference{Type: fv1.FunctionReferenceTypeFunctionName, Name: "hello"},
+			MessageQueueType:  fv1.MessageQueueTypeRedis,
+			Topic:             "orders",
+			ResponseTopic:     "responses",
+			ErrorTopic:        "errors",
+			MaxRetries:        1,
+			Secret:            "redis-creds",
+		},
+	}
+
+	// a consumer of the group crashed with a message pending
+	group := groupName(trigger)
+	if err := client.XGroupCreateMkStream(ctx, "orders", group, "$").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.XAdd(ctx, &goredis.XAddArgs{Stream: "orders", Values: map[string]interface{}{payloadField: "crashed"}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.XReadGroup(ctx, &goredis.XReadGroupArgs{Group: group, Consumer: "dead", Streams: []string{"orders", ">"}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := mq.Subscribe(trigger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, values := range []map[string]interface{}{
+		{payloadField: "order", "X-Order": "42"},
+		{payloadField: "fail"},
+	} {
+		if err := client.XAdd(ctx, &goredis.XAddArgs{Stream: "orders", Values: values}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	waitFor(t, "all messages to be acked", func() bool {
+		pending, err := client.XPending(ctx, "orders", group).Result()
+		return err == nil && pending.Count == 0 && client.XLen(ctx, "errors").Val() == 1
+	})
+
+	responses, err := client.XRange(ctx, "responses", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, resp := range responses {
+		got[resp.Values[payloadField].(string)] = resp.Values["X-Order"].(string)
+	}
+	// the message of the crashed consumer is reclaimed
+	expected := map[string]string{"processed order": "42", "processed crashed": ""}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected responses %v, got %v", expected, got)
+	}
+
+	errs, err := client.XRange(ctx, "errors", "-", "+").Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0].Values["MessageSource"] != "orders" || errs[0].Values["RecycleCounter"] != "2" {
+		t.Fatalf("unexpected error message %v", errs[0].Values)
+	}
+	// the failing message is delivered once and retried once
+	if n := atomic.LoadInt32(&failures); n != 2 {
+		t.Fatalf("expected 2 deliveries of the failing message, got %d", n)
+	}
+
+	err = mq.Unsubscribe(sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups, err := client.XInfoGroups(ctx, "orders").Result(); err != nil || len(groups) != 0 {
+		t.Fatalf("expected the consumer group to be deleted, got %v, %v", groups, err)
+	}
+}
+
+func TestRedisAuth(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.RequireAuth("pw")
+
+	mq, err := New(loggerfactory.GetLogger(), messageQueue.Config{Url: s.Addr()}, "http://router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: metav1.NamespaceDefault, UID: "uid"},
+		Spec: fv1.MessageQueueTriggerSpec{
+			FunctionReference: fv1.FunctionReference{Type: fv1.FunctionReferenceTypeFunctionName, Name: "hello"},
+			Topic:             "orders",
+		},
+	}
+	if _, err := mq.Subscribe(trigger); err == nil {
+		t.Fatal("expected an error connecting without credentials")
+	}
+}
+
+func TestIsTopicValid(t *testing.T) {
+	for topic, valid := range map[string]bool{
+		"orders":        true,
+		"orders:eu-1":   true,
+		"":              false,
+		"orders eu":     false,
+		"orders\nother": false,
+	} {
+		if IsTopicValid(topic) != valid {
+			t.Errorf("expected IsTopicValid(%q) to be %v", topic, valid)
+		}
+	}
+}
+
+func TestEntryTime(t *testing.T) {
+	if got := entryTime("1654084800000-3"); !got.Equal(time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected entry time %v", got)
+	}
+	if got := entryTime("not-an-id"); !got.IsZero() {
+		t.Fatalf("expected a zero time for an invalid id, got %v", got)
+	}
+}
+
+func TestParseConsumerInfos(t *testing.T) {
+	infos := parseConsumerInfos([]interface{}{
+		// redis 7.2 adds the inactive time
+		[]interface{}{"name", "mqtrigger-a", "pending", int64(2), "idle", int64(1500), "inactive", int64(1500)},
+		// the idle time is not reported by every server
+		[]interface{}{"name", "mqtrigger-b", "pending", int64(0)},
+		[]interface{}{"pending", int64(1)},
+		"not-a-consumer",
+	})
+	expected := []consumerInfo{
+		{name: "mqtrigger-a", pending: 2, idle: 1500 * time.Millisecond},
+		{name: "mqtrigger-b"},
+	}
+	if !reflect.DeepEqual(infos, expected) {
+		t.Fatalf("expected consumers %v, got %v", expected, infos)
+	}
+}
+
+// idleHook reports every consumer listed by XINFO CONSUMERS as idle for an
+// hour, as miniredis does not report idle times.
+type idleHook struct{}
+
+func (idleHook) BeforeProcess(ctx context.Context, _ goredis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (idleHook) AfterProcess(_ context.Context, cmder goredis.Cmder) error {
+	cmd, ok := cmder.(*goredis.Cmd)
+	if !ok || cmd.Name() != "xinfo" || cmd.Err() != nil {
+		return nil
+	}
+	reply, _ := cmd.Val().([]interface{})
+	for i, entry := range reply {
+		fields, _ := entry.([]interface{})
+		reply[i] = append(fields, "idle", time.Hour.Milliseconds())
+	}
+	cmd.SetVal(reply)
+	return nil
+}
+
+func (idleHook) BeforeProcessPipeline(ctx context.Context, _ []goredis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (idleHook) AfterProcessPipeline(context.Context, []goredis.Cmder) error {
+	return nil
+}
+
+func TestRemoveIdleConsumers(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	defer client.Close()
+	client.AddHook(idleHook{})
+
+	stream, group := "orders", "fission-orders"
+	if err := client.XGroupCreateMkStream(ctx, stream, group, "$").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.XAdd(ctx, &goredis.XAddArgs{Stream: stream, Values: map[string]interface{}{"body": "a"}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	// busy holds a pending message, self is the consumer itself
+	if err := client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+		Group: group, Consumer: "busy", Streams: []string{stream, ">"}, Block: -1,
+	}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"self", "crashed"} {
+		if err := client.XGroupCreateConsumer(ctx, stream, group, name).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: metav1.NamespaceDefault},
+		Spec:       fv1.MessageQueueTriggerSpec{Topic: stream},
+	}
+	c := newConsumer(loggerfactory.GetLogger(), trigger, client, group, "self", time.Minute, "http://router", publisher.CloudEventsModeNone)
+	c.removeIdleConsumers(ctx)
+
+	reply, err := client.Do(ctx, "XINFO", "CONSUMERS", stream, group).Slice()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range parseConsumerInfos(reply) {
+		names = append(names, info.name)
+	}
+	if expected := []string{"busy", "self"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected consumers %v, got %v", expected, names)
+	}
+}
+
+func TestReadOneAtATime(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	var invocations int32
+	release := make(chan struct{})
+	router := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&invocations, 1) == 1 {
+			<-release
+		}
+	}))
+	defer router.Close()
+	// unblock the function before closing the router on failures
+	defer close(release)
+
+	stream, group := "orders", "fission-orders"
+	if err := client.XGroupCreateMkStream(ctx, stream, group, "$").Err(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := client.XAdd(ctx, &goredis.XAddArgs{Stream: stream, Values: map[string]interface{}{payloadField: "order"}}).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trigger := &fv1.MessageQueueTrigger{
+		ObjectMeta: metav1.ObjectMeta{Name: "orders", Namespace: metav1.NamespaceDefault},
+		Spec: fv1.MessageQueueTriggerSpec{
+			FunctionReference: fv1.FunctionReference{Type: fv1.FunctionReferenceTypeFunctionName, Name: "hello"},
+			Topic:             stream,
+		},
+	}
+	c := newConsumer(loggerfactory.GetLogger(), trigger, client, group, "self", time.Minute, router.URL, publisher.CloudEventsModeNone)
+	go c.run(ctx)
+
+	waitFor(t, "the first invocation", func() bool {
+		return atomic.LoadInt32(&invocations) == 1
+	})
+	// only the message being handled is pending, the others can be read
+	// by other consumers meanwhile
+	pending, err := client.XPending(ctx, stream, group).Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Count != 1 {
+		t.Fatalf("expected 1 pending message, got %d", pending.Count)
+	}
+	release <- struct{}{}
+
+	waitFor(t, "all messages to be acked", func() bool {
+		pending, err := client.XPending(ctx, stream, group).Result()
+		return err == nil && pending.Count == 0 && atomic.LoadInt32(&invocations) == 3
+	})
+}
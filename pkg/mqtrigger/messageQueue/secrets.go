@@ -0,0 +1,122 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package messageQueue
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/crd"
+)
+
+// TriggerSecrets returns the credentials message queues connect with for
+// a trigger: the data of the secret named by the trigger, or the secrets
+// mounted into the message queue trigger manager if the trigger names none.
+type TriggerSecrets struct {
+	defaults map[string][]byte
+
+	// kubeClient is created on first use, the manager only needs access
+	// to the Kubernetes API if triggers have secrets
+	lock       sync.Mutex
+	kubeClient kubernetes.Interface
+}
+
+// MakeTriggerSecrets returns the secrets of triggers, read with
+// kubeClient, or a client created on first use if it is nil.
+func MakeTriggerSecrets(defaults map[string][]byte, kubeClient kubernetes.Interface) *TriggerSecrets {
+	return &TriggerSecrets{
+		defaults:   defaults,
+		kubeClient: kubeClient,
+	}
+}
+
+func (s *TriggerSecrets) getKubeClient() (kubernetes.Interface, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.kubeClient == nil {
+		_, kubeClient, _, _, err := crd.MakeFissionClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating kubernetes client")
+		}
+		s.kubeClient = kubeClient
+	}
+	return s.kubeClient, nil
+}
+
+// Get returns the credentials of the trigger.
+func (s *TriggerSecrets) Get(ctx context.Context, trigger *fv1.MessageQueueTrigger) (map[string][]byte, error) {
+	if len(trigger.Spec.Secret) == 0 {
+		return s.defaults, nil
+	}
+	kubeClient, err := s.getKubeClient()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := kubeClient.CoreV1().Secrets(trigger.ObjectMeta.Namespace).Get(ctx, trigger.Spec.Secret, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting secret %v of trigger %v", trigger.Spec.Secret, trigger.ObjectMeta.Name)
+	}
+	return secret.Data, nil
+}
+
+// TLSConfig returns the TLS configuration for the caCert, userCert and
+// userKey in secrets, or nil if secrets have neither a CA nor a user
+// certificate. INSECURE_SKIP_VERIFY disables the verification of the
+// server certificate.
+func TLSConfig(logger *zap.Logger, secrets map[string][]byte) (*tls.Config, error) {
+	if len(secrets["caCert"]) == 0 && len(secrets["userCert"]) == 0 {
+		return nil, nil
+	}
+
+	tlsConfig := tls.Config{MinVersion: tls.VersionTLS12}
+	if len(secrets["userCert"]) > 0 {
+		cert, err := tls.X509KeyPair(secrets["userCert"], secrets["userKey"])
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if s := os.Getenv("INSECURE_SKIP_VERIFY"); len(s) > 0 {
+		skipVerify, err := strconv.ParseBool(s)
+		if err != nil {
+			logger.Error("failed to parse value of env variable INSECURE_SKIP_VERIFY taking default value false, expected boolean value: true/false",
+				zap.String("received", s))
+		} else {
+			tlsConfig.InsecureSkipVerify = skipVerify
+		}
+	}
+
+	if len(secrets["caCert"]) > 0 {
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(secrets["caCert"]) {
+			return nil, errors.New("error parsing the CA certificate")
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	return &tlsConfig, nil
+}
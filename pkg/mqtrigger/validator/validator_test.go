@@ -0,0 +1,48 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validator_test
+
+import (
+	"testing"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	_ "github.com/fission/fission/pkg/mqtrigger/messageQueue/jetstream"
+	_ "github.com/fission/fission/pkg/mqtrigger/messageQueue/kafka"
+	_ "github.com/fission/fission/pkg/mqtrigger/messageQueue/redis"
+	"github.com/fission/fission/pkg/mqtrigger/validator"
+)
+
+func TestIsValidMessageQueue(t *testing.T) {
+	for _, mqType := range []string{fv1.MessageQueueTypeKafka, fv1.MessageQueueTypeNatsJetStream, fv1.MessageQueueTypeRedis} {
+		if !validator.IsValidMessageQueue(mqType, "fission") {
+			t.Errorf("expected %v to be a valid message queue", mqType)
+		}
+	}
+	if validator.IsValidMessageQueue("aws-sqs-queue", "fission") {
+		t.Error("expected aws-sqs-queue to be a keda message queue only")
+	}
+	if !validator.IsValidMessageQueue(fv1.MessageQueueTypeRedis, "keda") {
+		t.Error("expected redis to be a valid keda message queue")
+	}
+
+	if !validator.IsValidTopic(fv1.MessageQueueTypeRedis, "orders:eu", "fission") {
+		t.Error("expected a valid redis stream")
+	}
+	if validator.IsValidTopic(fv1.MessageQueueTypeNatsJetStream, "orders..created", "fission") {
+		t.Error("expected an invalid nats subject")
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"go.uber.org/zap"
+)
+
+// CloudEventsMode is how trigger originated invocations are encoded as
+// CloudEvents 1.0 over HTTP, none if empty.
+type CloudEventsMode string
+
+const (
+	// CloudEventsModeNone keeps the trigger specific headers and body.
+	CloudEventsModeNone CloudEventsMode = ""
+	// CloudEventsModeBinary carries the event attributes in ce- headers and
+	// the event data as the body.
+	CloudEventsModeBinary CloudEventsMode = "binary"
+	// CloudEventsModeStructured carries the whole event as an
+	// application/cloudevents+json body.
+	CloudEventsModeStructured CloudEventsMode = "structured"
+
+	// CloudEventsModeEnv is the environment variable the components read
+	// the mode from.
+	CloudEventsModeEnv = "CLOUDEVENTS_MODE"
+
+	CloudEventsSpecVersion = "1.0"
+
+	// Event types of the invocations originated by triggers.
+	CloudEventTypeTimer           = "io.fission.timetrigger.fired"
+	CloudEventTypeKubeWatchPrefix = "io.fission.kuberneteswatchtrigger."
+	CloudEventTypeMessage         = "io.fission.messagequeuetrigger.message"
+
+	contentTypeCloudEvents      = "application/cloudevents+json"
+	contentTypeCloudEventsBatch = "application/cloudevents-batch+json"
+)
+
+// CloudEventsModeFromEnv returns the mode set in CLOUDEVENTS_MODE, none if
+// it's unset or invalid.
+func CloudEventsModeFromEnv(logger *zap.Logger) CloudEventsMode {
+	mode := CloudEventsMode(strings.ToLower(strings.TrimSpace(os.Getenv(CloudEventsModeEnv))))
+	switch mode {
+	case CloudEventsModeNone, CloudEventsModeBinary, CloudEventsModeStructured:
+		return mode
+	default:
+		logger.Warn("unsupported CloudEvents mode, CloudEvents encoding disabled",
+			zap.String("env", CloudEventsModeEnv),
+			zap.String("mode", string(mode)))
+		return CloudEventsModeNone
+	}
+}
+
+// CloudEventSource returns the source of the events of a trigger, the
+// reference of the trigger in the Kubernetes API, e.g.
+// /apis/fission.io/v1/namespaces/default/timetriggers/hourly.
+func CloudEventSource(resource string, namespace string, name string) string {
+	return fmt.Sprintf("/apis/fission.io/v1/namespaces/%s/%s/%s", namespace, resource, name)
+}
+
+// CloudEvent is an event along with its context attributes.
+type CloudEvent struct {
+	ID              string
+	Source          string
+	Type            string
+	Subject         string
+	Time            time.Time
+	DataContentType string
+	Data            []byte
+	// Extensions are extension context attributes, names must be lower
+	// case letters and digits.
+	Extensions map[string]string
+}
+
+// NewCloudEvent returns an event with a random id, happening now.
+func NewCloudEvent(source string, eventType string, data []byte, contentType string) *CloudEvent {
+	return &CloudEvent{
+		ID:              uuid.Must(uuid.NewV4()).String(),
+		Source:          source,
+		Type:            eventType,
+		Time:            time.Now().UTC(),
+		DataContentType: contentType,
+		Data:            data,
+	}
+}
+
+// Encode returns the body and headers of an HTTP request carrying the event
+// in the given mode. In none mode only the data is returned.
+func (e *CloudEvent) Encode(mode CloudEventsMode) ([]byte, map[string]string, error) {
+	headers := make(map[string]string)
+	switch mode {
+	case CloudEventsModeNone:
+		if len(e.DataContentType) > 0 {
+			headers["Content-Type"] = e.DataContentType
+		}
+		return e.Data, headers, nil
+	case CloudEventsModeBinary:
+		for k, v := range e.attributes() {
+			if k == "datacontenttype" {
+				headers["Content-Type"] = v
+				continue
+			}
+			headers["ce-"+k] = v
+		}
+		return e.Data, headers, nil
+	case CloudEventsModeStructured:
+		body, err := json.Marshal(e.structured())
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "error encoding CloudEvent")
+		}
+		headers["Content-Type"] = contentTypeCloudEvents
+		return body, headers, nil
+	default:
+		return nil, nil, errors.Errorf("unsupported CloudEvents mode %q", mode)
+	}
+}
+
+// PublishCloudEvent publishes the event to the target in the given mode. The
+// headers are sent along, the ones of the event encoding take precedence.
+func PublishCloudEvent(p Publisher, mode CloudEventsMode, e *CloudEvent, headers map[string]string, target string) error {
+	body, eventHeaders, err := e.Encode(mode)
+	if err != nil {
+		return err
+	}
+	merged := make(map[string]string, len(headers)+len(eventHeaders))
+	for k, v := range headers {
+		merged[k] = v
+	}
+	for k, v := range eventHeaders {
+		merged[k] = v
+	}
+	p.Publish(string(body), merged, target)
+	return nil
+}
+
+// EncodeCloudEventsBatch returns the body and content type of an HTTP request
+// carrying events in the structured batch format.
+func EncodeCloudEventsBatch(events []*CloudEvent) ([]byte, string, error) {
+	batch := make([]map[string]interface{}, 0, len(events))
+	for _, e := range events {
+		batch = append(batch, e.structured())
+	}
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "error encoding CloudEvents batch")
+	}
+	return body, contentTypeCloudEventsBatch, nil
+}
+
+// attributes returns the context attributes of the event, as strings.
+func (e *CloudEvent) attributes() map[string]string {
+	attrs := make(map[string]string, len(e.Extensions)+7)
+	for k, v := range e.Extensions {
+		attrs[k] = v
+	}
+	attrs["specversion"] = CloudEventsSpecVersion
+	attrs["id"] = e.ID
+	attrs["source"] = e.Source
+	attrs["type"] = e.Type
+	if !e.Time.IsZero() {
+		attrs["time"] = e.Time.UTC().Format(time.RFC3339Nano)
+	}
+	if len(e.Subject) > 0 {
+		attrs["subject"] = e.Subject
+	}
+	if len(e.DataContentType) > 0 {
+		attrs["datacontenttype"] = e.DataContentType
+	}
+	return attrs
+}
+
+// structured returns the event in the JSON event format. JSON data is
+// embedded as is, other text data as a string and binary data base64 encoded.
+func (e *CloudEvent) structured() map[string]interface{} {
+	event := make(map[string]interface{})
+	for k, v := range e.attributes() {
+		event[k] = v
+	}
+	switch {
+	case len(e.Data) == 0:
+	case isJSONContentType(e.DataContentType) && json.Valid(e.Data):
+		event["data"] = json.RawMessage(e.Data)
+	case utf8.Valid(e.Data):
+		event["data"] = string(e.Data)
+	default:
+		// []byte values are marshalled base64 encoded
+		event["data_base64"] = e.Data
+	}
+	return event
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return len(mediaType) == 0 || mediaType == "application/json" || mediaType == "text/json" ||
+		strings.HasSuffix(mediaType, "+json")
+}
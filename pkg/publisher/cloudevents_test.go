@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package publisher
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type recordingPublisher struct {
+	body    string
+	headers map[string]string
+	target  string
+}
+
+func (p *recordingPublisher) Publish(body string, headers map[string]string, target string) {
+	p.body, p.headers, p.target = body, headers, target
+}
+
+func testEvent(data []byte, contentType string) *CloudEvent {
+	return &CloudEvent{
+		ID:              "42",
+		Source:          CloudEventSource("timetriggers", "default", "hourly"),
+		Type:            CloudEventTypeTimer,
+		Subject:         "subject",
+		Time:            time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+		DataContentType: contentType,
+		Data:            data,
+		Extensions:      map[string]string{"partition": "3"},
+	}
+}
+
+func TestCloudEventEncodeBinary(t *testing.T) {
+	body, headers, err := testEvent([]byte(`{"a":1}`), "application/json").Encode(CloudEventsModeBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != `{"a":1}` {
+		t.Fatalf("expected the data as body, got %q", string(body))
+	}
+	expected := map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          "42",
+		"ce-source":      "/apis/fission.io/v1/namespaces/default/timetriggers/hourly",
+		"ce-type":        "io.fission.timetrigger.fired",
+		"ce-time":        "2022-06-01T12:00:00Z",
+		"ce-subject":     "subject",
+		"ce-partition":   "3",
+		"Content-Type":   "application/json",
+	}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Fatalf("expected headers %v, got %v", expected, headers)
+	}
+}
+
+func TestCloudEventEncodeStructured(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		data        []byte
+		contentType string
+		key         string
+		expected    interface{}
+	}{
+		{"json", []byte(`{"a":1}`), "application/json", "data", map[string]interface{}{"a": float64(1)}},
+		{"text", []byte("hello"), "text/plain", "data", "hello"},
+		{"invalid json", []byte("{"), "application/json", "data", "{"},
+		{"binary", []byte{0xff, 0x00}, "application/octet-stream", "data_base64", "/wA="},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body, headers, err := testEvent(tc.data, tc.contentType).Encode(CloudEventsModeStructured)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if headers["Content-Type"] != "application/cloudevents+json" || len(headers) != 1 {
+				t.Fatalf("unexpected headers %v", headers)
+			}
+			var event map[string]interface{}
+			if err := json.Unmarshal(body, &event); err != nil {
+				t.Fatal(err)
+			}
+			if event["specversion"] != "1.0" || event["id"] != "42" || event["type"] != CloudEventTypeTimer ||
+				event["datacontenttype"] != tc.contentType || event["partition"] != "3" {
+				t.Fatalf("unexpected event %v", event)
+			}
+			if !reflect.DeepEqual(event[tc.key], tc.expected) {
+				t.Fatalf("expected %v %v, got %v", tc.key, tc.expected, event[tc.key])
+			}
+		})
+	}
+}
+
+func TestCloudEventEncodeNone(t *testing.T) {
+	body, headers, err := testEvent([]byte("hello"), "text/plain").Encode(CloudEventsModeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello" || !reflect.DeepEqual(headers, map[string]string{"Content-Type": "text/plain"}) {
+		t.Fatalf("expected the data alone, got %q %v", string(body), headers)
+	}
+
+	_, headers, err = testEvent(nil, "").Encode(CloudEventsModeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 0 {
+		t.Fatalf("expected no headers, got %v", headers)
+	}
+
+	if _, _, err := testEvent(nil, "").Encode("xml"); err == nil {
+		t.Fatal("expected an error for an unsupported mode")
+	}
+}
+
+func TestEncodeCloudEventsBatch(t *testing.T) {
+	body, contentType, err := EncodeCloudEventsBatch([]*CloudEvent{
+		testEvent([]byte(`{"a":1}`), "application/json"),
+		testEvent([]byte("hello"), "text/plain"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/cloudevents-batch+json" {
+		t.Fatalf("unexpected content type %q", contentType)
+	}
+	var events []map[string]interface{}
+	if err := json.Unmarshal(body, &events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1]["data"] != "hello" {
+		t.Fatalf("unexpected batch %v", events)
+	}
+}
+
+func TestPublishCloudEvent(t *testing.T) {
+	p := &recordingPublisher{}
+	headers := map[string]string{"X-Fission-Timer-Name": "hourly", "Content-Type": "text/plain"}
+	err := PublishCloudEvent(p, CloudEventsModeStructured, testEvent(nil, ""), headers, "/fission-function/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.target != "/fission-function/hello" || p.headers["X-Fission-Timer-Name"] != "hourly" ||
+		p.headers["Content-Type"] != "application/cloudevents+json" {
+		t.Fatalf("unexpected publish %+v", p)
+	}
+	if headers["Content-Type"] != "text/plain" {
+		t.Fatal("the headers passed in were modified")
+	}
+}
+
+func TestCloudEventsModeFromEnv(t *testing.T) {
+	for value, expected := range map[string]CloudEventsMode{
+		"":           CloudEventsModeNone,
+		"binary":     CloudEventsModeBinary,
+		"Structured": CloudEventsModeStructured,
+		"xml":        CloudEventsModeNone,
+	} {
+		t.Setenv(CloudEventsModeEnv, value)
+		if mode := CloudEventsModeFromEnv(zap.NewNop()); mode != expected {
+			t.Errorf("CloudEventsModeFromEnv with %q = %q, expected %q", value, mode, expected)
+		}
+	}
+}
@@ -19,6 +19,7 @@ package router
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
@@ -27,6 +28,7 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -42,6 +44,7 @@ import (
 	"github.com/fission/fission/pkg/throttler"
 	"github.com/fission/fission/pkg/utils"
 	otelUtils "github.com/fission/fission/pkg/utils/otel"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 )
 
 const (
@@ -95,18 +98,35 @@ type (
 		funcTimeout      time.Duration
 		closeContextFunc *context.CancelFunc
 		serviceURL       *url.URL
+		podURL           *url.URL
 		urlFromCache     bool
 		totalRetry       int
 	}
 
+	// releasingReadCloser releases the function pod a response comes from once the response body is closed.
+	releasingReadCloser struct {
+		io.ReadCloser
+		release  func()
+		released int32
+	}
+
 	// To keep the request body open during retries, we create an interface with Close operation being a no-op.
 	// Details : https://github.com/flynn/flynn/pull/875
 	fakeCloseReadCloser struct {
 		io.ReadCloser
 	}
 
+	// executorServiceEntry is the service of a function returned by executor.
+	executorServiceEntry struct {
+		svcURL     *url.URL
+		podURLs    []*url.URL
+		generation int64
+		ttl        time.Duration
+	}
+
 	svcEntryRecord struct {
 		svcURL   *url.URL
+		podURL   *url.URL
 		cacheHit bool
 	}
 )
@@ -116,6 +136,13 @@ func init() {
 	rand.Seed(time.Now().UnixNano())
 }
 
+func (r *releasingReadCloser) Close() error {
+	if atomic.CompareAndSwapInt32(&r.released, 0, 1) {
+		r.release()
+	}
+	return r.ReadCloser.Close()
+}
+
 func (w *fakeCloseReadCloser) Close() error {
 	return nil
 }
@@ -215,7 +242,6 @@ func (roundTripper *RetryingRoundTripper) RoundTrip(req *http.Request) (*http.Re
 			logger.Debug("round tripper response", zap.String("response", string(respMsg)))
 		}
 	}
-    svcType:=fv1.SVCTypeName
 	for i := 0; i < roundTripper.funcHandler.tsRoundTripperParams.maxRetries; i++ {
 		// set service url of target service of request only when
 		// trying to get new service url from cache/executor.
@@ -224,12 +250,9 @@ func (roundTripper *RetryingRoundTripper) RoundTrip(req *http.Request) (*http.Re
 				"function-name":      fnMeta.Name,
 				"function-namespace": fnMeta.Namespace})...)
 			// get function service url from cache or executor
-			if svcType==fv1.SVCTypeName{
-				roundTripper.serviceURL, roundTripper.urlFromCache, svcType,err = roundTripper.funcHandler.getServiceEntry(ctx,fv1.SVCTypeName)
-			}else{
-				roundTripper.serviceURL, roundTripper.urlFromCache, svcType,err = roundTripper.funcHandler.getServiceEntry(ctx,fv1.SVCTypePodIP)
-			}
-			
+			var record svcEntryRecord
+			record, err = roundTripper.funcHandler.getServiceEntry(ctx, req)
+			roundTripper.serviceURL, roundTripper.podURL, roundTripper.urlFromCache = record.svcURL, record.podURL, record.cacheHit
 			if err != nil {
 				// We might want a specific error code or header for fission failures as opposed to
 				// user function bugs.
@@ -249,6 +272,11 @@ func (roundTripper *RetryingRoundTripper) RoundTrip(req *http.Request) (*http.Re
 						Header:        make(http.Header),
 					}, nil
 				}
+				// The executor answers 503 when the function did not become
+				// ready within its specialization timeout, relay it as-is.
+				if statusCode == http.StatusServiceUnavailable {
+					return nil, err
+				}
 				return nil, ferror.MakeError(http.StatusInternalServerError, err.Error())
 			}
 			if roundTripper.serviceURL == nil {
@@ -269,8 +297,12 @@ func (roundTripper *RetryingRoundTripper) RoundTrip(req *http.Request) (*http.Re
 
 			// modify the request to reflect the service url
 			// this service url comes from executor response
-			req.URL.Scheme = roundTripper.serviceURL.Scheme
-			req.URL.Host = roundTripper.serviceURL.Host
+			targetURL := roundTripper.serviceURL
+			if roundTripper.podURL != nil {
+				targetURL = roundTripper.podURL
+			}
+			req.URL.Scheme = targetURL.Scheme
+			req.URL.Host = targetURL.Host
 			// With addition of routing support from functions if function supports routing,
 			// 1. we trim prefix url and forward request
 			// 2. otherwise we just keep default request to root path
@@ -295,6 +327,12 @@ func (roundTripper *RetryingRoundTripper) RoundTrip(req *http.Request) (*http.Re
 			} else {
 				req.URL.Path = "/"
 			}
+			// functions sharing a wasm host are served under a route
+			// prefix of the host, which is already there on retries
+			if servicePath := strings.TrimSuffix(targetURL.Path, "/"); servicePath != "" &&
+				!strings.HasPrefix(req.URL.Path, servicePath+"/") {
+				req.URL.Path = servicePath + req.URL.Path
+			}
 
 			logger.Debug("function invoke url",
 				zap.String("prefixTrim", prefixTrim),
@@ -303,9 +341,7 @@ func (roundTripper *RetryingRoundTripper) RoundTrip(req *http.Request) (*http.Re
 			// Overwrite request host with internal host,
 			// or request will be blocked in some situations
 			// (e.g. istio-proxy)
-			req.Host = roundTripper.serviceURL.Host
-			// req.Host =  podAddress.Host
-			logger.Info("+++++********service url is ", zap.String("serviceURL", req.URL.Host))
+			req.Host = targetURL.Host
 		}
 
 		// over-riding default settings.
@@ -330,14 +366,26 @@ func (roundTripper *RetryingRoundTripper) RoundTrip(req *http.Request) (*http.Re
 			"function-url":       newReq.URL.String(),
 			"retryCounter":       fmt.Sprintf("%d", retryCounter)})...)
 		otelRoundTripper := otelhttp.NewTransport(transport)
+		// count the requests in flight to a function pod for the
+		// least-outstanding load balancer.
+		endpoint := roundTripper.funcHandler.fmap.lookupPodEndpoint(string(roundTripper.funcHandler.function.UID), newReq.URL.Host)
+		if endpoint != nil {
+			endpoint.acquire()
+		}
 		resp, err := otelRoundTripper.RoundTrip(newReq)
 		if roundTripper.funcHandler.isDebugEnv {
 			dumpRespFunc(resp)
 		}
 		if err == nil {
+			if endpoint != nil {
+				resp.Body = &releasingReadCloser{ReadCloser: resp.Body, release: endpoint.release}
+			}
 			// return response back to user
 			return resp, nil
 		}
+		if endpoint != nil {
+			endpoint.release()
+		}
 
 		roundTripper.totalRetry++
 
@@ -369,6 +417,12 @@ func (roundTripper *RetryingRoundTripper) RoundTrip(req *http.Request) (*http.Re
 			resp.Body.Close()
 		}
 
+		// stop sending requests to a function pod which can't be reached,
+		// load balancers pick another pod in the next loop.
+		if endpoint != nil {
+			endpoint.markUnhealthy()
+		}
+
 		// Check whether an error is an timeout error ("dial tcp i/o timeout").
 		if isNetTimeoutErr {
 			logger.Debug("request errored out - backing off before retrying",
@@ -492,6 +546,7 @@ func (fh functionHandler) handler(responseWriter http.ResponseWriter, request *h
 		Transport:    rrt,
 		ErrorHandler: fh.getProxyErrorHandler(start, rrt),
 		ModifyResponse: func(resp *http.Response) error {
+			fh.collectWasmUsage(resp)
 			go fh.collectFunctionMetric(start, rrt, request, resp)
 			return nil
 		},
@@ -629,33 +684,32 @@ func (fh functionHandler) getServiceEntryFromCache() (serviceUrl *url.URL, err e
 	}
 	return serviceUrl, nil
 }
-// getPodIPEntryFromCache returns pod ip url entry returns from cache
-func (fh functionHandler) getPodIPEntryFromCache() (podUrl *url.URL, err error) {
-	// cache lookup to get serviceUrl
-	podUrl, err = fh.fmap.lookuppodip(string(fh.function.UID))
-	if err != nil {
-		var errMsg string
 
+// getPodIPEntryFromCache returns the url of a function pod picked by the load
+// balancer of the http trigger, or nil if no healthy pod is known.
+func (fh functionHandler) getPodIPEntryFromCache(req *http.Request) (podUrl *url.URL, err error) {
+	var lbConfig *fv1.LoadBalancerConfig
+	if fh.httpTrigger != nil {
+		lbConfig = fh.httpTrigger.Spec.LoadBalancer
+	}
+	endpoint, err := fh.fmap.lookuppodip(string(fh.function.UID), makeLoadBalancer(lbConfig), req)
+	if err != nil {
 		e, ok := err.(ferror.Error)
-		if !ok {
-			errMsg = fmt.Sprintf("Unknown error when looking up service entry: %v", err)
-		} else {
-			// Ignore ErrorNotFound error here, it's an expected error,
-			// roundTripper will try to get service url later.
-			if e.Code == ferror.ErrorNotFound {
-				return nil, nil
-			}
-			errMsg = fmt.Sprintf("Error getting function %v;s pod ip service entry from cache: %v", fh.function.ObjectMeta.Name, err)
+		if !ok || e.Code != ferror.ErrorNotFound {
+			errMsg := fmt.Sprintf("Error getting function %v;s pod ip service entry from cache: %v", fh.function.ObjectMeta.Name, err)
+			return nil, ferror.MakeError(http.StatusInternalServerError, errMsg)
 		}
-		return nil, ferror.MakeError(http.StatusInternalServerError, errMsg)
 	}
-	return podUrl, nil
+	if endpoint == nil {
+		return nil, nil
+	}
+	return endpoint.url, nil
 }
 
 // addServiceEntryToCache add service url entry to cache
-func (fh functionHandler) addServiceEntryToCache(serviceURL *url.URL,podURL *url.URL) {
-	fh.fmap.assign(&fh.function.ObjectMeta, serviceURL)
-	fh.fmap.assignpodip(string(fh.function.UID), podURL)
+func (fh functionHandler) addServiceEntryToCache(entry *executorServiceEntry) {
+	fh.fmap.assign(&fh.function.ObjectMeta, entry.svcURL)
+	fh.fmap.assignpodip(string(fh.function.UID), entry.podURLs, entry.generation, entry.ttl)
 }
 
 // removeServiceEntryFromCache removes service url entry from cache
@@ -670,7 +724,7 @@ func (fh functionHandler) removeServiceEntryFromCache() {
 	}
 }
 
-func (fh functionHandler) getServiceEntryFromExecutor(ctx context.Context) (serviceUrl *url.URL, PodUrl *url.URL,err error) {
+func (fh functionHandler) getServiceEntryFromExecutor(ctx context.Context) (*executorServiceEntry, error) {
 	logger := otelUtils.LoggerWithTraceID(ctx, fh.logger)
 	// send a request to executor to specialize a new pod
 	fh.logger.Debug("function timeout specified", zap.Int("timeout", fh.function.Spec.FunctionTimeout))
@@ -685,7 +739,7 @@ func (fh functionHandler) getServiceEntryFromExecutor(ctx context.Context) (serv
 		fContext = ctx
 	}
 
-	address, err := fh.executor.GetServiceForFunction(fContext, fh.function)
+	svc, err := fh.executor.GetServiceForFunction(fContext, fh.function)
 	if err != nil {
 		statusCode, errMsg := ferror.GetHTTPError(err)
 		logger.Error("error from GetServiceForFunction",
@@ -693,67 +747,54 @@ func (fh functionHandler) getServiceEntryFromExecutor(ctx context.Context) (serv
 			zap.String("error_message", errMsg),
 			zap.Any("function", fh.function),
 			zap.Int("status_code", statusCode))
-		return nil, nil,err
-	}
-	// parse the address into url
-    result := strings.Split(address, ",")
-	if len(result)<1{
-		logger.Error("error getting service url, len of addres should equal 2",
-			zap.Error(err))
-		return nil, nil,err
+		return nil, err
 	}
-	svcURL, err := url.Parse(fmt.Sprintf("http://%v", result[0]))
+	svcURL, err := url.Parse(fmt.Sprintf("http://%v", svc.Address))
 	if err != nil {
 		logger.Error("error parsing service url",
 			zap.Error(err),
-			zap.String("service_url", svcURL.String()))
-		return nil, nil,err
+			zap.String("service_url", svc.Address))
+		return nil, err
+	}
+	entry := &executorServiceEntry{
+		svcURL:     svcURL,
+		generation: svc.CacheGeneration,
+		ttl:        time.Duration(svc.TTLSeconds) * time.Second,
 	}
-	if len(result)==2&&result[1]!=""{
-		PodUrl,err= url.Parse(fmt.Sprintf("http://%v", result[1]))
+	for _, endpoint := range svc.PodEndpoints {
+		podURL, err := url.Parse(fmt.Sprintf("http://%v", endpoint))
 		if err != nil {
-			logger.Error("error parsing Pod url",
+			logger.Error("error parsing pod url",
 				zap.Error(err),
-				zap.String("service_url", PodUrl.String()))
-			return nil, nil,err
+				zap.String("pod_url", endpoint))
+			return nil, err
 		}
-		return svcURL, PodUrl,err
+		entry.podURLs = append(entry.podURLs, podURL)
 	}
-	return svcURL, svcURL,err
+	return entry, nil
 }
 
-// getServiceEntryFromExecutor returns service url entry returns from executor
-func (fh functionHandler) getServiceEntry(ctx context.Context,serviceType string) (svcURL *url.URL,cacheHit bool,svcType string,err error) {
-	var svc *url.URL
+// getServiceEntry returns the service url of the function from cache or
+// executor. Requests to wasm functions go to a pod of the function picked by
+// the load balancer of the http trigger, and to the service url only while no
+// healthy pod is known.
+func (fh functionHandler) getServiceEntry(ctx context.Context, req *http.Request) (svcEntryRecord, error) {
 	if fh.function.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType == fv1.ExecutorTypePoolmgr {
-		svcURL,_,err = fh.getServiceEntryFromExecutor(ctx)
-		return svcURL,false,fv1.SVCTypeName, err
+		entry, err := fh.getServiceEntryFromExecutor(ctx)
+		if err != nil {
+			return svcEntryRecord{}, err
+		}
+		return svcEntryRecord{svcURL: entry.svcURL}, nil
 	}
-	firstTime:=false
+
 	// Check if service URL present in cache
-	svcURL, err = fh.getServiceEntryFromCache()
-	if err == nil {
-		if svcURL != nil {
-			if serviceType==fv1.SVCTypeName{
-				return svcURL,  true, fv1.SVCTypeName,nil
-			}else{
-				firstTime=false
-			}
-		}else {
-			firstTime=true
-			serviceType=fv1.SVCTypePodIP
-		}		
-	} else if err != nil {
-		return nil,  false, fv1.SVCTypeName,err
+	svcURL, err := fh.getServiceEntryFromCache()
+	if err != nil {
+		return svcEntryRecord{}, err
 	}
-
-	if serviceType==fv1.SVCTypePodIP && firstTime!=true{
-		svcURL, err := fh.getPodIPEntryFromCache()
-		if err != nil {
-			return nil, false,fv1.SVCTypeName,err
-		}else{
-			return svcURL,true,fv1.SVCTypePodIP,err
-		}
+	// ask executor again once the pod endpoints outlived the TTL it suggested
+	if svcURL != nil && !fh.fmap.podIPExpired(string(fh.function.UID)) {
+		return fh.makeServiceEntryRecord(req, svcURL, true)
 	}
 
 	fnMeta := &fh.function.ObjectMeta
@@ -761,29 +802,42 @@ func (fh functionHandler) getServiceEntry(ctx context.Context,serviceType string
 		crd.CacheKey(fnMeta),
 		func(firstToTheLock bool) (interface{}, error) {
 			if !firstToTheLock {
-				svcURL, err := fh.getPodIPEntryFromCache()
+				svcURL, err := fh.getServiceEntryFromCache()
 				if err != nil {
 					return nil, err
 				}
-				return svcEntryRecord{svcURL: svcURL, cacheHit: true}, err
+				return fh.makeServiceEntryRecord(req, svcURL, true)
 			}
-			svc, svcURL,err = fh.getServiceEntryFromExecutor(ctx)
+			entry, err := fh.getServiceEntryFromExecutor(ctx)
 			if err != nil {
 				return nil, err
 			}
-			fh.addServiceEntryToCache(svc,svcURL)
-			return svcEntryRecord{
-				svcURL:   svcURL,
-				cacheHit: false,
-			}, nil
+			fh.addServiceEntryToCache(entry)
+			return fh.makeServiceEntryRecord(req, entry.svcURL, false)
 		},
 	)
 
 	record, ok := recordObj.(svcEntryRecord)
 	if !ok {
-		return nil, false, fv1.SVCTypePodIP,fmt.Errorf("unexpected type of recordObj %T: %w", recordObj, err)
+		return svcEntryRecord{}, fmt.Errorf("unexpected type of recordObj %T: %w", recordObj, err)
+	}
+	return record, err
+}
+
+// makeServiceEntryRecord returns the service entry of the function with the
+// given service url, along with a healthy pod to send the request to if the
+// function is a wasm function.
+func (fh functionHandler) makeServiceEntryRecord(req *http.Request, svcURL *url.URL, cacheHit bool) (svcEntryRecord, error) {
+	record := svcEntryRecord{svcURL: svcURL, cacheHit: cacheHit}
+	if svcURL == nil || fh.function.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType != fv1.ExecutorTypeWasm {
+		return record, nil
+	}
+	podURL, err := fh.getPodIPEntryFromCache(req)
+	if err != nil {
+		return svcEntryRecord{}, err
 	}
-	return record.svcURL, record.cacheHit, fv1.SVCTypePodIP,err
+	record.podURL = podURL
+	return record, nil
 }
 
 // getProxyErrorHandler returns a reverse proxy error handler
@@ -807,9 +861,12 @@ func (fh functionHandler) getProxyErrorHandler(start time.Time, rrt *RetryingRou
 			msg := "no response from function before timeout"
 			logger.Error(msg, zap.Any("function", fh.function), zap.String("status", http.StatusText(status)))
 		default:
-			code, _ := ferror.GetHTTPError(err)
+			code, errMsg := ferror.GetHTTPError(err)
 			status = code
 			msg = "error sending request to function"
+			if code == http.StatusServiceUnavailable {
+				msg = errMsg
+			}
 			logger.Error(msg, zap.Error(err), zap.Any("function", fh.function),
 				zap.Any("status", http.StatusText(status)), zap.Int("code", code))
 		}
@@ -832,6 +889,44 @@ func (fh functionHandler) getProxyErrorHandler(start time.Time, rrt *RetryingRou
 	}
 }
 
+// collectWasmUsage observes the usage the wasm runtime returns for an
+// invocation of a wasm function, and removes it from the response so that it
+// does not reach clients.
+func (fh functionHandler) collectWasmUsage(resp *http.Response) {
+	if fh.function.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType != fv1.ExecutorTypeWasm {
+		return
+	}
+	header := resp.Header.Get(wasmmodule.UsageHeader)
+	if len(header) == 0 {
+		return
+	}
+	resp.Header.Del(wasmmodule.UsageHeader)
+
+	var u wasmmodule.Usage
+	err := json.Unmarshal([]byte(header), &u)
+	if err != nil {
+		fh.logger.Debug("error decoding wasm function usage", zap.Error(err),
+			zap.String("function", fh.function.ObjectMeta.Name))
+		return
+	}
+	// the function is the one the router invoked, whatever the runtime says
+	u.Namespace, u.Function = fh.function.ObjectMeta.Namespace, fh.function.ObjectMeta.Name
+	err = u.Validate()
+	if err != nil {
+		fh.logger.Debug("dropping invalid wasm function usage", zap.Error(err),
+			zap.String("function", fh.function.ObjectMeta.Name))
+		return
+	}
+
+	labels := []string{u.Namespace, u.Function}
+	wasmFunctionWallTime.WithLabelValues(labels...).Observe(u.WallTimeSeconds)
+	wasmFunctionInstantiation.WithLabelValues(labels...).Observe(u.InstantiationSeconds)
+	wasmFunctionPeakMemory.WithLabelValues(labels...).Observe(float64(u.PeakMemoryBytes))
+	if u.Fuel != nil {
+		wasmFunctionFuel.WithLabelValues(labels...).Observe(float64(*u.Fuel))
+	}
+}
+
 func (fh functionHandler) collectFunctionMetric(start time.Time, rrt *RetryingRoundTripper, req *http.Request, resp *http.Response) {
 	duration := time.Since(start)
 	var path string
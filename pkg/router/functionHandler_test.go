@@ -21,15 +21,18 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+	"github.com/fission/fission/pkg/utils/wasmmodule"
 )
 
 func TestProxyErrorHandler(t *testing.T) {
@@ -67,3 +70,96 @@ func TestProxyErrorHandler(t *testing.T) {
 	errHandler(respRecorder, req, errors.New("dummy"))
 	assert.Equal(t, http.StatusInternalServerError, respRecorder.Code)
 }
+
+func TestGetServiceEntryWasm(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	assert.Nil(t, err)
+
+	fn := &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "dummy",
+			Namespace:       "dummy-bar",
+			UID:             "fn-uid",
+			ResourceVersion: "1",
+		},
+	}
+	fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType = fv1.ExecutorTypeWasm
+	svcURL, err := url.Parse("http://wasm-host.fission-function/fn-uid")
+	assert.Nil(t, err)
+	pod1, err := url.Parse("http://10.0.0.1:8888/fn-uid")
+	assert.Nil(t, err)
+	pod2, err := url.Parse("http://10.0.0.2:8888/fn-uid")
+	assert.Nil(t, err)
+
+	fh := &functionHandler{
+		logger:   logger,
+		function: fn,
+		fmap:     makeFunctionServiceMap(logger, 0),
+	}
+	fh.addServiceEntryToCache(&executorServiceEntry{
+		svcURL:  svcURL,
+		podURLs: []*url.URL{pod1, pod2},
+		ttl:     time.Minute,
+	})
+
+	// cached requests are spread across the pods
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, expected := range []*url.URL{pod1, pod2, pod1} {
+		record, err := fh.getServiceEntry(context.Background(), req)
+		assert.Nil(t, err)
+		assert.True(t, record.cacheHit)
+		assert.Equal(t, svcURL, record.svcURL)
+		assert.Equal(t, expected, record.podURL)
+	}
+
+	// the service url is used while no pod is healthy
+	fh.fmap.lookupPodEndpoint(string(fn.UID), pod1.Host).markUnhealthy()
+	fh.fmap.lookupPodEndpoint(string(fn.UID), pod2.Host).markUnhealthy()
+	record, err := fh.getServiceEntry(context.Background(), req)
+	assert.Nil(t, err)
+	assert.True(t, record.cacheHit)
+	assert.Equal(t, svcURL, record.svcURL)
+	assert.Nil(t, record.podURL)
+}
+
+func TestCollectWasmUsage(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	assert.Nil(t, err)
+
+	fn := &fv1.Function{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "wasm-usage",
+			Namespace: "dummy-bar",
+		},
+	}
+	fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType = fv1.ExecutorTypeWasm
+	fh := &functionHandler{
+		logger:   logger,
+		function: fn,
+	}
+	series := func() int {
+		return testutil.CollectAndCount(wasmFunctionWallTime, "fission_wasm_function_wall_time_seconds")
+	}
+
+	// the runtime may not name the function it was invoked for
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set(wasmmodule.UsageHeader, `{"namespace":"other","function":"other","wallTimeSeconds":0.02,"instantiationSeconds":0.005,"peakMemoryBytes":131072}`)
+	fh.collectWasmUsage(resp)
+	assert.Empty(t, resp.Header.Get(wasmmodule.UsageHeader))
+	assert.Equal(t, 1, series())
+	assert.Equal(t, 0, testutil.CollectAndCount(wasmFunctionFuel, "fission_wasm_function_fuel_consumed"))
+
+	fn.ObjectMeta.Name = "wasm-invalid"
+	resp.Header.Set(wasmmodule.UsageHeader, `{"wallTimeSeconds":-1}`)
+	fh.collectWasmUsage(resp)
+	assert.Empty(t, resp.Header.Get(wasmmodule.UsageHeader))
+	assert.Equal(t, 1, series())
+
+	// the header of other functions is left to them
+	fn.Spec.InvokeStrategy.ExecutionStrategy.ExecutorType = fv1.ExecutorTypeNewdeploy
+	resp.Header.Set(wasmmodule.UsageHeader, `{"wallTimeSeconds":0.01}`)
+	fh.collectWasmUsage(resp)
+	assert.NotEmpty(t, resp.Header.Get(wasmmodule.UsageHeader))
+	assert.Equal(t, 1, series())
+	assert.True(t, wasmFunctionWallTime.DeleteLabelValues("dummy-bar", "wasm-usage"))
+}
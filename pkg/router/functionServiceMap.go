@@ -17,6 +17,7 @@ limitations under the License.
 package router
 
 import (
+	"net/http"
 	"net/url"
 	"time"
 
@@ -28,9 +29,9 @@ import (
 
 type (
 	functionServiceMap struct {
-		logger *zap.Logger
-		cache  *cache.Cache      // map[metadataKey]*url.URL
-	    podIPcache  *cache.Cache // map[string functionuid]string
+		logger     *zap.Logger
+		cache      *cache.Cache // map[metadataKey]*url.URL
+		podIPcache *cache.Cache // map[functionuid]*podEndpoints
 	}
 
 	// metav1.ObjectMeta is not hashable, so we make a hashable copy
@@ -44,9 +45,9 @@ type (
 
 func makeFunctionServiceMap(logger *zap.Logger, expiry time.Duration) *functionServiceMap {
 	return &functionServiceMap{
-		logger: logger.Named("function_service_map"),
-		cache:  cache.MakeCache(expiry, 0),
-		podIPcache:cache.MakeCache(expiry, 0),
+		logger:     logger.Named("function_service_map"),
+		cache:      cache.MakeCache(expiry, 0),
+		podIPcache: cache.MakeCache(expiry, 0),
 	}
 }
 
@@ -85,29 +86,73 @@ func (fmap *functionServiceMap) remove(f *metav1.ObjectMeta) error {
 	return fmap.cache.Delete(*mk)
 }
 
-
-func (fmap *functionServiceMap) lookuppodip(fuid string) (*url.URL, error) {
-	// mk := keyFromMetadata(f)
+// lookuppodip returns a healthy pod of the function picked by lb, or nil if
+// no pod of the function is healthy.
+func (fmap *functionServiceMap) lookuppodip(fuid string, lb loadBalancer, req *http.Request) (*podEndpoint, error) {
 	item, err := fmap.podIPcache.Get(fuid)
 	if err != nil {
 		return nil, err
 	}
-	u := item.(*url.URL)
-	return u, nil
+	return item.(*podEndpoints).pick(lb, req), nil
+}
+
+// lookupPodEndpoint returns the pod of the function with the given host, or
+// nil if there is none.
+func (fmap *functionServiceMap) lookupPodEndpoint(fuid string, host string) *podEndpoint {
+	item, err := fmap.podIPcache.Get(fuid)
+	if err != nil {
+		return nil
+	}
+	return item.(*podEndpoints).find(host)
+}
+
+// podIPExpired reports whether the cached pod URLs of the function outlived
+// the TTL suggested by executor.
+func (fmap *functionServiceMap) podIPExpired(fuid string) bool {
+	item, err := fmap.podIPcache.Get(fuid)
+	if err != nil {
+		return false
+	}
+	return item.(*podEndpoints).expired()
 }
 
-func (fmap *functionServiceMap) assignpodip(fuid string, PodIP *url.URL) {
-	// mk := keyFromMetadata(f)
-	old, err := fmap.podIPcache.Set(fuid, PodIP)
+// assignpodip caches the pod URLs of the function, replacing the ones cached
+// before, if any. Pod URLs of an older generation than the cached ones are
+// ignored, as they were computed before the cached ones. A generation of zero
+// comes from executors not reporting generations and always replaces. No
+// pod URLs remove the cached ones, which executor no longer knows of.
+func (fmap *functionServiceMap) assignpodip(fuid string, podURLs []*url.URL, generation int64, ttl time.Duration) {
+	if len(podURLs) == 0 {
+		err := fmap.podIPcache.Delete(fuid)
+		if err != nil {
+			fmap.logger.Error("error removing pod urls of function", zap.Error(err))
+		}
+		return
+	}
+	endpoints := makePodEndpoints(podURLs, generation, ttl)
+	old, err := fmap.podIPcache.Set(fuid, endpoints)
 	if err != nil {
-		if *PodIP == *(old.(*url.URL)) {
+		oldEndpoints := old.(*podEndpoints)
+		if generation > 0 && generation < oldEndpoints.generation {
 			return
 		}
-		fmap.logger.Error("error caching pod ip for function with a different value", zap.Error(err))
-		// ignore error
+		if oldEndpoints.equal(podURLs) {
+			// keep the state of the pods, e.g. requests in flight
+			oldEndpoints.refresh(ttl)
+			return
+		}
+		err = fmap.podIPcache.Delete(fuid)
+		if err != nil {
+			fmap.logger.Error("error removing pod urls of function", zap.Error(err))
+			return
+		}
+		_, err = fmap.podIPcache.Set(fuid, endpoints)
+		if err != nil {
+			fmap.logger.Error("error caching pod urls for function", zap.Error(err))
+		}
 	}
 }
 
 func (fmap *functionServiceMap) removepodip(fuid string) error {
 	return fmap.podIPcache.Delete(fuid)
-}
\ No newline at end of file
+}
@@ -17,8 +17,11 @@ limitations under the License.
 package router
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -55,3 +58,110 @@ func TestFunctionServiceMap(t *testing.T) {
 		t.Errorf("No error on missing entry")
 	}
 }
+
+func TestFunctionServiceMapPodIP(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	panicIf(err)
+
+	m := makeFunctionServiceMap(logger, 0)
+	lb := roundRobinBalancer{}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	m.assignpodip("fn-uid", []*url.URL{parseURL(t, "http://10.0.0.1:8888"), parseURL(t, "http://10.0.0.2:8888")}, 0, 0)
+	for _, expected := range []string{"10.0.0.1:8888", "10.0.0.2:8888", "10.0.0.1:8888"} {
+		ep, err := m.lookuppodip("fn-uid", lb, req)
+		if err != nil {
+			t.Fatalf("Lookup error: %v", err)
+		}
+		if ep.url.Host != expected {
+			t.Errorf("Expected %s, got %s", expected, ep.url.Host)
+		}
+	}
+
+	if ep := m.lookupPodEndpoint("fn-uid", "10.0.0.2:8888"); ep == nil {
+		t.Errorf("Expected pod endpoint 10.0.0.2:8888 to be found")
+	}
+	if ep := m.lookupPodEndpoint("fn-uid", "10.0.0.3:8888"); ep != nil {
+		t.Errorf("Expected pod endpoint 10.0.0.3:8888 not to be found")
+	}
+
+	// assigning new pod urls replaces the old ones
+	m.assignpodip("fn-uid", []*url.URL{parseURL(t, "http://10.0.0.3:8888")}, 0, 0)
+	ep, err := m.lookuppodip("fn-uid", lb, req)
+	if err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	if ep.url.Host != "10.0.0.3:8888" {
+		t.Errorf("Expected 10.0.0.3:8888, got %s", ep.url.Host)
+	}
+
+	// no pod is picked once all pods are unhealthy
+	ep.markUnhealthy()
+	ep, err = m.lookuppodip("fn-uid", lb, req)
+	if err != nil {
+		t.Fatalf("Lookup error: %v", err)
+	}
+	if ep != nil {
+		t.Errorf("Expected no healthy pod, got %s", ep.url.Host)
+	}
+
+	err = m.removepodip("fn-uid")
+	if err != nil {
+		t.Fatalf("Remove error: %v", err)
+	}
+	_, err = m.lookuppodip("fn-uid", lb, req)
+	if err == nil {
+		t.Errorf("No error on missing entry")
+	}
+}
+
+func TestFunctionServiceMapPodIPGeneration(t *testing.T) {
+	logger, err := zap.NewDevelopment()
+	panicIf(err)
+
+	m := makeFunctionServiceMap(logger, 0)
+	lb := roundRobinBalancer{}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	lookup := func() string {
+		ep, err := m.lookuppodip("fn-uid", lb, req)
+		if err != nil {
+			t.Fatalf("Lookup error: %v", err)
+		}
+		return ep.url.Host
+	}
+
+	m.assignpodip("fn-uid", []*url.URL{parseURL(t, "http://10.0.0.1:8888")}, 2, time.Minute)
+
+	// pod urls of an older generation are ignored
+	m.assignpodip("fn-uid", []*url.URL{parseURL(t, "http://10.0.0.2:8888")}, 1, time.Minute)
+	if host := lookup(); host != "10.0.0.1:8888" {
+		t.Errorf("Expected 10.0.0.1:8888, got %s", host)
+	}
+
+	// pod urls of a newer generation replace the cached ones
+	m.assignpodip("fn-uid", []*url.URL{parseURL(t, "http://10.0.0.3:8888")}, 3, time.Minute)
+	if host := lookup(); host != "10.0.0.3:8888" {
+		t.Errorf("Expected 10.0.0.3:8888, got %s", host)
+	}
+	if m.podIPExpired("fn-uid") {
+		t.Errorf("Expected pod urls not to be expired")
+	}
+
+	// pod urls expire after their TTL, and are refreshed by the same urls
+	m.assignpodip("fn-uid", []*url.URL{parseURL(t, "http://10.0.0.3:8888")}, 3, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if !m.podIPExpired("fn-uid") {
+		t.Errorf("Expected pod urls to be expired")
+	}
+	m.assignpodip("fn-uid", []*url.URL{parseURL(t, "http://10.0.0.3:8888")}, 3, 0)
+	if m.podIPExpired("fn-uid") {
+		t.Errorf("Expected pod urls without TTL not to expire")
+	}
+
+	// executor knowing no pods removes the cached ones
+	m.assignpodip("fn-uid", nil, 4, time.Minute)
+	if _, err := m.lookuppodip("fn-uid", lb, req); err == nil {
+		t.Errorf("Expected pod urls to be removed")
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package router
+
+import (
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+)
+
+// unhealthyEndpointBackoff is how long router stops sending requests to a
+// function pod it failed to connect to.
+const unhealthyEndpointBackoff = 10 * time.Second
+
+type (
+	// podEndpoints holds the pods of a function router sends requests to
+	// directly, together with the state load balancers pick pods with.
+	podEndpoints struct {
+		endpoints  []*podEndpoint
+		next       uint32
+		generation int64 // cache generation of the endpoints reported by executor
+		expiresAt  int64 // unix nano time router should refresh the endpoints at, 0 if never
+	}
+
+	// podEndpoint is a pod of a function.
+	podEndpoint struct {
+		url            *url.URL
+		outstanding    int64 // number of requests in flight
+		unhealthyUntil int64 // unix nano time until the pod is considered unhealthy
+	}
+
+	// loadBalancer picks the pod a request is sent to among the healthy pods
+	// of a function.
+	loadBalancer interface {
+		pick(e *podEndpoints, healthy []*podEndpoint, req *http.Request) *podEndpoint
+	}
+
+	roundRobinBalancer struct{}
+
+	leastOutstandingBalancer struct{}
+
+	// consistentHashBalancer sends requests with the same header or cookie
+	// value to the same pod. It uses rendezvous hashing, so that only the
+	// requests of a pod going away are moved to other pods.
+	consistentHashBalancer struct {
+		header string
+		cookie string
+	}
+)
+
+func makePodEndpoints(podURLs []*url.URL, generation int64, ttl time.Duration) *podEndpoints {
+	e := &podEndpoints{generation: generation}
+	e.refresh(ttl)
+	for _, u := range podURLs {
+		e.endpoints = append(e.endpoints, &podEndpoint{url: u})
+	}
+	return e
+}
+
+// pick returns a healthy pod picked by lb, or nil if no pod is healthy.
+func (e *podEndpoints) pick(lb loadBalancer, req *http.Request) *podEndpoint {
+	now := time.Now().UnixNano()
+	healthy := make([]*podEndpoint, 0, len(e.endpoints))
+	for _, ep := range e.endpoints {
+		if atomic.LoadInt64(&ep.unhealthyUntil) <= now {
+			healthy = append(healthy, ep)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return lb.pick(e, healthy, req)
+}
+
+// find returns the pod with the given host, or nil if there is none.
+func (e *podEndpoints) find(host string) *podEndpoint {
+	for _, ep := range e.endpoints {
+		if ep.url.Host == host {
+			return ep
+		}
+	}
+	return nil
+}
+
+// refresh sets the time the endpoints expire at ttl from now. The endpoints
+// never expire if ttl is zero.
+func (e *podEndpoints) refresh(ttl time.Duration) {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+	atomic.StoreInt64(&e.expiresAt, expiresAt)
+}
+
+// expired reports whether router should ask executor for the endpoints again.
+func (e *podEndpoints) expired() bool {
+	expiresAt := atomic.LoadInt64(&e.expiresAt)
+	return expiresAt > 0 && expiresAt <= time.Now().UnixNano()
+}
+
+func (e *podEndpoints) equal(podURLs []*url.URL) bool {
+	if len(e.endpoints) != len(podURLs) {
+		return false
+	}
+	for i := range podURLs {
+		if *e.endpoints[i].url != *podURLs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (ep *podEndpoint) acquire() {
+	atomic.AddInt64(&ep.outstanding, 1)
+}
+
+func (ep *podEndpoint) release() {
+	atomic.AddInt64(&ep.outstanding, -1)
+}
+
+// markUnhealthy stops load balancers from picking the pod for a while.
+func (ep *podEndpoint) markUnhealthy() {
+	atomic.StoreInt64(&ep.unhealthyUntil, time.Now().Add(unhealthyEndpointBackoff).UnixNano())
+}
+
+// makeLoadBalancer returns the load balancer for the given config of an
+// HTTPTrigger. Round-robin is used if config is nil.
+func makeLoadBalancer(config *fv1.LoadBalancerConfig) loadBalancer {
+	if config == nil {
+		return roundRobinBalancer{}
+	}
+	switch config.Strategy {
+	case fv1.LoadBalancerStrategyLeastOutstanding:
+		return leastOutstandingBalancer{}
+	case fv1.LoadBalancerStrategyConsistentHash:
+		return consistentHashBalancer{header: config.HashHeader, cookie: config.HashCookie}
+	default:
+		return roundRobinBalancer{}
+	}
+}
+
+func (roundRobinBalancer) pick(e *podEndpoints, healthy []*podEndpoint, req *http.Request) *podEndpoint {
+	n := atomic.AddUint32(&e.next, 1)
+	return healthy[(n-1)%uint32(len(healthy))]
+}
+
+func (leastOutstandingBalancer) pick(e *podEndpoints, healthy []*podEndpoint, req *http.Request) *podEndpoint {
+	// start at the next pod in round-robin order, so that ties are spread
+	// across pods instead of always going to the first one.
+	start := int(atomic.AddUint32(&e.next, 1) - 1)
+	var picked *podEndpoint
+	for i := range healthy {
+		ep := healthy[(start+i)%len(healthy)]
+		if picked == nil || atomic.LoadInt64(&ep.outstanding) < atomic.LoadInt64(&picked.outstanding) {
+			picked = ep
+		}
+	}
+	return picked
+}
+
+func (lb consistentHashBalancer) pick(e *podEndpoints, healthy []*podEndpoint, req *http.Request) *podEndpoint {
+	key := lb.key(req)
+	if len(key) == 0 {
+		return roundRobinBalancer{}.pick(e, healthy, req)
+	}
+	var picked *podEndpoint
+	var max uint64
+	for _, ep := range healthy {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte(ep.url.Host))
+		if score := h.Sum64(); picked == nil || score > max {
+			picked, max = ep, score
+		}
+	}
+	return picked
+}
+
+// key returns the value requests are hashed on, or an empty string if the
+// request does not carry it.
+func (lb consistentHashBalancer) key(req *http.Request) string {
+	if len(lb.header) > 0 {
+		return req.Header.Get(lb.header)
+	}
+	if len(lb.cookie) > 0 {
+		if c, err := req.Cookie(lb.cookie); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	fv1 "github.com/fission/fission/pkg/apis/core/v1"
+)
+
+func parseURL(t *testing.T, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("can't parse url %s", rawURL)
+	}
+	return u
+}
+
+func makeTestPodEndpoints(t *testing.T) *podEndpoints {
+	return makePodEndpoints([]*url.URL{
+		parseURL(t, "http://10.0.0.1:8888"),
+		parseURL(t, "http://10.0.0.2:8888"),
+		parseURL(t, "http://10.0.0.3:8888"),
+	}, 0, 0)
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	e := makeTestPodEndpoints(t)
+	lb := makeLoadBalancer(nil)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	e.endpoints[1].markUnhealthy()
+	for _, expected := range []string{"10.0.0.1:8888", "10.0.0.3:8888", "10.0.0.1:8888"} {
+		if host := e.pick(lb, req).url.Host; host != expected {
+			t.Errorf("Expected %s, got %s", expected, host)
+		}
+	}
+}
+
+func TestLeastOutstandingBalancer(t *testing.T) {
+	e := makeTestPodEndpoints(t)
+	lb := makeLoadBalancer(&fv1.LoadBalancerConfig{Strategy: fv1.LoadBalancerStrategyLeastOutstanding})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	e.endpoints[0].acquire()
+	e.endpoints[0].acquire()
+	e.endpoints[2].acquire()
+	if host := e.pick(lb, req).url.Host; host != "10.0.0.2:8888" {
+		t.Errorf("Expected 10.0.0.2:8888, got %s", host)
+	}
+
+	e.endpoints[1].acquire()
+	e.endpoints[1].acquire()
+	e.endpoints[0].release()
+	e.endpoints[0].release()
+	if host := e.pick(lb, req).url.Host; host != "10.0.0.1:8888" {
+		t.Errorf("Expected 10.0.0.1:8888, got %s", host)
+	}
+}
+
+func TestConsistentHashBalancer(t *testing.T) {
+	e := makeTestPodEndpoints(t)
+
+	t.Run("header", func(t *testing.T) {
+		lb := makeLoadBalancer(&fv1.LoadBalancerConfig{
+			Strategy:   fv1.LoadBalancerStrategyConsistentHash,
+			HashHeader: "X-User",
+		})
+		picked := map[string]string{}
+		for i := 0; i < 3; i++ {
+			for _, user := range []string{"alice", "bob", "carol", "dave"} {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.Header.Set("X-User", user)
+				host := e.pick(lb, req).url.Host
+				if prev, ok := picked[user]; ok && prev != host {
+					t.Errorf("Expected requests of %s to go to %s, got %s", user, prev, host)
+				}
+				picked[user] = host
+			}
+		}
+
+		// only requests of the pod going away are moved
+		for user, host := range picked {
+			if host == "10.0.0.1:8888" {
+				continue
+			}
+			e.endpoints[0].markUnhealthy()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-User", user)
+			if got := e.pick(lb, req).url.Host; got != host {
+				t.Errorf("Expected requests of %s to stay on %s, got %s", user, host, got)
+			}
+			e.endpoints[0].unhealthyUntil = 0
+		}
+	})
+
+	t.Run("cookie", func(t *testing.T) {
+		lb := makeLoadBalancer(&fv1.LoadBalancerConfig{
+			Strategy:   fv1.LoadBalancerStrategyConsistentHash,
+			HashCookie: "session",
+		})
+		var picked string
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+			host := e.pick(lb, req).url.Host
+			if picked != "" && picked != host {
+				t.Errorf("Expected requests of session to go to %s, got %s", picked, host)
+			}
+			picked = host
+		}
+
+		// requests without the cookie are spread round-robin
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		first := e.pick(lb, req).url.Host
+		if second := e.pick(lb, req).url.Host; first == second {
+			t.Errorf("Expected requests without cookie to be spread, got %s twice", first)
+		}
+	})
+}
@@ -37,4 +37,42 @@ var (
 		},
 		labelsStrings,
 	)
+
+	// wasm function invocations usage
+	// function_namespace: function namespace
+	// function_name: function name
+	wasmLabelsStrings = []string{"function_namespace", "function_name"}
+
+	wasmFunctionWallTime = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "fission_wasm_function_wall_time_seconds",
+			Help:    "The time invocations of wasm functions took.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+		},
+		wasmLabelsStrings,
+	)
+	wasmFunctionInstantiation = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "fission_wasm_function_instantiation_seconds",
+			Help:    "The time instantiating wasm modules took.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 2, 15),
+		},
+		wasmLabelsStrings,
+	)
+	wasmFunctionPeakMemory = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "fission_wasm_function_peak_memory_bytes",
+			Help:    "The peak linear memory of invocations of wasm functions.",
+			Buckets: prometheus.ExponentialBuckets(65536, 2, 14),
+		},
+		wasmLabelsStrings,
+	)
+	wasmFunctionFuel = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "fission_wasm_function_fuel_consumed",
+			Help:    "The fuel or instructions invocations of wasm functions consumed.",
+			Buckets: prometheus.ExponentialBuckets(1000, 4, 12),
+		},
+		wasmLabelsStrings,
+	)
 )
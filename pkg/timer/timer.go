@@ -38,6 +38,7 @@ type (
 		triggers       map[string]*timerTriggerWithCron
 		requestChannel chan *timerRequest
 		publisher      *publisher.Publisher
+		cloudEvents    publisher.CloudEventsMode
 	}
 
 	timerRequest struct {
@@ -54,12 +55,13 @@ type (
 	}
 )
 
-func MakeTimer(logger *zap.Logger, publisher publisher.Publisher) *Timer {
+func MakeTimer(logger *zap.Logger, poster publisher.Publisher) *Timer {
 	timer := &Timer{
 		logger:         logger.Named("timer"),
 		triggers:       make(map[string]*timerTriggerWithCron),
 		requestChannel: make(chan *timerRequest),
-		publisher:      &publisher,
+		publisher:      &poster,
+		cloudEvents:    publisher.CloudEventsModeFromEnv(logger),
 	}
 	go timer.svc()
 	return timer
@@ -131,11 +133,17 @@ func (timer *Timer) newCron(t fv1.TimeTrigger) *cron.Cron {
 		headers := map[string]string{
 			"X-Fission-Timer-Name": t.ObjectMeta.Name,
 		}
+		event := publisher.NewCloudEvent(publisher.CloudEventSource("timetriggers", t.ObjectMeta.Namespace, t.ObjectMeta.Name),
+			publisher.CloudEventTypeTimer, nil, "")
 
 		// with the addition of multi-tenancy, the users can create functions in any namespace. however,
 		// the triggers can only be created in the same namespace as the function.
 		// so essentially, function namespace = trigger namespace.
-		(*timer.publisher).Publish("", headers, utils.UrlForFunction(t.Spec.FunctionReference.Name, t.ObjectMeta.Namespace))
+		err := publisher.PublishCloudEvent(*timer.publisher, timer.cloudEvents, event, headers,
+			utils.UrlForFunction(t.Spec.FunctionReference.Name, t.ObjectMeta.Namespace))
+		if err != nil {
+			timer.logger.Error("failed to publish time trigger event", zap.Error(err), zap.String("trigger", t.ObjectMeta.Name))
+		}
 	})
 	c.Start()
 	timer.logger.Info("added new cron for time trigger", zap.String("trigger", t.ObjectMeta.Name))
@@ -0,0 +1,583 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package wasmmodule inspects WebAssembly binaries, so that broken modules
+// are rejected before they are handed to a wasm runtime.
+package wasmmodule
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	KindModule    = "module"
+	KindComponent = "component"
+
+	WASINone     = "none"
+	WASIUnstable = "unstable"
+	WASIPreview1 = "preview1"
+	WASIPreview2 = "preview2"
+)
+
+const (
+	coreModuleVersion = 1
+
+	layerCore      = 0
+	layerComponent = 1
+
+	coreSectionImport = 2
+	coreSectionExport = 7
+
+	componentSectionImport = 10
+	componentSectionExport = 11
+)
+
+var magic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+type (
+	// Module is what is known about a wasm binary without running it.
+	Module struct {
+		// Kind is either a core module or a component-model binary.
+		Kind string
+		// Version is the binary format version in the header.
+		Version uint16
+		// WASI is the WASI version the imports of the module target.
+		WASI    string
+		Imports []Import
+		Exports []Export
+	}
+
+	// Import is an import of a module. Module is empty for components,
+	// which import by a single name like "wasi:cli/stdout@0.2.0".
+	Import struct {
+		Module string
+		Name   string
+		Kind   string
+	}
+
+	// Export is an export of a module.
+	Export struct {
+		Name string
+		Kind string
+	}
+
+	reader struct {
+		data []byte
+		off  int
+	}
+)
+
+// ParseFile parses the wasm binary in the given file.
+func ParseFile(path string) (*Module, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading wasm module %v", path)
+	}
+	m, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing wasm module %v", path)
+	}
+	return m, nil
+}
+
+// IsWasmFile reports whether the file starts with the wasm magic number.
+// Files which can not be read are not wasm binaries.
+func IsWasmFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, len(magic))
+	_, err = io.ReadFull(f, header)
+	return err == nil && bytes.Equal(header, magic)
+}
+
+// Parse checks the header of a wasm binary and reads its imports and exports.
+func Parse(data []byte) (*Module, error) {
+	if len(data) < 8 {
+		return nil, errors.New("file too short to be a wasm binary")
+	}
+	if !bytes.Equal(data[:4], magic) {
+		return nil, errors.New("missing wasm magic number, not a wasm binary")
+	}
+
+	m := &Module{Version: binary.LittleEndian.Uint16(data[4:6])}
+	r := &reader{data: data, off: 8}
+
+	var err error
+	switch layer := binary.LittleEndian.Uint16(data[6:8]); layer {
+	case layerCore:
+		if m.Version != coreModuleVersion {
+			return nil, errors.Errorf("unsupported wasm binary version %d", m.Version)
+		}
+		m.Kind = KindModule
+		err = m.parseCoreSections(r)
+	case layerComponent:
+		m.Kind = KindComponent
+		err = m.parseComponentSections(r)
+	default:
+		return nil, errors.Errorf("unsupported wasm binary layer %d", layer)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m.WASI = m.detectWASI()
+	return m, nil
+}
+
+// HasExport reports whether the module exports the given name.
+func (m *Module) HasExport(name string) bool {
+	for _, e := range m.Exports {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportNames returns the names of the exports of the module.
+func (m *Module) ExportNames() []string {
+	names := make([]string, 0, len(m.Exports))
+	for _, e := range m.Exports {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// ImportNames returns the imports of the module as "module.name" for core
+// modules and as the plain name for components.
+func (m *Module) ImportNames() []string {
+	names := make([]string, 0, len(m.Imports))
+	for _, i := range m.Imports {
+		if len(i.Module) > 0 {
+			names = append(names, i.Module+"."+i.Name)
+		} else {
+			names = append(names, i.Name)
+		}
+	}
+	return names
+}
+
+func (m *Module) detectWASI() string {
+	for _, i := range m.Imports {
+		switch {
+		case i.Module == "wasi_snapshot_preview1":
+			return WASIPreview1
+		case i.Module == "wasi_unstable":
+			return WASIUnstable
+		case len(i.Module) == 0 && strings.HasPrefix(i.Name, "wasi:"):
+			return WASIPreview2
+		}
+	}
+	return WASINone
+}
+
+func (m *Module) parseCoreSections(r *reader) error {
+	for !r.eof() {
+		id, content, err := r.section()
+		if err != nil {
+			return err
+		}
+		switch id {
+		case coreSectionImport:
+			err = m.parseCoreImports(content)
+		case coreSectionExport:
+			err = m.parseCoreExports(content)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Module) parseCoreImports(r *reader) error {
+	count, err := r.u32()
+	if err != nil {
+		return errors.Wrap(err, "error reading import section")
+	}
+	for i := uint32(0); i < count; i++ {
+		module, err := r.name()
+		if err != nil {
+			return errors.Wrap(err, "error reading import module")
+		}
+		name, err := r.name()
+		if err != nil {
+			return errors.Wrap(err, "error reading import name")
+		}
+		kind, err := r.coreImportDesc()
+		if err != nil {
+			return errors.Wrapf(err, "error reading import %v.%v", module, name)
+		}
+		m.Imports = append(m.Imports, Import{Module: module, Name: name, Kind: kind})
+	}
+	return nil
+}
+
+func (m *Module) parseCoreExports(r *reader) error {
+	count, err := r.u32()
+	if err != nil {
+		return errors.Wrap(err, "error reading export section")
+	}
+	for i := uint32(0); i < count; i++ {
+		name, err := r.name()
+		if err != nil {
+			return errors.Wrap(err, "error reading export name")
+		}
+		kind, err := r.coreExternKind()
+		if err != nil {
+			return errors.Wrapf(err, "error reading export %v", name)
+		}
+		if _, err = r.u32(); err != nil {
+			return errors.Wrapf(err, "error reading export %v", name)
+		}
+		m.Exports = append(m.Exports, Export{Name: name, Kind: kind})
+	}
+	return nil
+}
+
+func (m *Module) parseComponentSections(r *reader) error {
+	for !r.eof() {
+		id, content, err := r.section()
+		if err != nil {
+			return err
+		}
+		switch id {
+		case componentSectionImport:
+			err = m.parseComponentImports(content)
+		case componentSectionExport:
+			err = m.parseComponentExports(content)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Module) parseComponentImports(r *reader) error {
+	count, err := r.u32()
+	if err != nil {
+		return errors.Wrap(err, "error reading import section")
+	}
+	for i := uint32(0); i < count; i++ {
+		name, err := r.componentExternName()
+		if err != nil {
+			return errors.Wrap(err, "error reading import name")
+		}
+		kind, err := r.componentExternDesc()
+		if err != nil {
+			return errors.Wrapf(err, "error reading import %v", name)
+		}
+		m.Imports = append(m.Imports, Import{Name: name, Kind: kind})
+	}
+	return nil
+}
+
+func (m *Module) parseComponentExports(r *reader) error {
+	count, err := r.u32()
+	if err != nil {
+		return errors.Wrap(err, "error reading export section")
+	}
+	for i := uint32(0); i < count; i++ {
+		name, err := r.componentExternName()
+		if err != nil {
+			return errors.Wrap(err, "error reading export name")
+		}
+		kind, err := r.componentSort()
+		if err != nil {
+			return errors.Wrapf(err, "error reading export %v", name)
+		}
+		if _, err = r.u32(); err != nil {
+			return errors.Wrapf(err, "error reading export %v", name)
+		}
+		// an optional type ascription follows
+		hasType, err := r.byte()
+		if err != nil {
+			return errors.Wrapf(err, "error reading export %v", name)
+		}
+		if hasType == 0x01 {
+			if _, err = r.componentExternDesc(); err != nil {
+				return errors.Wrapf(err, "error reading export %v", name)
+			}
+		} else if hasType != 0x00 {
+			return errors.Errorf("invalid type ascription 0x%x of export %v", hasType, name)
+		}
+		m.Exports = append(m.Exports, Export{Name: name, Kind: kind})
+	}
+	return nil
+}
+
+func (r *reader) eof() bool {
+	return r.off >= len(r.data)
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.eof() {
+		return 0, errors.New("unexpected end of wasm binary")
+	}
+	b := r.data[r.off]
+	r.off++
+	return b, nil
+}
+
+func (r *reader) bytes(n uint32) ([]byte, error) {
+	if uint64(n) > uint64(len(r.data)-r.off) {
+		return nil, errors.New("unexpected end of wasm binary")
+	}
+	b := r.data[r.off : r.off+int(n)]
+	r.off += int(n)
+	return b, nil
+}
+
+// leb reads an LEB128 encoded integer of at most maxBytes bytes. Signed
+// integers are skipped the same way, so callers only use the result of
+// unsigned ones.
+func (r *reader) leb(maxBytes int) (uint64, error) {
+	var result uint64
+	for i := 0; i < maxBytes; i++ {
+		b, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+	return 0, errors.New("integer representation too long")
+}
+
+func (r *reader) u32() (uint32, error) {
+	v, err := r.leb(5)
+	if err != nil {
+		return 0, err
+	}
+	if v > 0xffffffff {
+		return 0, errors.New("integer too large")
+	}
+	return uint32(v), nil
+}
+
+func (r *reader) name() (string, error) {
+	n, err := r.u32()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.bytes(n)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(b) {
+		return "", errors.New("name is not valid UTF-8")
+	}
+	return string(b), nil
+}
+
+// section reads the next section and returns its id and a reader of its
+// content.
+func (r *reader) section() (byte, *reader, error) {
+	id, err := r.byte()
+	if err != nil {
+		return 0, nil, err
+	}
+	size, err := r.u32()
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "error reading size of section %d", id)
+	}
+	content, err := r.bytes(size)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "error reading section %d", id)
+	}
+	return id, &reader{data: content}, nil
+}
+
+func (r *reader) coreExternKind() (string, error) {
+	kind, err := r.byte()
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case 0x00:
+		return "func", nil
+	case 0x01:
+		return "table", nil
+	case 0x02:
+		return "memory", nil
+	case 0x03:
+		return "global", nil
+	case 0x04:
+		return "tag", nil
+	default:
+		return "", fmt.Errorf("invalid external kind 0x%x", kind)
+	}
+}
+
+func (r *reader) coreImportDesc() (string, error) {
+	kind, err := r.coreExternKind()
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case "func":
+		_, err = r.u32()
+	case "table":
+		if err = r.valType(); err == nil {
+			err = r.limits()
+		}
+	case "memory":
+		err = r.limits()
+	case "global":
+		if err = r.valType(); err == nil {
+			_, err = r.byte()
+		}
+	case "tag":
+		if _, err = r.byte(); err == nil {
+			_, err = r.u32()
+		}
+	}
+	return kind, err
+}
+
+func (r *reader) valType() error {
+	t, err := r.byte()
+	if err != nil {
+		return err
+	}
+	// (ref null? ht) carries a heap type
+	if t == 0x63 || t == 0x64 {
+		_, err = r.leb(5)
+	}
+	return err
+}
+
+func (r *reader) limits() error {
+	flags, err := r.byte()
+	if err != nil {
+		return err
+	}
+	if _, err = r.leb(10); err != nil {
+		return err
+	}
+	if flags&0x01 != 0 {
+		if _, err = r.leb(10); err != nil {
+			return err
+		}
+	}
+	// custom page size
+	if flags&0x08 != 0 {
+		_, err = r.u32()
+	}
+	return err
+}
+
+func (r *reader) componentExternName() (string, error) {
+	b, err := r.byte()
+	if err != nil {
+		return "", err
+	}
+	switch b {
+	case 0x00:
+		return r.name()
+	case 0x01:
+		name, err := r.name()
+		if err != nil {
+			return "", err
+		}
+		// version suffix
+		_, err = r.name()
+		return name, err
+	default:
+		return "", fmt.Errorf("invalid extern name 0x%x", b)
+	}
+}
+
+func (r *reader) componentSort() (string, error) {
+	sort, err := r.byte()
+	if err != nil {
+		return "", err
+	}
+	switch sort {
+	case 0x00:
+		coreSort, err := r.byte()
+		if err != nil {
+			return "", err
+		}
+		if coreSort == 0x11 {
+			return "module", nil
+		}
+		return "core", nil
+	case 0x01:
+		return "func", nil
+	case 0x02:
+		return "value", nil
+	case 0x03:
+		return "type", nil
+	case 0x04:
+		return "component", nil
+	case 0x05:
+		return "instance", nil
+	default:
+		return "", fmt.Errorf("invalid sort 0x%x", sort)
+	}
+}
+
+func (r *reader) componentExternDesc() (string, error) {
+	kind, err := r.byte()
+	if err != nil {
+		return "", err
+	}
+	switch kind {
+	case 0x00:
+		if _, err = r.byte(); err == nil {
+			_, err = r.u32()
+		}
+		return "module", err
+	case 0x01:
+		_, err = r.u32()
+		return "func", err
+	case 0x02:
+		// value bound, either an index or a value type
+		if _, err = r.byte(); err == nil {
+			_, err = r.leb(5)
+		}
+		return "value", err
+	case 0x03:
+		bound, err := r.byte()
+		if err == nil && bound == 0x00 {
+			_, err = r.u32()
+		}
+		return "type", err
+	case 0x04:
+		_, err = r.u32()
+		return "component", err
+	case 0x05:
+		_, err = r.u32()
+		return "instance", err
+	default:
+		return "", fmt.Errorf("invalid extern descriptor 0x%x", kind)
+	}
+}
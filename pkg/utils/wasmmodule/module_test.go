@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasmmodule
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var (
+	coreHeader      = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	componentHeader = []byte{0x00, 0x61, 0x73, 0x6d, 0x0d, 0x00, 0x01, 0x00}
+)
+
+func encName(s string) []byte {
+	return append([]byte{byte(len(s))}, s...)
+}
+
+func encSection(id byte, content ...[]byte) []byte {
+	var body []byte
+	for _, c := range content {
+		body = append(body, c...)
+	}
+	return append([]byte{id, byte(len(body))}, body...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func TestParseCoreModule(t *testing.T) {
+	data := concat(coreHeader,
+		// type section, skipped
+		encSection(1, []byte{0x01, 0x60, 0x00, 0x00}),
+		encSection(2, []byte{0x02},
+			encName("wasi_snapshot_preview1"), encName("fd_write"), []byte{0x00, 0x00},
+			encName("env"), encName("memory"), []byte{0x02, 0x01, 0x01, 0x02}),
+		encSection(7, []byte{0x02},
+			encName("_start"), []byte{0x00, 0x01},
+			encName("handler"), []byte{0x00, 0x02}),
+		// custom section, skipped
+		encSection(0, encName("name"), []byte{0x00}),
+	)
+
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("error parsing module: %v", err)
+	}
+	expected := &Module{
+		Kind:    KindModule,
+		Version: 1,
+		WASI:    WASIPreview1,
+		Imports: []Import{
+			{Module: "wasi_snapshot_preview1", Name: "fd_write", Kind: "func"},
+			{Module: "env", Name: "memory", Kind: "memory"},
+		},
+		Exports: []Export{
+			{Name: "_start", Kind: "func"},
+			{Name: "handler", Kind: "func"},
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, m)
+	}
+	if !m.HasExport("handler") || m.HasExport("main") {
+		t.Fatalf("unexpected exports %v", m.ExportNames())
+	}
+	if names := m.ImportNames(); !reflect.DeepEqual(names, []string{"wasi_snapshot_preview1.fd_write", "env.memory"}) {
+		t.Fatalf("unexpected import names %v", names)
+	}
+}
+
+func TestParseComponent(t *testing.T) {
+	data := concat(componentHeader,
+		encSection(10, []byte{0x01},
+			[]byte{0x00}, encName("wasi:cli/stdout@0.2.0"), []byte{0x05, 0x00}),
+		encSection(11, []byte{0x01},
+			[]byte{0x00}, encName("wasi:http/incoming-handler@0.2.0"), []byte{0x05, 0x01, 0x00}),
+	)
+
+	m, err := Parse(data)
+	if err != nil {
+		t.Fatalf("error parsing component: %v", err)
+	}
+	expected := &Module{
+		Kind:    KindComponent,
+		Version: 0x0d,
+		WASI:    WASIPreview2,
+		Imports: []Import{{Name: "wasi:cli/stdout@0.2.0", Kind: "instance"}},
+		Exports: []Export{{Name: "wasi:http/incoming-handler@0.2.0", Kind: "instance"}},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, m)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"too short":         {0x00, 0x61, 0x73},
+		"bad magic":         {0x7f, 0x45, 0x4c, 0x46, 0x01, 0x00, 0x00, 0x00},
+		"bad version":       {0x00, 0x61, 0x73, 0x6d, 0x02, 0x00, 0x00, 0x00},
+		"bad layer":         {0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x02, 0x00},
+		"truncated section": concat(coreHeader, []byte{0x07, 0x10, 0x01}),
+		"bad export kind":   concat(coreHeader, encSection(7, []byte{0x01}, encName("f"), []byte{0x09, 0x00})),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse(data); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestIsWasmFile(t *testing.T) {
+	dir := t.TempDir()
+	for name, c := range map[string]struct {
+		data     []byte
+		expected bool
+	}{
+		"hello.wasm": {concat(coreHeader, encSection(7, []byte{0x00})), true},
+		"hello.zip":  {[]byte("PK\x03\x04"), false},
+		"short":      {[]byte{0x00, 0x61}, false},
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if IsWasmFile(path) != c.expected {
+			t.Fatalf("expected IsWasmFile(%v) to be %v", name, c.expected)
+		}
+	}
+	if IsWasmFile(filepath.Join(dir, "missing.wasm")) {
+		t.Fatal("expected missing file not to be a wasm binary")
+	}
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasmmodule
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// WasmLayerMediaType is the media type of wasm modules published as
+	// OCI artifacts.
+	WasmLayerMediaType = "application/vnd.wasm.content.layer.v1+wasm"
+
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociScheme            = "oci://"
+
+	defaultRegistry    = "docker.io"
+	defaultRegistryAPI = "registry-1.docker.io"
+
+	// maxManifestSize bounds the manifests read from registries.
+	maxManifestSize = 4 << 20
+)
+
+var (
+	digestRegexp = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	tagRegexp    = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	repoRegexp   = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?:/[a-z0-9]+(?:[._-][a-z0-9]+)*)*$`)
+	bearerRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+type (
+	// OCIReference is a reference to an OCI artifact, like
+	// "ghcr.io/org/hello:v1" or "ghcr.io/org/hello@sha256:...".
+	OCIReference struct {
+		Registry   string
+		Repository string
+		Tag        string
+		Digest     string
+	}
+
+	// OCIResolver resolves OCI references to the digest of their manifest,
+	// checking the manifest is the one of a wasm module. Registries are
+	// accessed anonymously.
+	OCIResolver struct {
+		client *http.Client
+		// plainHTTP reports whether the registry is accessed over HTTP
+		// instead of HTTPS.
+		plainHTTP func(registry string) bool
+	}
+
+	ociManifest struct {
+		Layers []ociDescriptor `json:"layers"`
+	}
+
+	ociDescriptor struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	}
+)
+
+// IsOCIReference reports whether ref is explicitly marked as an OCI
+// reference with the oci:// scheme.
+func IsOCIReference(ref string) bool {
+	return strings.HasPrefix(ref, ociScheme)
+}
+
+// ParseOCIReference parses a reference to an OCI artifact. The oci:// scheme
+// is optional, the registry defaults to docker.io and the tag to latest.
+func ParseOCIReference(ref string) (*OCIReference, error) {
+	s := strings.TrimPrefix(ref, ociScheme)
+	if len(s) == 0 {
+		return nil, errors.New("empty OCI reference")
+	}
+
+	r := &OCIReference{}
+	if i := strings.Index(s, "@"); i >= 0 {
+		r.Digest = s[i+1:]
+		s = s[:i]
+		if !digestRegexp.MatchString(r.Digest) {
+			return nil, errors.Errorf("invalid digest '%v' in OCI reference %v", r.Digest, ref)
+		}
+	}
+	if i := strings.LastIndex(s, ":"); i >= 0 && !strings.Contains(s[i:], "/") {
+		r.Tag = s[i+1:]
+		s = s[:i]
+		if !tagRegexp.MatchString(r.Tag) {
+			return nil, errors.Errorf("invalid tag '%v' in OCI reference %v", r.Tag, ref)
+		}
+	}
+
+	r.Registry = defaultRegistry
+	if i := strings.Index(s, "/"); i >= 0 {
+		host := s[:i]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			r.Registry = host
+			s = s[i+1:]
+		}
+	}
+	if r.Registry == defaultRegistry && !strings.Contains(s, "/") {
+		s = "library/" + s
+	}
+	r.Repository = s
+	if !repoRegexp.MatchString(r.Repository) {
+		return nil, errors.Errorf("invalid repository '%v' in OCI reference %v", r.Repository, ref)
+	}
+
+	if len(r.Tag) == 0 && len(r.Digest) == 0 {
+		r.Tag = "latest"
+	}
+	return r, nil
+}
+
+// String returns the reference in its canonical form.
+func (r OCIReference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if len(r.Tag) > 0 {
+		s += ":" + r.Tag
+	}
+	if len(r.Digest) > 0 {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// Pinned returns the reference to the artifact with the given digest.
+func (r OCIReference) Pinned(digest string) string {
+	return r.Registry + "/" + r.Repository + "@" + digest
+}
+
+// NewOCIResolver returns a resolver accessing registries on localhost over
+// plain HTTP and all other registries over HTTPS.
+func NewOCIResolver() *OCIResolver {
+	return &OCIResolver{
+		client: &http.Client{Timeout: 30 * time.Second},
+		plainHTTP: func(registry string) bool {
+			host := registry
+			if i := strings.LastIndex(host, ":"); i >= 0 {
+				host = host[:i]
+			}
+			return host == "localhost" || host == "127.0.0.1"
+		},
+	}
+}
+
+// Resolve returns the digest of the manifest the reference points to. It
+// fails if the manifest has no wasm module layer, or if its content does not
+// match the digest of a pinned reference.
+func (resolver *OCIResolver) Resolve(ctx context.Context, ref *OCIReference) (string, error) {
+	version := ref.Digest
+	if len(version) == 0 {
+		version = ref.Tag
+	}
+
+	registry := ref.Registry
+	if registry == defaultRegistry {
+		registry = defaultRegistryAPI
+	}
+	scheme := "https"
+	if resolver.plainHTTP(registry) {
+		scheme = "http"
+	}
+	manifestURL := fmt.Sprintf("%v://%v/v2/%v/manifests/%v", scheme, registry, ref.Repository, version)
+
+	resp, err := resolver.getManifest(ctx, manifestURL, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		token, err := resolver.getToken(ctx, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", errors.Wrapf(err, "error authenticating to registry %v", ref.Registry)
+		}
+		resp, err = resolver.getManifest(ctx, manifestURL, token)
+		if err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("error getting manifest of %v: registry returned %v", ref, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading manifest of %v", ref)
+	}
+	if len(body) > maxManifestSize {
+		return "", errors.Errorf("manifest of %v is larger than %v bytes", ref, maxManifestSize)
+	}
+	sum := sha256.Sum256(body)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if len(ref.Digest) > 0 && digest != ref.Digest {
+		return "", errors.Errorf("manifest of %v has digest %v", ref, digest)
+	}
+
+	manifest := ociManifest{}
+	err = json.Unmarshal(body, &manifest)
+	if err != nil {
+		return "", errors.Wrapf(err, "error decoding manifest of %v", ref)
+	}
+	for _, layer := range manifest.Layers {
+		if layer.MediaType == WasmLayerMediaType {
+			return digest, nil
+		}
+	}
+	return "", errors.Errorf("%v is not a wasm module, its manifest has no %v layer", ref, WasmLayerMediaType)
+}
+
+func (resolver *OCIResolver) getManifest(ctx context.Context, manifestURL string, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ociManifestMediaType)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := resolver.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting manifest %v", manifestURL)
+	}
+	return resp, nil
+}
+
+// getToken gets an anonymous pull token from the authorization server named
+// in the bearer challenge of a registry.
+func (resolver *OCIResolver) getToken(ctx context.Context, challenge string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", errors.Errorf("unsupported authentication challenge '%v'", challenge)
+	}
+	params := make(map[string]string)
+	for _, m := range bearerRegexp.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || len(realm.Host) == 0 {
+		return "", errors.Errorf("invalid realm in authentication challenge '%v'", challenge)
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if len(params[key]) > 0 {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := resolver.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("authorization server returned %v", resp.Status)
+	}
+
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding token")
+	}
+	if len(token.Token) > 0 {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasmmodule
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	for _, test := range []struct {
+		ref      string
+		expected OCIReference
+	}{
+		{
+			ref:      "ghcr.io/org/hello:v1",
+			expected: OCIReference{Registry: "ghcr.io", Repository: "org/hello", Tag: "v1"},
+		},
+		{
+			ref:      "oci://localhost:5000/hello",
+			expected: OCIReference{Registry: "localhost:5000", Repository: "hello", Tag: "latest"},
+		},
+		{
+			ref:      "hello@" + digest,
+			expected: OCIReference{Registry: "docker.io", Repository: "library/hello", Digest: digest},
+		},
+		{
+			ref:      "org/hello:v1@" + digest,
+			expected: OCIReference{Registry: "docker.io", Repository: "org/hello", Tag: "v1", Digest: digest},
+		},
+	} {
+		t.Run(test.ref, func(t *testing.T) {
+			ref, err := ParseOCIReference(test.ref)
+			if err != nil {
+				t.Fatalf("error parsing reference: %v", err)
+			}
+			if *ref != test.expected {
+				t.Fatalf("expected %+v, got %+v", test.expected, *ref)
+			}
+		})
+	}
+
+	for _, ref := range []string{"", "Hello:v1", "hello@sha256:abc", "hello:-v1"} {
+		if _, err := ParseOCIReference(ref); err == nil {
+			t.Fatalf("expected %q to be rejected", ref)
+		}
+	}
+}
+
+func TestOCIResolverResolve(t *testing.T) {
+	wasmManifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%v","config":{"mediaType":"application/vnd.wasm.config.v1+json"},"layers":[{"mediaType":"%v","digest":"sha256:%v"}]}`,
+		ociManifestMediaType, WasmLayerMediaType, strings.Repeat("b", 64))
+	imageManifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"%v","layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip"}]}`,
+		ociManifestMediaType)
+	sum := sha256.Sum256([]byte(wasmManifest))
+	wasmDigest := "sha256:" + hex.EncodeToString(sum[:])
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			if r.URL.Query().Get("scope") != "repository:org/hello:pull" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token":"secret"}`)
+		case "/v2/org/hello/manifests/v1", "/v2/org/hello/manifests/" + wasmDigest:
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.Header().Set("WWW-Authenticate",
+					fmt.Sprintf(`Bearer realm="%v/token",service="registry",scope="repository:org/hello:pull"`, server.URL))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, wasmManifest)
+		case "/v2/org/image/manifests/v1":
+			fmt.Fprint(w, imageManifest)
+		case "/v2/org/large/manifests/v1":
+			// still valid JSON once truncated, hitting the limit must fail
+			fmt.Fprint(w, wasmManifest+strings.Repeat(" ", maxManifestSize))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	registry := strings.TrimPrefix(server.URL, "http://")
+	resolver := NewOCIResolver()
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		ref     string
+		digest  string
+		wantErr bool
+	}{
+		{ref: registry + "/org/hello:v1", digest: wasmDigest},
+		{ref: registry + "/org/hello@" + wasmDigest, digest: wasmDigest},
+		{ref: registry + "/org/hello@sha256:" + strings.Repeat("c", 64), wantErr: true},
+		{ref: registry + "/org/image:v1", wantErr: true},
+		{ref: registry + "/org/large:v1", wantErr: true},
+		{ref: registry + "/org/missing:v1", wantErr: true},
+	} {
+		t.Run(test.ref, func(t *testing.T) {
+			ref, err := ParseOCIReference(test.ref)
+			if err != nil {
+				t.Fatalf("error parsing reference: %v", err)
+			}
+			digest, err := resolver.Resolve(ctx, ref)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error resolving reference: %v", err)
+			}
+			if digest != test.digest {
+				t.Fatalf("expected digest %v, got %v", test.digest, digest)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasmmodule
+
+import (
+	"github.com/pkg/errors"
+)
+
+// UsageHeader is the response header wasm runtimes return the JSON encoded
+// usage of an invocation in. The router observes it and removes it from the
+// response.
+const UsageHeader = "X-Fission-Wasm-Usage"
+
+// Usage is the resources a single invocation of a wasm function used.
+type Usage struct {
+	Namespace string `json:"namespace"`
+	Function  string `json:"function"`
+	// WallTimeSeconds is the time the invocation took, instantiation
+	// included
+	WallTimeSeconds float64 `json:"wallTimeSeconds"`
+	// InstantiationSeconds is the time instantiating the module took
+	InstantiationSeconds float64 `json:"instantiationSeconds"`
+	// PeakMemoryBytes is the peak size of the linear memory
+	PeakMemoryBytes int64 `json:"peakMemoryBytes"`
+	// Fuel is the fuel or instructions the invocation consumed, nil if
+	// the engine does not count them
+	Fuel *int64 `json:"fuel,omitempty"`
+}
+
+// Validate checks a usage report is for a function and has no negative
+// measurements.
+func (u Usage) Validate() error {
+	if len(u.Namespace) == 0 || len(u.Function) == 0 {
+		return errors.New("usage report is missing the function")
+	}
+	if u.WallTimeSeconds < 0 || u.InstantiationSeconds < 0 || u.PeakMemoryBytes < 0 || (u.Fuel != nil && *u.Fuel < 0) {
+		return errors.New("usage report has negative measurements")
+	}
+	return nil
+}
+
+// UsageSummary aggregates the usage of the invocations of a function.
+type UsageSummary struct {
+	Invocations               int64   `json:"invocations"`
+	TotalWallTimeSeconds      float64 `json:"totalWallTimeSeconds"`
+	MaxWallTimeSeconds        float64 `json:"maxWallTimeSeconds"`
+	TotalInstantiationSeconds float64 `json:"totalInstantiationSeconds"`
+	MaxPeakMemoryBytes        int64   `json:"maxPeakMemoryBytes"`
+	// TotalFuel is nil until an invocation reports fuel
+	TotalFuel *int64 `json:"totalFuel,omitempty"`
+}
+
+// Add adds the usage of an invocation to the summary.
+func (s *UsageSummary) Add(u Usage) {
+	s.Invocations++
+	s.TotalWallTimeSeconds += u.WallTimeSeconds
+	if u.WallTimeSeconds > s.MaxWallTimeSeconds {
+		s.MaxWallTimeSeconds = u.WallTimeSeconds
+	}
+	s.TotalInstantiationSeconds += u.InstantiationSeconds
+	if u.PeakMemoryBytes > s.MaxPeakMemoryBytes {
+		s.MaxPeakMemoryBytes = u.PeakMemoryBytes
+	}
+	if u.Fuel != nil {
+		fuel := *u.Fuel
+		if s.TotalFuel != nil {
+			fuel += *s.TotalFuel
+		}
+		s.TotalFuel = &fuel
+	}
+}
+
+// AvgWallTimeSeconds returns the mean wall time of the invocations.
+func (s *UsageSummary) AvgWallTimeSeconds() float64 {
+	if s.Invocations == 0 {
+		return 0
+	}
+	return s.TotalWallTimeSeconds / float64(s.Invocations)
+}
+
+// AvgInstantiationSeconds returns the mean instantiation time of the
+// invocations.
+func (s *UsageSummary) AvgInstantiationSeconds() float64 {
+	if s.Invocations == 0 {
+		return 0
+	}
+	return s.TotalInstantiationSeconds / float64(s.Invocations)
+}
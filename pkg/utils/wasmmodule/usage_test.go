@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasmmodule
+
+import (
+	"testing"
+)
+
+func TestUsageSummary(t *testing.T) {
+	fuel := int64(100)
+	var s UsageSummary
+	s.Add(Usage{Namespace: "default", Function: "hello", WallTimeSeconds: 0.3, InstantiationSeconds: 0.1, PeakMemoryBytes: 65536})
+	if s.TotalFuel != nil {
+		t.Fatalf("expected no fuel, got %v", *s.TotalFuel)
+	}
+	s.Add(Usage{Namespace: "default", Function: "hello", WallTimeSeconds: 0.1, InstantiationSeconds: 0.1, PeakMemoryBytes: 131072, Fuel: &fuel})
+	s.Add(Usage{Namespace: "default", Function: "hello", WallTimeSeconds: 0.2, PeakMemoryBytes: 65536, Fuel: &fuel})
+
+	if s.Invocations != 3 || s.MaxWallTimeSeconds != 0.3 || s.MaxPeakMemoryBytes != 131072 {
+		t.Fatalf("unexpected summary %+v", s)
+	}
+	if avg := s.AvgWallTimeSeconds(); avg < 0.19 || avg > 0.21 {
+		t.Fatalf("expected an average wall time of 0.2s, got %v", avg)
+	}
+	if s.TotalFuel == nil || *s.TotalFuel != 200 {
+		t.Fatalf("expected a total fuel of 200, got %v", s.TotalFuel)
+	}
+}
+
+func TestUsageValidate(t *testing.T) {
+	if err := (Usage{Namespace: "default", Function: "hello", WallTimeSeconds: 0.1}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := (Usage{Namespace: "default", WallTimeSeconds: 0.1}).Validate(); err == nil {
+		t.Fatal("expected an error for a report without function")
+	}
+	if err := (Usage{Namespace: "default", Function: "hello", PeakMemoryBytes: -1}).Validate(); err == nil {
+		t.Fatal("expected an error for negative measurements")
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasmmodule
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// targetTriples are the targets engines precompile modules for by node
+// architecture.
+var targetTriples = map[string]string{
+	"amd64": "x86_64-unknown-linux-gnu",
+	"arm64": "aarch64-unknown-linux-gnu",
+}
+
+// precompiledExtensions are the file extensions of precompiled modules by
+// engine.
+var precompiledExtensions = map[string]string{
+	"wasmtime": ".cwasm",
+	"wasmedge": ".so",
+	"wasmer":   ".wasmu",
+}
+
+// Variant is a module precompiled ahead of time for a wasm engine and node
+// architecture.
+type Variant struct {
+	Engine       string `json:"engine"`
+	Architecture string `json:"architecture"`
+	URL          string `json:"url"`
+	SHA256       string `json:"sha256,omitempty"`
+}
+
+// TargetTriple returns the target engines precompile for on nodes of arch.
+func TargetTriple(arch string) (string, error) {
+	triple, ok := targetTriples[arch]
+	if !ok {
+		return "", errors.Errorf("unsupported node architecture %q", arch)
+	}
+	return triple, nil
+}
+
+// PrecompiledExtension returns the file extension of modules precompiled
+// for engine.
+func PrecompiledExtension(engine string) string {
+	ext, ok := precompiledExtensions[engine]
+	if !ok {
+		return ".bin"
+	}
+	return ext
+}
+
+// EncodeVariants encodes variants for the pod annotation the runtime reads
+// them from.
+func EncodeVariants(variants []Variant) (string, error) {
+	b, err := json.Marshal(variants)
+	if err != nil {
+		return "", errors.Wrap(err, "error encoding module variants")
+	}
+	return string(b), nil
+}
+
+// DecodeVariants decodes variants encoded by EncodeVariants.
+func DecodeVariants(s string) ([]Variant, error) {
+	var variants []Variant
+	if len(s) == 0 {
+		return variants, nil
+	}
+	err := json.Unmarshal([]byte(s), &variants)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding module variants")
+	}
+	return variants, nil
+}
+
+// SelectVariant returns the variant precompiled for engine on nodes of
+// arch, or nil if there is none and the portable module has to be used.
+func SelectVariant(variants []Variant, engine string, arch string) *Variant {
+	for i := range variants {
+		if variants[i].Engine == engine && variants[i].Architecture == arch {
+			return &variants[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The Fission Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wasmmodule
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariants(t *testing.T) {
+	variants := []Variant{
+		{Engine: "wasmtime", Architecture: "amd64", URL: "http://storagesvc/v1/archive?id=a", SHA256: "aa"},
+		{Engine: "wasmtime", Architecture: "arm64", URL: "http://storagesvc/v1/archive?id=b", SHA256: "bb"},
+	}
+
+	s, err := EncodeVariants(variants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeVariants(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, variants) {
+		t.Fatalf("expected %v, got %v", variants, decoded)
+	}
+
+	if v := SelectVariant(decoded, "wasmtime", "arm64"); v == nil || v.SHA256 != "bb" {
+		t.Fatalf("expected the arm64 variant, got %v", v)
+	}
+	if v := SelectVariant(decoded, "wasmedge", "amd64"); v != nil {
+		t.Fatalf("expected no variant for another engine, got %v", v)
+	}
+
+	if decoded, err := DecodeVariants(""); err != nil || len(decoded) != 0 {
+		t.Fatalf("expected no variants, got %v, %v", decoded, err)
+	}
+	if _, err := DecodeVariants("{"); err == nil {
+		t.Fatal("expected an error decoding invalid variants")
+	}
+}
+
+func TestTargetTriple(t *testing.T) {
+	if triple, err := TargetTriple("arm64"); err != nil || triple != "aarch64-unknown-linux-gnu" {
+		t.Fatalf("unexpected triple %v, %v", triple, err)
+	}
+	if _, err := TargetTriple("s390x"); err == nil {
+		t.Fatal("expected an error for an unsupported architecture")
+	}
+}